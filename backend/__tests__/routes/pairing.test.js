@@ -0,0 +1,238 @@
+/**
+ * HomePiNAS - Pairing Routes Tests
+ */
+
+const express = require('express');
+const request = require('supertest');
+
+jest.mock('../../middleware/auth', () => ({
+    requireAuth: (req, res, next) => {
+        req.user = { username: 'testadmin', role: 'admin' };
+        next();
+    }
+}));
+
+jest.mock('../../middleware/rbac', () => ({
+    requireAdmin: (req, res, next) => next()
+}));
+
+jest.mock('express-rate-limit', () => () => (req, res, next) => next());
+
+jest.mock('../../utils/security', () => ({
+    logSecurityEvent: jest.fn()
+}));
+
+jest.mock('../../utils/session', () => ({
+    createSession: jest.fn(() => 'sso-session-id')
+}));
+
+jest.mock('../../middleware/csrf', () => ({
+    getCsrfToken: jest.fn(() => 'sso-csrf-token')
+}));
+
+// In-memory data.json
+let mockStore = {};
+jest.mock('../../utils/data', () => ({
+    getData: jest.fn(() => JSON.parse(JSON.stringify(mockStore))),
+    saveData: jest.fn((data) => { mockStore = JSON.parse(JSON.stringify(data)); })
+}));
+
+const pairingRouter = require('../../routes/pairing');
+const { pairedTokenOr } = require('../../middleware/pairing');
+
+const app = express();
+app.use(express.json());
+app.use('/api/pairing', pairingRouter);
+app.post('/api/system/reboot', pairedTokenOr('power', (req, res) => res.status(401).json({ error: 'Authentication required' })), (req, res) => {
+    res.json({ user: req.user.username });
+});
+
+beforeAll(() => {
+    jest.spyOn(console, 'error').mockImplementation(() => {});
+});
+
+afterAll(() => {
+    console.error.mockRestore();
+});
+
+beforeEach(() => {
+    mockStore = { user: { username: 'testadmin' } };
+});
+
+async function requestPairing(body = { clientName: 'HomePiNAS Finder (laptop)' }) {
+    return request(app).post('/api/pairing/request').send(body);
+}
+
+async function pairClient() {
+    const { body: pairing } = await requestPairing();
+    await request(app).post(`/api/pairing/${pairing.requestId}/approve`).send({ code: pairing.code });
+    const res = await request(app)
+        .get(`/api/pairing/status/${pairing.requestId}`)
+        .set('X-Pairing-Secret', pairing.pollSecret);
+    return res.body;
+}
+
+describe('POST /api/pairing/request', () => {
+    test('returns a 6-digit code and a poll secret', async () => {
+        const res = await requestPairing();
+        expect(res.status).toBe(200);
+        expect(res.body.code).toMatch(/^\d{6}$/);
+        expect(res.body.pollSecret).toHaveLength(64);
+        expect(res.body.expiresIn).toBe(300);
+    });
+
+    test('rejects a missing client name', async () => {
+        const res = await requestPairing({});
+        expect(res.status).toBe(400);
+    });
+
+    test('rejects unknown scopes', async () => {
+        const res = await requestPairing({ clientName: 'Finder', scopes: ['files'] });
+        expect(res.status).toBe(400);
+    });
+});
+
+describe('Pairing approval', () => {
+    test('lists the pending request for the dashboard', async () => {
+        const { body: pairing } = await requestPairing();
+        const res = await request(app).get('/api/pairing/pending');
+        expect(res.status).toBe(200);
+        const entry = res.body.requests.find(r => r.id === pairing.requestId);
+        expect(entry.code).toBe(pairing.code);
+        expect(entry).not.toHaveProperty('secretHash');
+    });
+
+    test('stays pending until approved', async () => {
+        const { body: pairing } = await requestPairing();
+        const res = await request(app)
+            .get(`/api/pairing/status/${pairing.requestId}`)
+            .set('X-Pairing-Secret', pairing.pollSecret);
+        expect(res.body.status).toBe('pending');
+    });
+
+    test('refuses to approve with the wrong code', async () => {
+        const { body: pairing } = await requestPairing();
+        const wrong = pairing.code === '000000' ? '111111' : '000000';
+        const res = await request(app).post(`/api/pairing/${pairing.requestId}/approve`).send({ code: wrong });
+        expect(res.status).toBe(400);
+        expect(mockStore.pairedClients).toBeUndefined();
+    });
+
+    test('hands the token out once and stores only its hash', async () => {
+        const { body: pairing } = await requestPairing();
+        await request(app).post(`/api/pairing/${pairing.requestId}/approve`).send({ code: pairing.code });
+
+        const first = await request(app)
+            .get(`/api/pairing/status/${pairing.requestId}`)
+            .set('X-Pairing-Secret', pairing.pollSecret);
+        expect(first.body.status).toBe('approved');
+        expect(first.body.scopes).toEqual(['power', 'update']);
+        expect(JSON.stringify(mockStore)).not.toContain(first.body.token);
+
+        const second = await request(app)
+            .get(`/api/pairing/status/${pairing.requestId}`)
+            .set('X-Pairing-Secret', pairing.pollSecret);
+        expect(second.status).toBe(404);
+    });
+
+    test('requires the poll secret', async () => {
+        const { body: pairing } = await requestPairing();
+        const res = await request(app)
+            .get(`/api/pairing/status/${pairing.requestId}`)
+            .set('X-Pairing-Secret', 'not-the-secret');
+        expect(res.status).toBe(404);
+    });
+
+    test('reports a denied request', async () => {
+        const { body: pairing } = await requestPairing();
+        await request(app).post(`/api/pairing/${pairing.requestId}/deny`);
+        const res = await request(app)
+            .get(`/api/pairing/status/${pairing.requestId}`)
+            .set('X-Pairing-Secret', pairing.pollSecret);
+        expect(res.body.status).toBe('denied');
+    });
+});
+
+describe('Paired tokens', () => {
+    test('authorize actions in their scope', async () => {
+        const { token } = await pairClient();
+        const res = await request(app).post('/api/system/reboot').set('Authorization', `Bearer ${token}`);
+        expect(res.status).toBe(200);
+        expect(res.body.user).toBe('paired:HomePiNAS Finder (laptop)');
+    });
+
+    test('are refused outside their scope', async () => {
+        const { body: pairing } = await requestPairing({ clientName: 'Finder', scopes: ['update'] });
+        await request(app).post(`/api/pairing/${pairing.requestId}/approve`).send({ code: pairing.code });
+        const { body } = await request(app)
+            .get(`/api/pairing/status/${pairing.requestId}`)
+            .set('X-Pairing-Secret', pairing.pollSecret);
+
+        const res = await request(app).post('/api/system/reboot').set('Authorization', `Bearer ${body.token}`);
+        expect(res.status).toBe(403);
+    });
+
+    test('fall back to the session middlewares without a bearer token', async () => {
+        const res = await request(app).post('/api/system/reboot');
+        expect(res.status).toBe(401);
+    });
+
+    test('stop working once revoked', async () => {
+        const { token, clientId } = await pairClient();
+        const list = await request(app).get('/api/pairing/clients');
+        expect(list.body.clients).toEqual([expect.objectContaining({ id: clientId, scopes: ['power', 'update', 'login'] })]);
+        expect(list.body.clients[0]).not.toHaveProperty('tokenHash');
+
+        await request(app).delete(`/api/pairing/clients/${clientId}`);
+        const res = await request(app).post('/api/system/reboot').set('Authorization', `Bearer ${token}`);
+        expect(res.status).toBe(401);
+    });
+});
+
+describe('SSO login', () => {
+    async function loginTicket(token) {
+        return request(app).post('/api/pairing/login-ticket').set('Authorization', `Bearer ${token}`);
+    }
+
+    test('a login ticket opens a session for the approving admin once', async () => {
+        const { token } = await pairClient();
+        const { body } = await loginTicket(token);
+        expect(body.ticket).toHaveLength(64);
+        expect(body.expiresIn).toBe(60);
+
+        const res = await request(app).post('/api/pairing/sso').send({ ticket: body.ticket });
+        expect(res.status).toBe(200);
+        expect(res.body).toEqual({
+            success: true,
+            sessionId: 'sso-session-id',
+            csrfToken: 'sso-csrf-token',
+            user: { username: 'testadmin' }
+        });
+
+        const again = await request(app).post('/api/pairing/sso').send({ ticket: body.ticket });
+        expect(again.status).toBe(401);
+    });
+
+    test('login tickets require a token with the login scope', async () => {
+        const { body: pairing } = await requestPairing({ clientName: 'Finder', scopes: ['power'] });
+        await request(app).post(`/api/pairing/${pairing.requestId}/approve`).send({ code: pairing.code });
+        const { body } = await request(app)
+            .get(`/api/pairing/status/${pairing.requestId}`)
+            .set('X-Pairing-Secret', pairing.pollSecret);
+
+        expect((await loginTicket(body.token)).status).toBe(403);
+        expect((await request(app).post('/api/pairing/login-ticket')).status).toBe(401);
+    });
+
+    test('no ticket is issued once the approving admin is gone', async () => {
+        const { token } = await pairClient();
+        mockStore.user = { username: 'someoneelse' };
+        expect((await loginTicket(token)).status).toBe(403);
+    });
+
+    test('rejects unknown tickets', async () => {
+        const res = await request(app).post('/api/pairing/sso').send({ ticket: 'nope' });
+        expect(res.status).toBe(401);
+        expect(res.body.success).toBe(false);
+    });
+});
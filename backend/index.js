@@ -41,6 +41,7 @@ const authRoutes = require('./routes/auth');
 const networkRoutes = require('./routes/network');
 const powerRoutes = require('./routes/power');
 const updateRoutes = require('./routes/update');
+const pairingRoutes = require('./routes/pairing');
 const terminalRoutes = require('./routes/terminal');
 const shortcutsRoutes = require('./routes/shortcuts');
 const filesRoutes = require('./routes/files');
@@ -287,6 +288,9 @@ app.use('/api/system', powerRoutes);
 // Update routes (check, apply)
 app.use('/api/update', updateRoutes);
 
+// Pairing routes (HomePiNAS Finder tokens)
+app.use('/api/pairing', pairingRoutes);
+
 // Terminal routes (PTY sessions)
 app.use('/api/terminal', terminalRoutes);
 
@@ -0,0 +1,53 @@
+/**
+ * HomePiNAS - Paired Client Token Middleware
+ *
+ * Lets a paired client (HomePiNAS Finder) call a management endpoint with
+ * `Authorization: Bearer <token>` instead of a dashboard session.
+ * Bearer requests carry no session id, so CSRF protection does not apply to them;
+ * browsers never attach this header on their own.
+ */
+
+const { findPairedClient, touchPairedClient } = require('../utils/pairing');
+const { logSecurityEvent } = require('../utils/security');
+
+/**
+ * Middleware factory: accept a paired token with `scope`, otherwise run `fallback`
+ * (without fallback the token is mandatory)
+ * Usage: router.post('/reboot', pairedTokenOr('power', requireAuth, requireAdmin), handler)
+ */
+function pairedTokenOr(scope, ...fallback) {
+    return (req, res, next) => {
+        const header = req.headers.authorization || '';
+        if (!header.startsWith('Bearer ') && fallback.length === 0) {
+            return res.status(401).json({ error: 'Pairing token required' });
+        }
+        if (!header.startsWith('Bearer ')) {
+            // Run the regular session middlewares in order
+            const run = (i) => (err) => {
+                if (err) return next(err);
+                if (i >= fallback.length) return next();
+                fallback[i](req, res, run(i + 1));
+            };
+            return run(0)();
+        }
+
+        const client = findPairedClient(header.slice('Bearer '.length).trim());
+        if (!client) {
+            logSecurityEvent('PAIRED_TOKEN_INVALID', { path: req.path }, req.ip);
+            return res.status(401).json({ error: 'Invalid pairing token' });
+        }
+        if (!(client.scopes || []).includes(scope)) {
+            logSecurityEvent('PAIRED_TOKEN_SCOPE_DENIED', { client: client.name, scope }, req.ip);
+            return res.status(403).json({ error: `Token not allowed for: ${scope}` });
+        }
+
+        touchPairedClient(client.id);
+        req.user = { username: `paired:${client.name}`, role: 'admin', pairedClient: client.id };
+        req.pairedClient = client;
+        next();
+    };
+}
+
+module.exports = {
+    pairedTokenOr
+};
@@ -0,0 +1,288 @@
+/**
+ * HomePiNAS - Pairing Routes
+ *
+ * Pairing flow for HomePiNAS Finder:
+ * 1. The finder asks for a pairing code (public, rate limited)
+ * 2. An admin checks the code shown by the finder against the one on the
+ *    dashboard and approves it
+ * 3. The finder polls with its secret and receives a scoped API token, once
+ *
+ * With the 'login' scope the finder can also open the dashboard already signed in:
+ * it trades its token for a one-time ticket that the browser exchanges for a session
+ */
+
+const express = require('express');
+const router = express.Router();
+const crypto = require('crypto');
+const rateLimit = require('express-rate-limit');
+
+const { requireAuth } = require('../middleware/auth');
+const { requireAdmin } = require('../middleware/rbac');
+const { pairedTokenOr } = require('../middleware/pairing');
+const { logSecurityEvent } = require('../utils/security');
+const { createSession } = require('../utils/session');
+const { getCsrfToken } = require('../middleware/csrf');
+const { getData } = require('../utils/data');
+const {
+    PAIRING_SCOPES,
+    createPairedClient,
+    listPairedClients,
+    revokePairedClient
+} = require('../utils/pairing');
+
+const REQUEST_TTL = 5 * 60 * 1000; // 5 minutes to approve a request
+const MAX_PENDING = 10;
+const MAX_CLIENT_NAME = 64;
+const TICKET_TTL = 60 * 1000; // SSO tickets must be used within a minute
+
+// Pending requests live in memory: a restart simply cancels them
+// id -> { id, code, secretHash, clientName, ip, scopes, status, createdAt, expiresAt, token? }
+const pending = new Map();
+
+// One-time SSO tickets, by SHA-256 of the ticket
+// hash -> { username, clientName, expiresAt }
+const tickets = new Map();
+
+// Requesting a code is public: limit it per IP
+const pairingLimiter = rateLimit({
+    windowMs: 15 * 60 * 1000, // 15 minutes
+    max: 10,
+    message: { error: 'Too many pairing requests, please try again later' }
+});
+
+function hashSecret(secret) {
+    return crypto.createHash('sha256').update(String(secret)).digest();
+}
+
+function purgeExpired() {
+    const now = Date.now();
+    for (const [id, entry] of pending) {
+        if (entry.expiresAt <= now) pending.delete(id);
+    }
+    for (const [hash, ticket] of tickets) {
+        if (ticket.expiresAt <= now) tickets.delete(hash);
+    }
+}
+
+/**
+ * Is `username` still a user of this NAS? (primary admin or multi-user)
+ */
+function userExists(username) {
+    const data = getData();
+    if (data.user && data.user.username === username) return true;
+    return (data.users || []).some(u => u.username === username);
+}
+
+function publicEntry(entry) {
+    return {
+        id: entry.id,
+        code: entry.code,
+        clientName: entry.clientName,
+        ip: entry.ip,
+        scopes: entry.scopes,
+        createdAt: new Date(entry.createdAt).toISOString(),
+        expiresAt: new Date(entry.expiresAt).toISOString()
+    };
+}
+
+function findPending(id) {
+    purgeExpired();
+    const entry = pending.get(id);
+    return entry && entry.status === 'pending' ? entry : null;
+}
+
+/**
+ * POST /request - Finder asks for a pairing code
+ * Body: { clientName, scopes? } (scopes default to all of PAIRING_SCOPES)
+ */
+router.post('/request', pairingLimiter, (req, res) => {
+    const { clientName, scopes } = req.body || {};
+
+    if (!clientName || typeof clientName !== 'string' || clientName.trim().length > MAX_CLIENT_NAME) {
+        return res.status(400).json({ error: `clientName is required (max ${MAX_CLIENT_NAME} characters)` });
+    }
+    const requested = scopes === undefined ? PAIRING_SCOPES : scopes;
+    if (!Array.isArray(requested) || requested.length === 0 || requested.some(s => !PAIRING_SCOPES.includes(s))) {
+        return res.status(400).json({ error: `scopes must be a list of: ${PAIRING_SCOPES.join(', ')}` });
+    }
+
+    purgeExpired();
+    if (pending.size >= MAX_PENDING) {
+        return res.status(429).json({ error: 'Too many pending pairing requests' });
+    }
+
+    const id = crypto.randomUUID();
+    const pollSecret = crypto.randomBytes(32).toString('hex');
+    const now = Date.now();
+    const entry = {
+        id,
+        code: String(crypto.randomInt(0, 1000000)).padStart(6, '0'),
+        secretHash: hashSecret(pollSecret),
+        clientName: clientName.trim(),
+        ip: req.ip,
+        scopes: [...new Set(requested)],
+        status: 'pending',
+        createdAt: now,
+        expiresAt: now + REQUEST_TTL
+    };
+    pending.set(id, entry);
+
+    logSecurityEvent('PAIRING_REQUESTED', { client: entry.clientName, scopes: entry.scopes }, req.ip);
+    res.json({ requestId: id, code: entry.code, pollSecret, expiresIn: REQUEST_TTL / 1000 });
+});
+
+/**
+ * GET /status/:id - Finder polls its request (X-Pairing-Secret header)
+ * The token is returned only once, then the request is forgotten
+ */
+router.get('/status/:id', (req, res) => {
+    purgeExpired();
+    const entry = pending.get(req.params.id);
+    const secret = req.headers['x-pairing-secret'];
+
+    if (!entry || !secret || !crypto.timingSafeEqual(hashSecret(secret), entry.secretHash)) {
+        return res.status(404).json({ error: 'Pairing request not found or expired' });
+    }
+
+    if (entry.status === 'pending') {
+        return res.json({ status: 'pending', expiresIn: Math.ceil((entry.expiresAt - Date.now()) / 1000) });
+    }
+
+    pending.delete(entry.id);
+    if (entry.status === 'denied') {
+        return res.json({ status: 'denied' });
+    }
+    res.json({ status: 'approved', clientId: entry.clientId, token: entry.token, scopes: entry.scopes });
+});
+
+/**
+ * POST /login-ticket - Paired finder asks for a one-time SSO ticket
+ * The finder opens the dashboard with it in the URL fragment (#sso=...)
+ */
+router.post('/login-ticket', pairedTokenOr('login'), (req, res) => {
+    const client = req.pairedClient;
+    if (!client.pairedBy || !userExists(client.pairedBy)) {
+        return res.status(403).json({ error: 'The user who approved this pairing no longer exists' });
+    }
+
+    purgeExpired();
+    const ticket = crypto.randomBytes(32).toString('hex');
+    tickets.set(hashSecret(ticket).toString('hex'), {
+        username: client.pairedBy,
+        clientName: client.name,
+        expiresAt: Date.now() + TICKET_TTL
+    });
+
+    res.json({ ticket, expiresIn: TICKET_TTL / 1000 });
+});
+
+/**
+ * POST /sso - Browser trades an SSO ticket for a session (public, single use)
+ */
+router.post('/sso', pairingLimiter, (req, res) => {
+    purgeExpired();
+    const { ticket } = req.body || {};
+    const hash = typeof ticket === 'string' ? hashSecret(ticket).toString('hex') : null;
+    const entry = hash && tickets.get(hash);
+
+    if (!entry) {
+        logSecurityEvent('SSO_TICKET_INVALID', {}, req.ip);
+        return res.status(401).json({ success: false, message: 'Invalid or expired login link' });
+    }
+    tickets.delete(hash);
+
+    if (!userExists(entry.username)) {
+        return res.status(401).json({ success: false, message: 'Invalid or expired login link' });
+    }
+
+    const sessionId = createSession(entry.username);
+    const csrfToken = getCsrfToken(sessionId);
+    logSecurityEvent('SSO_LOGIN', { username: entry.username, client: entry.clientName }, req.ip);
+    res.json({
+        success: true,
+        sessionId,
+        csrfToken,
+        user: { username: entry.username }
+    });
+});
+
+/**
+ * GET /pending - Requests waiting for approval (dashboard)
+ */
+router.get('/pending', requireAuth, requireAdmin, (req, res) => {
+    purgeExpired();
+    const requests = [...pending.values()].filter(e => e.status === 'pending').map(publicEntry);
+    res.json({ requests });
+});
+
+/**
+ * POST /:id/approve - Admin confirms the code shown by the finder
+ * Body: { code }
+ */
+router.post('/:id/approve', requireAuth, requireAdmin, (req, res) => {
+    const entry = findPending(req.params.id);
+    if (!entry) {
+        return res.status(404).json({ error: 'Pairing request not found or expired' });
+    }
+
+    const code = String((req.body || {}).code || '').trim();
+    if (code !== entry.code) {
+        logSecurityEvent('PAIRING_CODE_MISMATCH', { user: req.user.username, client: entry.clientName }, req.ip);
+        return res.status(400).json({ error: 'Pairing code does not match' });
+    }
+
+    try {
+        const { client, token } = createPairedClient({
+            name: entry.clientName,
+            ip: entry.ip,
+            scopes: entry.scopes,
+            pairedBy: req.user.username
+        });
+        Object.assign(entry, { status: 'approved', clientId: client.id, token });
+
+        logSecurityEvent('PAIRING_APPROVED', { user: req.user.username, client: client.name, scopes: client.scopes }, req.ip);
+        res.json({ success: true, clientId: client.id });
+    } catch (e) {
+        console.error('Pairing approve error:', e);
+        res.status(500).json({ error: 'Failed to pair client' });
+    }
+});
+
+/**
+ * POST /:id/deny - Admin rejects a request
+ */
+router.post('/:id/deny', requireAuth, requireAdmin, (req, res) => {
+    const entry = findPending(req.params.id);
+    if (!entry) {
+        return res.status(404).json({ error: 'Pairing request not found or expired' });
+    }
+
+    entry.status = 'denied';
+    logSecurityEvent('PAIRING_DENIED', { user: req.user.username, client: entry.clientName }, req.ip);
+    res.json({ success: true });
+});
+
+/**
+ * GET /clients - Paired clients
+ */
+router.get('/clients', requireAuth, requireAdmin, (req, res) => {
+    res.json({ clients: listPairedClients() });
+});
+
+/**
+ * DELETE /clients/:id - Revoke a paired client's token
+ */
+router.delete('/clients/:id', requireAuth, requireAdmin, (req, res) => {
+    try {
+        if (!revokePairedClient(req.params.id)) {
+            return res.status(404).json({ error: 'Paired client not found' });
+        }
+        logSecurityEvent('PAIRING_REVOKED', { user: req.user.username, clientId: req.params.id }, req.ip);
+        res.json({ success: true });
+    } catch (e) {
+        console.error('Pairing revoke error:', e);
+        res.status(500).json({ error: 'Failed to revoke client' });
+    }
+});
+
+module.exports = router;
@@ -13,6 +13,7 @@ const { exec } = require('child_process');
 const { requireAuth } = require('../middleware/auth');
 const { requireAdmin } = require('../middleware/rbac');
 const { criticalLimiter } = require('../middleware/rateLimit');
+const { pairedTokenOr } = require('../middleware/pairing');
 const { logSecurityEvent } = require('../utils/security');
 const { clearAllSessions } = require('../utils/session');
 const { DATA_FILE } = require('../utils/data');
@@ -62,8 +63,8 @@ router.post('/factory-reset', factoryResetLimiter, (req, res) => {
     }
 });
 
-// System reboot
-router.post('/reboot', requireAuth, requireAdmin, criticalLimiter, (req, res) => {
+// System reboot (also allowed to paired clients with the 'power' scope)
+router.post('/reboot', pairedTokenOr('power', requireAuth, requireAdmin), criticalLimiter, (req, res) => {
     logSecurityEvent('SYSTEM_REBOOT', { user: req.user.username }, req.ip);
     res.json({ message: 'Rebooting...' });
 
@@ -76,8 +77,8 @@ router.post('/reboot', requireAuth, requireAdmin, criticalLimiter, (req, res) =>
     }, 1000);
 });
 
-// System shutdown
-router.post('/shutdown', requireAuth, requireAdmin, criticalLimiter, (req, res) => {
+// System shutdown (also allowed to paired clients with the 'power' scope)
+router.post('/shutdown', pairedTokenOr('power', requireAuth, requireAdmin), criticalLimiter, (req, res) => {
     logSecurityEvent('SYSTEM_SHUTDOWN', { user: req.user.username }, req.ip);
     res.json({ message: 'Shutting down...' });
 
@@ -12,14 +12,15 @@ const path = require('path');
 
 const { requireAuth } = require('../middleware/auth');
 const { criticalLimiter } = require('../middleware/rateLimit');
+const { pairedTokenOr } = require('../middleware/pairing');
 const { logSecurityEvent } = require('../utils/security');
 
 const INSTALL_DIR = '/opt/homepinas';
 const REPO_URL = 'https://github.com/juanlusoft/homepinas-v2.git';
 const EXPECTED_REMOTE = 'github.com/juanlusoft/homepinas-v2'; // SECURITY: Expected repo pattern
 
-// Check for updates
-router.get('/check', requireAuth, async (req, res) => {
+// Check for updates (sessions or paired clients with the 'update' scope)
+router.get('/check', pairedTokenOr('update', requireAuth), async (req, res) => {
     try {
         // Get current local version
         const packageJson = require(path.join(INSTALL_DIR, 'package.json'));
@@ -112,7 +113,7 @@ router.get('/check', requireAuth, async (req, res) => {
 });
 
 // Perform update
-router.post('/apply', requireAuth, criticalLimiter, async (req, res) => {
+router.post('/apply', pairedTokenOr('update', requireAuth), criticalLimiter, async (req, res) => {
     logSecurityEvent('UPDATE_STARTED', { user: req.user.username }, req.ip);
 
     // SECURITY: Verify we're updating from the expected repository
@@ -197,7 +198,7 @@ router.post('/apply', requireAuth, criticalLimiter, async (req, res) => {
 });
 
 // Get update log/status
-router.get('/status', requireAuth, (req, res) => {
+router.get('/status', pairedTokenOr('update', requireAuth), (req, res) => {
     try {
         // SECURITY: Use execFileSync with explicit arguments
         let log = 'No git history';
@@ -0,0 +1,93 @@
+/**
+ * HomePiNAS - Device Pairing Utilities
+ *
+ * Scoped API tokens for paired clients (HomePiNAS Finder).
+ * Only the SHA-256 hash of each token is stored in data.json.
+ */
+
+const crypto = require('crypto');
+const { getData, saveData } = require('./data');
+
+// Management actions a paired client may be granted
+// (login: open the dashboard already signed in as the admin who approved the pairing)
+const PAIRING_SCOPES = ['power', 'update', 'login'];
+
+function hashToken(token) {
+    return crypto.createHash('sha256').update(String(token)).digest('hex');
+}
+
+/**
+ * Store a new paired client and return it with its token (shown only once)
+ */
+function createPairedClient({ name, ip, scopes, pairedBy }) {
+    const token = crypto.randomBytes(32).toString('hex');
+    const client = {
+        id: crypto.randomUUID(),
+        name,
+        ip,
+        scopes,
+        tokenHash: hashToken(token),
+        pairedBy,
+        pairedAt: new Date().toISOString(),
+        lastUsed: null
+    };
+
+    const data = getData();
+    data.pairedClients = [...(data.pairedClients || []), client];
+    saveData(data);
+
+    return { client, token };
+}
+
+/**
+ * Find the paired client that owns a token (timing-safe comparison)
+ */
+function findPairedClient(token) {
+    if (!token || typeof token !== 'string') return null;
+
+    const hash = Buffer.from(hashToken(token), 'hex');
+    const clients = getData().pairedClients || [];
+    return clients.find(c => {
+        const stored = Buffer.from(c.tokenHash || '', 'hex');
+        return stored.length === hash.length && crypto.timingSafeEqual(stored, hash);
+    }) || null;
+}
+
+/**
+ * Record the last time a paired client used its token
+ */
+function touchPairedClient(id) {
+    const data = getData();
+    const client = (data.pairedClients || []).find(c => c.id === id);
+    if (!client) return;
+    client.lastUsed = new Date().toISOString();
+    saveData(data);
+}
+
+/**
+ * Paired clients without their token hashes
+ */
+function listPairedClients() {
+    return (getData().pairedClients || []).map(({ tokenHash, ...client }) => client);
+}
+
+/**
+ * Revoke a paired client; returns false if it does not exist
+ */
+function revokePairedClient(id) {
+    const data = getData();
+    const clients = data.pairedClients || [];
+    if (!clients.some(c => c.id === id)) return false;
+    data.pairedClients = clients.filter(c => c.id !== id);
+    saveData(data);
+    return true;
+}
+
+module.exports = {
+    PAIRING_SCOPES,
+    createPairedClient,
+    findPairedClient,
+    touchPairedClient,
+    listPairedClients,
+    revokePairedClient
+};
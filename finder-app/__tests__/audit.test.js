@@ -0,0 +1,63 @@
+/**
+ * HomePiNAS Finder - Audit Tests
+ * Append-only log of device actions and its filters
+ */
+
+const fs = require('fs');
+const os = require('os');
+const path = require('path');
+const { recordAction, auditAction, readAudit } = require('../src/audit');
+
+let dir;
+let previousHome;
+
+beforeEach(() => {
+  dir = fs.mkdtempSync(path.join(os.tmpdir(), 'finder-audit-'));
+  previousHome = process.env.HOMEPINAS_FINDER_HOME;
+  process.env.HOMEPINAS_FINDER_HOME = dir;
+});
+
+afterEach(() => {
+  if (previousHome === undefined) delete process.env.HOMEPINAS_FINDER_HOME;
+  else process.env.HOMEPINAS_FINDER_HOME = previousHome;
+  fs.rmSync(dir, { recursive: true, force: true });
+});
+
+describe('auditAction', () => {
+  test('records the result of successful and failed actions', async () => {
+    expect(await auditAction('wake', '192.168.1.10', 'cli', async () => 'sent')).toBe('sent');
+    await expect(auditAction('reboot', '192.168.1.10', 'web', async () => {
+      throw new Error('no emparejado');
+    })).rejects.toThrow('no emparejado');
+
+    expect(readAudit()).toMatchObject([
+      { action: 'wake', device: '192.168.1.10', client: 'cli', result: 'ok' },
+      { action: 'reboot', client: 'web', result: 'error', error: 'no emparejado' }
+    ]);
+  });
+});
+
+describe('readAudit', () => {
+  test('returns nothing before the first action', () => {
+    expect(readAudit()).toEqual([]);
+  });
+
+  test('filters by device, action, client, result and date', () => {
+    recordAction({ action: 'wake', device: '192.168.1.10', client: 'ui', result: 'ok' });
+    recordAction({ action: 'update', device: '192.168.1.11', client: 'cli', result: 'error', error: 'timeout' });
+    recordAction({ action: 'wake', device: '192.168.1.11', client: 'web', result: 'ok' });
+
+    expect(readAudit({ device: '192.168.1.11' })).toHaveLength(2);
+    expect(readAudit({ action: 'wake', client: 'web' }).map((entry) => entry.device)).toEqual(['192.168.1.11']);
+    expect(readAudit({ result: 'error' })[0].error).toBe('timeout');
+    expect(readAudit({ since: '2000-01-01T00:00:00Z' })).toHaveLength(3);
+    expect(readAudit({ since: new Date(Date.now() + 60000).toISOString() })).toEqual([]);
+    expect(readAudit({ limit: 1 })[0].client).toBe('web');
+  });
+
+  test('skips truncated lines', () => {
+    recordAction({ action: 'wake', device: '192.168.1.10', client: 'ui', result: 'ok' });
+    fs.appendFileSync(path.join(dir, 'audit.log'), '{"action":"reb');
+    expect(readAudit()).toHaveLength(1);
+  });
+});
@@ -0,0 +1,124 @@
+/**
+ * HomePiNAS Finder - Beacon Tests
+ * Signed UDP beacon replies: what the finder must refuse (bad signature, replayed
+ * or foreign nonce, public source, changed key) and what it accepts
+ */
+
+const crypto = require('crypto');
+const fs = require('fs');
+const os = require('os');
+const path = require('path');
+const { createProbe, parseProbe, signReply, verifyReply } = require('../src/beacon');
+const { beaconReplyDevice } = require('../src/scanner');
+const { openTrustStore } = require('../src/trust-store');
+
+const FIELDS = { name: 'pinas', hostname: 'pinas.local', version: '2.4.1', scheme: 'https', port: 443 };
+const NONCE = crypto.randomBytes(16).toString('hex');
+const { privateKey } = crypto.generateKeyPairSync('ed25519');
+const { privateKey: otherKey } = crypto.generateKeyPairSync('ed25519');
+
+// Re-serialized reply with some fields changed, keeping the original signature
+function tamper(packet, changes) {
+  return Buffer.from(JSON.stringify({ ...JSON.parse(packet.toString()), ...changes }));
+}
+
+let dir;
+let trustStore;
+
+beforeEach(() => {
+  dir = fs.mkdtempSync(path.join(os.tmpdir(), 'finder-beacon-'));
+  trustStore = openTrustStore(path.join(dir, 'known-certs.json'));
+});
+
+afterEach(() => {
+  fs.rmSync(dir, { recursive: true, force: true });
+});
+
+describe('probe packets', () => {
+  test('round-trips the nonce and refuses anything else', () => {
+    expect(parseProbe(createProbe(NONCE))).toBe(NONCE);
+    expect(parseProbe(Buffer.from(`HOMEPINAS-DISCOVER 2 ${NONCE}\n`))).toBeNull();
+    expect(parseProbe(Buffer.from('HOMEPINAS-DISCOVER 1 1234\n'))).toBeNull();
+    expect(parseProbe(Buffer.from(`HOMEPINAS-DISCOVER 1 ${NONCE.toUpperCase()}\n`))).toBeNull();
+    expect(parseProbe(Buffer.from(`M-SEARCH * HTTP/1.1\r\n${NONCE}`))).toBeNull();
+  });
+});
+
+describe('verifyReply', () => {
+  test('accepts a reply signed for our nonce', () => {
+    const verified = verifyReply(signReply(FIELDS, NONCE, privateKey), NONCE);
+    expect(verified.reply).toMatchObject({ ...FIELDS, nonce: NONCE });
+    expect(verified.keyFingerprint).toMatch(/^([0-9A-F]{2}:){31}[0-9A-F]{2}$/);
+  });
+
+  test('rejects a reply whose fields changed after signing', () => {
+    const packet = signReply(FIELDS, NONCE, privateKey);
+    expect(verifyReply(tamper(packet, { version: '9.9.9' }), NONCE)).toBeNull();
+    expect(verifyReply(tamper(packet, { port: 8443 }), NONCE)).toBeNull();
+    expect(verifyReply(tamper(packet, { extra: 'x' }), NONCE)).toBeNull();
+  });
+
+  test('rejects a signature made with another key or that is not base64 of one', () => {
+    const packet = signReply(FIELDS, NONCE, privateKey);
+    const forged = JSON.parse(signReply(FIELDS, NONCE, otherKey).toString()).signature;
+    expect(verifyReply(tamper(packet, { signature: forged }), NONCE)).toBeNull();
+    expect(verifyReply(tamper(packet, { signature: 'not a signature' }), NONCE)).toBeNull();
+    expect(verifyReply(tamper(packet, { signature: undefined }), NONCE)).toBeNull();
+    // The key of the reply swapped for another one: the signature no longer matches
+    const otherPublic = JSON.parse(signReply(FIELDS, NONCE, otherKey).toString()).publicKey;
+    expect(verifyReply(tamper(packet, { publicKey: otherPublic }), NONCE)).toBeNull();
+  });
+
+  test('rejects replies to another probe (replayed or foreign nonce)', () => {
+    const previous = crypto.randomBytes(16).toString('hex');
+    const replayed = signReply(FIELDS, previous, privateKey);
+    expect(verifyReply(replayed, NONCE)).toBeNull();
+    // Re-targeting the old reply at the current nonce breaks its signature
+    expect(verifyReply(tamper(replayed, { nonce: NONCE }), NONCE)).toBeNull();
+  });
+
+  test('rejects keys that are not Ed25519, wrong magic or version and malformed packets', () => {
+    const { privateKey: rsaKey, publicKey: rsaPublic } = crypto.generateKeyPairSync('rsa', { modulusLength: 2048 });
+    const reply = { ...FIELDS, magic: 'HOMEPINAS', v: 1, nonce: NONCE, publicKey: rsaPublic.export({ type: 'spki', format: 'der' }).toString('base64') };
+    const payload = JSON.stringify(Object.fromEntries(Object.keys(reply).sort().map((key) => [key, reply[key]])));
+    reply.signature = crypto.sign('sha256', Buffer.from(payload), rsaKey).toString('base64');
+    expect(verifyReply(Buffer.from(JSON.stringify(reply)), NONCE)).toBeNull();
+
+    const packet = signReply(FIELDS, NONCE, privateKey);
+    expect(verifyReply(tamper(packet, { magic: 'OTHER' }), NONCE)).toBeNull();
+    expect(verifyReply(tamper(packet, { v: 2 }), NONCE)).toBeNull();
+    expect(verifyReply(Buffer.from('{"magic":"HOMEPINAS"'), NONCE)).toBeNull();
+    expect(verifyReply(Buffer.from('null'), NONCE)).toBeNull();
+    expect(verifyReply(signReply({ ...FIELDS, name: 'x'.repeat(3000) }, NONCE, privateKey), NONCE)).toBeNull();
+  });
+});
+
+describe('beaconReplyDevice', () => {
+  test('takes the IP from the packet source and pins the key on first contact', () => {
+    const packet = signReply({ ...FIELDS, ip: '10.66.0.1' }, NONCE, privateKey);
+    const device = beaconReplyDevice(packet, '192.168.1.50', NONCE, { trustStore });
+    expect(device).toMatchObject({ ip: '192.168.1.50', method: 'beacon', url: 'https://192.168.1.50', keyPin: 'new' });
+    expect(beaconReplyDevice(packet, '192.168.1.50', NONCE, { trustStore }).keyPin).toBe('match');
+  });
+
+  test('ignores replies from public addresses unless allowed', () => {
+    const packet = signReply(FIELDS, NONCE, privateKey);
+    expect(beaconReplyDevice(packet, '203.0.113.7', NONCE, { trustStore })).toBeNull();
+    expect(beaconReplyDevice(packet, '203.0.113.7', NONCE, { trustStore, allowPublic: true })).toMatchObject({ ip: '203.0.113.7' });
+  });
+
+  test('flags another key answering from a pinned IP', () => {
+    beaconReplyDevice(signReply(FIELDS, NONCE, privateKey), '192.168.1.50', NONCE, { trustStore });
+    const impostor = beaconReplyDevice(signReply(FIELDS, NONCE, otherKey), '192.168.1.50', NONCE, { trustStore });
+    expect(impostor).toMatchObject({ keyPin: 'mismatch', keyChanged: true });
+    // The pin stays with the first key
+    expect(beaconReplyDevice(signReply(FIELDS, NONCE, privateKey), '192.168.1.50', NONCE, { trustStore }).keyPin).toBe('match');
+  });
+
+  test('does not report invalid replies at all', () => {
+    const packet = signReply(FIELDS, NONCE, privateKey);
+    expect(beaconReplyDevice(tamper(packet, { name: 'evil' }), '192.168.1.50', NONCE, { trustStore })).toBeNull();
+    expect(beaconReplyDevice(packet, '192.168.1.50', crypto.randomBytes(16).toString('hex'), { trustStore })).toBeNull();
+    expect(trustStore.get('beacon:192.168.1.50')).toBeFalsy();
+  });
+});
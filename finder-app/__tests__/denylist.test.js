@@ -0,0 +1,61 @@
+/**
+ * HomePiNAS Finder - Denylist Tests
+ * Hosts that no discovery method may probe or report
+ */
+
+const { compileDenylist } = require('../src/denylist');
+const { scanNetwork, createScanState } = require('../src/scanner');
+
+describe('compileDenylist', () => {
+  test('matches single IPv4 and IPv6 addresses', () => {
+    const denied = compileDenylist(['192.168.1.10', 'fd00::10']);
+    expect(denied('192.168.1.10')).toBe(true);
+    expect(denied('192.168.1.11')).toBe(false);
+    // Same address written differently
+    expect(denied('fd00:0:0::10')).toBe(true);
+    expect(denied('fd00::11')).toBe(false);
+  });
+
+  test('matches IPv4 and IPv6 CIDRs', () => {
+    const denied = compileDenylist(['10.0.5.0/24', 'fd00:5::/64']);
+    expect(denied('10.0.5.200')).toBe(true);
+    expect(denied('10.0.6.1')).toBe(false);
+    expect(denied('fd00:5::abcd')).toBe(true);
+    expect(denied('fd00:6::1')).toBe(false);
+  });
+
+  test('ignores the zone of link-local addresses', () => {
+    const denied = compileDenylist(['fe80::/64']);
+    expect(denied('fe80::1%eth0')).toBe(true);
+  });
+
+  test('matches MAC prefixes in any notation', () => {
+    const denied = compileDenylist(['B8-27-EB']);
+    expect(denied('192.168.1.20', 'b8:27:eb:12:34:56')).toBe(true);
+    expect(denied('192.168.1.20', 'B8-27-EB-12-34-56')).toBe(true);
+    expect(denied('192.168.1.20', 'dc:a6:32:12:34:56')).toBe(false);
+    // Without a known MAC the prefix cannot match
+    expect(denied('192.168.1.20')).toBe(false);
+  });
+
+  test('skips invalid entries', () => {
+    const denied = compileDenylist(['not-an-ip', '10.0.0.0/40', 'fd00::/200', '']);
+    expect(denied('10.0.0.1')).toBe(false);
+    expect(denied('fd00::1')).toBe(false);
+  });
+});
+
+describe('scanNetwork exclusion', () => {
+  test('drops a host whose MAC is only learned after probing it', async () => {
+    // The simulated network has no ARP table: the MAC comes with the probe result
+    const devices = await scanNetwork({
+      simulation: [
+        { ip: '192.0.2.10', mac: 'b8:27:eb:00:00:10' },
+        { ip: '192.0.2.11', mac: 'dc:a6:32:00:00:11' }
+      ],
+      exclude: ['b8:27:eb'],
+      state: createScanState()
+    });
+    expect(devices.map((device) => device.ip)).toEqual(['192.0.2.11']);
+  });
+});
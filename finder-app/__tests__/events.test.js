@@ -0,0 +1,110 @@
+/**
+ * HomePiNAS Finder - Events Tests
+ * Availability events between scans and differences between stored scans
+ */
+
+const { createAvailabilityTracker, describeEvent, findKnown } = require('../src/events');
+const { diffScans } = require('../src/history');
+
+const nas = (fields) => ({ name: 'pinas', hostname: 'pinas.local', version: '2.4.1', ...fields });
+const types = (events) => events.map((event) => event.type);
+
+describe('createAvailabilityTracker', () => {
+  test('announces discovered, offline and online devices', () => {
+    const tracker = createAvailabilityTracker();
+    const device = nas({ ip: '192.168.1.10', mac: 'dc:a6:32:00:00:10' });
+
+    expect(types(tracker.update([device]))).toEqual(['discovered']);
+    expect(tracker.update([device])).toEqual([]);
+    expect(types(tracker.update([]))).toEqual(['offline']);
+    expect(types(tracker.update([device]))).toEqual(['online']);
+  });
+
+  test('follows a device that changes IP by its MAC', () => {
+    const tracker = createAvailabilityTracker();
+    tracker.update([nas({ ip: '192.168.1.10', mac: 'dc:a6:32:00:00:10' })]);
+    const events = tracker.update([nas({ ip: '192.168.1.23', mac: 'dc:a6:32:00:00:10' })]);
+    expect(types(events)).toEqual(['changed']);
+    expect(describeEvent(events[0])).toBe('pinas (192.168.1.23) ha cambiado de IP (antes 192.168.1.10)');
+  });
+
+  test('reports version changes', () => {
+    const tracker = createAvailabilityTracker();
+    tracker.update([nas({ ip: '192.168.1.10' })]);
+    const events = tracker.update([nas({ ip: '192.168.1.10', version: '2.5.0' })]);
+    expect(types(events)).toEqual(['changed']);
+    expect(events[0].previous.version).toBe('2.4.1');
+  });
+
+  test('does not treat two devices with the same hostname as one', () => {
+    const tracker = createAvailabilityTracker();
+    tracker.update([nas({ ip: '192.168.1.10', mac: 'dc:a6:32:00:00:10' })]);
+    // A second, freshly installed NAS announces the default hostname too
+    const events = tracker.update([
+      nas({ ip: '192.168.1.10', mac: 'dc:a6:32:00:00:10' }),
+      nas({ ip: '192.168.1.11', mac: 'dc:a6:32:00:00:11' })
+    ]);
+    expect(types(events)).toEqual(['discovered']);
+    expect(events[0].device.ip).toBe('192.168.1.11');
+  });
+
+  test('warns once about a changed certificate', () => {
+    const tracker = createAvailabilityTracker();
+    tracker.update([nas({ ip: '192.168.1.10' })]);
+    const changed = nas({ ip: '192.168.1.10', certChanged: true });
+    expect(types(tracker.update([changed]))).toEqual(['cert-changed']);
+    expect(tracker.update([changed])).toEqual([]);
+  });
+});
+
+describe('findKnown', () => {
+  const known = new Map([
+    ['a', nas({ ip: '192.168.1.10', mac: 'dc:a6:32:00:00:10' })],
+    ['b', nas({ ip: '192.168.1.20', addresses: ['192.168.1.20', 'fd00::20'] })]
+  ]);
+
+  test('matches by MAC or by a shared address', () => {
+    expect(findKnown(known, { ip: '192.168.1.99', mac: 'dc:a6:32:00:00:10' }, new Set())).toBe('a');
+    expect(findKnown(known, { ip: 'fd00::20' }, new Set())).toBe('b');
+  });
+
+  test('never matches by hostname alone', () => {
+    expect(findKnown(known, { ip: '192.168.1.30', hostname: 'pinas.local' }, new Set())).toBeNull();
+  });
+
+  test('does not match an IP reused by a different MAC', () => {
+    expect(findKnown(known, { ip: '192.168.1.10', mac: 'dc:a6:32:00:00:99' }, new Set())).toBeNull();
+  });
+
+  test('skips devices already matched in this scan', () => {
+    expect(findKnown(known, { ip: '192.168.1.10' }, new Set(['a']))).toBeNull();
+  });
+});
+
+describe('diffScans', () => {
+  test('lists appeared, vanished, moved and updated devices', () => {
+    const from = {
+      id: 1,
+      devices: [
+        nas({ ip: '192.168.1.10', mac: 'dc:a6:32:00:00:10' }),
+        nas({ ip: '192.168.1.11', name: 'copias', hostname: 'copias.local' }),
+        nas({ ip: '192.168.1.12', name: 'garaje', hostname: 'garaje.local', version: '2.1.5' })
+      ]
+    };
+    const to = {
+      id: 2,
+      devices: [
+        nas({ ip: '192.168.1.40', mac: 'dc:a6:32:00:00:10' }),
+        nas({ ip: '192.168.1.12', name: 'garaje', hostname: 'garaje.local', version: '2.2.0' }),
+        // Same hostname as the vanished one, but a different host
+        nas({ ip: '192.168.1.50', name: 'copias', hostname: 'copias.local' })
+      ]
+    };
+
+    const diff = diffScans(from, to);
+    expect(diff.appeared.map((device) => device.ip)).toEqual(['192.168.1.50']);
+    expect(diff.vanished.map((device) => device.ip)).toEqual(['192.168.1.11']);
+    expect(diff.moved).toMatchObject([{ ip: '192.168.1.40', previousIp: '192.168.1.10' }]);
+    expect(diff.updated).toMatchObject([{ ip: '192.168.1.12', previousVersion: '2.1.5' }]);
+  });
+});
@@ -0,0 +1,73 @@
+/**
+ * HomePiNAS Finder - Fingerprint Tests
+ * Detectors that decide whether an HTTP response comes from a HomePiNAS
+ */
+
+const { matchFingerprint, registerDetector, probeEndpoints } = require('../src/fingerprints');
+
+const json = (body, statusCode = 200) => ({ statusCode, headers: {}, body: JSON.stringify(body) });
+const html = (body, statusCode = 200) => ({ statusCode, headers: { 'content-type': 'text/html' }, body });
+
+describe('matchFingerprint', () => {
+  test('recognises the system info API with full confidence', () => {
+    const match = matchFingerprint(json({ product: 'HomePiNAS', hostname: 'pinas', version: '2.4.1' }));
+    expect(match.name).toBe('system-info');
+    expect(match.confidence).toBe(1);
+    expect(match.json.version).toBe('2.4.1');
+  });
+
+  test('falls back to lower-priority detectors', () => {
+    expect(matchFingerprint(json({ hostname: 'pinas' })).name).toBe('system-hostname');
+    expect(matchFingerprint(json({ poolConfigured: true })).name).toBe('system-status');
+    expect(matchFingerprint(html('<title>HomePiNAS - Login</title>')).name).toBe('dashboard-title');
+  });
+
+  test('recognises the install certificate', () => {
+    const match = matchFingerprint({ ...html('<html></html>'), cert: { subject: { O: 'HomePiNAS', CN: 'pinas' } } });
+    expect(match.name).toBe('install-cert');
+  });
+
+  test('does not treat other web panels as a NAS', () => {
+    // Router, printer and camera pages: they answer, but nothing says HomePiNAS
+    expect(matchFingerprint(html('<title>Router login</title>'))).toBeNull();
+    expect(matchFingerprint(html('Unauthorized', 401))).toBeNull();
+    expect(matchFingerprint(html('', 200))).toBeNull();
+    expect(matchFingerprint(json({ model: 'LaserJet' }))).toBeNull();
+  });
+
+  test('ignores detectors below minConfidence', () => {
+    expect(matchFingerprint(html('<title>HomePiNAS</title>'), 0.8)).toBeNull();
+    expect(matchFingerprint(json({ product: 'HomePiNAS' }), 0.8).name).toBe('system-info');
+  });
+
+  test('does not match a different product in the system info API', () => {
+    const match = matchFingerprint(json({ product: 'OtherNAS' }));
+    expect(match).toBeNull();
+  });
+});
+
+describe('registerDetector', () => {
+  test('adds a detector and its endpoints', () => {
+    registerDetector({
+      name: 'test-v2-about', priority: 95, confidence: 0.9,
+      endpoints: ['/api/v2/about'], json: { vendor: /^HomePiNAS$/ }
+    });
+    expect(probeEndpoints()).toContain('/api/v2/about');
+    expect(matchFingerprint(json({ vendor: 'HomePiNAS' })).name).toBe('test-v2-about');
+  });
+
+  test('replaces a detector with the same name', () => {
+    registerDetector({ name: 'test-v2-about', priority: 95, confidence: 0.9, json: { vendor: /^Acme$/ } });
+    expect(matchFingerprint(json({ vendor: 'HomePiNAS' }))).toBeNull();
+    expect(matchFingerprint(json({ vendor: 'Acme' })).name).toBe('test-v2-about');
+  });
+
+  test('a throwing detector never breaks the probe', () => {
+    registerDetector({ name: 'test-broken', priority: 200, detect: () => { throw new Error('boom'); } });
+    expect(matchFingerprint(json({ product: 'HomePiNAS' })).name).toBe('system-info');
+  });
+
+  test('requires a name', () => {
+    expect(() => registerDetector({ priority: 1 })).toThrow('nombre');
+  });
+});
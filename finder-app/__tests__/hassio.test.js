@@ -0,0 +1,89 @@
+/**
+ * HomePiNAS Finder - Home Assistant Add-on Tests
+ * Add-on options and devices published through the Supervisor
+ */
+
+const fs = require('fs');
+const http = require('http');
+const os = require('os');
+const path = require('path');
+const { loadAddonOptions } = require('../src/config');
+const { deviceState, createSupervisorPublisher } = require('../src/hassio');
+
+describe('loadAddonOptions', () => {
+  let dir;
+  let file;
+
+  beforeAll(() => {
+    dir = fs.mkdtempSync(path.join(os.tmpdir(), 'finder-addon-'));
+    file = path.join(dir, 'options.json');
+    fs.writeFileSync(file, JSON.stringify({ scanTargets: ['192.168.10.0/24'], stealth: true, unknown: 1 }));
+  });
+
+  afterAll(() => {
+    delete process.env.SUPERVISOR_TOKEN;
+    fs.rmSync(dir, { recursive: true, force: true });
+  });
+
+  test('ignores options.json outside Home Assistant', () => {
+    delete process.env.SUPERVISOR_TOKEN;
+    expect(loadAddonOptions(file)).toEqual({});
+  });
+
+  test('keeps only config.json keys', () => {
+    process.env.SUPERVISOR_TOKEN = 'supervisor-token';
+    expect(loadAddonOptions(file)).toEqual({ scanTargets: ['192.168.10.0/24'], stealth: true });
+  });
+});
+
+describe('createSupervisorPublisher', () => {
+  let supervisor;
+  let url;
+  const received = [];
+
+  beforeAll(async () => {
+    supervisor = http.createServer((req, res) => {
+      let body = '';
+      req.on('data', (chunk) => { body += chunk; });
+      req.on('end', () => {
+        received.push({ path: req.url, authorization: req.headers.authorization, body: JSON.parse(body) });
+        // Home Assistant restarting: the entity of the second NAS fails
+        res.writeHead(req.url.endsWith('_b2') ? 502 : 201);
+        res.end();
+      });
+    });
+    await new Promise((resolve) => supervisor.listen(0, '127.0.0.1', resolve));
+    url = `http://127.0.0.1:${supervisor.address().port}`;
+  });
+
+  afterAll(() => {
+    supervisor.closeAllConnections();
+    supervisor.close();
+  });
+
+  test('names the entity after the MAC, like MQTT discovery', () => {
+    const { entityId, state } = deviceState({ ip: '192.168.1.10', name: 'pinas', mac: 'DC:A6:32:00:00:10', online: false });
+    expect(entityId).toBe('binary_sensor.homepinas_dc_a6_32_00_00_10');
+    expect(state).toMatchObject({ state: 'off', attributes: { friendly_name: 'pinas', device_class: 'connectivity' } });
+  });
+
+  test('posts each device state with the Supervisor token and survives failures', async () => {
+    const publisher = createSupervisorPublisher({ token: 'supervisor-token', url });
+    const published = await publisher.publish([
+      { ip: '192.168.1.10', name: 'pinas', alias: 'Salón', hostname: 'a1', online: true, version: '2.4.1' },
+      { ip: '192.168.1.11', name: 'copias', hostname: 'b2', online: true }
+    ]);
+    expect(published).toBe(1);
+    expect(received).toHaveLength(2);
+    expect(received[0]).toMatchObject({
+      path: '/core/api/states/binary_sensor.homepinas_a1',
+      authorization: 'Bearer supervisor-token',
+      body: { state: 'on', attributes: { friendly_name: 'Salón', ip: '192.168.1.10', version: '2.4.1' } }
+    });
+  });
+
+  test('needs the Supervisor token', () => {
+    delete process.env.SUPERVISOR_TOKEN;
+    expect(() => createSupervisorPublisher()).toThrow('SUPERVISOR_TOKEN');
+  });
+});
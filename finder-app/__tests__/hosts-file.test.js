@@ -0,0 +1,106 @@
+/**
+ * HomePiNAS Finder - Hosts File Tests
+ * Names written to the hosts block and the managed block update
+ */
+const fs = require('fs');
+const os = require('os');
+const path = require('path');
+const { toHostName, hostsSuffix, renderHostsSnippet, replaceBlock, updateHostsFile } = require('../src/hosts-file');
+
+describe('toHostName', () => {
+  test('turns names into single DNS labels', () => {
+    expect(toHostName('HomePiNAS Salón')).toBe('homepinas-salon');
+    expect(toHostName('nas')).toBe('nas');
+    expect(toHostName('NAS.local')).toBe('nas');
+    expect(toHostName('nas.local.')).toBe('nas');
+    expect(toHostName('nas.home.arpa', 'home.arpa')).toBe('nas');
+  });
+
+  test('drops names with dots', () => {
+    expect(toHostName('accounts.google.com')).toBe('');
+    expect(toHostName('nas.home.arpa')).toBe('');
+    expect(toHostName('192.168.1.10')).toBe('');
+    expect(toHostName('a.nas.local')).toBe('');
+    expect(toHostName('.local')).toBe('');
+  });
+
+  test('drops reserved names', () => {
+    for (const name of ['localhost', 'LOCALHOST.local', 'localhost.', 'broadcasthost', 'ip6-loopback', 'wpad', 'isatap', 'local']) {
+      expect(toHostName(name)).toBe('');
+    }
+  });
+
+  test('drops empty and overlong labels', () => {
+    expect(toHostName('')).toBe('');
+    expect(toHostName(undefined)).toBe('');
+    expect(toHostName('---')).toBe('');
+    expect(toHostName('a'.repeat(63))).toBe('a'.repeat(63));
+    expect(toHostName('a'.repeat(64))).toBe('');
+  });
+});
+
+describe('hostsSuffix', () => {
+  test('accepts local and own domains', () => {
+    expect(hostsSuffix()).toBe('local');
+    expect(hostsSuffix('Home.Arpa.')).toBe('home.arpa');
+  });
+
+  test('rejects invalid suffixes', () => {
+    expect(() => hostsSuffix('')).toThrow('hostsSuffix');
+    expect(() => hostsSuffix('bad suffix')).toThrow('hostsSuffix');
+    expect(() => hostsSuffix('localhost')).toThrow('hostsSuffix');
+  });
+});
+
+describe('renderHostsSnippet', () => {
+  const devices = [
+    { ip: '192.168.1.10', hostname: 'nas.local', name: 'HomePiNAS Salón' },
+    { ip: '192.168.1.11', hostname: 'accounts.google.com', name: 'localhost' },
+    { ip: '192.168.1.12', hostname: '', name: 'backup' }
+  ];
+
+  test('writes each label with .local and skips devices without a valid name', () => {
+    const lines = renderHostsSnippet(devices).trim().split(/\r?\n/);
+    expect(lines).toEqual([
+      '# BEGIN homepinas-finder',
+      '192.168.1.10\tnas.local homepinas-salon.local',
+      '192.168.1.12\tbackup.local',
+      '# END homepinas-finder'
+    ]);
+  });
+
+  test('uses the configured suffix', () => {
+    const snippet = renderHostsSnippet([{ ip: '10.0.0.5', hostname: 'nas.home.arpa', name: 'nas' }], { suffix: 'home.arpa' });
+    expect(snippet).toContain('10.0.0.5\tnas.home.arpa');
+    expect(snippet).not.toContain('.local');
+  });
+
+  test('rejects an invalid suffix', () => {
+    expect(() => renderHostsSnippet(devices, { suffix: 'localhost' })).toThrow('hostsSuffix');
+  });
+});
+
+describe('updateHostsFile', () => {
+  let dir;
+
+  beforeEach(() => {
+    dir = fs.mkdtempSync(path.join(os.tmpdir(), 'hosts-test-'));
+  });
+
+  afterEach(() => {
+    fs.rmSync(dir, { recursive: true, force: true });
+  });
+
+  test('replaces only the managed block', async () => {
+    const file = path.join(dir, 'hosts');
+    fs.writeFileSync(file, '127.0.0.1\tlocalhost\n');
+    const devices = [{ ip: '192.168.1.10', hostname: 'nas.local' }];
+
+    expect(await updateHostsFile(devices, file)).toBe(true);
+    expect(await updateHostsFile(devices, file)).toBe(false);
+    const content = fs.readFileSync(file, 'utf8');
+    expect(content.startsWith('127.0.0.1\tlocalhost\n# BEGIN homepinas-finder')).toBe(true);
+    expect(content).toContain('192.168.1.10\tnas.local');
+    expect(replaceBlock(content, renderHostsSnippet([]))).not.toContain('192.168.1.10');
+  });
+});
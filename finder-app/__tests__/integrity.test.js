@@ -0,0 +1,46 @@
+/**
+ * HomePiNAS Finder - Integrity Tests
+ * Checksum manifest of the packaged files
+ */
+
+const fs = require('fs');
+const os = require('os');
+const path = require('path');
+const { writeManifest, verifyManifest } = require('../src/integrity');
+
+let dir;
+
+beforeEach(() => {
+  dir = fs.mkdtempSync(path.join(os.tmpdir(), 'finder-integrity-'));
+  fs.mkdirSync(path.join(dir, 'web'));
+  fs.writeFileSync(path.join(dir, 'main.js'), 'module.exports = 1;\n');
+  fs.writeFileSync(path.join(dir, 'web', 'app.js'), 'void 0;\n');
+});
+
+afterEach(() => {
+  fs.rmSync(dir, { recursive: true, force: true });
+});
+
+describe('verifyManifest', () => {
+  test('is not checked without a manifest', () => {
+    expect(verifyManifest(dir)).toEqual({ checked: false, problems: [] });
+  });
+
+  test('passes for untouched files', () => {
+    expect(writeManifest(dir)).toBe(2);
+    expect(verifyManifest(dir)).toEqual({ checked: true, problems: [] });
+  });
+
+  test('reports modified and missing files', () => {
+    writeManifest(dir);
+    fs.writeFileSync(path.join(dir, 'main.js'), 'module.exports = 2;\n');
+    fs.rmSync(path.join(dir, 'web', 'app.js'));
+    expect(verifyManifest(dir).problems).toEqual(['main.js: checksum distinto', 'web/app.js: no encontrado']);
+  });
+
+  test('reports files that are not in the manifest', () => {
+    writeManifest(dir);
+    fs.writeFileSync(path.join(dir, 'web', 'extra.js'), 'require("child_process");\n');
+    expect(verifyManifest(dir).problems).toEqual(['web/extra.js: no está en el manifiesto']);
+  });
+});
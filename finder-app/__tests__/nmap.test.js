@@ -0,0 +1,99 @@
+/**
+ * HomePiNAS Finder - nmap Tests
+ * Parsing of nmap -oX output (including malformed files) and the XML export
+ */
+
+const { parseNmapXml, nmapSeeds, formatNmapXml } = require('../src/nmap');
+
+// Trimmed output of `nmap -oX - -p 22,80,443 192.168.1.0/24` (nmap 7.94)
+const SAMPLE = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE nmaprun>
+<nmaprun scanner="nmap" args="nmap -oX - -p 22,80,443 192.168.1.0/24" start="1760000000" version="7.94" xmloutputversion="1.05">
+<host starttime="1760000001" endtime="1760000002"><status state="up" reason="arp-response" reason_ttl="0"/>
+<address addr="192.168.1.50" addrtype="ipv4"/>
+<address addr="DC:A6:32:12:34:56" addrtype="mac" vendor="Raspberry Pi Trading"/>
+<hostnames><hostname name="pinas.lan" type="PTR"/></hostnames>
+<ports>
+<port protocol="tcp" portid="22"><state state="open" reason="syn-ack" reason_ttl="64"/><service name="ssh" method="table" conf="3"/></port>
+<port protocol="tcp" portid="80"><state state="closed" reason="reset" reason_ttl="64"/><service name="http" method="table" conf="3"/></port>
+<port protocol="tcp" portid="443"><state state="open" reason="syn-ack" reason_ttl="64"/><service name="https" method="table" conf="3"/></port>
+<port protocol="udp" portid="53"><state state="open" reason="udp-response" reason_ttl="64"/></port>
+</ports>
+</host>
+<host starttime="1760000001" endtime="1760000002"><status state="up" reason="arp-response" reason_ttl="0"/>
+<address addr="192.168.1.60" addrtype="ipv4"/>
+<hostnames><hostname name="tv &amp; audio" type="PTR"/></hostnames>
+<ports>
+<port protocol="tcp" portid="22"><state state="filtered" reason="no-response" reason_ttl="0"/></port>
+</ports>
+</host>
+<host><status state="down" reason="no-response" reason_ttl="0"/>
+<address addr="192.168.1.70" addrtype="ipv4"/>
+</host>
+<host><status state="up" reason="nd-response" reason_ttl="0"/>
+<address addr="fd00::80" addrtype="ipv6"/>
+</host>
+<runstats><finished time="1760000010" elapsed="10" exit="success"/><hosts up="3" down="1" total="4"/></runstats>
+</nmaprun>
+`;
+
+// `nmap -sn -oX`: host discovery only, no <ports> section
+const PING_SCAN = `<nmaprun><host><status state="up" reason="echo-reply" reason_ttl="64"/>
+<address addr="192.168.1.90" addrtype="ipv4"/><hostnames/></host></nmaprun>`;
+
+describe('parseNmapXml', () => {
+  test('keeps the hosts that are up with their open TCP ports', () => {
+    const hosts = parseNmapXml(SAMPLE);
+    expect(hosts).toEqual([
+      { ip: '192.168.1.50', mac: 'dc:a6:32:12:34:56', hostname: 'pinas.lan', ports: [22, 443] },
+      { ip: '192.168.1.60', mac: '', hostname: 'tv & audio', ports: [] }
+    ]);
+  });
+
+  test('does not know the ports of a ping scan', () => {
+    expect(parseNmapXml(PING_SCAN)).toEqual([{ ip: '192.168.1.90', mac: '', hostname: '', ports: null }]);
+  });
+
+  test('skips hosts without an IPv4 address or with no status', () => {
+    expect(parseNmapXml('<nmaprun><host><address addr="fd00::1" addrtype="ipv6"/></host></nmaprun>')).toEqual([]);
+    expect(parseNmapXml('<host><address addr="10.0.0.5" addrtype="ipv4"/></host>'))
+      .toEqual([{ ip: '10.0.0.5', mac: '', hostname: '', ports: null }]);
+  });
+
+  test('ignores malformed input instead of throwing', () => {
+    expect(parseNmapXml('')).toEqual([]);
+    expect(parseNmapXml('Starting Nmap 7.94 ( https://nmap.org )\nNmap done: 256 IP addresses')).toEqual([]);
+    expect(parseNmapXml('{"hosts": []}')).toEqual([]);
+    // Interrupted scan: the last <host> never closes
+    const truncated = SAMPLE.slice(0, SAMPLE.indexOf('<address addr="192.168.1.60"'));
+    expect(parseNmapXml(truncated).map((host) => host.ip)).toEqual(['192.168.1.50']);
+    // Port without a state or with a non-numeric id
+    const odd = '<host><status state="up"/><address addr="10.0.0.6" addrtype="ipv4"/><ports>' +
+      '<port protocol="tcp" portid="443"></port><port protocol="tcp" portid="abc"><state state="open"/></port></ports></host>';
+    expect(parseNmapXml(odd)).toEqual([{ ip: '10.0.0.6', mac: '', hostname: '', ports: [] }]);
+  });
+});
+
+describe('nmapSeeds', () => {
+  test('keeps hosts with a web port open or unknown ports', () => {
+    const hosts = [...parseNmapXml(SAMPLE), ...parseNmapXml(PING_SCAN)];
+    expect(nmapSeeds(hosts).map((host) => host.ip)).toEqual(['192.168.1.50', '192.168.1.90']);
+    expect(nmapSeeds(hosts, new Set([22])).map((host) => host.ip)).toEqual(['192.168.1.50', '192.168.1.90']);
+  });
+});
+
+describe('formatNmapXml', () => {
+  test('writes XML that parses back with escaped names', () => {
+    const xml = formatNmapXml([
+      { ip: '192.168.1.50', hostname: 'pinas "salón" <1>', url: 'https://192.168.1.50:8443', name: 'A & B', version: '2.4.1' },
+      { ip: '192.168.1.51', url: 'http://192.168.1.51' }
+    ], { startedAt: new Date(1760000000000), finishedAt: new Date(1760000005000), version: '2.4.1' });
+
+    expect(xml).toContain('extrainfo="A &amp; B"');
+    expect(xml).toContain('<hosts up="2" down="0" total="2"/>');
+    expect(parseNmapXml(xml)).toEqual([
+      { ip: '192.168.1.50', mac: '', hostname: 'pinas "salón" <1>', ports: [8443] },
+      { ip: '192.168.1.51', mac: '', hostname: '', ports: [80] }
+    ]);
+  });
+});
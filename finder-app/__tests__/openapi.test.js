@@ -0,0 +1,39 @@
+/**
+ * HomePiNAS Finder - OpenAPI Tests
+ * The served document must describe every route of the web server
+ */
+
+const fs = require('fs');
+const path = require('path');
+const { buildOpenApi } = require('../src/openapi');
+
+// Fixed routes handled by web.js (`url.pathname === '/...'`)
+const source = fs.readFileSync(path.join(__dirname, '..', 'src', 'web.js'), 'utf8');
+const routes = [...new Set([...source.matchAll(/url\.pathname === '([^']+)'/g)].map((match) => match[1]))];
+
+describe('buildOpenApi', () => {
+  test('is an OpenAPI 3 document', () => {
+    const doc = buildOpenApi();
+    expect(doc.openapi).toMatch(/^3\./);
+    expect(doc.info.title).toBe('HomePiNAS Finder');
+    expect(Object.keys(doc.components.securitySchemes)).toEqual(['bearer', 'basic', 'session', 'csrf']);
+  });
+
+  test('describes every route of the web server', () => {
+    const paths = Object.keys(buildOpenApi({ debug: true }).paths);
+    expect(routes.length).toBeGreaterThan(5);
+    for (const route of routes) expect(paths).toContain(route);
+    expect(paths).toContain('/api/scans/{id}');
+    expect(paths).toContain('/api/scans/{id}/results');
+  });
+
+  test('only lists the debug routes with serve --debug', () => {
+    expect(Object.keys(buildOpenApi().paths)).not.toContain('/api/debug/trace');
+  });
+
+  test('every schema reference exists', () => {
+    const doc = buildOpenApi({ debug: true });
+    const refs = [...JSON.stringify(doc).matchAll(/"#\/components\/schemas\/(\w+)"/g)].map((match) => match[1]);
+    for (const name of refs) expect(Object.keys(doc.components.schemas)).toContain(name);
+  });
+});
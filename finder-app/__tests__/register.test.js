@@ -0,0 +1,86 @@
+/**
+ * HomePiNAS Finder - Registration Tests
+ * Signed self-registration of a NAS and the finder's mDNS advertisement
+ */
+
+const crypto = require('crypto');
+const fs = require('fs');
+const os = require('os');
+const path = require('path');
+const { signRegistration, createRegistrar } = require('../src/register');
+const { finderRecords } = require('../src/advertise');
+const { openTrustStore } = require('../src/trust-store');
+
+const FIELDS = { ip: '192.168.1.50', name: 'pinas', hostname: 'pinas.local', version: '2.4.1', scheme: 'https', port: 3001 };
+const { privateKey } = crypto.generateKeyPairSync('ed25519');
+
+let dir;
+let trustStore;
+let registrar;
+
+beforeEach(() => {
+  dir = fs.mkdtempSync(path.join(os.tmpdir(), 'finder-register-'));
+  trustStore = openTrustStore(path.join(dir, 'known-certs.json'));
+  registrar = createRegistrar({ trustStore, exclude: ['192.168.1.99'] });
+});
+
+afterEach(() => {
+  fs.rmSync(dir, { recursive: true, force: true });
+});
+
+// Status of the error thrown by register()
+function rejection(registration, source = FIELDS.ip) {
+  try {
+    registrar.register(registration, source);
+  } catch (err) {
+    return err.status;
+  }
+  return null;
+}
+
+describe('createRegistrar', () => {
+  test('turns a signed registration into a device and pins its key', () => {
+    const device = registrar.register(signRegistration(FIELDS, privateKey), '::ffff:192.168.1.50');
+    expect(device).toMatchObject({
+      ip: '192.168.1.50',
+      name: 'pinas',
+      version: '2.4.1',
+      method: 'register',
+      url: 'https://192.168.1.50:3001',
+      keyPin: 'new'
+    });
+    expect(trustStore.get('beacon:192.168.1.50').fingerprint256).toBe(device.keyFingerprint);
+    expect(registrar.register(signRegistration(FIELDS, privateKey), FIELDS.ip).keyPin).toBe('match');
+  });
+
+  test('rejects tampered, stale and replayed registrations', () => {
+    const registration = signRegistration(FIELDS, privateKey);
+    expect(rejection({ ...registration, version: '9.9.9' })).toBe(401);
+    expect(rejection(signRegistration(FIELDS, privateKey, Date.now() - 10 * 60 * 1000))).toBe(401);
+    expect(rejection({ ...registration, magic: 'OTHER' })).toBe(400);
+    registrar.register(registration, FIELDS.ip);
+    expect(rejection(registration)).toBe(401);
+  });
+
+  test('only registers the address the request comes from', () => {
+    expect(rejection(signRegistration(FIELDS, privateKey), '192.168.1.77')).toBe(403);
+    expect(rejection(signRegistration({ ...FIELDS, ip: '203.0.113.5' }, privateKey), '203.0.113.5')).toBe(403);
+    expect(rejection(signRegistration({ ...FIELDS, ip: '192.168.1.99' }, privateKey), '192.168.1.99')).toBe(403);
+  });
+
+  test('refuses another key for a pinned address', () => {
+    registrar.register(signRegistration(FIELDS, privateKey), FIELDS.ip);
+    const other = crypto.generateKeyPairSync('ed25519').privateKey;
+    expect(rejection(signRegistration(FIELDS, other))).toBe(403);
+  });
+});
+
+describe('finderRecords', () => {
+  test('advertises where and how to register', () => {
+    const records = finderRecords('192.168.1.10', { port: 8088, scheme: 'https', fingerprint256: 'AB:CD' });
+    expect(records.ptr.name).toBe('_homepinas-finder._tcp.local');
+    expect(records.srv.data.port).toBe(8088);
+    expect(records.a.data).toBe('192.168.1.10');
+    expect(records.txt.data).toEqual(['v=1', 'path=/api/register', 'scheme=https', 'fingerprint=AB:CD']);
+  });
+});
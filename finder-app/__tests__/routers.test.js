@@ -0,0 +1,190 @@
+/**
+ * HomePiNAS Finder - Router Leases Tests
+ * DHCP leases from each router integration (against a local fake router serving
+ * the fixtures in __tests__/fixtures/routers) and the ARP/NDP table parsers
+ */
+
+const crypto = require('crypto');
+const fs = require('fs');
+const http = require('http');
+const path = require('path');
+const { fetchRouterLeases } = require('../src/routers');
+const {
+  parseProcArp, parseBsdArp, parseWindowsArp, parseArpScan, parseIpNeigh, parseNdp
+} = require('../src/neighbors');
+
+const fixture = (name) => fs.readFileSync(path.join(__dirname, 'fixtures', 'routers', name), 'utf8');
+
+const SESSION = 'a'.repeat(32);
+const API_KEY = 'pfsense-key';
+const FRITZ = { username: 'admin', password: 'fritz-pass', realm: 'HTTPS Access', nonce: '4F2A9C81D1E0B3C7' };
+const md5 = (value) => crypto.createHash('md5').update(value).digest('hex');
+
+// Port mappings of the fake IGD (the second one points to the same host)
+const MAPPINGS = [
+  { client: '192.168.1.50', description: 'HomePiNAS HTTPS' },
+  { client: '192.168.1.50', description: 'HomePiNAS SSH' },
+  { client: '192.168.1.64', description: 'Plex' }
+];
+
+let server;
+let base;
+
+function validDigest(req) {
+  const header = req.headers.authorization || '';
+  const params = Object.fromEntries(Array.from(header.matchAll(/(\w+)="?([^",]*)"?/g), ([, key, value]) => [key, value]));
+  const ha1 = md5(`${FRITZ.username}:${FRITZ.realm}:${FRITZ.password}`);
+  const ha2 = md5(`${req.method}:${req.url}`);
+  return params.username === FRITZ.username &&
+    params.response === md5(`${ha1}:${FRITZ.nonce}:${params.nc}:${params.cnonce}:auth:${ha2}`);
+}
+
+function soapResponse(action, fields) {
+  const body = Object.entries(fields).map(([key, value]) => `<${key}>${value}</${key}>`).join('');
+  return '<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/">' +
+    `<s:Body><u:${action}Response xmlns:u="urn:test">${body}</u:${action}Response></s:Body></s:Envelope>`;
+}
+
+function handle(req, res, body) {
+  const send = (status, text, type = 'text/xml') => {
+    res.writeHead(status, { 'Content-Type': type });
+    res.end(text);
+  };
+
+  if (req.url === '/ubus') {
+    const { params: [session, object, method, args] } = JSON.parse(body);
+    if (object === 'session' && method === 'login') {
+      const ok = args.username === 'root' && args.password === 'openwrt-pass';
+      return send(200, JSON.stringify({ jsonrpc: '2.0', id: 1, result: ok ? [0, { ubus_rpc_session: SESSION }] : [6] }), 'application/json');
+    }
+    if (session !== SESSION) return send(200, JSON.stringify({ jsonrpc: '2.0', id: 2, result: [6] }), 'application/json');
+    return send(200, fixture('openwrt-leases.json'), 'application/json');
+  }
+  if (req.url === '/api/v2/status/dhcp_server/leases') {
+    if (req.headers['x-api-key'] !== API_KEY) return send(401, '{"code":401,"status":"unauthorized"}', 'application/json');
+    return send(200, fixture('pfsense-leases.json'), 'application/json');
+  }
+  if (req.url === '/upnp/control/hosts') {
+    if (!validDigest(req)) {
+      res.writeHead(401, { 'WWW-Authenticate': `Digest realm="${FRITZ.realm}", nonce="${FRITZ.nonce}", algorithm=MD5, qop="auth"` });
+      return res.end();
+    }
+    return send(200, soapResponse('X_AVM-DE_GetHostListPath', { 'NewX_AVM-DE_HostListPath': '/devicehostlist.lua?sid=0c5b7e' }));
+  }
+  if (req.url === '/devicehostlist.lua?sid=0c5b7e') return send(200, fixture('fritzbox-hostlist.xml'));
+  if (req.url === '/igd.xml') return send(200, fixture('igd-description.xml'));
+  if (req.url === '/ctl/IPConn') {
+    const index = Number(body.match(/<NewPortMappingIndex>(\d+)</)[1]);
+    const mapping = MAPPINGS[index];
+    // End of the table, as a real IGD answers it: SpecifiedArrayIndexInvalid
+    if (!mapping) return send(500, soapResponse('Fault', { errorCode: 713 }));
+    return send(200, soapResponse('GetGenericPortMappingEntry', {
+      NewInternalClient: mapping.client,
+      NewPortMappingDescription: mapping.description
+    }));
+  }
+  send(404, 'Not found', 'text/plain');
+}
+
+beforeAll(async () => {
+  server = http.createServer((req, res) => {
+    let body = '';
+    req.on('data', (chunk) => { body += chunk; });
+    req.on('end', () => handle(req, res, body));
+  });
+  await new Promise((resolve) => server.listen(0, '127.0.0.1', resolve));
+  base = `http://127.0.0.1:${server.address().port}`;
+});
+
+afterAll(() => {
+  server.closeAllConnections();
+  server.close();
+});
+
+describe('fetchRouterLeases', () => {
+  test('reads the DHCP leases of OpenWrt through ubus', async () => {
+    const leases = await fetchRouterLeases({ type: 'openwrt', url: base, password: 'openwrt-pass' });
+    expect([...leases]).toEqual([
+      ['192.168.1.50', { mac: 'dc:a6:32:12:34:56', hostname: 'pinas' }],
+      ['192.168.1.61', { mac: '3c:22:fb:0a:0b:0c', hostname: 'phone' }]
+    ]);
+  });
+
+  test('returns null when the router rejects the credentials', async () => {
+    expect(await fetchRouterLeases({ type: 'openwrt', url: base, password: 'wrong' })).toBeNull();
+    expect(await fetchRouterLeases({ type: 'pfsense', url: base, password: 'wrong' })).toBeNull();
+  });
+
+  test('keeps only the active pfSense leases', async () => {
+    const leases = await fetchRouterLeases({ type: 'pfsense', url: base, password: API_KEY });
+    expect([...leases]).toEqual([
+      ['10.0.10.20', { mac: 'dc:a6:32:aa:bb:cc', hostname: 'nas-storage' }],
+      ['10.0.10.22', { mac: '00:11:32:04:05:06', hostname: '' }]
+    ]);
+  });
+
+  test('answers the TR-064 digest challenge and reads the Fritz!Box host list', async () => {
+    const leases = await fetchRouterLeases({ type: 'fritzbox', url: base, username: FRITZ.username, password: FRITZ.password });
+    expect([...leases]).toEqual([
+      ['192.168.178.20', { mac: 'dc:a6:32:00:00:20', hostname: 'pinas' }],
+      ['192.168.178.40', { mac: 'b8:27:eb:00:00:40', hostname: '' }]
+    ]);
+    expect(await fetchRouterLeases({ type: 'fritzbox', url: base, username: FRITZ.username, password: 'wrong' })).toBeNull();
+  });
+
+  test('takes the internal clients of the UPnP port mappings', async () => {
+    const leases = await fetchRouterLeases({ type: 'upnp', url: `${base}/igd.xml` });
+    expect([...leases]).toEqual([
+      ['192.168.1.50', { mac: '', hostname: '' }],
+      ['192.168.1.64', { mac: '', hostname: '' }]
+    ]);
+  });
+
+  test('ignores unknown router types and missing configuration', async () => {
+    expect(await fetchRouterLeases({ type: 'mikrotik', url: base })).toBeNull();
+    expect(await fetchRouterLeases(null)).toBeNull();
+  });
+});
+
+describe('neighbor table parsers', () => {
+  test('reads /proc/net/arp, with incomplete entries as unreachable', () => {
+    expect([...parseProcArp(fixture('proc-net-arp.txt'))]).toEqual([
+      ['192.168.1.1', { mac: 'f4:f2:6d:11:22:33', reachable: true }],
+      ['192.168.1.50', { mac: 'dc:a6:32:12:34:56', reachable: true }],
+      ['192.168.1.77', { mac: '', reachable: false }],
+      ['192.168.1.90', { mac: 'b8:27:eb:aa:bb:cc', reachable: true }]
+    ]);
+  });
+
+  test('reads the BSD arp output and pads the short MACs of macOS', () => {
+    const table = parseBsdArp(fixture('bsd-arp.txt'));
+    expect(table.get('192.168.1.50')).toEqual({ mac: 'dc:a6:32:02:04:06', reachable: true });
+    expect(table.get('192.168.1.77')).toEqual({ mac: '', reachable: false });
+  });
+
+  test('reads the Windows arp output without the broadcast entry', () => {
+    const table = parseWindowsArp(fixture('windows-arp.txt'));
+    expect(table.get('192.168.1.50')).toEqual({ mac: 'dc:a6:32:12:34:56', reachable: true });
+    expect(table.has('192.168.1.255')).toBe(false);
+    expect(table.has('Interface:')).toBe(false);
+  });
+
+  test('reads arp-scan --plain and skips its summary lines', () => {
+    expect([...parseArpScan(fixture('arp-scan.txt')).keys()]).toEqual(['192.168.1.1', '192.168.1.50']);
+  });
+
+  test('reads IPv6 neighbors from ip neigh and ndp, scoping link-local addresses', () => {
+    expect([...parseIpNeigh(fixture('ip-neigh.txt'))]).toEqual([
+      ['fe80::1%eth0', { mac: 'f4:f2:6d:11:22:33', reachable: true }],
+      ['fd00::50', { mac: 'dc:a6:32:12:34:56', reachable: true }]
+    ]);
+    expect([...parseNdp(fixture('ndp.txt')).keys()]).toEqual(['fe80::1%en0', 'fd00::50']);
+  });
+
+  test('returns empty tables for empty or unrelated output', () => {
+    for (const parse of [parseProcArp, parseBsdArp, parseWindowsArp, parseArpScan, parseIpNeigh, parseNdp]) {
+      expect(parse('').size).toBe(0);
+      expect(parse('command not found\n').size).toBe(0);
+    }
+  });
+});
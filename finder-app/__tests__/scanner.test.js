@@ -0,0 +1,139 @@
+/**
+ * HomePiNAS Finder - Scanner Tests
+ * Probing of individual hosts against local HTTP servers
+ */
+
+const http = require('http');
+const { scanNetwork, createScanState } = require('../src/scanner');
+
+function listen(handler) {
+  return new Promise((resolve) => {
+    const server = http.createServer(handler);
+    server.listen(0, '127.0.0.1', () => resolve(server));
+  });
+}
+
+const sendJson = (res, status, body) => {
+  res.writeHead(status, { 'Content-Type': 'application/json' });
+  res.end(JSON.stringify(body));
+};
+
+// Only the seeds method, against the loopback servers started below
+const scanSeeds = (ports, options = {}) => scanNetwork({
+  methods: ['seeds'],
+  seeds: [{ ip: '127.0.0.1', hostname: '' }],
+  ports: ports.map((port) => `http:${port}`),
+  allowPublic: true,
+  state: createScanState(),
+  ...options
+});
+
+let nas;
+let router;
+let slow;
+
+beforeAll(async () => {
+  nas = await listen((req, res) => {
+    if (req.url === '/api/system/info') return sendJson(res, 200, { product: 'HomePiNAS', hostname: 'pinas', version: '2.4.1' });
+    sendJson(res, 404, { error: 'Not found' });
+  });
+  router = await listen((req, res) => {
+    res.writeHead(401, { 'Content-Type': 'text/html' });
+    res.end('<html><title>Router</title></html>');
+  });
+  // Never answers: the probe must give up on its own
+  slow = await listen(() => {});
+});
+
+afterAll(() => {
+  for (const server of [nas, router, slow]) {
+    server.closeAllConnections();
+    server.close();
+  }
+});
+
+describe('scanNetwork probing', () => {
+  test('finds a HomePiNAS by its system info API', async () => {
+    const devices = await scanSeeds([nas.address().port]);
+    expect(devices).toHaveLength(1);
+    expect(devices[0]).toMatchObject({
+      ip: '127.0.0.1',
+      name: 'pinas',
+      version: '2.4.1',
+      method: 'HTTP',
+      fingerprint: 'system-info',
+      url: `http://127.0.0.1:${nas.address().port}`
+    });
+  });
+
+  test('does not report a router login page', async () => {
+    const devices = await scanSeeds([router.address().port]);
+    expect(devices).toHaveLength(0);
+  });
+
+  test('a slow port does not hold back the one that answers', async () => {
+    const started = Date.now();
+    const devices = await scanSeeds([slow.address().port, nas.address().port], { httpTimeout: 3000 });
+    expect(devices).toHaveLength(1);
+    expect(devices[0].url).toBe(`http://127.0.0.1:${nas.address().port}`);
+    // The winner cancels the other probe instead of waiting for its timeout
+    expect(Date.now() - started).toBeLessThan(2500);
+  });
+
+  test('caches empty hosts and skips them in the next scan', async () => {
+    const state = createScanState();
+    await scanSeeds([router.address().port], { state });
+    expect(state.negativeCache.has('127.0.0.1')).toBe(true);
+
+    await scanSeeds([nas.address().port], { state });
+    expect(state.status.progress.probed).toBe(1);
+    expect(state.status.found).toBe(0);
+  });
+
+  test('drops expired negative-cache entries when a scan starts', async () => {
+    const state = createScanState();
+    state.negativeCache.set('192.0.2.1', Date.now() - 1000);
+    state.negativeCache.set('192.0.2.2', Date.now() + 60000);
+    await scanSeeds([nas.address().port], { state, seeds: [] });
+    expect([...state.negativeCache.keys()]).toEqual(['192.0.2.2']);
+  });
+
+  test('counts the hosts of each swept range', async () => {
+    const state = createScanState();
+    const devices = await scanSeeds([nas.address().port], { state, methods: ['targets'], targets: ['127.0.0.1/30'] });
+    expect(devices.map((device) => device.ip)).toEqual(['127.0.0.1']);
+    expect(state.status.progress.subnets).toEqual([{ range: '127.0.0.0/30', probed: 2, total: 2, found: 1 }]);
+  });
+
+  test('reports carried devices without probing them', async () => {
+    const state = createScanState();
+    const known = { ip: '192.0.2.20', addresses: ['192.0.2.20'], name: 'pinas', mac: 'dc:a6:32:00:00:20', method: 'HTTP' };
+    const devices = await scanSeeds([nas.address().port], { state, seeds: [], carried: [known] });
+    expect(devices).toHaveLength(1);
+    expect(devices[0]).toMatchObject({ ip: '192.0.2.20', name: 'pinas' });
+    expect(state.status.progress.probed).toBe(0);
+  });
+});
+
+describe('scanNetwork merging', () => {
+  // The simulated network reports each device as-is, without touching the network
+  const simulate = (devices) => scanNetwork({ simulation: devices, state: createScanState() });
+
+  test('merges addresses of the same host by MAC', async () => {
+    const devices = await simulate([
+      { ip: '192.0.2.10', hostname: 'pinas.local', mac: 'dc:a6:32:00:00:10' },
+      { ip: '2001:db8::10', hostname: 'pinas.local', mac: 'dc:a6:32:00:00:10', latencyMs: 50 }
+    ]);
+    expect(devices).toHaveLength(1);
+    expect(devices[0].addresses).toEqual(['192.0.2.10', '2001:db8::10']);
+  });
+
+  test('keeps two hosts that announce the same hostname apart', async () => {
+    const devices = await simulate([
+      { ip: '192.0.2.10', hostname: 'pinas.local', mac: 'dc:a6:32:00:00:10' },
+      { ip: '192.0.2.11', hostname: 'pinas.local', mac: 'dc:a6:32:00:00:11', latencyMs: 50 },
+      { ip: '192.0.2.12', hostname: 'pinas.local', latencyMs: 50 }
+    ]);
+    expect(devices.map((device) => device.ip)).toEqual(['192.0.2.10', '192.0.2.11', '192.0.2.12']);
+  });
+});
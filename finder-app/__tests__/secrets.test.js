@@ -0,0 +1,139 @@
+/**
+ * HomePiNAS Finder - Secrets Tests
+ * Encrypted secrets file: round-trip, rejection of tampered entries and the
+ * order of key sources (passphrase, machine secret, generated secret.key)
+ */
+
+const crypto = require('crypto');
+const fs = require('fs');
+const os = require('os');
+const path = require('path');
+const { openSecretStore, getKeyMaterial, encrypt, decrypt } = require('../src/secrets');
+
+const PLATFORM = Object.getOwnPropertyDescriptor(process, 'platform');
+
+// Platform with no machine identifier, so the last key source is used
+function withoutMachineSecret(fn) {
+  Object.defineProperty(process, 'platform', { ...PLATFORM, value: 'aix' });
+  try {
+    return fn();
+  } finally {
+    Object.defineProperty(process, 'platform', PLATFORM);
+  }
+}
+
+// Same entry with one byte of a base64 field flipped
+function flip(entry, field) {
+  const bytes = Buffer.from(entry[field], 'base64');
+  bytes[0] ^= 0x01;
+  return { ...entry, [field]: bytes.toString('base64') };
+}
+
+let dir;
+let passphrase;
+
+beforeEach(() => {
+  dir = fs.mkdtempSync(path.join(os.tmpdir(), 'finder-secrets-'));
+  passphrase = process.env.HOMEPINAS_FINDER_PASSPHRASE;
+  process.env.HOMEPINAS_FINDER_PASSPHRASE = 'correct horse battery staple';
+});
+
+afterEach(() => {
+  if (passphrase === undefined) delete process.env.HOMEPINAS_FINDER_PASSPHRASE;
+  else process.env.HOMEPINAS_FINDER_PASSPHRASE = passphrase;
+  fs.rmSync(dir, { recursive: true, force: true });
+});
+
+describe('encrypted file store', () => {
+  test('round-trips values across reopenings without writing them in clear', () => {
+    const store = openSecretStore(dir, { backend: 'file' });
+    expect(store.backend).toBe('file');
+    store.set('nas:192.168.1.50', 'token-ñ-1234');
+    store.set('ssh:pinas', 'hunter2');
+
+    const raw = fs.readFileSync(path.join(dir, 'secrets.enc.json'), 'utf8');
+    expect(raw).not.toContain('token-ñ-1234');
+    expect(raw).not.toContain('hunter2');
+    expect(fs.statSync(path.join(dir, 'secrets.enc.json')).mode & 0o777).toBe(0o600);
+
+    const reopened = openSecretStore(dir, { backend: 'file' });
+    expect(reopened.get('nas:192.168.1.50')).toBe('token-ñ-1234');
+    expect(reopened.get('missing')).toBeNull();
+    reopened.delete('ssh:pinas');
+    expect(openSecretStore(dir, { backend: 'file' }).get('ssh:pinas')).toBeNull();
+  });
+
+  test('returns null for tampered entries or another passphrase', () => {
+    openSecretStore(dir, { backend: 'file' }).set('token', 'secret-value');
+    const file = path.join(dir, 'secrets.enc.json');
+    const store = JSON.parse(fs.readFileSync(file, 'utf8'));
+
+    fs.writeFileSync(file, JSON.stringify({ ...store, entries: { token: flip(store.entries.token, 'data') } }));
+    expect(openSecretStore(dir, { backend: 'file' }).get('token')).toBeNull();
+
+    fs.writeFileSync(file, JSON.stringify(store));
+    process.env.HOMEPINAS_FINDER_PASSPHRASE = 'another passphrase';
+    expect(openSecretStore(dir, { backend: 'file' }).get('token')).toBeNull();
+  });
+});
+
+describe('encrypt/decrypt', () => {
+  const key = crypto.randomBytes(32);
+
+  test('uses a fresh IV for every value', () => {
+    const first = encrypt(key, 'same');
+    const second = encrypt(key, 'same');
+    expect(first.iv).not.toBe(second.iv);
+    expect(decrypt(key, first)).toBe('same');
+    expect(decrypt(key, second)).toBe('same');
+  });
+
+  test('rejects a modified ciphertext, tag or IV and the wrong key', () => {
+    const entry = encrypt(key, 'secret-value');
+    expect(() => decrypt(key, flip(entry, 'data'))).toThrow();
+    expect(() => decrypt(key, flip(entry, 'tag'))).toThrow();
+    expect(() => decrypt(key, flip(entry, 'iv'))).toThrow();
+    expect(() => decrypt(key, { ...entry, tag: '' })).toThrow();
+    expect(() => decrypt(crypto.randomBytes(32), entry)).toThrow();
+  });
+});
+
+describe('getKeyMaterial', () => {
+  test('prefers the passphrase from the environment', () => {
+    expect(getKeyMaterial(dir)).toBe('correct horse battery staple');
+    expect(fs.existsSync(path.join(dir, 'secret.key'))).toBe(false);
+  });
+
+  test('falls back to the machine secret without a passphrase', () => {
+    delete process.env.HOMEPINAS_FINDER_PASSPHRASE;
+    let machineId = null;
+    try {
+      machineId = fs.readFileSync('/etc/machine-id', 'utf8').trim() || null;
+    } catch {
+      // No /etc/machine-id (minimal containers): nothing to compare against
+    }
+    if (process.platform !== 'linux' || !machineId) return;
+    expect(getKeyMaterial(dir)).toBe(machineId);
+    expect(fs.existsSync(path.join(dir, 'secret.key'))).toBe(false);
+  });
+
+  test('generates a 0600 secret.key as last resort and reuses it', () => {
+    delete process.env.HOMEPINAS_FINDER_PASSPHRASE;
+    const keyDir = path.join(dir, 'config');
+    const key = withoutMachineSecret(() => getKeyMaterial(keyDir));
+    const keyFile = path.join(keyDir, 'secret.key');
+
+    expect(key).toMatch(/^[0-9a-f]{64}$/);
+    expect(fs.readFileSync(keyFile, 'utf8')).toBe(key);
+    if (process.platform !== 'win32') expect(fs.statSync(keyFile).mode & 0o777).toBe(0o600);
+    expect(withoutMachineSecret(() => getKeyMaterial(keyDir))).toBe(key);
+  });
+
+  test('keeps secrets readable with the generated key file', () => {
+    delete process.env.HOMEPINAS_FINDER_PASSPHRASE;
+    withoutMachineSecret(() => openSecretStore(dir, { backend: 'file' }).set('token', 'from-key-file'));
+    expect(withoutMachineSecret(() => openSecretStore(dir, { backend: 'file' }).get('token'))).toBe('from-key-file');
+    fs.rmSync(path.join(dir, 'secret.key'));
+    expect(withoutMachineSecret(() => openSecretStore(dir, { backend: 'file' }).get('token'))).toBeNull();
+  });
+});
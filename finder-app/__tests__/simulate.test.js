@@ -0,0 +1,85 @@
+/**
+ * HomePiNAS Finder - Simulated Network Tests
+ * A --simulate run must not persist anything nor notify any channel
+ */
+
+const { spawn } = require('child_process');
+const fs = require('fs');
+const http = require('http');
+const os = require('os');
+const path = require('path');
+
+const CLI = path.join(__dirname, '..', 'src', 'cli.js');
+
+let home;
+let webhook;
+let received;
+
+// Runs the CLI until it exits or until `until` matches its output (then stops it like the service manager)
+function runCli(args, until = null) {
+  return new Promise((resolve, reject) => {
+    const child = spawn(process.execPath, [CLI, ...args], {
+      env: { ...process.env, HOMEPINAS_FINDER_HOME: home },
+      stdio: ['ignore', 'pipe', 'pipe']
+    });
+    let stdout = '';
+    child.stdout.on('data', (chunk) => {
+      stdout += chunk;
+      // Leave time for the notifications that would follow the events
+      if (until && until.test(stdout)) setTimeout(() => child.kill('SIGTERM'), 1000);
+    });
+    child.on('error', reject);
+    child.on('exit', (code) => resolve({ code, stdout }));
+  });
+}
+
+beforeAll(async () => {
+  received = [];
+  webhook = http.createServer((req, res) => {
+    received.push(req.url);
+    res.end();
+  });
+  await new Promise((resolve) => webhook.listen(0, '127.0.0.1', resolve));
+});
+
+afterAll(() => {
+  webhook.close();
+});
+
+beforeEach(() => {
+  home = fs.mkdtempSync(path.join(os.tmpdir(), 'finder-simulate-'));
+  fs.writeFileSync(path.join(home, 'config.json'), JSON.stringify({
+    notifications: { webhooks: [{ url: `http://127.0.0.1:${webhook.address().port}/hook` }] },
+    simulation: {
+      devices: [
+        { ip: '192.0.2.10', name: 'Demo', mac: 'dc:a6:32:00:00:10', latencyMs: 10 },
+        { ip: '192.0.2.11', name: 'Copias', method: 'beacon', latencyMs: 20 }
+      ]
+    }
+  }));
+  received = [];
+});
+
+afterEach(() => {
+  fs.rmSync(home, { recursive: true, force: true });
+});
+
+const storedFiles = () => fs.readdirSync(home).filter((name) => name !== 'config.json');
+
+describe('--simulate', () => {
+  test('a scan finds the simulated devices and saves nothing', async () => {
+    const { stdout } = await runCli(['--simulate', '--output', 'json']);
+    expect(JSON.parse(stdout).map((device) => device.ip)).toEqual(['192.0.2.10', '192.0.2.11']);
+    expect(storedFiles()).not.toContain('scan-history.json');
+    expect(storedFiles()).not.toContain('inventory.json');
+  });
+
+  test('watch prints the events but sends no notification', async () => {
+    const { stdout } = await runCli(['watch', '--simulate', '--interval', '5', '--output', 'json'], /192\.0\.2\.11/);
+    const events = stdout.trim().split('\n').map((line) => JSON.parse(line));
+    expect(events.map((event) => event.type)).toEqual(['discovered', 'discovered']);
+    expect(received).toEqual([]);
+    expect(storedFiles()).not.toContain('scan-history.json');
+    expect(storedFiles()).not.toContain('inventory.json');
+  });
+});
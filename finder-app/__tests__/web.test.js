@@ -0,0 +1,449 @@
+/**
+ * HomePiNAS Finder - Web Server Tests
+ * Authentication, DNS-rebinding and CSRF protection of serve, and its Home Assistant ingress mode
+ */
+
+const crypto = require('crypto');
+const { EventEmitter } = require('events');
+const http = require('http');
+const os = require('os');
+const { createWebAuth, startWebServer } = require('../src/web');
+
+const TOKEN = 'test-token';
+let server;
+let base;
+// Scan of the fake API: pending until the test calls finishScan(devices)
+let scanning = null;
+let finishScan;
+// Scan events of the fake API, as serve emits them
+const scanEvents = new EventEmitter();
+let cancelled = 0;
+
+// Raw WebSocket client: resolves with { send(object), next() } or the refused HTTP response
+function openSocket(path, headers = {}) {
+  return new Promise((resolve, reject) => {
+    const req = http.request(`${base}${path}`, {
+      headers: {
+        Connection: 'Upgrade',
+        Upgrade: 'websocket',
+        'Sec-WebSocket-Version': '13',
+        'Sec-WebSocket-Key': crypto.randomBytes(16).toString('base64'),
+        ...headers
+      }
+    });
+    req.on('response', (res) => resolve({ status: res.statusCode }));
+    req.on('upgrade', (res, socket, head) => {
+      let buffer = Buffer.alloc(0);
+      const queue = [];
+      const waiting = [];
+      const onData = (chunk) => {
+        buffer = Buffer.concat([buffer, chunk]);
+        // Server frames: unmasked, under 64 KiB in these tests
+        for (;;) {
+          if (buffer.length < 2) break;
+          const extended = (buffer[1] & 0x7f) === 126;
+          if (extended && buffer.length < 4) break;
+          const offset = extended ? 4 : 2;
+          const length = extended ? buffer.readUInt16BE(2) : buffer[1] & 0x7f;
+          if (buffer.length < offset + length) break;
+          const message = JSON.parse(buffer.subarray(offset, offset + length).toString());
+          buffer = buffer.subarray(offset + length);
+          if (waiting.length > 0) waiting.shift()(message);
+          else queue.push(message);
+        }
+      };
+      socket.on('data', onData);
+      onData(head);
+      resolve({
+        status: res.statusCode,
+        next: () => (queue.length > 0 ? Promise.resolve(queue.shift()) : new Promise((done) => waiting.push(done))),
+        send: (object) => {
+          const payload = Buffer.from(JSON.stringify(object));
+          const mask = crypto.randomBytes(4);
+          socket.write(Buffer.concat([Buffer.from([0x81, 0x80 | payload.length]), mask, payload.map((byte, i) => byte ^ mask[i % 4])]));
+        },
+        close: () => socket.destroy()
+      });
+    });
+    req.on('error', reject);
+    req.end();
+  });
+}
+
+// Raw request: fetch would not let the tests forge the Host header
+function request(path, { method = 'GET', headers = {}, body, to = base } = {}) {
+  return new Promise((resolve, reject) => {
+    const req = http.request(`${to}${path}`, { method, headers }, (res) => {
+      let body = '';
+      res.on('data', (chunk) => { body += chunk; });
+      res.on('end', () => resolve({ status: res.statusCode, headers: res.headers, body }));
+    });
+    req.on('error', reject);
+    req.end(body);
+  });
+}
+
+const bearer = { Authorization: `Bearer ${TOKEN}` };
+
+async function login() {
+  const res = await request(`/login?token=${TOKEN}`);
+  const cookie = res.headers['set-cookie'][0].split(';')[0];
+  const page = await request('/', { headers: { Cookie: cookie } });
+  const csrf = page.body.match(/name="csrf-token" content="([0-9a-f]+)"/)[1];
+  return { cookie, csrf };
+}
+
+beforeAll(async () => {
+  server = await startWebServer({
+    host: '127.0.0.1',
+    port: 0,
+    auth: createWebAuth({ token: TOKEN }),
+    allowedHosts: ['finder.home.lan'],
+    api: {
+      status: () => ({
+        running: Boolean(scanning),
+        found: 0,
+        progress: { probed: 1, total: 4, methods: {}, subnets: [{ range: '192.168.1.0/30', probed: 1, total: 2, found: 0 }] }
+      }),
+      scan: () => (scanning ??= new Promise((resolve) => { finishScan = resolve; }).finally(() => { scanning = null; })),
+      events: scanEvents,
+      history: () => [{ id: 2, found: 1 }, { id: 1, found: 1 }],
+      diff: (from, to) => {
+        if (from === '7') throw Object.assign(new Error('No existe el escaneo 7'), { status: 404 });
+        return { from, to, appeared: [], vanished: [], moved: [{ ip: '192.168.1.12', previousIp: '192.168.1.10' }], updated: [] };
+      },
+      audit: (filter) => [{ action: 'wake', device: '192.168.1.10', client: 'web', result: 'ok', filter }],
+      cancel: () => {
+        cancelled += 1;
+        return Boolean(scanning);
+      },
+      devices: ({ tag } = {}) => [
+        { id: 'a1', ip: '192.168.1.10', name: 'pinas', alias: 'Salón', version: '2.4.1', online: true, tags: ['backup', 'casa'] },
+        { id: 'b2', ip: 'fd00::20', name: 'copias', online: false }
+      ].filter((device) => !tag || (device.tags || []).includes(tag)),
+      stats: () => ({ scans: [] }),
+      diagnose: async (host) => ({ host }),
+      update: async (id, changes) => {
+        if (id !== 'a1') throw Object.assign(new Error(`Dispositivo desconocido: ${id}`), { status: 404 });
+        if (changes.ip) throw Object.assign(new Error('Campo no editable: ip'), { status: 400 });
+        return { id, ip: '192.168.1.10', ...changes };
+      },
+      details: async (ip) => {
+        if (ip !== '192.168.1.10') throw Object.assign(new Error(`${ip} no está en el inventario`), { status: 404 });
+        return { ip, infoError: '', ports: [{ port: 443, service: 'https', state: 'open' }] };
+      },
+      wake: async (id) => {
+        if (id !== 'b2') throw Object.assign(new Error(`Dispositivo desconocido: ${id}`), { status: 404 });
+        return ['192.168.1.255'];
+      },
+      register: async (registration, ip) => {
+        if (registration.signature !== 'ok') throw Object.assign(new Error('Firma no válida'), { status: 401 });
+        return { id: 'a1', ip, keyPin: 'match' };
+      }
+    }
+  });
+  base = `http://127.0.0.1:${server.address().port}`;
+});
+
+afterAll(() => {
+  server.closeAllConnections();
+  server.close();
+});
+
+describe('startWebServer', () => {
+  test('requires authentication', async () => {
+    expect((await request('/api/devices')).status).toBe(401);
+    expect((await request('/api/devices', { headers: bearer })).status).toBe(200);
+    // Probes stay open
+    expect((await request('/healthz')).status).toBe(200);
+  });
+
+  test('rejects unknown Host names', async () => {
+    const rebound = await request('/api/devices', { headers: { ...bearer, Host: 'evil.example.com' } });
+    expect(rebound.status).toBe(421);
+    expect((await request('/api/devices', { headers: { ...bearer, Host: 'finder.home.lan:8088' } })).status).toBe(200);
+    expect((await request('/api/devices', { headers: { ...bearer, Host: 'localhost:8088' } })).status).toBe(200);
+    expect((await request('/api/devices', { headers: { ...bearer, Host: '[::1]:8088' } })).status).toBe(200);
+  });
+
+  test('rejects /api calls from another origin', async () => {
+    const res = await request('/api/devices', { headers: { ...bearer, Origin: 'https://evil.example.com' } });
+    expect(res.status).toBe(403);
+  });
+
+  test('requires the page token with a session cookie', async () => {
+    const { cookie, csrf } = await login();
+    expect((await request('/api/devices', { headers: { Cookie: cookie } })).status).toBe(403);
+    expect((await request('/api/devices', { headers: { Cookie: cookie, 'X-CSRF-Token': 'wrong' } })).status).toBe(403);
+    const res = await request('/api/devices', { headers: { Cookie: cookie, 'X-CSRF-Token': csrf } });
+    expect(res.status).toBe(200);
+    expect(JSON.parse(res.body).devices).toHaveLength(2);
+  });
+
+  test('gives each session its own page token', async () => {
+    const first = await login();
+    const second = await login();
+    expect(first.csrf).not.toBe(second.csrf);
+    const crossed = await request('/api/devices', { headers: { Cookie: first.cookie, 'X-CSRF-Token': second.csrf } });
+    expect(crossed.status).toBe(403);
+  });
+
+  test('lists the inventory as Prometheus http_sd targets', async () => {
+    const res = await request('/api/prometheus/sd', { headers: bearer });
+    expect(res.status).toBe(200);
+    expect(JSON.parse(res.body)).toEqual([
+      {
+        targets: ['192.168.1.10:9100'],
+        labels: {
+          __meta_homepinas_id: 'a1',
+          __meta_homepinas_name: 'Salón',
+          __meta_homepinas_version: '2.4.1',
+          __meta_homepinas_online: 'true',
+          __meta_homepinas_tags: ',backup,casa,'
+        }
+      },
+      {
+        targets: ['[fd00::20]:9100'],
+        labels: { __meta_homepinas_id: 'b2', __meta_homepinas_name: 'copias', __meta_homepinas_online: 'false' }
+      }
+    ]);
+  });
+
+  test('scrapes another port when asked', async () => {
+    const res = await request('/api/prometheus/sd?port=9633', { headers: bearer });
+    expect(JSON.parse(res.body)[0].targets).toEqual(['192.168.1.10:9633']);
+    expect((await request('/api/prometheus/sd?port=99999', { headers: bearer })).status).toBe(400);
+  });
+
+  test('runs scans in the background', async () => {
+    const started = await request('/api/scans', { method: 'POST', headers: bearer });
+    expect(started.status).toBe(202);
+    const job = JSON.parse(started.body);
+    expect(job.state).toBe('running');
+    expect(started.headers.location).toBe(`/api/scans/${job.id}`);
+
+    // A second client joins the same scan
+    const joined = JSON.parse((await request('/api/scans', { method: 'POST', headers: bearer })).body);
+    expect(joined.id).toBe(job.id);
+
+    const status = JSON.parse((await request(`/api/scans/${job.id}`, { headers: bearer })).body);
+    expect(status.progress).toMatchObject({ probed: 1, total: 4 });
+    expect((await request(`/api/scans/${job.id}/results`, { headers: bearer })).status).toBe(409);
+
+    finishScan([{ ip: '192.168.1.10' }]);
+    await new Promise((resolve) => setImmediate(resolve));
+    const results = await request(`/api/scans/${job.id}/results`, { headers: bearer });
+    expect(results.status).toBe(200);
+    expect(JSON.parse(results.body)).toMatchObject({ id: job.id, state: 'done', devices: [{ ip: '192.168.1.10' }] });
+  });
+
+  test('lets a NAS register itself without the token', async () => {
+    const res = await request('/api/register', { method: 'POST', body: JSON.stringify({ signature: 'ok' }) });
+    expect(res.status).toBe(200);
+    expect(JSON.parse(res.body)).toEqual({ id: 'a1', keyPin: 'match' });
+    expect((await request('/api/register', { method: 'POST', body: '{"signature":"bad"}' })).status).toBe(401);
+    expect((await request('/api/register', { method: 'POST', body: 'not json' })).status).toBe(400);
+    expect((await request('/api/register', { method: 'POST', body: 'x'.repeat(5000) })).status).toBe(413);
+  });
+
+  test('wakes a device of the inventory behind the page token', async () => {
+    const { cookie, csrf } = await login();
+    expect((await request('/api/devices/b2/wake', { method: 'POST', headers: { Cookie: cookie } })).status).toBe(403);
+    const res = await request('/api/devices/b2/wake', { method: 'POST', headers: { Cookie: cookie, 'X-CSRF-Token': csrf } });
+    expect(res.status).toBe(200);
+    expect(JSON.parse(res.body)).toEqual({ sent: ['192.168.1.255'] });
+    expect((await request('/api/devices/zz/wake', { method: 'POST', headers: bearer })).status).toBe(404);
+  });
+
+  test('filters the devices by tag', async () => {
+    const tagged = JSON.parse((await request('/api/devices?tag=backup', { headers: bearer })).body).devices;
+    expect(tagged.map((device) => device.id)).toEqual(['a1']);
+    expect(JSON.parse((await request('/api/devices?tag=', { headers: bearer })).body).devices).toHaveLength(2);
+  });
+
+  test('probes the details of an inventory device by its IP', async () => {
+    const res = await request('/api/devices/192.168.1.10/details', { headers: bearer });
+    expect(res.status).toBe(200);
+    expect(JSON.parse(res.body)).toMatchObject({ ip: '192.168.1.10', ports: [{ port: 443, state: 'open' }] });
+    expect((await request('/api/devices/10.9.9.9/details', { headers: bearer })).status).toBe(404);
+    expect((await request('/api/devices/evil.example.com/details', { headers: bearer })).status).toBe(404);
+  });
+
+  test('edits the user fields of a device behind the page token', async () => {
+    const { cookie, csrf } = await login();
+    const body = JSON.stringify({ alias: 'Oficina', tags: ['copias'] });
+    expect((await request('/api/devices/a1', { method: 'PATCH', headers: { Cookie: cookie }, body })).status).toBe(403);
+    const res = await request('/api/devices/a1', { method: 'PATCH', headers: { Cookie: cookie, 'X-CSRF-Token': csrf }, body });
+    expect(res.status).toBe(200);
+    expect(JSON.parse(res.body)).toMatchObject({ id: 'a1', alias: 'Oficina', tags: ['copias'] });
+    expect((await request('/api/devices/a1', { method: 'PATCH', headers: bearer, body: '{"ip":"10.0.0.1"}' })).status).toBe(400);
+    expect((await request('/api/devices/a1', { method: 'PATCH', headers: bearer, body: '["alias"]' })).status).toBe(400);
+    expect((await request('/api/devices/zz', { method: 'PATCH', headers: bearer, body })).status).toBe(404);
+    expect((await request('/api/devices/a1', { method: 'PATCH', body })).status).toBe(401);
+  });
+
+  test('serves the page files with an ETag and answers 304 when unchanged', async () => {
+    const script = await request('/app.js', { headers: bearer });
+    expect(script.status).toBe(200);
+    expect(script.headers['cache-control']).toBe('private, no-cache');
+    const cached = await request('/app.js', { headers: { ...bearer, 'If-None-Match': script.headers.etag } });
+    expect(cached.status).toBe(304);
+    expect(cached.body).toBe('');
+  });
+
+  test('ties the ETag of the page to its CSRF token', async () => {
+    const first = await login();
+    const second = await login();
+    const page = await request('/', { headers: { Cookie: first.cookie } });
+    expect((await request('/', { headers: { Cookie: first.cookie, 'If-None-Match': page.headers.etag } })).status).toBe(304);
+    const other = await request('/', { headers: { Cookie: second.cookie, 'If-None-Match': page.headers.etag } });
+    expect(other.status).toBe(200);
+    expect(other.body).toContain(second.csrf);
+  });
+
+  test('does not start without the page files', async () => {
+    const start = startWebServer({ host: '127.0.0.1', port: 0, auth: createWebAuth({ token: TOKEN }), api: {}, webDir: os.tmpdir() });
+    await expect(start).rejects.toThrow('Falta index.html');
+  });
+
+  test('opens /ws only with the same checks as /api', async () => {
+    expect((await openSocket('/ws')).status).toBe(401);
+    expect((await openSocket('/ws', { ...bearer, Origin: 'https://evil.example.com' })).status).toBe(403);
+    expect((await openSocket('/ws', { ...bearer, Host: 'evil.example.com' })).status).toBe(421);
+    const { cookie, csrf } = await login();
+    expect((await openSocket('/ws', { Cookie: cookie })).status).toBe(403);
+    const socket = await openSocket(`/ws?csrf=${csrf}`, { Cookie: cookie });
+    expect(socket.status).toBe(101);
+    socket.close();
+    expect((await request('/ws', { headers: bearer })).status).toBe(426);
+  });
+
+  test('starts, follows and cancels scans over /ws', async () => {
+    const socket = await openSocket('/ws', bearer);
+    expect(await socket.next()).toMatchObject({ type: 'status', running: false });
+
+    // Each unknown message gets an error back: the server has read everything before it
+    socket.send({ type: 'start-scan' });
+    socket.send({ type: 'reboot' });
+    expect(await socket.next()).toEqual({ type: 'error', error: 'Mensaje desconocido: reboot' });
+    expect(scanning).not.toBeNull();
+    scanEvents.emit('device-found', { ip: '192.168.1.30' });
+    expect(await socket.next()).toEqual({ type: 'device-found', device: { ip: '192.168.1.30' } });
+
+    socket.send({ type: 'cancel-scan' });
+    socket.send({ type: 'reboot' });
+    await socket.next();
+    expect(cancelled).toBe(1);
+    finishScan([]);
+    scanEvents.emit('scan-finished', { state: 'cancelled', found: 0 });
+    expect(await socket.next()).toEqual({ type: 'scan-finished', state: 'cancelled', found: 0 });
+    socket.close();
+  });
+
+  test('lists the audit log with its filters', async () => {
+    expect((await request('/api/audit')).status).toBe(401);
+    const res = await request('/api/audit?device=192.168.1.10&action=wake&since=2026-01-01T00:00:00Z&limit=5&unknown=x', { headers: bearer });
+    expect(res.status).toBe(200);
+    expect(JSON.parse(res.body).entries[0].filter).toEqual({
+      device: '192.168.1.10', action: 'wake', since: '2026-01-01T00:00:00Z', limit: 5
+    });
+    expect((await request('/api/audit?limit=0', { headers: bearer })).status).toBe(400);
+    expect((await request('/api/audit?since=yesterday', { headers: bearer })).status).toBe(400);
+  });
+
+  test('reports the progress of the scan per subnet', async () => {
+    const res = await request('/api/scan/progress', { headers: bearer });
+    expect(res.status).toBe(200);
+    expect(JSON.parse(res.body)).toMatchObject({
+      running: false, found: 0, probed: 1, total: 4,
+      subnets: [{ range: '192.168.1.0/30', probed: 1, total: 2 }]
+    });
+  });
+
+  test('lists saved scans and compares two of them', async () => {
+    expect(JSON.parse((await request('/api/scans/history', { headers: bearer })).body).scans).toHaveLength(2);
+    const latest = JSON.parse((await request('/api/scans/diff', { headers: bearer })).body);
+    expect(latest).toMatchObject({ from: 'previous', to: 'latest', moved: [{ previousIp: '192.168.1.10' }] });
+    expect(JSON.parse((await request('/api/scans/diff?from=1&to=2', { headers: bearer })).body)).toMatchObject({ from: '1', to: '2' });
+    expect((await request('/api/scans/diff?from=7', { headers: bearer })).status).toBe(404);
+    expect((await request('/api/scans/diff?from=../x', { headers: bearer })).status).toBe(400);
+  });
+
+  test('answers 404 for unknown scans', async () => {
+    const res = await request('/api/scans/00000000-0000-4000-8000-000000000000', { headers: bearer });
+    expect(res.status).toBe(404);
+  });
+});
+
+describe('startWebServer as a Home Assistant add-on', () => {
+  const INGRESS = { 'X-Ingress-Path': '/api/hassio_ingress/abc123', 'X-Forwarded-Host': 'ha.local:8123' };
+  const servers = [];
+
+  // The tests connect from 127.0.0.1: with that proxy address every request comes through ingress
+  async function startAddon(proxy) {
+    const addon = await startWebServer({
+      host: '127.0.0.1',
+      port: 0,
+      auth: createWebAuth({ token: TOKEN }),
+      ingress: { proxy },
+      api: {
+        status: () => ({ running: false, found: 0 }),
+        scan: () => new Promise(() => {}),
+        devices: () => [{ id: 'a1', ip: '192.168.1.10', name: 'pinas', online: true }],
+        stats: () => ({ scans: [] }),
+        register: async (registration, ip) => ({ id: 'a1', ip, keyPin: 'new' })
+      }
+    });
+    servers.push(addon);
+    return `http://127.0.0.1:${addon.address().port}`;
+  }
+
+  afterAll(() => {
+    for (const addon of servers) {
+      addon.closeAllConnections();
+      addon.close();
+    }
+  });
+
+  test('trusts the ingress proxy but still requires the page token', async () => {
+    const to = await startAddon('127.0.0.1');
+    const page = await request('/', { headers: INGRESS, to });
+    expect(page.status).toBe(200);
+    // Home Assistant shows the page inside an iframe of its own origin
+    expect(page.headers['content-security-policy']).toContain("frame-ancestors 'self'");
+    expect(page.body).toContain('<script src="app.js">');
+    const csrf = page.body.match(/name="csrf-token" content="([0-9a-f]+)"/)[1];
+
+    expect((await request('/api/devices', { headers: INGRESS, to })).status).toBe(403);
+    const res = await request('/api/devices', { headers: { ...INGRESS, 'X-CSRF-Token': csrf }, to });
+    expect(res.status).toBe(200);
+    expect(JSON.parse(res.body).devices).toHaveLength(1);
+  });
+
+  test('checks Origin against the Home Assistant host', async () => {
+    const to = await startAddon('127.0.0.1');
+    const csrf = (await request('/', { headers: INGRESS, to })).body.match(/content="([0-9a-f]+)"/)[1];
+    const headers = { ...INGRESS, 'X-CSRF-Token': csrf };
+    expect((await request('/api/devices', { headers: { ...headers, Origin: 'http://ha.local:8123' }, to })).status).toBe(200);
+    expect((await request('/api/devices', { headers: { ...headers, Origin: 'https://evil.example.com' }, to })).status).toBe(403);
+  });
+
+  test('prefixes redirects with the ingress path', async () => {
+    const to = await startAddon('127.0.0.1');
+    const csrf = (await request('/', { headers: INGRESS, to })).body.match(/content="([0-9a-f]+)"/)[1];
+    const headers = { ...INGRESS, 'X-CSRF-Token': csrf };
+    const started = await request('/api/scans', { method: 'POST', headers, to });
+    expect(started.headers.location).toBe(`/api/hassio_ingress/abc123/api/scans/${JSON.parse(started.body).id}`);
+    const openapi = JSON.parse((await request('/api/openapi.json', { headers, to })).body);
+    expect(openapi.servers).toEqual([{ url: '/api/hassio_ingress/abc123/' }]);
+  });
+
+  test('rejects requests that do not come through ingress', async () => {
+    const to = await startAddon('172.30.32.2');
+    expect((await request('/', { to })).status).toBe(403);
+    expect((await request('/api/devices', { headers: bearer, to })).status).toBe(403);
+    expect((await request('/healthz', { to })).status).toBe(200);
+    // NAS registrations come straight from the LAN
+    expect((await request('/api/register', { method: 'POST', body: '{}', to })).status).toBe(200);
+  });
+});
@@ -0,0 +1,56 @@
+/**
+ * HomePiNAS Finder - WebSocket Tests
+ * Frames of the minimal RFC 6455 server behind /ws
+ */
+
+const crypto = require('crypto');
+const { encodeFrame, decodeFrame, MAX_MESSAGE } = require('../src/websocket');
+
+// Client frame: always masked
+function clientFrame(opcode, text, { fin = true, mask = true } = {}) {
+  const payload = Buffer.from(text, 'utf8');
+  const key = crypto.randomBytes(4);
+  const masked = Buffer.from(payload.map((byte, i) => byte ^ key[i % 4]));
+  let header;
+  if (payload.length < 126) {
+    header = Buffer.from([(fin ? 0x80 : 0) | opcode, (mask ? 0x80 : 0) | payload.length]);
+  } else {
+    header = Buffer.from([(fin ? 0x80 : 0) | opcode, (mask ? 0x80 : 0) | 126, 0, 0]);
+    header.writeUInt16BE(payload.length, 2);
+  }
+  return Buffer.concat([header, ...(mask ? [key, masked] : [payload])]);
+}
+
+describe('encodeFrame', () => {
+  test('writes short and extended lengths', () => {
+    expect([...encodeFrame(1, Buffer.from('hi'))]).toEqual([0x81, 2, 0x68, 0x69]);
+    const long = encodeFrame(1, Buffer.alloc(300));
+    expect(long[1]).toBe(126);
+    expect(long.readUInt16BE(2)).toBe(300);
+    expect(long).toHaveLength(304);
+  });
+});
+
+describe('decodeFrame', () => {
+  test('unmasks a client text frame', () => {
+    const frame = clientFrame(1, '{"type":"start-scan"}');
+    const decoded = decodeFrame(frame);
+    expect(decoded.opcode).toBe(1);
+    expect(decoded.payload.toString()).toBe('{"type":"start-scan"}');
+    expect(decoded.size).toBe(frame.length);
+  });
+
+  test('waits for the whole frame', () => {
+    const frame = clientFrame(1, 'x'.repeat(200));
+    expect(decodeFrame(frame.subarray(0, 1))).toBeNull();
+    expect(decodeFrame(frame.subarray(0, 3))).toBeNull();
+    expect(decodeFrame(frame.subarray(0, frame.length - 1))).toBeNull();
+    expect(decodeFrame(Buffer.concat([frame, clientFrame(9, '')])).size).toBe(frame.length);
+  });
+
+  test('rejects unmasked, fragmented and oversized frames', () => {
+    expect(() => decodeFrame(clientFrame(1, 'hi', { mask: false }))).toThrow('sin máscara');
+    expect(() => decodeFrame(clientFrame(1, 'hi', { fin: false }))).toThrow('fragmentados');
+    expect(() => decodeFrame(clientFrame(1, 'x'.repeat(MAX_MESSAGE + 1)))).toThrow('demasiado grande');
+  });
+});
@@ -0,0 +1,71 @@
+/**
+ * Responder de referencia del beacon UDP (docs/beacon-protocol.md)
+ *
+ *   node scripts/beacon-responder.js --key /etc/homepinas/beacon.key \
+ *     --name "HomePiNAS salón" --version 2.2.0 --scheme https --port 3001
+ *
+ * La clave Ed25519 se genera (0600) la primera vez si no existe
+ */
+const crypto = require('crypto');
+const dgram = require('dgram');
+const fs = require('fs');
+const os = require('os');
+const { BEACON_PORT, BEACON_GROUP, parseProbe, signReply } = require('../src/beacon');
+const { isPrivateAddress } = require('../src/netutil');
+
+// Una respuesta por origen y segundo: evita usar el NAS como amplificador
+const REPLY_INTERVAL = 1000;
+
+function option(name, fallback) {
+  const index = process.argv.indexOf(`--${name}`);
+  return index !== -1 ? process.argv[index + 1] : fallback;
+}
+
+function loadKey(file) {
+  try {
+    return crypto.createPrivateKey(fs.readFileSync(file));
+  } catch (err) {
+    if (err.code !== 'ENOENT') throw err;
+    const { privateKey } = crypto.generateKeyPairSync('ed25519');
+    fs.writeFileSync(file, privateKey.export({ type: 'pkcs8', format: 'pem' }), { mode: 0o600 });
+    console.log(`[Beacon] Clave nueva en ${file}`);
+    return privateKey;
+  }
+}
+
+const privateKey = loadKey(option('key', 'beacon.key'));
+const fields = {
+  name: option('name', os.hostname()),
+  hostname: option('hostname', `${os.hostname()}.local`),
+  version: option('version', ''),
+  scheme: option('scheme', 'https'),
+  port: Number.parseInt(option('port', '443'), 10)
+};
+
+const lastReply = new Map();
+const socket = dgram.createSocket({ type: 'udp4', reuseAddr: true });
+
+socket.on('message', (packet, rinfo) => {
+  const nonce = parseProbe(packet);
+  if (!nonce || !isPrivateAddress(rinfo.address)) return;
+
+  const now = Date.now();
+  if (now - (lastReply.get(rinfo.address) || 0) < REPLY_INTERVAL) return;
+  lastReply.set(rinfo.address, now);
+
+  socket.send(signReply(fields, nonce, privateKey), rinfo.port, rinfo.address);
+});
+
+socket.bind(BEACON_PORT, () => {
+  for (const ifaces of Object.values(os.networkInterfaces())) {
+    for (const iface of ifaces) {
+      if (iface.family !== 'IPv4' || iface.internal) continue;
+      try {
+        socket.addMembership(BEACON_GROUP, iface.address);
+      } catch (err) {
+        console.warn(`[Beacon] Sin multicast en ${iface.address}: ${err.message}`);
+      }
+    }
+  }
+  console.log(`[Beacon] Escuchando en UDP ${BEACON_PORT} (${BEACON_GROUP})`);
+});
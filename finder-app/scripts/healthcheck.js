@@ -0,0 +1,30 @@
+/**
+ * HEALTHCHECK del contenedor: GET /healthz del serve que está corriendo
+ * La URL (http o https, puerto) sale de serve.lock, así que vale con cualquier --listen
+ * Sale con 0 si responde 200
+ */
+const fs = require('fs');
+const http = require('http');
+const https = require('https');
+const path = require('path');
+const { getConfigDir } = require('../src/config');
+
+let url;
+try {
+  url = new URL('healthz', JSON.parse(fs.readFileSync(path.join(getConfigDir(), 'serve.lock'), 'utf8')).url);
+} catch (err) {
+  console.error(`[Health] serve no está corriendo: ${err.message}`);
+  process.exit(1);
+}
+
+// El certificado autofirmado es para la red: aquí solo importa que responda
+const client = url.protocol === 'https:' ? https : http;
+const req = client.get(url, { rejectUnauthorized: false, timeout: 5000 }, (res) => {
+  res.resume();
+  process.exit(res.statusCode === 200 ? 0 : 1);
+});
+req.on('timeout', () => req.destroy(new Error('sin respuesta')));
+req.on('error', (err) => {
+  console.error(`[Health] ${url.href}: ${err.message}`);
+  process.exit(1);
+});
@@ -0,0 +1,133 @@
+/**
+ * Cliente de referencia del registro de un NAS en el Finder (docs/register-protocol.md)
+ * Pensado para lanzarse al arrancar y al cambiar de red (systemd, dispatcher de NetworkManager)
+ *
+ *   node scripts/register-nas.js --key /etc/homepinas/beacon.key \
+ *     --name "HomePiNAS salón" --version 2.2.0 --scheme https --port 3001 [--finder https://192.168.1.10:8088]
+ *
+ * Sin --finder busca los Finder anunciados por mDNS (_homepinas-finder._tcp) y se registra
+ * en todos. La clave es la del beacon (scripts/beacon-responder.js)
+ */
+const crypto = require('crypto');
+const dgram = require('dgram');
+const fs = require('fs');
+const http = require('http');
+const https = require('https');
+const os = require('os');
+const multicastDns = require('multicast-dns');
+const { signRegistration } = require('../src/register');
+const { SERVICE_TYPE, REGISTER_PATH } = require('../src/advertise');
+const { urlHost } = require('../src/netutil');
+
+const BROWSE_TIME = 3000;
+const REQUEST_TIMEOUT = 10000;
+
+function option(name, fallback) {
+  const index = process.argv.indexOf(`--${name}`);
+  return index !== -1 ? process.argv[index + 1] : fallback;
+}
+
+/**
+ * Finder anunciados por mDNS: [{ url, fingerprint }]
+ */
+function browseFinders() {
+  return new Promise((resolve) => {
+    const mdns = multicastDns();
+    const records = [];
+    mdns.on('response', (response) => records.push(...response.answers, ...response.additionals));
+    mdns.query({ questions: [{ name: SERVICE_TYPE, type: 'PTR' }] });
+
+    setTimeout(() => {
+      mdns.destroy();
+      const finders = new Map();
+      for (const ptr of records.filter((record) => record.type === 'PTR' && record.name === SERVICE_TYPE)) {
+        const srv = records.find((record) => record.type === 'SRV' && record.name === ptr.data);
+        const a = srv && records.find((record) => record.type === 'A' && record.name === srv.data.target);
+        const txt = records.find((record) => record.type === 'TXT' && record.name === ptr.data);
+        if (!a) continue;
+        const fields = Object.fromEntries((txt?.data || []).map((entry) => String(entry).split(/=(.*)/s)));
+        const url = `${fields.scheme === 'http' ? 'http' : 'https'}://${urlHost(a.data)}:${srv.data.port}${fields.path || REGISTER_PATH}`;
+        finders.set(url, { url, fingerprint: fields.fingerprint || null });
+      }
+      resolve([...finders.values()]);
+    }, BROWSE_TIME);
+  });
+}
+
+/**
+ * IP local con la que se llega a `host` (la que verá el Finder como origen)
+ */
+function localAddressFor(host) {
+  return new Promise((resolve, reject) => {
+    const socket = dgram.createSocket(host.includes(':') ? 'udp6' : 'udp4');
+    socket.connect(9, host, (err) => {
+      if (err) return reject(err);
+      const { address } = socket.address();
+      socket.close();
+      resolve(address);
+    });
+  });
+}
+
+/**
+ * POST del registro; con HTTPS solo se acepta el certificado con la huella anunciada
+ * (el del Finder es autofirmado). Sin huella, el de --finder se acepta tal cual
+ */
+function post({ url, fingerprint }, body) {
+  return new Promise((resolve, reject) => {
+    const target = new URL(url);
+    const client = target.protocol === 'http:' ? http : https;
+    const payload = JSON.stringify(body);
+    const req = client.request(target, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json', 'Content-Length': Buffer.byteLength(payload) },
+      timeout: REQUEST_TIMEOUT,
+      rejectUnauthorized: false,
+      checkServerIdentity: (host, cert) => (fingerprint && cert.fingerprint256 !== fingerprint
+        ? new Error(`Huella del certificado distinta de la anunciada: ${cert.fingerprint256}`)
+        : undefined)
+    }, (res) => {
+      let text = '';
+      res.on('data', (chunk) => { text += chunk; });
+      res.on('end', () => resolve({ status: res.statusCode, body: text }));
+    });
+    req.on('timeout', () => req.destroy(new Error('timeout')));
+    req.on('error', reject);
+    req.end(payload);
+  });
+}
+
+async function main() {
+  const privateKey = crypto.createPrivateKey(fs.readFileSync(option('key', 'beacon.key')));
+  const fields = {
+    name: option('name', os.hostname()),
+    hostname: option('hostname', `${os.hostname()}.local`),
+    version: option('version', ''),
+    scheme: option('scheme', 'https'),
+    port: Number.parseInt(option('port', '443'), 10)
+  };
+
+  const explicit = option('finder', null);
+  const finders = explicit
+    ? [{ url: new URL(REGISTER_PATH, explicit).toString(), fingerprint: null }]
+    : await browseFinders();
+  if (finders.length === 0) {
+    console.log('[Register] Ningún Finder anunciado en la red');
+    return;
+  }
+
+  for (const finder of finders) {
+    try {
+      const ip = await localAddressFor(new URL(finder.url).hostname.replace(/^\[|\]$/g, ''));
+      const { status, body } = await post(finder, signRegistration({ ...fields, ip }, privateKey));
+      console.log(`[Register] ${finder.url}: ${status} ${body}`);
+    } catch (err) {
+      console.warn(`[Register] ${finder.url}: ${err.message}`);
+    }
+  }
+}
+
+main().catch((err) => {
+  console.error(`[Register] ${err.message}`);
+  process.exitCode = 1;
+});
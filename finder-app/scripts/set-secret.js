@@ -0,0 +1,32 @@
+/**
+ * Guarda un secreto en el llavero del sistema (o cifrado en fichero): npm run secret -- <nombre>
+ * El valor se lee de la entrada estándar para que no quede en el historial
+ * Con --delete se elimina
+ */
+const { openSecretStore } = require('../src/secrets');
+
+const [name, flag] = process.argv.slice(2);
+if (!name) {
+  console.error('Uso: npm run secret -- <nombre> [--delete]');
+  process.exit(1);
+}
+
+const store = openSecretStore();
+
+if (flag === '--delete') {
+  store.delete(name);
+  console.log(`[Secrets] ${name} eliminado`);
+  process.exit(0);
+}
+
+if (process.stdin.isTTY) {
+  process.stdout.write(`Valor de ${name}: `);
+}
+
+let value = '';
+process.stdin.setEncoding('utf8');
+process.stdin.on('data', (chunk) => { value += chunk; });
+process.stdin.on('end', () => {
+  store.set(name, value.replace(/\r?\n$/, ''));
+  console.log(`[Secrets] ${name} guardado (${store.backend})`);
+});
@@ -0,0 +1,8 @@
+/**
+ * Genera src/integrity.json antes de empaquetar (npm run build*)
+ */
+const path = require('path');
+const { writeManifest } = require('../src/integrity');
+
+const count = writeManifest(path.join(__dirname, '..', 'src'));
+console.log(`[Integrity] Manifiesto generado con ${count} ficheros`);
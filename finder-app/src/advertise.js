@@ -0,0 +1,76 @@
+/**
+ * Anuncio mDNS del propio Finder mientras corre serve: _homepinas-finder._tcp, para que los
+ * NAS de la red encuentren dónde registrarse (POST /api/register, ver register.js) sin
+ * configurar nada. Cada interfaz anuncia su propia dirección
+ */
+const os = require('os');
+const multicastDns = require('multicast-dns');
+const log = require('./log');
+const { toHostName } = require('./hosts-file');
+const { answerQuestion, proxyAddresses } = require('./mdns-proxy');
+
+const SERVICE_TYPE = '_homepinas-finder._tcp.local';
+const REGISTER_PATH = '/api/register';
+const HOST_TTL = 120;
+const SERVICE_TTL = 4500;
+
+/**
+ * Registros DNS-SD del Finder en `address`; TXT: versión del protocolo de registro, ruta,
+ * esquema y, con HTTPS, la huella del certificado (para que el NAS la fije)
+ */
+function finderRecords(address, { port, scheme, fingerprint256 = null }) {
+  const label = toHostName(os.hostname()) || 'homepinas-finder';
+  const host = `${label}.local`;
+  const instance = `HomePiNAS Finder (${label}).${SERVICE_TYPE}`;
+  const txt = ['v=1', `path=${REGISTER_PATH}`, `scheme=${scheme}`]
+    .concat(fingerprint256 ? [`fingerprint=${fingerprint256}`] : []);
+
+  return {
+    host,
+    type: SERVICE_TYPE,
+    instance,
+    a: { name: host, type: 'A', ttl: HOST_TTL, data: address },
+    ptr: { name: SERVICE_TYPE, type: 'PTR', ttl: SERVICE_TTL, data: instance },
+    srv: { name: instance, type: 'SRV', ttl: HOST_TTL, data: { port, target: host, priority: 0, weight: 0 } },
+    txt: { name: instance, type: 'TXT', ttl: SERVICE_TTL, data: txt }
+  };
+}
+
+/**
+ * Anuncia el Finder escuchando en `listen` ({ host, port }); con un host concreto solo en
+ * esa interfaz. null si solo escucha en loopback: ningún NAS llegaría
+ */
+function advertiseFinder(listen, { scheme, fingerprint256 } = {}) {
+  const everywhere = listen.host === '0.0.0.0' || listen.host === '::';
+  const addresses = proxyAddresses().filter((address) => everywhere || address === listen.host);
+  if (addresses.length === 0) return null;
+
+  const responders = addresses.map((address) => {
+    const entries = [finderRecords(address, { port: listen.port, scheme, fingerprint256 })];
+    const mdns = multicastDns({ interface: address, reuseAddr: true, loopback: true });
+
+    mdns.on('query', (query) => {
+      const response = { answers: [], additionals: [] };
+      for (const question of query.questions) {
+        const { answers, additionals } = answerQuestion(question, entries);
+        response.answers.push(...answers);
+        response.additionals.push(...additionals);
+      }
+      if (response.answers.length > 0) mdns.respond(response);
+    });
+    mdns.on('error', (err) => log.warn(`[mDNS] ${address}: ${err.message}`));
+    // Anuncio no solicitado al arrancar: los NAS que ya escuchan no tienen que preguntar
+    const [entry] = entries;
+    mdns.respond({ answers: [entry.ptr, entry.srv, entry.txt, entry.a] });
+    return mdns;
+  });
+
+  return {
+    addresses,
+    stop() {
+      for (const mdns of responders) mdns.destroy();
+    }
+  };
+}
+
+module.exports = { SERVICE_TYPE, REGISTER_PATH, finderRecords, advertiseFinder };
@@ -0,0 +1,79 @@
+const fs = require('fs');
+const path = require('path');
+const log = require('./log');
+const { getConfigDir } = require('./config');
+
+const AUDIT_FILE = 'audit.log';
+
+function auditPath() {
+  return path.join(getConfigDir(), AUDIT_FILE);
+}
+
+/**
+ * Añade una entrada al registro de auditoría (JSON por línea, solo append)
+ */
+function recordAction({ action, device, client, result, error }) {
+  const entry = {
+    timestamp: new Date().toISOString(),
+    action,
+    device,
+    client,
+    result
+  };
+  if (error) entry.error = error;
+
+  try {
+    fs.mkdirSync(getConfigDir(), { recursive: true });
+    fs.appendFileSync(auditPath(), JSON.stringify(entry) + '\n', { mode: 0o600 });
+  } catch (err) {
+    log.warn(`[Audit] No se pudo registrar ${action}: ${err.message}`);
+  }
+}
+
+/**
+ * Ejecuta una acción sobre un dispositivo dejando constancia del resultado
+ */
+async function auditAction(action, device, client, fn) {
+  try {
+    const value = await fn();
+    recordAction({ action, device, client, result: 'ok' });
+    return value;
+  } catch (err) {
+    recordAction({ action, device, client, result: 'error', error: err.message });
+    throw err;
+  }
+}
+
+/**
+ * Últimas `limit` entradas del registro; `device`, `action`, `client` y `result` dejan solo
+ * las que coinciden y `since` (ISO 8601) las de ese momento en adelante
+ */
+function readAudit({ device, action, client, result, since, limit = 100 } = {}) {
+  let lines;
+  try {
+    lines = fs.readFileSync(auditPath(), 'utf8').split('\n');
+  } catch (err) {
+    if (err.code === 'ENOENT') return [];
+    throw err;
+  }
+
+  const from = since ? Date.parse(since) : null;
+  const wanted = { device, action, client, result };
+  const matches = (entry) => Object.entries(wanted).every(([field, value]) => !value || entry[field] === value) &&
+    (from === null || Date.parse(entry.timestamp) >= from);
+
+  const entries = [];
+  for (const line of lines) {
+    if (!line) continue;
+    try {
+      const entry = JSON.parse(line);
+      if (matches(entry)) entries.push(entry);
+    } catch {
+      // Línea truncada (p. ej. cierre abrupto): se ignora
+    }
+  }
+
+  return entries.slice(-limit);
+}
+
+module.exports = { recordAction, auditAction, readAudit };
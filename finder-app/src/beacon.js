@@ -0,0 +1,89 @@
+const crypto = require('crypto');
+
+// Protocolo de descubrimiento por UDP, ver docs/beacon-protocol.md
+const BEACON_PORT = 47474;
+const BEACON_GROUP = '239.255.74.74';
+const PROBE_MAGIC = 'HOMEPINAS-DISCOVER';
+const REPLY_MAGIC = 'HOMEPINAS';
+const PROTOCOL_VERSION = 1;
+const MAX_REPLY_SIZE = 2048;
+
+/**
+ * Paquete de sondeo: "HOMEPINAS-DISCOVER 1 <nonce>\n"
+ */
+function createProbe(nonce) {
+  return Buffer.from(`${PROBE_MAGIC} ${PROTOCOL_VERSION} ${nonce}\n`, 'ascii');
+}
+
+/**
+ * Nonce de un paquete de sondeo, o null si no lo es
+ */
+function parseProbe(packet) {
+  const match = packet.toString('ascii').match(/^HOMEPINAS-DISCOVER 1 ([0-9a-f]{32})\n?$/);
+  return match ? match[1] : null;
+}
+
+/**
+ * Serialización canónica que se firma: claves ordenadas, sin espacios y sin `signature`
+ */
+function canonicalPayload(reply) {
+  const fields = Object.keys(reply).filter((key) => key !== 'signature').sort();
+  return JSON.stringify(fields.reduce((acc, key) => ({ ...acc, [key]: reply[key] }), {}));
+}
+
+/**
+ * Respuesta firmada con la clave Ed25519 del NAS (lado responder)
+ */
+function signReply(fields, nonce, privateKey) {
+  const publicKey = crypto.createPublicKey(privateKey).export({ type: 'spki', format: 'der' });
+  const reply = {
+    ...fields,
+    magic: REPLY_MAGIC,
+    v: PROTOCOL_VERSION,
+    nonce,
+    publicKey: publicKey.toString('base64')
+  };
+  reply.signature = crypto.sign(null, Buffer.from(canonicalPayload(reply)), privateKey).toString('base64');
+  return Buffer.from(JSON.stringify(reply));
+}
+
+/**
+ * Valida una respuesta: formato, nonce de nuestro sondeo y firma
+ * Devuelve { reply, keyFingerprint } o null
+ */
+function verifyReply(packet, nonce) {
+  if (packet.length > MAX_REPLY_SIZE) return null;
+
+  let reply;
+  try {
+    reply = JSON.parse(packet.toString('utf8'));
+  } catch {
+    return null;
+  }
+  if (reply?.magic !== REPLY_MAGIC || reply.v !== PROTOCOL_VERSION || reply.nonce !== nonce) return null;
+  if (typeof reply.publicKey !== 'string' || typeof reply.signature !== 'string') return null;
+
+  try {
+    const der = Buffer.from(reply.publicKey, 'base64');
+    const key = crypto.createPublicKey({ key: der, format: 'der', type: 'spki' });
+    if (key.asymmetricKeyType !== 'ed25519') return null;
+
+    const valid = crypto.verify(null, Buffer.from(canonicalPayload(reply)), key, Buffer.from(reply.signature, 'base64'));
+    if (!valid) return null;
+
+    const digest = crypto.createHash('sha256').update(der).digest('hex').toUpperCase();
+    return { reply, keyFingerprint: digest.match(/../g).join(':') };
+  } catch {
+    return null;
+  }
+}
+
+module.exports = {
+  BEACON_PORT,
+  BEACON_GROUP,
+  createProbe,
+  parseProbe,
+  canonicalPayload,
+  signReply,
+  verifyReply
+};
@@ -0,0 +1,220 @@
+/**
+ * Captura pasiva de mDNS y SSDP para el paquete de soporte (doctor --capture):
+ * escucha los grupos multicast unos segundos y anota quién anuncia qué, para ver si
+ * los equipos de la red (el NAS incluido) anuncian algo o si no llega nada
+ *
+ * Se guarda saneada: se conservan tipos de servicio, tipos de registro, puertos e IPs
+ * privadas; nombres de equipos, IPs públicas, IPv6 (pueden llevar la MAC), UUID y
+ * valores TXT se sustituyen por un seudónimo (mismo valor → mismo seudónimo, con una
+ * sal distinta en cada captura)
+ */
+const crypto = require('crypto');
+const dgram = require('dgram');
+const net = require('net');
+const multicastDns = require('multicast-dns');
+const { getLocalInterfaces } = require('./scanner');
+const { isPrivateAddress } = require('./netutil');
+
+const SSDP_GROUP = '239.255.255.250';
+const SSDP_PORT = 1900;
+const MAX_CAPTURE_SECONDS = 300;
+const MAX_EVENTS = 2000;
+// El mismo paquete llega por cada interfaz unida al grupo
+const DUPLICATE_WINDOW = 1000;
+// Cabeceras SSDP que se conservan; el resto (cookies, ids propios del fabricante) se descarta
+const SSDP_HEADERS = ['nt', 'nts', 'st', 'man', 'server', 'user-agent', 'cache-control', 'usn', 'location'];
+const HOMEPINAS_NAME = /(home)?pinas/i;
+
+function createSanitizer() {
+  const salt = crypto.randomBytes(16);
+  const pseudonym = (prefix, value) =>
+    `${prefix}-${crypto.createHash('sha256').update(salt).update(String(value).toLowerCase()).digest('hex').slice(0, 8)}`;
+
+  const ip = (address) => {
+    const plain = String(address).split('%')[0];
+    if (net.isIPv4(plain) && isPrivateAddress(plain)) return plain;
+    return pseudonym(net.isIPv6(plain) ? 'ipv6' : 'ip', plain);
+  };
+  // Etiquetas de servicio (_http._tcp), local, in-addr.arpa y las de HomePiNAS se quedan
+  const name = (value) => String(value).split('.').map((label) => (
+    !label || label.startsWith('_') || /^(local|arpa|in-addr|ip6|\d{1,3})$/i.test(label) || HOMEPINAS_NAME.test(label)
+      ? label
+      : pseudonym('h', label)
+  )).join('.');
+
+  const record = ({ name: recordName, type, data }) => {
+    const sanitized = { name: name(recordName), type };
+    if (type === 'A' || type === 'AAAA') sanitized.data = ip(data);
+    else if (type === 'PTR' || type === 'CNAME') sanitized.data = name(data);
+    else if (type === 'SRV' && data) sanitized.data = { port: data.port, target: name(data.target) };
+    else if (type === 'TXT' && Array.isArray(data)) {
+      // Solo las claves: los valores pueden llevar números de serie o nombres
+      sanitized.keys = data.map((entry) => String(entry).split('=')[0]).filter(Boolean);
+    }
+    return sanitized;
+  };
+
+  const ssdpHeader = (header, value) => {
+    if (header === 'usn') return value.replace(/uuid:[^:]+/i, (uuid) => `uuid:${pseudonym('u', uuid)}`);
+    if (header === 'location') {
+      try {
+        const url = new URL(value);
+        return `${url.protocol}//${ip(url.hostname.replace(/^\[|\]$/g, ''))}${url.port ? `:${url.port}` : ''}${url.pathname}`;
+      } catch {
+        return '';
+      }
+    }
+    return value;
+  };
+
+  return { ip, name, record, ssdpHeader };
+}
+
+/**
+ * Mensaje SSDP (NOTIFY, M-SEARCH o respuesta HTTP) → { kind, headers } o null
+ */
+function parseSsdp(message) {
+  const [first, ...lines] = String(message).split(/\r?\n/);
+  const kind = /^NOTIFY /i.test(first) ? 'notify' : /^M-SEARCH /i.test(first) ? 'search' : /^HTTP\/1\.[01] /i.test(first) ? 'response' : null;
+  if (!kind) return null;
+  const headers = {};
+  for (const line of lines) {
+    const separator = line.indexOf(':');
+    if (separator <= 0) continue;
+    headers[line.slice(0, separator).trim().toLowerCase()] = line.slice(separator + 1).trim();
+  }
+  return { kind, headers };
+}
+
+/**
+ * Una sesión mDNS por interfaz, solo escuchando (no pregunta nada)
+ */
+function listenMdns(address, record) {
+  const mdns = multicastDns({ ...(address ? { interface: address } : {}), reuseAddr: true, loopback: false });
+  mdns.on('query', (packet, rinfo) => record('mdns', 'query', rinfo.address, {
+    questions: (packet.questions || []).map(({ name, type }) => ({ name, type }))
+  }));
+  mdns.on('response', (packet, rinfo) => record('mdns', 'response', rinfo.address, {
+    answers: [...(packet.answers || []), ...(packet.additionals || [])]
+  }));
+  return mdns;
+}
+
+function listenSsdp(addresses, record, errors) {
+  const socket = dgram.createSocket({ type: 'udp4', reuseAddr: true });
+  socket.on('message', (message, rinfo) => {
+    const parsed = parseSsdp(message);
+    if (parsed) record('ssdp', parsed.kind, rinfo.address, { headers: parsed.headers });
+  });
+  socket.on('error', (err) => errors.push(`SSDP: ${err.message}`));
+  socket.bind(SSDP_PORT, () => {
+    for (const address of addresses.length > 0 ? addresses : [undefined]) {
+      try {
+        socket.addMembership(SSDP_GROUP, address);
+      } catch (err) {
+        errors.push(`SSDP ${address || 'por defecto'}: ${err.message}`);
+      }
+    }
+  });
+  return socket;
+}
+
+/**
+ * Escucha mDNS (5353) y SSDP (1900) durante `seconds` en todas las interfaces IPv4
+ * Devuelve { startedAt, seconds, interfaces, events, dropped, errors, summary }, ya saneado
+ */
+function captureMulticast({ seconds = 30, signal } = {}) {
+  const duration = Math.min(Math.max(Number(seconds) || 30, 1), MAX_CAPTURE_SECONDS);
+  const sanitize = createSanitizer();
+  const addresses = getLocalInterfaces().map(({ address }) => address);
+  const startedAt = Date.now();
+  const events = [];
+  const errors = [];
+  const recent = new Map();
+  let dropped = 0;
+
+  const record = (protocol, kind, source, packet) => {
+    const event = { t: Date.now() - startedAt, protocol, kind, source: sanitize.ip(source) };
+    if (packet.questions) event.questions = packet.questions.map(({ name, type }) => ({ name: sanitize.name(name), type }));
+    if (packet.answers) event.answers = packet.answers.map(sanitize.record);
+    if (packet.headers) {
+      event.headers = Object.fromEntries(SSDP_HEADERS
+        .filter((header) => packet.headers[header])
+        .map((header) => [header, sanitize.ssdpHeader(header, packet.headers[header])]));
+    }
+    const key = JSON.stringify({ ...event, t: 0 });
+    if (event.t - (recent.get(key) ?? -Infinity) < DUPLICATE_WINDOW) return;
+    recent.set(key, event.t);
+    if (events.length >= MAX_EVENTS) {
+      dropped++;
+      return;
+    }
+    events.push(event);
+  };
+
+  return new Promise((resolve) => {
+    const sockets = [];
+    for (const address of addresses.length > 0 ? addresses : [null]) {
+      try {
+        const mdns = listenMdns(address, record);
+        mdns.on('error', (err) => errors.push(`mDNS ${address || 'por defecto'}: ${err.message}`));
+        sockets.push(() => mdns.destroy());
+      } catch (err) {
+        errors.push(`mDNS ${address || 'por defecto'}: ${err.message}`);
+      }
+    }
+    try {
+      const ssdp = listenSsdp(addresses, record, errors);
+      sockets.push(() => ssdp.close());
+    } catch (err) {
+      errors.push(`SSDP: ${err.message}`);
+    }
+
+    const finish = () => {
+      clearTimeout(timer);
+      signal?.removeEventListener('abort', finish);
+      for (const close of sockets) {
+        try {
+          close();
+        } catch {
+          // Ya cerrado
+        }
+      }
+      resolve({
+        startedAt: new Date(startedAt).toISOString(),
+        seconds: Math.round((Date.now() - startedAt) / 1000),
+        interfaces: addresses.map(sanitize.ip),
+        events,
+        dropped,
+        errors,
+        summary: summarizeCapture(events)
+      });
+    };
+    const timer = setTimeout(finish, duration * 1000);
+    if (signal?.aborted) return finish();
+    signal?.addEventListener('abort', finish, { once: true });
+  });
+}
+
+/**
+ * Resumen de la captura: paquetes y equipos por protocolo, tipos de servicio anunciados
+ * y si algún anuncio es de un HomePiNAS
+ */
+function summarizeCapture(events) {
+  const summary = {};
+  for (const protocol of ['mdns', 'ssdp']) {
+    const own = events.filter((event) => event.protocol === protocol);
+    summary[protocol] = {
+      packets: own.length,
+      sources: new Set(own.map((event) => event.source)).size,
+      announcers: new Set(own.filter((event) => event.kind !== 'query' && event.kind !== 'search').map((event) => event.source)).size
+    };
+  }
+  const names = events.flatMap((event) => (event.answers || []).flatMap((answer) => [answer.name, typeof answer.data === 'string' ? answer.data : '']));
+  summary.services = [...new Set(names.map((name) => name.match(/(_[^.]+\._(tcp|udp))\.local$/i)?.[1]).filter(Boolean))].sort();
+  summary.homepinas = names.some((name) => HOMEPINAS_NAME.test(name)) ||
+    events.some((event) => event.headers && HOMEPINAS_NAME.test(Object.values(event.headers).join(' ')));
+  return summary;
+}
+
+module.exports = { captureMulticast, MAX_CAPTURE_SECONDS };
@@ -0,0 +1,29 @@
+const DAY = 24 * 60 * 60 * 1000;
+// Días antes de caducar a partir de los que se avisa para renovar el certificado
+const EXPIRY_WARNING_DAYS = 14;
+
+/**
+ * Resumen de un certificado TLS (getPeerCertificate) para mostrarlo al usuario:
+ * sujeto, nombres alternativos, emisor, validez y si caduca pronto
+ */
+function describeCertificate(cert, now = Date.now()) {
+  const validTo = new Date(cert.valid_to);
+  const daysLeft = Math.floor((validTo - now) / DAY);
+  return {
+    subject: cert.subject?.CN || '',
+    organization: cert.subject?.O || '',
+    altNames: (cert.subjectaltname || '')
+      .split(', ')
+      .filter(Boolean)
+      .map((name) => name.replace(/^(DNS|IP Address):/, '')),
+    issuer: cert.issuer?.CN || cert.issuer?.O || '',
+    selfSigned: JSON.stringify(cert.subject) === JSON.stringify(cert.issuer),
+    validFrom: new Date(cert.valid_from).toISOString(),
+    validTo: validTo.toISOString(),
+    daysLeft,
+    expiringSoon: daysLeft <= EXPIRY_WARNING_DAYS,
+    fingerprint256: cert.fingerprint256 || ''
+  };
+}
+
+module.exports = { describeCertificate, EXPIRY_WARNING_DAYS };
@@ -0,0 +1,982 @@
+#!/usr/bin/env node
+/**
+ * Finder sin interfaz: un escaneo y los dispositivos encontrados por stdout
+ * Los avisos van a stderr para poder encadenar la salida con jq, hojas de cálculo, etc.
+ *
+ *   homepinas-finder [--output table|json|csv|yaml] [--expect-host <host>] [--allow-public]
+ *                    [--stealth] [--arp-sweep] [--ping-sweep] [--profile-scan] [--simulate]
+ *   homepinas-finder watch [--interval <segundos>] [--output table|json] [--metrics [host:]puerto] [--event-log] [--syslog] ...
+ *   homepinas-finder history [--output table|json]
+ *   homepinas-finder diff [<desde> [<hasta>]] [--output table|json]
+ *   homepinas-finder inventory [--tag <etiqueta>] [--output table|json]
+ *   homepinas-finder doctor [<host>] [--output table|json] [--capture <segundos>]
+ *   homepinas-finder wake <host>
+ *   homepinas-finder details <host> [--output table|json]
+ *   homepinas-finder pair <host>
+ *   homepinas-finder reboot|shutdown|update <host>
+ *   homepinas-finder service install|uninstall|status [-- <opciones de watch>]
+ *   homepinas-finder serve [--listen [host:]puerto] [--port <puerto>] [--tls | --no-tls] [--no-browser] [--print-url] [--container]
+ *                          [--debug] [--syslog]
+ *
+ * En todos: --log-level debug|info|warn|error y --log-format text|json (una línea JSON por aviso)
+ *
+ * Códigos de salida (ver EXIT): pensados para scripts de aprovisionamiento
+ */
+const crypto = require('crypto');
+const { EventEmitter } = require('events');
+const net = require('net');
+const os = require('os');
+const { setTimeout: sleep } = require('timers/promises');
+const log = require('./log');
+const { LEVELS, LOG_FORMATS, configureLogging } = log;
+const { scanNetwork, getScanStatus, getScanStats, getScanTrace } = require('./scanner');
+const { DEFAULTS, loadConfig } = require('./config');
+const { verifyManifest } = require('./integrity');
+const { formatProfile } = require('./profile');
+const { openTrustStore } = require('./trust-store');
+const { buildScanOptions, openNotifierSecrets, attachLogSinks } = require('./scan-options');
+const { createNotifier } = require('./notify');
+const { createAvailabilityTracker } = require('./events');
+const {
+  FORMATS, WATCH_FORMATS, HISTORY_FORMATS,
+  formatDevices, formatEvent, formatHistory, formatDiff, formatInventory, formatDetails, formatDoctor, formatDiagnosis
+} = require('./output');
+const { openHistory, diffScans } = require('./history');
+const { openInventory } = require('./inventory');
+const { wakeOnLan } = require('./wol');
+const { auditAction, readAudit } = require('./audit');
+const { probeDetails } = require('./details');
+const { openSecretStore } = require('./secrets');
+const { ACTIONS, requestPairing, waitForApproval, manageDevice, storePairing, pairingToken, forgetPairing } = require('./pairing');
+const { createMetrics, parseListen, startMetricsServer } = require('./metrics');
+const { createWebAuth, startWebServer, DEFAULT_PORT: WEB_PORT } = require('./web');
+const { loadWebTls } = require('./web-tls');
+const { acquireLock, openBrowser } = require('./instance-lock');
+const { getServiceBackend, serviceCommand } = require('./service');
+const { containerWarnings } = require('./container');
+const { isAddon, createSupervisorPublisher } = require('./hassio');
+const { createRegistrar } = require('./register');
+const { advertiseFinder, SERVICE_TYPE, REGISTER_PATH } = require('./advertise');
+const { createRuntimeMonitor } = require('./runtime');
+const { runDoctor } = require('./doctor');
+const { diagnoseHost } = require('./diagnose');
+const { captureMulticast, MAX_CAPTURE_SECONDS } = require('./capture');
+const { writeSupportBundle } = require('./support');
+const { createRefreshPlanner } = require('./refresh');
+
+const FLAGS = {
+  '--allow-public': 'allowPublic',
+  '--stealth': 'stealth',
+  '--arp-sweep': 'arpSweep',
+  '--ping-sweep': 'pingSweep',
+  '--profile-scan': 'profile',
+  '--simulate': 'simulate'
+};
+
+const EXIT = {
+  FOUND: 0, // al menos un HomePiNAS (y todos los de --expect-host)
+  NOT_FOUND: 1, // ninguno, o falta alguno de --expect-host
+  ERROR: 2, // error del escaneo u opciones no válidas
+  INTERRUPTED: 130 // Ctrl+C: resultado parcial
+};
+
+// Modo watch: segundos entre escaneos
+const DEFAULT_INTERVAL = 60;
+const MIN_INTERVAL = 5;
+
+// Secretos de la interfaz web de serve
+const WEB_TOKEN_SECRET = 'web.token';
+const WEB_PASSWORD_SECRET = 'web.password';
+
+const COMMANDS = [
+  'watch', 'serve', 'service', 'history', 'diff', 'inventory', 'doctor', 'wake', 'details', 'pair', ...Object.keys(ACTIONS)
+];
+const SERVICE_ACTIONS = ['install', 'uninstall', 'status'];
+// Comandos sobre un NAS concreto: su único argumento posicional es obligatorio
+const HOST_COMMANDS = ['wake', 'details', 'pair', ...Object.keys(ACTIONS)];
+// Argumentos posicionales que admite cada comando
+const MAX_REFS = { diff: 2, service: 1, doctor: 1, ...Object.fromEntries(HOST_COMMANDS.map((command) => [command, 1])) };
+
+const USAGE = `Uso: homepinas-finder [watch | serve | history | diff [desde] [hasta] | inventory | doctor [host] | wake <host> |
+                        details <host> | pair <host> | reboot|shutdown|update <host> |
+                        service install|uninstall|status [-- <opciones de watch>]] [opciones]
+
+  watch                   Reescanear periódicamente y mostrar solo los cambios
+                          (aparece, desaparece, cambia de IP o de versión)
+  serve                   Interfaz web con los NAS y un botón de escanear, para el móvil
+                          o la tablet (exige el token que se muestra al arrancar)
+  history                 Escaneos guardados (los escaneos completos de la app y de la CLI)
+  diff [desde] [hasta]    NAS que aparecen, desaparecen o cambian de IP o versión entre dos
+                          escaneos (ids de history, "latest" o "previous"; por defecto los dos últimos)
+  inventory               Todos los NAS vistos alguna vez, con sus alias, etiquetas y notas
+  doctor                  Comprueba lo que suele impedir encontrar un NAS (interfaces, multicast,
+                          resolución de pinas.local, conexiones al 443, cortafuegos) y dice qué hacer
+  doctor <host>           Por qué no aparece un NAS concreto (IP o hostname): dirección, ARP, puerto,
+                          TLS, API y detector, parando en la primera etapa que falla
+  wake <host>             Despierta con Wake-on-LAN un NAS del inventario (IP, hostname,
+                          nombre o alias)
+  details <host>          Sondeo ampliado de un NAS (del inventario o por IP): info completa,
+                          puertos abiertos, certificado TLS y latencia
+  pair <host>             Empareja un NAS del inventario: muestra un código que hay que
+                          aprobar en el NAS (Sistema → Dispositivos emparejados)
+  reboot|shutdown|update <host>
+                          Reinicia, apaga o actualiza un NAS emparejado
+  service install|uninstall|status
+                          Instala (o quita) watch como servicio (en Windows, del SCM y como
+                          administrador), que arranca solo y se reinicia si cae; lo que va tras -- son sus opciones
+                          (p. ej. service install -- --interval 300 --metrics 9464)
+  -o, --output <formato>  ${FORMATS.join(', ')} (por defecto table; en el resto de comandos: ${WATCH_FORMATS.join(', ')})
+  -i, --interval <seg>    Segundos entre escaneos en watch y en el complemento de Home Assistant
+                          (por defecto ${DEFAULT_INTERVAL})
+  --metrics <[host:]port> En watch, métricas de Prometheus en http://host:port/metrics
+                          (por defecto solo en 127.0.0.1)
+  --event-log             En watch, los eventos y los avisos (desde warn) también al registro de eventos
+                          de Windows (equivale a eventLog.enabled; lo usa el servicio)
+  --syslog                En watch y serve, el registro (desde info) y los eventos también a syslog
+                          (equivale a syslog.enabled con syslog.logs; servidor en config.json)
+  --listen <[host:]port>  En serve, dónde escucha la interfaz web (por defecto 127.0.0.1:${WEB_PORT};
+                          0.0.0.0:${WEB_PORT} para abrirla desde otros equipos de la red)
+  -p, --port <puerto>     En serve, el puerto (con el host de --listen o 127.0.0.1)
+  --tls, --no-tls         En serve, fuerza o desactiva HTTPS (por defecto solo fuera de localhost,
+                          con un certificado autofirmado o el de web.certFile/web.keyFile)
+  --no-browser            En serve, no abre el navegador al arrancar (máquinas sin escritorio)
+  --print-url             En serve, escribe en stdout el enlace de acceso (con el token) para scripts
+  --container             En serve, modo Docker: escucha en 0.0.0.0, no abre el navegador, escanea
+                          al arrancar (/readyz responde 200 al terminar) y avisa si la red es bridge.
+                          Como complemento de Home Assistant (SUPERVISOR_TOKEN), solo por ingress y
+                          sin HTTPS, con las opciones del complemento y los NAS publicados en Home Assistant
+  --debug                 En serve, anota por qué se acepta o descarta cada host y lo sirve en
+                          /api/debug/trace[?ip=<ip>] (para adjuntarlo al informar de un NAS que no aparece);
+                          también /api/debug/runtime (sockets, descriptores, sondeos en vuelo),
+                          /api/debug/cpu-profile?seconds=<n> y /api/debug/heap-snapshot
+  --capture <seg>         En doctor, escucha además mDNS y SSDP durante esos segundos (máx. ${MAX_CAPTURE_SECONDS}) y
+                          guarda un paquete de soporte saneado (homepinas-finder-support-*.json) para adjuntarlo
+                          a una incidencia: muestra si los equipos de la red anuncian algo
+  -e, --expect-host <h>   Falla (código 1) si no aparece este NAS: IP, hostname o nombre.
+                          Se puede repetir
+  -t, --tag <etiqueta>    En inventory, solo los NAS con esta etiqueta
+  --allow-public          Barrer también subredes con IPs públicas
+  --stealth               Escaneo lento y aleatorio
+  --arp-sweep             Barrido ARP activo antes del TCP
+  --ping-sweep            Ping a la subred antes del TCP
+  --profile-scan          Desglose de tiempos en stderr
+  --simulate              Escaneo, watch y serve con una red simulada (simulation.devices en config.json
+                          o unos de ejemplo, con latencias y fallos): no toca la red
+  --log-level <nivel>     Avisos en stderr a partir de: ${Object.keys(LEVELS).join(', ')} (por defecto info)
+  --log-format <formato>  ${LOG_FORMATS.join(', ')}; json escribe una línea por aviso (time, level, scope, msg)
+                          para journald, Loki, Elasticsearch...
+  -h, --help              Esta ayuda
+
+Códigos de salida: ${EXIT.FOUND} = encontrado, ${EXIT.NOT_FOUND} = ninguno o falta un --expect-host
+(en doctor, alguna comprobación o etapa falla), ${EXIT.ERROR} = error, ${EXIT.INTERRUPTED} = interrumpido
+`;
+
+/**
+ * Argumentos de línea de comandos: { command, refs, output, interval, metrics, eventLog, syslog, listen, port, tls,
+ * browser, printUrl, container, debug, capture, expectHosts, tag, serviceArgs, logLevel, logFormat, flags, help }
+ * Acepta "--output json" y "--output=json"
+ */
+function parseArgs(argv) {
+  const args = {
+    command: 'scan',
+    refs: [],
+    output: 'table',
+    interval: DEFAULT_INTERVAL,
+    metrics: null,
+    eventLog: false,
+    syslog: false,
+    listen: null,
+    port: null,
+    tls: null,
+    browser: true,
+    printUrl: false,
+    container: false,
+    debug: false,
+    capture: null,
+    expectHosts: [],
+    tag: null,
+    serviceArgs: [],
+    logLevel: 'info',
+    logFormat: 'text',
+    flags: {},
+    help: false
+  };
+  const rest = [...argv];
+  if (COMMANDS.includes(rest[0])) {
+    args.command = rest.shift();
+  }
+
+  for (let i = 0; i < rest.length; i++) {
+    const [name, inline] = rest[i].split(/=(.*)/s);
+    if (rest[i] === '--' && args.command === 'service') {
+      args.serviceArgs = rest.slice(i + 1);
+      break;
+    }
+    if (name === '-o' || name === '--output') {
+      args.output = inline ?? rest[++i];
+    } else if (name === '-i' || name === '--interval') {
+      args.interval = Number(inline ?? rest[++i]);
+      if (!Number.isFinite(args.interval) || args.interval < MIN_INTERVAL) {
+        throw new Error(`Intervalo no válido: mínimo ${MIN_INTERVAL} segundos`);
+      }
+    } else if (name === '--metrics') {
+      args.metrics = parseListen(inline ?? rest[++i]);
+    } else if (name === '--event-log') {
+      args.eventLog = true;
+    } else if (name === '--syslog') {
+      args.syslog = true;
+    } else if (name === '--listen') {
+      args.listen = parseListen(inline ?? rest[++i]);
+    } else if (name === '-p' || name === '--port') {
+      const value = inline ?? rest[++i];
+      args.port = /^\d+$/.test(value ?? '') ? Number(value) : NaN;
+      if (!(args.port >= 1 && args.port <= 65535)) throw new Error(`Puerto no válido: ${value}`);
+    } else if (name === '--tls' || name === '--no-tls') {
+      args.tls = name === '--tls';
+    } else if (name === '--no-browser') {
+      args.browser = false;
+    } else if (name === '--print-url') {
+      args.printUrl = true;
+    } else if (name === '--container') {
+      args.container = true;
+      args.browser = false;
+    } else if (name === '--debug') {
+      args.debug = true;
+    } else if (name === '--capture') {
+      args.capture = Number(inline ?? rest[++i]);
+      if (!Number.isInteger(args.capture) || args.capture < 1 || args.capture > MAX_CAPTURE_SECONDS) {
+        throw new Error(`Duración de --capture no válida: de 1 a ${MAX_CAPTURE_SECONDS} segundos`);
+      }
+    } else if (name === '-e' || name === '--expect-host') {
+      const host = inline ?? rest[++i];
+      if (!host) throw new Error('Falta el host de --expect-host');
+      args.expectHosts.push(host);
+    } else if (name === '-t' || name === '--tag') {
+      args.tag = inline ?? rest[++i];
+      if (!args.tag) throw new Error('Falta la etiqueta de --tag');
+    } else if (name === '--log-level') {
+      args.logLevel = inline ?? rest[++i];
+      if (!Object.hasOwn(LEVELS, args.logLevel)) throw new Error(`Nivel de registro no válido: ${args.logLevel}`);
+    } else if (name === '--log-format') {
+      args.logFormat = inline ?? rest[++i];
+      if (!LOG_FORMATS.includes(args.logFormat)) throw new Error(`Formato de registro no válido: ${args.logFormat}`);
+    } else if (name === '-h' || name === '--help') {
+      args.help = true;
+    } else if (FLAGS[name]) {
+      args.flags[FLAGS[name]] = true;
+    } else if (!name.startsWith('-') && args.refs.length < (MAX_REFS[args.command] || 0)) {
+      args.refs.push(name);
+    } else {
+      throw new Error(`Opción desconocida: ${rest[i]}`);
+    }
+  }
+
+  if (args.command !== 'scan' && args.expectHosts.length > 0) {
+    throw new Error('--expect-host solo tiene sentido en un escaneo');
+  }
+  if (args.command !== 'watch' && (args.metrics || args.eventLog)) {
+    throw new Error('--metrics y --event-log solo están disponibles en modo watch');
+  }
+  if (args.eventLog && process.platform !== 'win32') {
+    throw new Error('--event-log solo está disponible en Windows');
+  }
+  if (args.command !== 'serve' && (args.listen || args.port || args.tls !== null || !args.browser || args.printUrl || args.container || args.debug)) {
+    throw new Error('--listen, --port, --tls, --no-tls, --no-browser, --print-url, --container y --debug solo están disponibles en serve');
+  }
+  if (args.command !== 'doctor' && args.capture) {
+    throw new Error('--capture solo está disponible en doctor');
+  }
+  if (args.syslog && args.command !== 'watch' && args.command !== 'serve') {
+    throw new Error('--syslog solo está disponible en watch y serve');
+  }
+  if (args.flags.simulate && !['scan', 'watch', 'serve'].includes(args.command)) {
+    throw new Error('--simulate solo está disponible en el escaneo, watch y serve');
+  }
+  if (args.command !== 'inventory' && args.tag) {
+    throw new Error('--tag solo está disponible en inventory');
+  }
+  if (HOST_COMMANDS.includes(args.command) && args.refs.length === 0) {
+    throw new Error(`Falta el NAS (${args.command} <host>)`);
+  }
+  if (args.command === 'service') {
+    if (!SERVICE_ACTIONS.includes(args.refs[0])) throw new Error(`Falta la acción (service ${SERVICE_ACTIONS.join('|')})`);
+    // Las opciones del servicio se comprueban ya, no cuando arranque
+    if (args.serviceArgs.length > 0) parseArgs(['watch', ...args.serviceArgs]);
+  }
+  const formats = args.command === 'scan' ? FORMATS : args.command === 'watch' ? WATCH_FORMATS : HISTORY_FORMATS;
+  if (!formats.includes(args.output)) throw new Error(`Formato de salida no válido: ${args.output}`);
+  return args;
+}
+
+/**
+ * ¿Es este dispositivo el host indicado? Por IP (cualquiera de sus direcciones),
+ * hostname (con o sin .local) o nombre, sin distinguir mayúsculas
+ */
+function matchesHost(device, host) {
+  const wanted = host.toLowerCase().replace(/\.local$/, '');
+  const addresses = (device.addresses || [device.ip]).map((ip) => ip.split('%')[0].toLowerCase());
+  const hostname = (device.hostname || '').toLowerCase().replace(/\.local$/, '');
+  return addresses.includes(host.toLowerCase()) ||
+    (hostname !== '' && hostname === wanted) ||
+    (device.name || '').toLowerCase() === host.toLowerCase();
+}
+
+/**
+ * NAS del inventario por `host` (como en matchesHost, o su alias)
+ * Con `anyIp` una IP que no está en el inventario se da por buena
+ */
+function findInventoryDevice(host, { anyIp = false } = {}) {
+  const matches = openInventory().list()
+    .filter((record) => matchesHost(record, host) || (record.alias || '').toLowerCase() === host.toLowerCase());
+  if (matches.length === 0 && anyIp && net.isIP(host)) return { ip: host };
+  if (matches.length !== 1) {
+    throw new Error(matches.length === 0
+      ? `${host} no está en el inventario (ver homepinas-finder inventory)`
+      : `${host} coincide con varios NAS: ${matches.map((record) => record.ip).join(', ')}`);
+  }
+  return matches[0];
+}
+
+/**
+ * Wake-on-LAN a un NAS del inventario
+ */
+async function wake(host) {
+  const record = findInventoryDevice(host);
+  if (!record.mac) throw new Error(`No se conoce la MAC de ${record.ip}`);
+
+  const { port, broadcast } = loadConfig().wakeOnLan;
+  const sent = await auditAction('wake', record.ip, 'cli', () => wakeOnLan(record.mac, { ip: record.ip, port, broadcast }));
+  log.info(`[CLI] Paquete Wake-on-LAN para ${record.mac} enviado a ${sent.join(', ')}`);
+}
+
+/**
+ * Opciones de conexión a la API de un NAS: certificado cliente y certificado fijado (TOFU)
+ */
+function apiOptions(record) {
+  const { clientCertFor } = buildScanOptions(loadConfig());
+  return { clientCert: clientCertFor(record.ip), pin: openTrustStore().get(record.ip)?.fingerprint256 };
+}
+
+/**
+ * Empareja un NAS del inventario y guarda su token en el almacén de secretos
+ */
+async function pair(host, signal) {
+  const record = findInventoryDevice(host);
+  const options = { ...apiOptions(record), signal };
+  const pairing = await requestPairing(record, options);
+  log.info(`[CLI] Código de emparejamiento: ${pairing.code}`);
+  log.info(`[CLI] Apruébalo en ${record.ip} (Sistema → Dispositivos emparejados); caduca en ${Math.round(pairing.expiresIn / 60)} min`);
+
+  const result = await waitForApproval(record, pairing, options);
+  const inventory = openInventory();
+  storePairing(openSecretStore(), inventory, record.id, result);
+  inventory.save();
+  log.info(`[CLI] ${record.ip} emparejado (${result.scopes.join(', ')})`);
+}
+
+/**
+ * Acción de gestión en un NAS emparejado; si el NAS revocó el token se olvida
+ */
+async function manage(host, action, signal) {
+  const record = findInventoryDevice(host);
+  const secrets = openSecretStore();
+
+  // Queda en audit.log como las de la ventana, con origen cli
+  await auditAction(action, record.ip, 'cli', async () => {
+    const token = record.paired && pairingToken(secrets, record.id);
+    if (!token) throw new Error(`${record.ip} no está emparejado (homepinas-finder pair ${host})`);
+    try {
+      await manageDevice(record, action, token, { ...apiOptions(record), signal });
+    } catch (err) {
+      if (err.revoked) {
+        const inventory = openInventory();
+        forgetPairing(secrets, inventory, record.id);
+        inventory.save();
+      }
+      throw err;
+    }
+  });
+  log.info(`[CLI] ${action} enviado a ${record.ip}`);
+}
+
+/**
+ * Un escaneo con la configuración actual (se relee en cada vuelta del modo watch)
+ */
+async function scanOnce(args, signal, overrides = {}) {
+  const trustStore = openTrustStore();
+  const devices = await scanNetwork({
+    ...buildScanOptions(loadConfig(), { ...args.flags, trace: args.debug }),
+    ...overrides,
+    signal,
+    trustStore
+  });
+
+  try {
+    trustStore.save();
+  } catch (err) {
+    log.warn(`[Trust] No se pudieron guardar los certificados: ${err.message}`);
+  }
+
+  const status = getScanStatus();
+  if (status.profile) log.info(formatProfile(status.profile), { profile: status.profile });
+  return devices;
+}
+
+/**
+ * Guarda el escaneo en el historial (solo los completos: uno parcial daría falsas desapariciones)
+ * El modo watch no guarda: llenaría el historial con un escaneo por minuto
+ */
+function saveSnapshot(devices, history = openHistory()) {
+  try {
+    history.add(devices, getScanStatus());
+    history.save();
+  } catch (err) {
+    log.warn(`[History] No se pudo guardar el escaneo: ${err.message}`);
+  }
+}
+
+/**
+ * config.json con --event-log y --syslog aplicados: activan el canal y, si config.json
+ * no dice otra cosa, los mensajes de registro (warn en el registro de eventos, info en syslog)
+ */
+function withLogFlags(config, args) {
+  if (args.eventLog) config.eventLog = { ...DEFAULTS.eventLog, ...config.eventLog, enabled: true, logs: config.eventLog?.logs || 'warn' };
+  if (args.syslog) config.syslog = { ...DEFAULTS.syslog, ...config.syslog, enabled: true, logs: config.syslog?.logs || 'info' };
+  return config;
+}
+
+/**
+ * Reparte los eventos entre los canales configurados (se relee config.json cada vez)
+ * Los de la red simulada no salen de la terminal
+ */
+async function publish(events, args) {
+  if (events.length === 0 || args.flags.simulate) return;
+  const config = withLogFlags(loadConfig(), args);
+  await createNotifier(config, openNotifierSecrets(config)).publish(events);
+}
+
+/**
+ * Reescanea cada `interval` segundos y escribe solo los eventos de disponibilidad
+ * El primer escaneo anuncia como `discovered` los NAS que ya están en la red
+ * Los eventos van también a los canales de `notifications` y `syslog`, como en la app
+ * Con `--metrics` se sirven además las métricas de Prometheus mientras dure
+ * Solo barre la subred cada `fullScanEvery` vueltas (ver refresh.js)
+ */
+async function watch(args, signal) {
+  const tracker = createAvailabilityTracker();
+  const metrics = args.metrics ? createMetrics() : null;
+  const server = metrics ? await startMetricsServer(metrics, args.metrics) : null;
+  if (server) log.info(`[Metrics] Escuchando en http://${args.metrics.host}:${args.metrics.port}/metrics`);
+  const refresh = createRefreshPlanner({ fullScanEvery: loadConfig().fullScanEvery });
+  let known = null; // NAS de la vuelta anterior: los que vuelve a comprobar una incremental
+
+  try {
+    while (!signal.aborted) {
+      const started = Date.now();
+      try {
+        const plan = await refresh.next(known);
+        const devices = await scanOnce(args, signal, plan.options);
+        metrics?.recordScan({ durationMs: Date.now() - started, status: getScanStatus(), devices });
+        // Un escaneo cortado por Ctrl+C es parcial: daría por desconectados NAS no sondeados
+        if (signal.aborted) break;
+        known = devices;
+        const events = tracker.update(devices);
+        for (const event of events) {
+          process.stdout.write(formatEvent(event, args.output));
+        }
+        await publish(events, args);
+      } catch (err) {
+        metrics?.recordScan({ durationMs: Date.now() - started, error: true });
+        log.error(`[CLI] Error en el escaneo: ${err.message}`);
+      }
+
+      try {
+        await sleep(args.interval * 1000, undefined, { signal });
+      } catch {
+        // Ctrl+C durante la espera
+      }
+    }
+  } finally {
+    server?.close();
+  }
+}
+
+/**
+ * ¿Solo se llega desde esta máquina? Entonces no hace falta HTTPS
+ */
+function isLoopback(host) {
+  return host === 'localhost' || host === '::1' || (net.isIPv4(host) && host.startsWith('127.'));
+}
+
+/**
+ * Direcciones con las que abrir la interfaz web desde otro equipo: la de escucha
+ * o, si escucha en todas, las IPv4 de la red local
+ */
+function webAddresses({ host, port }) {
+  if (host !== '0.0.0.0' && host !== '::') return [`${net.isIPv6(host) ? `[${host}]` : host}:${port}`];
+  return Object.values(os.networkInterfaces()).flat()
+    .filter((iface) => iface.family === 'IPv4' && !iface.internal)
+    .map((iface) => `${iface.address}:${port}`);
+}
+
+/**
+ * Interfaz web (ver web.js) hasta Ctrl+C; cada escaneo actualiza el inventario y el historial
+ * El token se genera la primera vez y se guarda en el almacén de secretos (web.token)
+ * Abierta a la red va por HTTPS: el token y la cookie no deben viajar en claro por una Wi-Fi compartida
+ * Si ya hay un serve corriendo con esta configuración, se abre el suyo en el navegador y se sale
+ * Como complemento de Home Assistant solo se llega por ingress, que habla HTTP con el servidor
+ */
+async function serve(args, signal) {
+  const { web } = loadConfig();
+  const addon = args.container && isAddon();
+  // En un contenedor solo se llega a través del puerto publicado: hay que escuchar en todas
+  const defaultHost = args.container ? '0.0.0.0' : '127.0.0.1';
+  const listen = { host: args.listen?.host ?? defaultHost, port: args.port ?? args.listen?.port ?? WEB_PORT };
+  const useTls = args.tls ?? (!addon && !isLoopback(listen.host));
+  const scheme = useTls ? 'https' : 'http';
+  // URL para esta misma máquina (el certificado autofirmado incluye localhost)
+  const host = listen.host === '0.0.0.0' || listen.host === '::' ? 'localhost' : listen.host;
+  const localUrl = `${scheme}://${net.isIPv6(host) ? `[${host}]` : host}:${listen.port}/`;
+
+  const secrets = openSecretStore();
+  const lock = acquireLock(localUrl);
+  if (!lock.acquired) {
+    log.info(`[Web] Ya hay un Finder sirviendo en ${lock.url} (pid ${lock.pid})`);
+    await announceUrl(lock.url, secrets.get(WEB_TOKEN_SECRET), args);
+    return;
+  }
+
+  try {
+    await runServer({ args, signal, secrets, web, listen, useTls, scheme, localUrl, addon });
+  } finally {
+    lock.release();
+  }
+}
+
+/**
+ * Enlace de acceso de esta máquina: a stdout con --print-url y al navegador salvo con --no-browser
+ */
+async function announceUrl(url, token, args) {
+  const link = token ? `${url}login?token=${token}` : url;
+  if (args.printUrl) process.stdout.write(`${link}\n`);
+  if (!args.browser) return;
+  try {
+    await openBrowser(link);
+  } catch (err) {
+    log.warn(`[Web] No se pudo abrir el navegador (${err.message}); en máquinas sin escritorio usa --no-browser`);
+  }
+}
+
+/**
+ * Arranca el servidor de serve y lo mantiene hasta que se aborta `signal`
+ */
+async function runServer({ args, signal, secrets, web, listen, useTls, scheme, localUrl, addon }) {
+  // Igual que la app de escritorio: con src/ alterado no se abre nada a la red
+  const { checked, problems } = verifyManifest(__dirname);
+  if (checked && problems.length > 0) {
+    throw new Error(`Ficheros de la aplicación alterados; reinstala el Finder:\n  ${problems.join('\n  ')}`);
+  }
+
+  let token = secrets.get(WEB_TOKEN_SECRET);
+  const generated = !token;
+  if (generated) {
+    token = crypto.randomBytes(24).toString('hex');
+    secrets.set(WEB_TOKEN_SECRET, token);
+  }
+  const auth = createWebAuth({ token, user: web.user, password: secrets.get(WEB_PASSWORD_SECRET) });
+
+  // Con --simulate el inventario y el historial solo viven en memoria: los NAS falsos
+  // no deben mezclarse con los de verdad ni dar por desconectados a estos
+  const simulated = args.flags.simulate ? { inventory: openInventory(null), history: openHistory(null) } : null;
+  const openStore = () => simulated?.inventory || openInventory();
+  // En Home Assistant cada escaneo publica los NAS como entidades (los simulados no)
+  const supervisor = addon && !simulated ? createSupervisorPublisher() : null;
+
+  // Altas de NAS sin escaneo (POST /api/register) y el anuncio mDNS que les dice dónde; no con --simulate
+  const config = loadConfig();
+  const registrar = simulated ? null : createRegistrar({
+    trustStore: openTrustStore(),
+    allowPublic: Boolean(args.flags.allowPublic || config.allowPublicSubnets),
+    exclude: config.exclude
+  });
+  const register = (registration, ip) => {
+    const device = registrar.register(registration, ip);
+    const inventory = openStore();
+    const id = inventory.record(device);
+    inventory.save();
+    supervisor?.publish(inventory.list());
+    log.info(`[Web] ${device.name} (${device.ip}) se ha registrado${device.keyPin === 'new' ? ' (clave fijada)' : ''}`);
+    return { ...inventory.get(id), keyPin: device.keyPin };
+  };
+
+  // Varias pestañas que piden escanear a la vez comparten el mismo escaneo; /ws lo sigue
+  // con scanEvents y lo puede cortar (cancelScan) sin parar el servidor
+  let scanning = null;
+  let scanController = null;
+  const scanEvents = new EventEmitter();
+  const scan = async (overrides) => {
+    const controller = new AbortController();
+    const stop = () => controller.abort();
+    signal.addEventListener('abort', stop, { once: true });
+    scanController = controller;
+    scanEvents.emit('scan-started');
+    let devices;
+    try {
+      devices = await scanOnce(args, controller.signal, {
+        ...overrides,
+        onDevice: (device) => scanEvents.emit('device-found', device),
+        onProgress: (progress) => scanEvents.emit('progress', progress)
+      });
+    } catch (err) {
+      scanEvents.emit('scan-finished', { state: 'failed', error: err.message });
+      throw err;
+    } finally {
+      signal.removeEventListener('abort', stop);
+      scanController = null;
+    }
+    if (signal.aborted) return devices;
+    const inventory = openStore();
+    // Cancelado: se apuntan los encontrados, pero solo uno completo da por desconectados a los demás
+    const cancelled = controller.signal.aborted;
+    if (cancelled) {
+      const taken = new Set();
+      for (const device of devices) device.id = inventory.record(device, taken);
+    } else {
+      inventory.finishScan(devices);
+    }
+    inventory.save();
+    if (!cancelled) saveSnapshot(devices, simulated?.history);
+    await supervisor?.publish(inventory.list());
+    scanEvents.emit('scan-finished', { state: cancelled ? 'cancelled' : 'done', found: devices.length });
+    return devices;
+  };
+  const cancelScan = () => {
+    if (!scanController) return false;
+    scanController.abort();
+    return true;
+  };
+  const startScan = (overrides) => (scanning ??= scan(overrides).finally(() => { scanning = null; }));
+  // Historial de escaneos de /api/scans/history y /api/scans/diff (el de memoria con --simulate)
+  const openScans = () => simulated?.history || openHistory();
+  const diff = (fromRef, toRef) => {
+    const history = openScans();
+    const from = history.get(fromRef);
+    const to = history.get(toRef);
+    if (!from || !to) throw Object.assign(new Error(`No existe el escaneo ${from ? toRef : fromRef}`), { status: 404 });
+    return diffScans(from, to);
+  };
+  // Wake-on-LAN desde la página, auditado como el de la ventana y el de la CLI
+  const wakeDevice = (id) => {
+    const record = openStore().get(id);
+    if (!record) throw Object.assign(new Error(`Dispositivo desconocido: ${id}`), { status: 404 });
+    if (!record.mac) throw Object.assign(new Error(`No se conoce la MAC de ${record.ip}`), { status: 409 });
+    const { port, broadcast } = loadConfig().wakeOnLan;
+    return auditAction('wake', record.ip, 'web', () => wakeOnLan(record.mac, { ip: record.ip, port, broadcast }));
+  };
+  // PATCH /api/devices/{id}: lo mismo que editar la ficha en la aplicación, con la misma validación
+  const updateDevice = (id, changes) => {
+    const store = openStore();
+    const record = store.get(id);
+    if (!record) throw Object.assign(new Error(`Dispositivo desconocido: ${id}`), { status: 404 });
+    return auditAction('update-device', record.ip, 'web', () => {
+      try {
+        store.update(id, changes);
+      } catch (err) {
+        throw Object.assign(err, { status: 400 });
+      }
+      store.save();
+      return store.get(id);
+    });
+  };
+  // GET /api/devices/{ip}/details: como el comando details, pero solo con NAS del inventario
+  // (la página no sirve para sondear IPs cualesquiera)
+  const deviceDetails = (ip) => {
+    const record = openStore().list().find((device) => device.ip === ip || (device.addresses || []).includes(ip));
+    if (!record) throw Object.assign(new Error(`${ip} no está en el inventario`), { status: 404 });
+    const { clientCertFor } = buildScanOptions(loadConfig());
+    return probeDetails(record, { clientCert: clientCertFor(record.ip), signal });
+  };
+  // En modo contenedor /readyz espera al primer escaneo: hasta entonces la lista está vacía o vieja
+  let ready = !args.container;
+
+  // --debug: traza de los escaneos y diagnóstico del proceso en /api/debug/
+  const runtime = args.debug ? createRuntimeMonitor() : null;
+
+  const tls = useTls ? loadWebTls(web) : null;
+  if (tls?.generated) log.info('[Web] Certificado autofirmado nuevo para la interfaz web');
+  const server = await startWebServer({
+    ...listen,
+    auth,
+    tls,
+    // Además de IPs y localhost: el nombre del equipo (como en el certificado) y los de config.json
+    allowedHosts: [os.hostname(), `${os.hostname()}.local`, ...web.allowedHosts || []],
+    ingress: addon ? {} : null,
+    api: {
+      devices: ({ tag } = {}) => openStore().list({ tag }),
+      status: () => getScanStatus(),
+      stats: () => getScanStats(),
+      scan: startScan,
+      diagnose: (host) => diagnoseHost(host, buildScanOptions(loadConfig(), args.flags)),
+      ready: () => ready && !signal.aborted,
+      trace: args.debug ? getScanTrace : undefined,
+      runtime,
+      register: registrar ? register : undefined,
+      // Con --simulate no: los NAS falsos no tienen a quién despertar
+      wake: simulated ? undefined : wakeDevice,
+      update: updateDevice,
+      details: simulated ? undefined : deviceDetails,
+      events: scanEvents,
+      cancel: cancelScan,
+      audit: readAudit,
+      history: () => openScans().list(),
+      diff
+    }
+  }).catch((err) => {
+    runtime?.stop();
+    // Otro programa (o un Finder con otra configuración) ya tiene el puerto
+    if (err.code === 'EADDRINUSE') throw new Error(`El puerto ${listen.port} ya está en uso`);
+    throw err;
+  });
+
+  // El enlace lleva el token: solo se muestra en una terminal o cuando se acaba de crear
+  // (en Home Assistant no sirve: se entra por ingress)
+  const show = !addon && (generated || process.stderr.isTTY);
+  for (const address of webAddresses(listen)) {
+    log.info(`[Web] Escuchando en ${scheme}://${address}/${show ? `  →  ${scheme}://${address}/login?token=${token}` : ''}`);
+  }
+  // El navegador avisará del autofirmado: la huella permite comprobar que es este
+  if (tls) log.info(`[Web] Huella SHA-256 del certificado: ${tls.fingerprint256}`);
+  else if (!addon && !isLoopback(listen.host)) log.warn('[Web] Aviso: sin HTTPS el token y la sesión viajan en claro por la red');
+  const published = supervisor ? '; los NAS se publican como binary_sensor.homepinas_*' : '';
+  if (addon) log.info(`[Web] Complemento de Home Assistant: solo se atiende por ingress${published}`);
+  else if (!show) log.info(`[Web] El enlace de acceso lleva el token guardado en el secreto ${WEB_TOKEN_SECRET}`);
+  if (auth.basic) log.info(`[Web] También se puede entrar con el usuario ${web.user} y su contraseña`);
+  if (args.debug) log.info(`[Web] Modo depuración: ${localUrl}api/debug/ (trace, runtime, cpu-profile, heap-snapshot)`);
+  const advertisement = registrar ? advertiseFinder(listen, { scheme, fingerprint256: tls?.fingerprint256 }) : null;
+  if (advertisement) {
+    log.info(`[Web] Anunciado por mDNS (${SERVICE_TYPE}) en ${advertisement.addresses.join(', ')}: los NAS se registran en ${REGISTER_PATH}`);
+  }
+  await announceUrl(localUrl, token, args);
+
+  if (args.container) {
+    for (const warning of containerWarnings(loadConfig())) log.warn(`[Web] ${warning}`);
+    startScan()
+      .then((devices) => log.info(`[Web] Escaneo inicial: ${devices.length} NAS`))
+      .catch((err) => log.error(`[Web] Error en el escaneo inicial: ${err.message}`))
+      .finally(() => { ready = true; });
+  }
+  if (supervisor) keepPublished(args, signal, startScan);
+
+  await new Promise((resolve) => signal.addEventListener('abort', resolve, { once: true }));
+  advertisement?.stop();
+  runtime?.stop();
+  server.close();
+  // Las conexiones keep-alive de los navegadores retrasarían la salida
+  server.closeAllConnections();
+}
+
+/**
+ * Complemento de Home Assistant: los estados solo cambian con un escaneo, así que se
+ * reescanea cada --interval segundos aunque nadie abra el panel (incremental, ver refresh.js)
+ */
+async function keepPublished(args, signal, startScan) {
+  const refresh = createRefreshPlanner({ fullScanEvery: loadConfig().fullScanEvery });
+  let known = null;
+  while (!signal.aborted) {
+    try {
+      await sleep(args.interval * 1000, undefined, { signal });
+    } catch {
+      return; // parada durante la espera
+    }
+    try {
+      const plan = await refresh.next(known);
+      const devices = await startScan(plan.options);
+      if (!signal.aborted) known = devices;
+    } catch (err) {
+      log.error(`[Web] Error en el escaneo periódico: ${err.message}`);
+    }
+  }
+}
+
+/**
+ * doctor: comprobaciones de red o, con un host, su diagnóstico por etapas; con --capture,
+ * además el paquete de soporte. Devuelve el código de salida
+ */
+async function doctor(args) {
+  let checks = null;
+  let diagnosis = null;
+  let failed;
+  if (args.refs.length > 0) {
+    diagnosis = await diagnoseHost(args.refs[0], buildScanOptions(loadConfig(), args.flags));
+    process.stdout.write(formatDiagnosis(diagnosis, args.output));
+    failed = diagnosis.steps.some((step) => step.status === 'fail');
+  } else {
+    const knownHosts = openInventory().list().map((record) => record.ip);
+    checks = await runDoctor({ knownHosts });
+    process.stdout.write(formatDoctor(checks, args.output));
+    failed = checks.some((check) => check.status === 'fail');
+  }
+
+  if (args.capture) {
+    // Ctrl+C corta la captura antes de tiempo, pero el paquete se escribe igual
+    const controller = new AbortController();
+    const abort = () => controller.abort();
+    process.once('SIGINT', abort);
+    log.info(`[Doctor] Escuchando mDNS y SSDP durante ${args.capture} s (Ctrl+C para terminar antes)…`);
+    const capture = await captureMulticast({ seconds: args.capture, signal: controller.signal });
+    process.removeListener('SIGINT', abort);
+    const { mdns, ssdp, homepinas } = capture.summary;
+    log.info(`[Doctor] mDNS: ${mdns.packets} paquetes de ${mdns.sources} equipos; SSDP: ${ssdp.packets} de ${ssdp.sources}; ` +
+      `${homepinas ? 'algún anuncio es de un HomePiNAS' : 'ningún anuncio de HomePiNAS'}`);
+    for (const error of capture.errors) log.warn(`[Doctor] ${error}`);
+    log.info(`[Doctor] Paquete de soporte: ${writeSupportBundle({ checks, diagnosis, capture })}`);
+  }
+  return failed ? EXIT.NOT_FOUND : EXIT.FOUND;
+}
+
+/**
+ * service install|uninstall|status; status sale con 0 solo si está en marcha
+ */
+async function service(args) {
+  const backend = getServiceBackend();
+  const action = args.refs[0];
+
+  if (action === 'install') {
+    const { location, hint } = await backend.install(serviceCommand(args.serviceArgs));
+    log.info(`[Service] Instalado y en marcha: ${location}`);
+    if (hint) log.info(`[Service] ${hint}`);
+  } else if (action === 'uninstall') {
+    const removed = await backend.uninstall();
+    log.info(removed ? '[Service] Desinstalado' : '[Service] No estaba instalado');
+  } else {
+    const status = await backend.status();
+    if (!status.installed) {
+      process.stdout.write('No instalado\n');
+      process.exitCode = EXIT.NOT_FOUND;
+      return;
+    }
+    process.stdout.write(`Instalado: ${status.location}\n` +
+      `Arranque automático: ${status.enabled ? 'sí' : 'no'}\n` +
+      `Estado: ${status.running ? 'en marcha' : 'parado'}${status.detail ? ` (${status.detail})` : ''}\n`);
+    process.exitCode = status.running ? EXIT.FOUND : EXIT.NOT_FOUND;
+  }
+}
+
+async function main() {
+  let args;
+  try {
+    args = parseArgs(process.argv.slice(2));
+  } catch (err) {
+    process.stderr.write(`${err.message}\n\n${USAGE}`);
+    process.exitCode = EXIT.ERROR;
+    return;
+  }
+  if (args.help) {
+    process.stdout.write(USAGE);
+    return;
+  }
+  configureLogging({ level: args.logLevel, format: args.logFormat });
+  attachLogSinks(withLogFlags(loadConfig(), args));
+
+  if (args.command === 'history') {
+    process.stdout.write(formatHistory(openHistory().list(), args.output));
+    return;
+  }
+  if (args.command === 'diff') {
+    const history = openHistory();
+    const [fromRef = 'previous', toRef = 'latest'] = args.refs.length === 1 ? [args.refs[0]] : args.refs;
+    const from = history.get(fromRef);
+    const to = history.get(toRef);
+    if (!from || !to) {
+      log.error(`[CLI] No existe el escaneo ${from ? toRef : fromRef} (ver homepinas-finder history)`);
+      process.exitCode = EXIT.ERROR;
+      return;
+    }
+    process.stdout.write(formatDiff(diffScans(from, to), args.output));
+    return;
+  }
+  if (args.command === 'inventory') {
+    process.stdout.write(formatInventory(openInventory().list({ tag: args.tag }), args.output));
+    return;
+  }
+  if (args.command === 'doctor') {
+    try {
+      process.exitCode = await doctor(args);
+    } catch (err) {
+      log.error(`[CLI] ${err.message}`);
+      process.exitCode = EXIT.ERROR;
+    }
+    return;
+  }
+  if (args.command === 'service') {
+    try {
+      await service(args);
+    } catch (err) {
+      log.error(`[Service] ${err.message}`);
+      process.exitCode = EXIT.ERROR;
+    }
+    return;
+  }
+  if (HOST_COMMANDS.includes(args.command)) {
+    const controller = new AbortController();
+    process.once('SIGINT', () => controller.abort());
+    try {
+      if (args.command === 'wake') {
+        await wake(args.refs[0]);
+      } else if (args.command === 'pair') {
+        await pair(args.refs[0], controller.signal);
+      } else if (ACTIONS[args.command]) {
+        await manage(args.refs[0], args.command, controller.signal);
+      } else {
+        const device = findInventoryDevice(args.refs[0], { anyIp: true });
+        const { clientCertFor } = buildScanOptions(loadConfig());
+        const details = await probeDetails(device, { clientCert: clientCertFor(device.ip), signal: controller.signal });
+        process.stdout.write(formatDetails(details, args.output));
+      }
+    } catch (err) {
+      log.error(`[CLI] ${err.message}`);
+      process.exitCode = controller.signal.aborted ? EXIT.INTERRUPTED : EXIT.ERROR;
+    }
+    return;
+  }
+
+  const controller = new AbortController();
+  // Ctrl+C corta el escaneo; en modo normal se imprime lo encontrado hasta entonces
+  // Con SIGTERM es como el servicio del sistema para watch o serve
+  process.once('SIGINT', () => controller.abort());
+  process.once('SIGTERM', () => controller.abort());
+
+  if (args.command === 'watch') {
+    await watch(args, controller.signal);
+    return;
+  }
+  if (args.command === 'serve') {
+    try {
+      await serve(args, controller.signal);
+    } catch (err) {
+      log.error(`[Web] ${err.message}`);
+      process.exitCode = EXIT.ERROR;
+    }
+    return;
+  }
+
+  const devices = await scanOnce(args, controller.signal);
+  process.stdout.write(formatDevices(devices, args.output));
+  if (!controller.signal.aborted && !args.flags.simulate) saveSnapshot(devices);
+
+  const missing = args.expectHosts.filter((host) => !devices.some((device) => matchesHost(device, host)));
+  for (const host of missing) log.warn(`[CLI] No se encontró ${host}`);
+
+  if (controller.signal.aborted) {
+    process.exitCode = EXIT.INTERRUPTED;
+  } else if (devices.length === 0 || missing.length > 0) {
+    process.exitCode = EXIT.NOT_FOUND;
+  } else {
+    process.exitCode = EXIT.FOUND;
+  }
+}
+
+main().catch((err) => {
+  log.error(`[CLI] Error en el escaneo: ${err.message}`);
+  process.exitCode = EXIT.ERROR;
+});
@@ -0,0 +1,36 @@
+const fs = require('fs');
+const log = require('./log');
+
+/**
+ * Certificados cliente (mTLS) para NAS que los exigen
+ *
+ * config.json:
+ *   "clientCertificates": {
+ *     "default":      { "cert": "/ruta/cliente.pem", "key": "/ruta/cliente.key" },
+ *     "192.168.1.40": { "cert": "...", "key": "..." }
+ *   }
+ *
+ * La frase de paso de una clave cifrada se guarda en el almacén de secretos
+ * como `clientcert.<ip|default>.passphrase`.
+ *
+ * Devuelve ip => { cert, key, passphrase } | null
+ */
+function loadClientCertificates(entries = {}, secrets = null) {
+  const loaded = new Map();
+
+  for (const [target, files] of Object.entries(entries)) {
+    try {
+      loaded.set(target, {
+        cert: fs.readFileSync(files.cert),
+        key: fs.readFileSync(files.key),
+        passphrase: secrets?.get(`clientcert.${target}.passphrase`) || undefined
+      });
+    } catch (err) {
+      log.warn(`[mTLS] No se pudo cargar el certificado cliente de ${target}: ${err.message}`);
+    }
+  }
+
+  return (ip) => loaded.get(ip) || loaded.get('default') || null;
+}
+
+module.exports = { loadClientCertificates };
@@ -0,0 +1,138 @@
+const fs = require('fs');
+const os = require('os');
+const path = require('path');
+const log = require('./log');
+
+const DEFAULTS = {
+  // Sondeos simultáneos durante el barrido de subred
+  concurrency: 50,
+  // Barrer también subredes con IPs públicas (equivale a --allow-public)
+  allowPublicSubnets: false,
+  // Puertos del panel web que se sondean: "https:443", "http:8080" o números
+  probePorts: ['https:443', 'http:80'],
+  // Protocolos uno tras otro en este orden, p. ej. ["https", "http"] (null = en paralelo)
+  schemeOrder: null,
+  // Espera (ms) a que el host acepte la conexión y a cada lectura de la respuesta
+  connectTimeout: 1500,
+  httpTimeout: 1500,
+  // Confianza mínima (0..1) del detector que reconoce un NAS (0.8 deja solo la API y el certificado)
+  minConfidence: 0,
+  // Último octeto [desde, hasta] que se sondea primero (pool DHCP típico)
+  priorityRange: [2, 150],
+  // Solo se dan por verificados los NAS con certificado firmado por tlsCaFile
+  strictTls: false,
+  tlsCaFile: '',
+  // Rangos CIDR que se barren además de las subredes locales (otras VLAN)
+  scanTargets: [],
+  // Hosts que nunca se sondean: IPs, CIDRs o prefijos MAC
+  exclude: [],
+  // Escaneo lento, en orden aleatorio y con un solo sondeo por host
+  stealth: false,
+  // Barrido ARP activo con arp-scan antes del TCP (equivale a --arp-sweep)
+  arpSweep: false,
+  // Ping a la subred antes del TCP (equivale a --ping-sweep)
+  pingSweep: false,
+  // Router del que leer las concesiones DHCP: { type: openwrt|pfsense|fritzbox|upnp, url, username }
+  router: null,
+  // Consulta SNMP v2c de sysName/sysDescr durante el sondeo
+  snmp: { enabled: false, community: 'public' },
+  // Certificados cliente mTLS por IP (o "default"): { cert, key }
+  clientCertificates: {},
+  // Eventos de descubrimiento/disponibilidad a syslog (RFC 5424); `logs`: además los mensajes
+  // de registro desde ese nivel (debug, info, warn, error; false = ninguno). --syslog equivale a enabled + logs info
+  syslog: { enabled: false, host: '127.0.0.1', port: 514, protocol: 'udp', facility: 'user', logs: false },
+  // Los mismos eventos al registro de eventos de Windows (equivale a --event-log en watch, que además
+  // manda los mensajes de registro desde warn; `logs` como en syslog)
+  eventLog: { enabled: false, source: 'HomePiNAS Finder', logs: false },
+  // NAS como entidades de Home Assistant vía MQTT discovery (contraseña: secreto mqtt.password)
+  mqtt: {
+    enabled: false,
+    url: 'mqtt://homeassistant.local:1883',
+    username: '',
+    discoveryPrefix: 'homeassistant',
+    topicPrefix: 'homepinas-finder'
+  },
+  // Canales: slack/discord { webhookUrl }, telegram { botToken, chatId }, email { host, to, ... }
+  notifications: {},
+  // Reanuncia por mDNS los NAS descubiertos (interfaces: nombres; vacío = todas)
+  mdnsProxy: { enabled: false, interfaces: [] },
+  // Wake-on-LAN: puerto UDP y dirección de difusión extra (p. ej. la de otra VLAN)
+  wakeOnLan: { port: 9, broadcast: '' },
+  // Dominio de los nombres que escribe "Actualizar fichero hosts" (<nombre>.<hostsSuffix>)
+  hostsSuffix: 'local',
+  // Dónde se guardan tokens y credenciales: auto (llavero del sistema si lo hay), keyring o file
+  secretStore: 'auto',
+  // Icono en la bandeja con los NAS en línea; la app sigue abierta al cerrar la ventana (--tray)
+  // En ese modo reescanea cada `interval` segundos (0 = nunca) y avisa de NAS nuevos o que vuelven
+  tray: { enabled: false, interval: 300, notifications: true },
+  // watch y la bandeja: barrido completo cada N vueltas; entre medias solo mDNS, los NAS
+  // conocidos y las IPs nuevas de la tabla ARP (1 = siempre completo)
+  fullScanEvery: 10,
+  // Interfaz web de `serve`: usuario de la autenticación básica (contraseña: secreto web.password)
+  // y certificado TLS propio (vacío = autofirmado en el directorio de configuración)
+  web: { user: 'admin', certFile: '', keyFile: '', allowedHosts: [] },
+  // Red simulada de --simulate: dispositivos falsos (ip, name, latencyMs, failure...; ver simulate.js)
+  // Vacío = los de ejemplo
+  simulation: { devices: [] }
+};
+
+// Complemento de Home Assistant: el Supervisor escribe aquí las opciones de su panel
+const ADDON_OPTIONS_FILE = '/data/options.json';
+
+/**
+ * Directorio de configuración del Finder según plataforma
+ * Se puede forzar con HOMEPINAS_FINDER_HOME
+ */
+function getConfigDir() {
+  if (process.env.HOMEPINAS_FINDER_HOME) {
+    return process.env.HOMEPINAS_FINDER_HOME;
+  }
+
+  const home = os.homedir();
+  switch (process.platform) {
+    case 'win32':
+      return path.join(process.env.APPDATA || path.join(home, 'AppData', 'Roaming'), 'homepinas-finder');
+    case 'darwin':
+      return path.join(home, 'Library', 'Application Support', 'homepinas-finder');
+    default:
+      return path.join(process.env.XDG_CONFIG_HOME || path.join(home, '.config'), 'homepinas-finder');
+  }
+}
+
+/**
+ * Opciones del complemento de Home Assistant (solo con SUPERVISOR_TOKEN, que el Supervisor
+ * pone a sus complementos): las claves de config.json que aparecen en su panel
+ */
+function loadAddonOptions(file = ADDON_OPTIONS_FILE) {
+  if (!process.env.SUPERVISOR_TOKEN) return {};
+  try {
+    const options = JSON.parse(fs.readFileSync(file, 'utf8'));
+    return Object.fromEntries(Object.entries(options).filter(([key]) => Object.hasOwn(DEFAULTS, key)));
+  } catch (err) {
+    if (err.code !== 'ENOENT') {
+      log.warn(`[Config] No se pudo leer ${file}: ${err.message}`);
+    }
+    return {};
+  }
+}
+
+/**
+ * Carga config.json combinado con los valores por defecto y, en Home Assistant, con
+ * las opciones del complemento (mandan sobre config.json)
+ * Un fichero ausente o corrupto no impide arrancar
+ */
+function loadConfig() {
+  const file = path.join(getConfigDir(), 'config.json');
+
+  try {
+    const data = JSON.parse(fs.readFileSync(file, 'utf8'));
+    return { ...DEFAULTS, ...data, ...loadAddonOptions() };
+  } catch (err) {
+    if (err.code !== 'ENOENT') {
+      log.warn(`[Config] No se pudo leer ${file}: ${err.message}`);
+    }
+    return { ...DEFAULTS, ...loadAddonOptions() };
+  }
+}
+
+module.exports = { DEFAULTS, getConfigDir, loadConfig, loadAddonOptions };
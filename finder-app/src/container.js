@@ -0,0 +1,49 @@
+/**
+ * Diagnóstico del modo contenedor (serve --container): ¿corre en Docker/Podman y
+ * con red bridge? Ahí el multicast (mDNS, SSDP, WS-Discovery) no sale del bridge
+ * y el barrido de subred solo ve la red interna del contenedor
+ */
+const fs = require('fs');
+const os = require('os');
+const { ipv4InRange } = require('./netutil');
+
+// Redes que Docker y Podman asignan por defecto a sus bridges
+const BRIDGE_RANGES = [['172.16.0.0', 12], ['10.88.0.0', 16]];
+// Interfaces que solo se ven con la red del host (el propio bridge, veth, Wi-Fi, enpXsY...)
+const HOST_INTERFACES = /^(docker|br-|veth|cni|podman|wl|en[ops])/;
+
+function isContainer() {
+  if (fs.existsSync('/.dockerenv') || fs.existsSync('/run/.containerenv')) return true;
+  try {
+    return /docker|kubepods|containerd|libpod/.test(fs.readFileSync('/proc/1/cgroup', 'utf8'));
+  } catch {
+    return false;
+  }
+}
+
+/**
+ * Avisos para el arranque: [] si no es un contenedor o si parece tener la red del host
+ * `scanTargets` (de config.json) permite barrer la LAN a través del NAT del bridge
+ */
+function containerWarnings({ scanTargets = [] } = {}) {
+  if (!isContainer()) return [];
+
+  const interfaces = Object.entries(os.networkInterfaces())
+    .flatMap(([name, addresses]) => addresses.map((address) => ({ name, ...address })))
+    .filter((iface) => iface.family === 'IPv4' && !iface.internal);
+  const bridged = interfaces.length > 0 &&
+    !interfaces.some((iface) => HOST_INTERFACES.test(iface.name)) &&
+    interfaces.every((iface) => BRIDGE_RANGES.some(([base, prefix]) => ipv4InRange(iface.address, base, prefix)));
+  if (!bridged) return [];
+
+  const networks = interfaces.map((iface) => iface.cidr || iface.address).join(', ');
+  return [
+    `Contenedor con red bridge (${networks}): mDNS, SSDP y WS-Discovery no salen del bridge`,
+    scanTargets.length > 0
+      ? 'El barrido de scanTargets pasa por el NAT del contenedor; sin multicast puede faltar algún NAS'
+      : 'El barrido solo ve la red del contenedor: pon la subred de casa en scanTargets',
+    'Para descubrir toda la red arranca el contenedor con --network host (network_mode: host en compose)'
+  ];
+}
+
+module.exports = { isContainer, containerWarnings };
@@ -0,0 +1,57 @@
+const net = require('net');
+const log = require('./log');
+const { ipv4InRange } = require('./netutil');
+const { normalizeMac } = require('./neighbors');
+
+/**
+ * Compila la lista de exclusión de config.json (`exclude`)
+ * Admite IPs ("192.168.1.10", "fd00::10"), CIDRs IPv4 e IPv6 ("10.0.0.0/8", "fd00:1::/64")
+ * y prefijos MAC de al menos 3 octetos ("b8:27:eb")
+ * Devuelve (ip, mac) => true si el host no debe sondearse
+ *
+ * La MAC solo se conoce si el host ya está en la tabla ARP/NDP: uno que no está recibe
+ * el sondeo igualmente y se descarta al informar de él, con la MAC aprendida en la
+ * conexión. Los hosts de otra subred (tras un router) no tienen MAC visible: para
+ * esos solo sirven las IPs y los CIDRs
+ */
+function compileDenylist(entries = []) {
+  const ips = new Set();
+  const ranges = [];
+  // IPv6: BlockList compara las direcciones normalizadas (fd00::1 = fd00:0:0::1)
+  const ipv6 = new net.BlockList();
+  const macPrefixes = [];
+
+  for (const raw of entries) {
+    const entry = String(raw).trim().toLowerCase();
+    if (!entry) continue;
+
+    const [base, prefix] = entry.split('/');
+    const bits = /^\d+$/.test(prefix) ? Number.parseInt(prefix, 10) : NaN;
+    if (net.isIPv4(entry)) {
+      ips.add(entry);
+    } else if (net.isIPv6(entry)) {
+      ipv6.addAddress(entry, 'ipv6');
+    } else if (net.isIPv4(base) && bits <= 32) {
+      ranges.push([base, bits]);
+    } else if (net.isIPv6(base) && bits <= 128) {
+      ipv6.addSubnet(base, bits, 'ipv6');
+    } else if (/^[0-9a-f]{1,2}([:-][0-9a-f]{1,2}){2,5}$/.test(entry)) {
+      macPrefixes.push(entry.split(/[:-]/).map((part) => part.padStart(2, '0')).join(':'));
+    } else {
+      log.warn(`[Denylist] Entrada no válida ignorada: ${raw}`);
+    }
+  }
+
+  return (ip, mac = '') => {
+    if (ips.has(ip)) return true;
+    if (net.isIPv4(ip) && ranges.some(([base, prefix]) => ipv4InRange(ip, base, prefix))) return true;
+    // Las de enlace local llevan la zona (fe80::1%eth0)
+    const address = String(ip).split('%')[0];
+    if (net.isIPv6(address) && ipv6.check(address, 'ipv6')) return true;
+
+    const normalized = normalizeMac(mac);
+    return Boolean(normalized) && macPrefixes.some((prefix) => normalized.startsWith(prefix));
+  };
+}
+
+module.exports = { compileDenylist };
@@ -0,0 +1,108 @@
+const net = require('net');
+const { setMaxListeners } = require('events');
+const { httpGet } = require('./scanner');
+const { urlHost } = require('./netutil');
+const { describeCertificate } = require('./certificates');
+
+const DETAILS_TIMEOUT = 3000;
+const INFO_ENDPOINT = '/api/system/info';
+// Servicios habituales en un HomePiNAS; solo se comprueba si el puerto acepta conexiones
+const SERVICE_PORTS = [
+  { port: 21, service: 'ftp' },
+  { port: 22, service: 'ssh' },
+  { port: 80, service: 'http' },
+  { port: 139, service: 'netbios' },
+  { port: 443, service: 'https' },
+  { port: 445, service: 'smb' },
+  { port: 548, service: 'afp' },
+  { port: 873, service: 'rsync' },
+  { port: 2049, service: 'nfs' },
+  { port: 8096, service: 'jellyfin' },
+  { port: 9090, service: 'cockpit' },
+  { port: 32400, service: 'plex' }
+];
+
+/**
+ * Estado de un puerto TCP: open (acepta), closed (rechaza) o filtered (sin respuesta)
+ * y el tiempo hasta la respuesta en ms
+ */
+function checkPort(ip, port, timeout, signal) {
+  return new Promise((resolve) => {
+    const started = Date.now();
+    const socket = net.createConnection({ host: ip, port, signal });
+    const finish = (state) => {
+      socket.destroy();
+      resolve({ state, ms: Date.now() - started });
+    };
+    socket.setTimeout(timeout, () => finish('filtered'));
+    socket.once('connect', () => finish('open'));
+    socket.once('error', (err) => finish(err.code === 'ECONNREFUSED' ? 'closed' : 'filtered'));
+  });
+}
+
+/**
+ * Esquema y puerto de la URL de un NAS (por defecto https en el 443)
+ */
+function deviceScheme(device) {
+  const url = new URL(device.url || `https://${urlHost(device.ip)}`);
+  const protocol = url.protocol.replace(':', '');
+  return { url, protocol, port: Number(url.port) || (protocol === 'https' ? 443 : 80) };
+}
+
+/**
+ * Sondeo ampliado de un NAS ya descubierto (`device` con ip y url):
+ * respuesta completa de /api/system/info, puertos de servicio abiertos,
+ * certificado TLS y latencia (conexión TCP y respuesta HTTP)
+ * `clientCert` ({ cert, key, passphrase }) para los NAS que exigen mTLS
+ */
+async function probeDetails(device, { timeout = DETAILS_TIMEOUT, clientCert = null, signal } = {}) {
+  const { url, ...scheme } = deviceScheme(device);
+  const { protocol } = scheme;
+
+  const ports = SERVICE_PORTS.some(({ port }) => port === scheme.port)
+    ? SERVICE_PORTS
+    : [...SERVICE_PORTS, { port: scheme.port, service: protocol }].sort((a, b) => a.port - b.port);
+
+  // Una comprobación por puerto, todas con la misma señal
+  if (signal) setMaxListeners(0, signal);
+
+  let infoError = '';
+  const started = Date.now();
+  const [res, ...states] = await Promise.all([
+    httpGet(scheme, device.ip, INFO_ENDPOINT, {
+      signal,
+      clientCert,
+      connectTimeout: timeout,
+      timeout,
+      onError: (reason) => { infoError = reason; }
+    }),
+    ...ports.map(({ port }) => checkPort(device.ip, port, timeout, signal))
+  ]);
+  const responseMs = Date.now() - started;
+
+  let info = null;
+  if (res) {
+    try {
+      info = JSON.parse(res.body);
+    } catch {
+      infoError = `respuesta ${res.statusCode} no JSON`;
+    }
+  }
+  const panel = states[ports.findIndex(({ port }) => port === scheme.port)];
+
+  return {
+    ip: device.ip,
+    url: url.href,
+    checkedAt: new Date().toISOString(),
+    latency: {
+      connectMs: panel.state === 'open' ? panel.ms : null,
+      responseMs: res ? responseMs : null
+    },
+    info,
+    infoError: res && info ? '' : infoError || 'sin respuesta',
+    ports: ports.map(({ port, service }, i) => ({ port, service, state: states[i].state })),
+    certificate: res?.cert ? describeCertificate(res.cert) : null
+  };
+}
+
+module.exports = { probeDetails, deviceScheme, checkPort, SERVICE_PORTS };
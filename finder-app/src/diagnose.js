@@ -0,0 +1,273 @@
+/**
+ * "¿Por qué no encuentro mi NAS?": diagnóstico por etapas de una IP o un hostname
+ * concreto, las mismas que recorre el escáner. Se para en la primera que falla:
+ *
+ *   resolve → arp → port → tls → api → heuristic
+ *
+ * Cada etapa es { id, title, status: ok|warn|fail|skip, detail, hint }; `verdict` resume
+ */
+const dns = require('dns').promises;
+const net = require('net');
+const tls = require('tls');
+const { httpGet, getLocalInterfaces, resolveProbeSchemes, applyVendorConfidence } = require('./scanner');
+const { matchFingerprint, probeEndpoints } = require('./fingerprints');
+const { readNeighborTable } = require('./neighbors');
+const { udpPing } = require('./ping');
+const { checkPort } = require('./details');
+const { compileDenylist } = require('./denylist');
+const { ipv4InRange, isPrivateAddress } = require('./netutil');
+const { lookupVendor, isRaspberryPi, isLocalMac } = require('./oui');
+const { describeCertificate } = require('./certificates');
+
+const DIAGNOSE_TIMEOUT = 3000;
+const MAX_HOST_LENGTH = 253;
+
+const STAGES = {
+  resolve: 'Dirección',
+  arp: 'Responde en la red local',
+  port: 'Puerto del panel abierto',
+  tls: 'Saludo TLS',
+  api: 'Responde la API',
+  heuristic: 'Se reconoce como HomePiNAS'
+};
+
+function step(id, status, detail, hint = '') {
+  return { id, title: STAGES[id], status, detail, hint };
+}
+
+/**
+ * IP y nombre de lo que ha escrito el usuario: IP tal cual o hostname por DNS/mDNS
+ */
+async function resolveTarget(host) {
+  if (net.isIP(host)) return { ip: host, hostname: '' };
+  try {
+    const { address } = await dns.lookup(host, { family: 4 });
+    return { ip: address, hostname: host };
+  } catch {
+    // Sin registro A: el NAS puede ser solo IPv6
+  }
+  const { address } = await dns.lookup(host);
+  return { ip: address, hostname: host };
+}
+
+async function checkResolve(host, options) {
+  let target;
+  try {
+    target = await resolveTarget(host);
+  } catch (err) {
+    return {
+      step: step('resolve', 'fail', `${host} no resuelve (${err.code || err.message})`,
+        host.endsWith('.local')
+          ? 'El sistema no resuelve .local o el NAS no contesta por mDNS: prueba con su IP (la muestra el router) o ejecuta doctor'
+          : 'Prueba con la IP del NAS (la muestra el router en la lista de clientes DHCP)')
+    };
+  }
+  const { ip } = target;
+  if (compileDenylist(options.exclude)(ip)) {
+    return { target, step: step('resolve', 'fail', `${ip} está en la lista de exclusión`, 'Quítalo de "exclude" en config.json') };
+  }
+  const local = net.isIPv4(ip) ? getLocalInterfaces().find(({ address, prefix }) => ipv4InRange(ip, address, prefix)) : null;
+  target.local = Boolean(local);
+  const where = local ? `en la subred de ${local.name}` : 'fuera de las subredes locales';
+  if (net.isIPv4(ip) && !isPrivateAddress(ip) && !options.allowPublic) {
+    return { target, step: step('resolve', 'warn', `${ip}, IP pública ${where}`, 'El escáner no barre IPs públicas sin --allow-public') };
+  }
+  if (!local && net.isIPv4(ip)) {
+    const inTargets = (options.targets || []).some((entry) => {
+      const [address, bits = '32'] = String(entry).split('/');
+      return net.isIPv4(address) && ipv4InRange(ip, address, Number(bits));
+    });
+    if (!inTargets) {
+      return {
+        target,
+        step: step('resolve', 'warn', `${ip}, ${where}`, `El barrido no llega a otras subredes: añade la suya a scanTargets (p. ej. "${ip}/24")`)
+      };
+    }
+  }
+  return { target, step: step('resolve', 'ok', `${ip}${target.hostname ? ` (${target.hostname})` : ''}, ${where}`) };
+}
+
+async function checkArp(target) {
+  if (!target.local) return step('arp', 'skip', 'Otra subred: no hay ARP, se sigue con TCP');
+  const alive = await udpPing(target.ip, DIAGNOSE_TIMEOUT);
+  const entry = (await readNeighborTable())?.get(target.ip);
+  if (!entry?.mac) {
+    return step('arp', alive ? 'warn' : 'fail', alive ? 'Responde, pero no aparece en la tabla ARP' : 'No contesta a ARP',
+      alive ? '' : 'El NAS está apagado, en otra red (Wi-Fi de invitados, VLAN) o la IP ha cambiado: mira la lista de clientes del router');
+  }
+  target.mac = entry.mac;
+  const vendor = lookupVendor(entry.mac);
+  if (!isLocalMac(entry.mac) && !isRaspberryPi(entry.mac)) {
+    return step('arp', 'warn', `MAC ${entry.mac}${vendor ? ` (${vendor})` : ''}`,
+      'No es una Raspberry Pi: si el NAS solo se reconoce por heurística, esta MAC le resta confianza');
+  }
+  return step('arp', 'ok', `MAC ${entry.mac}${vendor ? ` (${vendor})` : ''}`);
+}
+
+async function checkPorts(target, schemes) {
+  const results = await Promise.all(schemes.map(async (scheme) => ({
+    scheme, ...(await checkPort(target.ip, scheme.port, DIAGNOSE_TIMEOUT))
+  })));
+  const label = { open: 'abierto', closed: 'cerrado', filtered: 'sin respuesta' };
+  const detail = results.map(({ scheme, state }) => `${scheme.protocol}:${scheme.port} ${label[state]}`).join(', ');
+  const open = results.filter(({ state }) => state === 'open').map(({ scheme }) => scheme);
+  if (open.length === 0) {
+    const filtered = results.every(({ state }) => state === 'filtered');
+    return {
+      open,
+      step: step('port', 'fail', detail, filtered
+        ? 'Nada contesta: el NAS está apagado o un cortafuegos (suyo o de esta red) filtra los puertos'
+        : 'Responde pero el panel no escucha en esos puertos: ¿usa otro? Añádelo a probePorts en config.json')
+    };
+  }
+  return { open, step: step('port', 'ok', detail) };
+}
+
+function handshake(ip, port, clientCert) {
+  return new Promise((resolve) => {
+    const socket = tls.connect({ host: ip, port, rejectUnauthorized: false, ...(clientCert || {}) });
+    const finish = (result) => {
+      socket.destroy();
+      resolve(result);
+    };
+    socket.setTimeout(DIAGNOSE_TIMEOUT, () => finish({ error: 'timeout' }));
+    socket.once('secureConnect', () => finish({ cert: socket.getPeerCertificate(), protocol: socket.getProtocol() }));
+    socket.once('error', (err) => finish({ error: err.code || err.message }));
+  });
+}
+
+async function checkTls(target, open, options) {
+  const secure = open.filter((scheme) => scheme.protocol === 'https');
+  if (secure.length === 0) return { usable: open, step: step('tls', 'skip', 'Solo HTTP') };
+
+  const clientCert = options.clientCertFor ? options.clientCertFor(target.ip) : null;
+  const results = await Promise.all(secure.map(async (scheme) => ({ scheme, ...(await handshake(target.ip, scheme.port, clientCert)) })));
+  const failed = results.filter((result) => result.error);
+  const usable = [...open.filter((scheme) => scheme.protocol === 'http'), ...results.filter((result) => !result.error).map(({ scheme }) => scheme)];
+  const ok = results.find((result) => !result.error);
+
+  if (!ok) {
+    const { error } = failed[0];
+    const status = usable.length > 0 ? 'warn' : 'fail';
+    return {
+      usable,
+      step: step('tls', status, `Falla en ${failed.map(({ scheme }) => scheme.port).join(', ')}: ${error}`,
+        error === 'ECONNRESET' || /CERTIFICATE_REQUIRED|ALERT/.test(error)
+          ? 'El NAS corta el saludo: puede exigir certificado cliente (clientCertificates en config.json)'
+          : 'El puerto no habla TLS (¿es HTTP?) o usa una versión que este equipo no admite')
+    };
+  }
+  const cert = describeCertificate(ok.cert);
+  return {
+    usable,
+    step: step('tls', cert.expiringSoon ? 'warn' : 'ok',
+      `${ok.protocol}, certificado ${cert.subject}${cert.organization ? ` (${cert.organization})` : ''}, caduca ${cert.validTo}`,
+      cert.expiringSoon ? 'El certificado caduca pronto o ya ha caducado: renuévalo en el panel del NAS' : '')
+  };
+}
+
+/**
+ * Pide los endpoints que usa el escáner y se queda con las respuestas
+ */
+async function checkApi(target, usable, options) {
+  const responses = [];
+  const errors = [];
+  for (const scheme of usable) {
+    for (const endpoint of probeEndpoints()) {
+      let reason = '';
+      const res = await httpGet(scheme, target.ip, endpoint, {
+        connectTimeout: DIAGNOSE_TIMEOUT,
+        timeout: DIAGNOSE_TIMEOUT,
+        clientCert: scheme.protocol === 'https' && options.clientCertFor ? options.clientCertFor(target.ip) : null,
+        onError: (code) => { reason = code; }
+      });
+      if (res) responses.push({ scheme, endpoint, res });
+      else errors.push(`${scheme.protocol}:${scheme.port}${endpoint} ${reason || 'sin respuesta'}`);
+    }
+  }
+  if (responses.length === 0) {
+    return { responses, step: step('api', 'fail', errors.join(', '), 'El puerto acepta conexiones pero no contesta HTTP: ¿es otro servicio?') };
+  }
+  const detail = responses.map(({ scheme, endpoint, res }) => `${scheme.protocol}:${scheme.port}${endpoint} → ${res.statusCode}`).join(', ');
+  const answered = responses.some(({ res }) => res.statusCode < 400 || res.statusCode === 401);
+  return {
+    responses,
+    step: step('api', answered ? 'ok' : 'warn', detail, answered ? '' : 'Ningún endpoint de HomePiNAS existe aquí: puede ser otro equipo con esta IP')
+  };
+}
+
+function checkHeuristic(target, responses, options) {
+  const minConfidence = Number(options.minConfidence) || 0;
+  // Sin mínimo: qué detector encaja aunque luego no llegue a la confianza exigida
+  const matches = responses
+    .map(({ scheme, endpoint, res }) => ({ scheme, endpoint, match: matchFingerprint(res) }))
+    .filter(({ match }) => match)
+    .sort((a, b) => b.match.confidence - a.match.confidence);
+  if (matches.length === 0) {
+    return step('heuristic', 'fail', 'Ningún detector encaja con las respuestas',
+      'No parece un HomePiNAS (o es una versión con otra API): adjunta esta salida a la incidencia');
+  }
+  const { match, scheme, endpoint } = matches[0];
+  const detail = `${match.name} (confianza ${match.confidence}) en ${scheme.protocol}:${scheme.port}${endpoint}`;
+  // La misma penalización que en el escaneo para MACs que no son de una Raspberry Pi
+  const kept = match.confidence >= minConfidence && applyVendorConfidence({ mac: target.mac, confidence: match.confidence }, minConfidence);
+  if (!kept) {
+    return step('heuristic', 'fail', detail, `No llega a minConfidence (${minConfidence}) con la penalización por MAC: bájalo en config.json`);
+  }
+  if (match.confidence < 0.5) {
+    return step('heuristic', 'warn', detail, 'Solo lo reconoce un detector poco fiable: actualiza el NAS para que responda /api/system/info');
+  }
+  return step('heuristic', 'ok', detail);
+}
+
+/**
+ * Diagnóstico de `host` (IP o hostname) con las opciones de escaneo (buildScanOptions)
+ * Devuelve { host, ip, steps, verdict }
+ */
+async function diagnoseHost(host, options = {}) {
+  host = String(host || '').trim();
+  if (!host || host.length > MAX_HOST_LENGTH || /[\s/]/.test(host)) throw new Error('Indica una IP o un hostname');
+
+  const steps = [];
+  const finish = (ip) => {
+    const failed = steps.find((s) => s.status === 'fail');
+    const warned = steps.find((s) => s.status === 'warn');
+    const verdict = failed
+      ? `No aparece porque falla "${failed.title}": ${failed.hint || failed.detail}`
+      : warned
+        ? `Debería aparecer, con un aviso en "${warned.title}": ${warned.hint || warned.detail}`
+        : 'Debería aparecer en el escaneo';
+    return { host, ip: ip || null, checkedAt: new Date().toISOString(), steps, verdict };
+  };
+  // Las etapas que quedan tras un fallo salen como no comprobadas
+  const stop = (ip) => {
+    for (const id of Object.keys(STAGES).slice(steps.length)) steps.push(step(id, 'skip', 'No se llegó a comprobar'));
+    return finish(ip);
+  };
+
+  const resolved = await checkResolve(host, options);
+  steps.push(resolved.step);
+  if (!resolved.target || resolved.step.status === 'fail') return stop(null);
+  const { target } = resolved;
+
+  const arp = await checkArp(target);
+  steps.push(arp);
+  // Sin ARP aún puede contestar por TCP (ARP filtrado no es lo habitual, pero pasa con algunos puentes Wi-Fi)
+
+  const ports = await checkPorts(target, resolveProbeSchemes(options.ports));
+  steps.push(ports.step);
+  if (ports.open.length === 0) return stop(target.ip);
+
+  const secure = await checkTls(target, ports.open, options);
+  steps.push(secure.step);
+  if (secure.usable.length === 0) return stop(target.ip);
+
+  const api = await checkApi(target, secure.usable, options);
+  steps.push(api.step);
+  if (api.responses.length === 0) return stop(target.ip);
+
+  steps.push(checkHeuristic(target, api.responses, options));
+  return finish(target.ip);
+}
+
+module.exports = { diagnoseHost, STAGES };
@@ -0,0 +1,146 @@
+/**
+ * Descubrimiento de HomePiNAS como librería, sin Electron ni config.json
+ * Para otras herramientas (instalador, puente móvil): require('homepinas-finder/discovery')
+ *
+ *   const scanner = new Scanner({ ports: ['https:443'], targets: ['10.0.20.0/24'] });
+ *   for await (const device of scanner.results()) console.log(device.ip, device.url);
+ *
+ * Las opciones son las de scanNetwork (concurrency, ports, schemeOrder, connectTimeout,
+ * httpTimeout, allowPublic, priorityRange, exclude, stealth, arpSweep, pingSweep, router,
+ * snmp, targets, seeds, methods, minConfidence, trustStore...). buildScanOptions() las saca de un config.json
+ * registerDetector() añade detectores para reconocer otros modelos (ver fingerprints.js)
+ */
+const { EventEmitter } = require('events');
+const { scanNetwork, getScanStatus, createScanState, METHOD_NAMES } = require('./scanner');
+const { buildScanOptions } = require('./scan-options');
+const { registerDetector } = require('./fingerprints');
+
+/**
+ * Un escáner con su propia caché negativa, hosts conocidos y estado
+ * Eventos: `device` (cada NAS en cuanto se confirma), `progress` y `done` (lista final)
+ */
+class Scanner extends EventEmitter {
+  constructor(options = {}) {
+    super();
+    const unknown = (options.methods || []).filter((name) => !METHOD_NAMES.includes(name));
+    if (unknown.length > 0) {
+      throw new Error(`Métodos desconocidos: ${unknown.join(', ')} (${METHOD_NAMES.join(', ')})`);
+    }
+    this.options = options;
+    this.state = createScanState();
+    this.controller = null;
+  }
+
+  get running() {
+    return this.controller !== null;
+  }
+
+  /**
+   * Escanea la red y resuelve con todos los dispositivos encontrados
+   * `signal` (opcional) cancela igual que stop(): se resuelve con lo encontrado hasta entonces
+   */
+  async scan(signal) {
+    if (this.controller) throw new Error('Ya hay un escaneo en curso');
+
+    const controller = new AbortController();
+    const cancel = () => controller.abort();
+    for (const external of [this.options.signal, signal]) {
+      if (external?.aborted) controller.abort();
+      external?.addEventListener('abort', cancel, { once: true });
+    }
+    this.controller = controller;
+
+    try {
+      const devices = await scanNetwork({
+        ...this.options,
+        state: this.state,
+        signal: controller.signal,
+        onDevice: (device) => this.emit('device', device),
+        onProgress: (progress) => this.emit('progress', progress)
+      });
+      this.emit('done', devices);
+      return devices;
+    } finally {
+      this.options.signal?.removeEventListener('abort', cancel);
+      signal?.removeEventListener('abort', cancel);
+      this.controller = null;
+    }
+  }
+
+  /**
+   * Resultados como canal: un iterador asíncrono que entrega cada NAS según aparece
+   * y termina con el escaneo. Salir del bucle (break) cancela el escaneo
+   */
+  async *results(signal) {
+    const queue = [];
+    let wake = null;
+    let finished = false;
+    const notify = () => {
+      if (wake) wake();
+      wake = null;
+    };
+    const onDevice = (device) => {
+      queue.push(device);
+      notify();
+    };
+
+    this.on('device', onDevice);
+    const done = this.scan(signal).finally(() => {
+      finished = true;
+      notify();
+    });
+    // El error se relanza en el `await done` del final
+    done.catch(() => {});
+
+    try {
+      while (queue.length > 0 || !finished) {
+        if (queue.length === 0) {
+          await new Promise((resolve) => { wake = resolve; });
+          continue;
+        }
+        yield queue.shift();
+      }
+      await done;
+    } finally {
+      this.off('device', onDevice);
+      if (!finished) {
+        // El break espera a que el escaneo cierre: al volver se puede lanzar otro
+        this.stop();
+        await done.catch(() => {});
+      }
+    }
+  }
+
+  /**
+   * Comprueba un host concreto (p. ej. el instalador esperando a que arranque el NAS)
+   * Devuelve el dispositivo o null; no usa la caché negativa, se puede llamar en bucle
+   */
+  async probe(ip, hostname = '', signal) {
+    const [device] = await scanNetwork({
+      ...this.options,
+      methods: ['seeds'],
+      seeds: [{ ip, hostname }],
+      // En simulación, solo el dispositivo falso de esa IP
+      ...(this.options.simulation ? { simulation: this.options.simulation.filter((spec) => spec?.ip === ip) } : {}),
+      state: { ...createScanState(), knownHosts: this.state.knownHosts },
+      signal: signal || this.options.signal
+    });
+    return device || null;
+  }
+
+  /**
+   * Cancela el escaneo en curso; no hace nada si no hay ninguno
+   */
+  stop() {
+    this.controller?.abort();
+  }
+
+  /**
+   * Estado del último escaneo de este Scanner: { running, startedAt, finishedAt, found, progress, ... }
+   */
+  status() {
+    return getScanStatus(this.state);
+  }
+}
+
+module.exports = { Scanner, METHODS: METHOD_NAMES, buildScanOptions, registerDetector };
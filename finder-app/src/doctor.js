@@ -0,0 +1,323 @@
+/**
+ * Autodiagnóstico (homepinas-finder doctor): lo que suele explicar que un escaneo no
+ * encuentre nada. Cada comprobación devuelve
+ *   { id, title, status: ok|warn|fail|skip, detail, hints: [qué hacer] }
+ */
+const dns = require('dns').promises;
+const fs = require('fs');
+const net = require('net');
+const { execFile } = require('child_process');
+const multicastDns = require('multicast-dns');
+const { getLocalInterfaces } = require('./scanner');
+const { isPrivateAddress, ipv4ToInt, intToIpv4 } = require('./netutil');
+const { containerWarnings } = require('./container');
+const { BEACON_PORT } = require('./beacon');
+
+const MDNS_HOSTNAME = 'pinas.local';
+const CHECK_TIMEOUT = 3000;
+const HTTPS_PORT = 443;
+const MAX_PORT_TARGETS = 4;
+// Túneles que pueden llevarse el tráfico de la LAN (VPN, Tailscale, ZeroTier...)
+const VPN_INTERFACES = /^(tun|tap|wg|utun|ppp|ipsec|zt|tailscale)/i;
+// Puertos que el cortafuegos debe dejar entrar desde la LAN
+const DISCOVERY_PORTS = `UDP 5353 (mDNS), 3702 (WS-Discovery) y ${BEACON_PORT} (beacon)`;
+
+/**
+ * Salida de un programa ('' si no existe, falla o tarda demasiado)
+ */
+function output(command, args) {
+  return new Promise((resolve) => {
+    execFile(command, args, { timeout: CHECK_TIMEOUT * 2, windowsHide: true }, (err, stdout) => {
+      resolve(err ? '' : String(stdout).trim());
+    });
+  });
+}
+
+function withTimeout(promise, ms, fallback) {
+  let timer;
+  return Promise.race([
+    promise.finally(() => clearTimeout(timer)),
+    new Promise((resolve) => { timer = setTimeout(() => resolve(fallback), ms); })
+  ]);
+}
+
+function checkInterfaces(interfaces) {
+  const check = { id: 'interfaces', title: 'Interfaces de red', status: 'ok', detail: '', hints: [] };
+  if (interfaces.length === 0) {
+    return {
+      ...check,
+      status: 'fail',
+      detail: 'Ninguna interfaz IPv4 conectada',
+      hints: ['Conecta este equipo (cable o Wi-Fi) a la misma red que el NAS']
+    };
+  }
+  check.detail = interfaces.map(({ name, address, prefix }) => `${name} ${address}/${prefix}`).join(', ');
+
+  const publicOnes = interfaces.filter(({ address }) => !isPrivateAddress(address));
+  if (publicOnes.length > 0) {
+    check.status = 'warn';
+    check.hints.push(`${publicOnes.map(({ name }) => name).join(', ')} tiene IP pública: no se barre sin --allow-public`);
+  }
+  const tunnels = interfaces.filter(({ name }) => VPN_INTERFACES.test(name));
+  if (tunnels.length > 0) {
+    check.status = 'warn';
+    check.hints.push(`VPN activa (${tunnels.map(({ name }) => name).join(', ')}): puede llevarse el tráfico de la LAN; ` +
+      'desconéctala o pon la subred del NAS en scanTargets');
+  }
+  const container = containerWarnings();
+  if (container.length > 0) {
+    check.status = 'warn';
+    check.hints.push(...container);
+  }
+  return check;
+}
+
+/**
+ * Una sesión mDNS por interfaz: se une al grupo, pregunta por los servicios de la red
+ * (_services._dns-sd._udp) y por pinas.local, y anota quién contesta
+ */
+function mdnsSession(address) {
+  return new Promise((resolve) => {
+    const result = { address, joined: false, loopback: false, responders: new Set(), resolved: new Set(), error: null };
+    let mdns;
+    try {
+      mdns = multicastDns({ interface: address, reuseAddr: true, loopback: true });
+    } catch (err) {
+      resolve({ ...result, error: err.message });
+      return;
+    }
+
+    const finish = () => {
+      clearTimeout(timer);
+      try {
+        mdns.destroy();
+      } catch {
+        // Ya cerrado
+      }
+      resolve(result);
+    };
+    const timer = setTimeout(finish, CHECK_TIMEOUT);
+
+    mdns.on('error', (err) => {
+      result.error = err.message;
+      finish();
+    });
+    mdns.on('ready', () => {
+      result.joined = true;
+      mdns.query({ questions: [{ name: '_services._dns-sd._udp.local', type: 'PTR' }, { name: MDNS_HOSTNAME, type: 'A' }] });
+    });
+    // Con loopback el sistema nos devuelve nuestra propia pregunta: el envío al grupo funciona
+    mdns.on('query', (packet, rinfo) => {
+      if (rinfo.address === address) result.loopback = true;
+    });
+    mdns.on('response', (packet, rinfo) => {
+      if (rinfo.address !== address) result.responders.add(rinfo.address);
+      for (const answer of [...(packet.answers || []), ...(packet.additionals || [])]) {
+        if (answer.type === 'A' && String(answer.name).toLowerCase() === MDNS_HOSTNAME) result.resolved.add(answer.data);
+      }
+    });
+  });
+}
+
+function checkMulticast(sessions) {
+  const check = { id: 'multicast', title: 'Multicast (mDNS)', status: 'ok', detail: '', hints: [] };
+  if (sessions.length === 0) return { ...check, status: 'skip', detail: 'Sin interfaces que probar' };
+
+  check.detail = sessions.map((session) => {
+    if (!session.joined) return `${session.address}: no se pudo unir al grupo (${session.error || 'sin respuesta'})`;
+    if (session.responders.size > 0) return `${session.address}: responden ${session.responders.size} equipo(s)`;
+    return `${session.address}: ${session.loopback ? 'envía, pero nadie responde' : 'sin eco local'}`;
+  }).join('; ');
+
+  if (sessions.every((session) => !session.joined)) {
+    check.status = 'fail';
+    check.hints.push('El sistema no deja usar multicast: otro programa ocupa el puerto 5353 en exclusiva o falta la ruta 224.0.0.0/4',
+      'El barrido de subred sigue funcionando; mDNS, WS-Discovery y el beacon no');
+  } else if (sessions.every((session) => session.responders.size === 0)) {
+    check.status = 'warn';
+    check.hints.push('Ningún equipo contesta por mDNS: el cortafuegos puede bloquear las respuestas (ver abajo) o la Wi-Fi ' +
+      'aísla a los clientes (aislamiento de AP, red de invitados)',
+    'Conecta el equipo a la misma red (no la de invitados) que el NAS o usa scanTargets');
+  }
+  return check;
+}
+
+async function checkMdnsResolution(sessions) {
+  const check = { id: 'mdns-resolution', title: `Resolución de ${MDNS_HOSTNAME}`, status: 'ok', detail: '', hints: [] };
+  const direct = [...new Set(sessions.flatMap((session) => [...session.resolved]))];
+  const system = await withTimeout(
+    dns.lookup(MDNS_HOSTNAME, { all: true }).then((results) => results.map(({ address }) => address), () => []),
+    CHECK_TIMEOUT,
+    []
+  );
+
+  if (system.length > 0) {
+    return { ...check, detail: `El sistema lo resuelve: ${system.join(', ')}`, addresses: system };
+  }
+  if (direct.length > 0) {
+    check.status = 'warn';
+    check.detail = `Responde por mDNS (${direct.join(', ')}), pero el sistema no resuelve nombres .local`;
+    const fix = {
+      linux: 'Instala avahi-daemon y libnss-mdns (mdns4_minimal en la línea hosts de /etc/nsswitch.conf)',
+      win32: 'Windows 10/11 resuelve .local si no lo ha desactivado una directiva (EnableMulticast); si no, instala Bonjour',
+      darwin: 'Comprueba que mDNSResponder no esté bloqueado por un perfil de configuración o una VPN'
+    }[process.platform];
+    if (fix) check.hints.push(fix);
+    check.hints.push('El Finder lo encuentra igual con su propio mDNS; solo falla abrirlo por nombre');
+    return { ...check, addresses: direct };
+  }
+  check.status = 'warn';
+  check.detail = `${MDNS_HOSTNAME} no responde`;
+  check.hints.push('El NAS puede estar apagado, en otra subred o con otro nombre (Sistema → Red en su panel)');
+  return { ...check, addresses: [] };
+}
+
+/**
+ * Puerta de enlace por defecto, para tener un destino en la LAN al que conectar
+ */
+async function defaultGateways() {
+  if (process.platform === 'linux') {
+    try {
+      return fs.readFileSync('/proc/net/route', 'utf8').split('\n').slice(1)
+        .map((line) => line.trim().split(/\s+/))
+        .filter((fields) => fields[1] === '00000000' && /^[0-9A-F]{8}$/i.test(fields[2] || '') && fields[2] !== '00000000')
+        .map((fields) => Buffer.from(fields[2], 'hex').reverse().join('.'));
+    } catch {
+      return [];
+    }
+  }
+  if (process.platform === 'darwin') {
+    const match = (await output('route', ['-n', 'get', 'default'])).match(/gateway:\s*(\S+)/);
+    return match && net.isIPv4(match[1]) ? [match[1]] : [];
+  }
+  if (process.platform === 'win32') {
+    return [...(await output('route', ['print', '-4', '0.0.0.0'])).matchAll(/^\s*0\.0\.0\.0\s+0\.0\.0\.0\s+(\d+\.\d+\.\d+\.\d+)/gm)]
+      .map((match) => match[1]);
+  }
+  return [];
+}
+
+/**
+ * Conexión TCP: connected (acepta), refused (la rechaza: el paquete llega), blocked
+ * (el propio sistema no deja salir) o timeout (se pierde por el camino)
+ */
+function tryConnect(ip, port) {
+  return new Promise((resolve) => {
+    const socket = net.createConnection({ host: ip, port });
+    const finish = (state, code) => {
+      socket.destroy();
+      resolve({ ip, state, code });
+    };
+    socket.setTimeout(CHECK_TIMEOUT, () => finish('timeout'));
+    socket.once('connect', () => finish('connected'));
+    socket.once('error', (err) => {
+      if (err.code === 'ECONNREFUSED') finish('refused', err.code);
+      else if (err.code === 'EACCES' || err.code === 'EPERM') finish('blocked', err.code);
+      else finish('timeout', err.code);
+    });
+  });
+}
+
+async function checkOutbound(knownHosts, resolved) {
+  const check = { id: 'outbound-443', title: 'Conexiones salientes al 443', status: 'ok', detail: '', hints: [] };
+  const gateways = await defaultGateways();
+  const targets = [...new Set([...knownHosts, ...resolved, ...gateways])].filter((ip) => net.isIPv4(ip)).slice(0, MAX_PORT_TARGETS);
+  if (targets.length === 0) return { ...check, status: 'skip', detail: 'Sin NAS conocidos ni puerta de enlace a los que probar' };
+
+  const results = await Promise.all(targets.map((ip) => tryConnect(ip, HTTPS_PORT)));
+  const label = { connected: 'abierto', refused: 'cerrado (pero responde)', blocked: 'bloqueado por este equipo', timeout: 'sin respuesta' };
+  check.detail = results.map(({ ip, state }) => `${ip}${gateways.includes(ip) ? ' (router)' : ''}: ${label[state]}`).join(', ');
+
+  if (results.some(({ state }) => state === 'blocked')) {
+    check.status = 'fail';
+    check.hints.push('Un cortafuegos o antivirus de este equipo no deja abrir conexiones: permite node (o HomePiNAS Finder) en la red local');
+  } else if (results.every(({ state }) => state === 'timeout')) {
+    check.status = 'warn';
+    check.hints.push('Nada responde en la LAN: ¿está el equipo en la misma red que el NAS?, ¿lo filtra un cortafuegos saliente?');
+  }
+  return check;
+}
+
+/**
+ * Cortafuegos activo del sistema, con lo que hay que abrir para el descubrimiento
+ */
+async function checkFirewall(interfaces) {
+  const check = { id: 'firewall', title: 'Cortafuegos', status: 'ok', detail: '', hints: [] };
+
+  if (process.platform === 'linux') {
+    const active = [];
+    if (await output('systemctl', ['is-active', 'firewalld']) === 'active') active.push('firewalld');
+    try {
+      if (/^ENABLED=yes/m.test(fs.readFileSync('/etc/ufw/ufw.conf', 'utf8'))) active.push('ufw');
+    } catch {
+      // Sin ufw
+    }
+    if (active.length === 0) return { ...check, detail: 'firewalld y ufw inactivos (las reglas de nftables/iptables no se ven sin root)' };
+    check.status = 'warn';
+    check.detail = `${active.join(' y ')} activo: debe dejar entrar ${DISCOVERY_PORTS} desde la LAN`;
+    if (active.includes('firewalld')) {
+      check.hints.push('sudo firewall-cmd --permanent --add-service=mdns --add-port=3702/udp ' +
+        `--add-port=${BEACON_PORT}/udp && sudo firewall-cmd --reload`);
+    }
+    if (active.includes('ufw')) {
+      const subnets = interfaces.filter(({ address }) => isPrivateAddress(address)).map(({ address, prefix }) => {
+        const mask = prefix === 0 ? 0 : (0xffffffff << (32 - prefix)) >>> 0;
+        return `${intToIpv4((ipv4ToInt(address) & mask) >>> 0)}/${prefix}`;
+      });
+      for (const subnet of subnets.length > 0 ? subnets : ['<subred de casa>']) {
+        check.hints.push(`sudo ufw allow from ${subnet} to any port 5353,3702,${BEACON_PORT} proto udp`);
+      }
+    }
+    return check;
+  }
+
+  if (process.platform === 'darwin') {
+    const tool = '/usr/libexec/ApplicationFirewall/socketfilterfw';
+    const state = await output(tool, ['--getglobalstate']);
+    if (!state) return { ...check, status: 'skip', detail: 'No se pudo consultar el cortafuegos de macOS' };
+    if (!/enabled/i.test(state)) return { ...check, detail: 'Cortafuegos de macOS desactivado' };
+    const blockAll = /enabled/i.test(await output(tool, ['--getblockall']));
+    check.status = 'warn';
+    check.detail = `Cortafuegos de macOS activo${blockAll ? ' y bloqueando todas las conexiones entrantes' : ''}`;
+    check.hints.push(blockAll
+      ? 'Desactiva "Bloquear todas las conexiones entrantes" (Ajustes → Red → Cortafuegos → Opciones): corta las respuestas mDNS'
+      : 'Si macOS preguntó al arrancar el Finder, permite las conexiones entrantes de node / HomePiNAS Finder');
+    return check;
+  }
+
+  if (process.platform === 'win32') {
+    const categories = await output('powershell.exe', ['-NoProfile', '-NonInteractive', '-Command',
+      '(Get-NetConnectionProfile).NetworkCategory']);
+    if (!categories) return { ...check, status: 'skip', detail: 'No se pudo consultar el perfil de red' };
+    check.detail = `Perfil de red: ${categories.split(/\r?\n/).join(', ')}`;
+    if (/Public/i.test(categories)) {
+      check.status = 'warn';
+      check.hints.push('La red está como Pública: Windows bloquea el descubrimiento. Cámbiala a Privada ' +
+        '(Configuración → Red e Internet → propiedades de la conexión)',
+      `Y permite node / HomePiNAS Finder en el Firewall de Windows para redes privadas (${DISCOVERY_PORTS})`);
+    }
+    return check;
+  }
+
+  return { ...check, status: 'skip', detail: `Sin comprobación para ${process.platform}` };
+}
+
+/**
+ * Todas las comprobaciones; `knownHosts` son IPs de NAS ya vistos (inventario)
+ */
+async function runDoctor({ knownHosts = [] } = {}) {
+  const interfaces = getLocalInterfaces();
+  const sessions = await Promise.all(interfaces.map(({ address }) => mdnsSession(address)));
+  const resolution = await checkMdnsResolution(sessions);
+  const { addresses, ...resolutionCheck } = resolution;
+
+  return [
+    checkInterfaces(interfaces),
+    checkMulticast(sessions),
+    resolutionCheck,
+    await checkOutbound(knownHosts, addresses),
+    await checkFirewall(interfaces)
+  ];
+}
+
+module.exports = { runDoctor, MDNS_HOSTNAME };
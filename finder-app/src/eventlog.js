@@ -0,0 +1,67 @@
+/**
+ * Registro de eventos de Windows (registro Aplicación) con eventcreate
+ * El origen hay que registrarlo una vez como administrador (lo hace `service install`);
+ * después cualquier usuario puede escribir con él
+ */
+const { execFile } = require('child_process');
+
+const DEFAULT_SOURCE = 'HomePiNAS Finder';
+const TYPES = { error: 'ERROR', warning: 'WARNING', info: 'INFORMATION' };
+const MAX_MESSAGE = 31000; // eventcreate corta los mensajes largos
+// Ids de los mensajes de registro (los eventos de descubrimiento usan 100-104)
+const LOG_IDS = { debug: 200, info: 200, warn: 201, error: 202 };
+const LOG_TYPES = { debug: 'info', info: 'info', warn: 'warning', error: 'error' };
+
+function eventcreate(args) {
+  return new Promise((resolve, reject) => {
+    execFile('eventcreate', args, { timeout: 10000, windowsHide: true }, (err, stdout, stderr) => {
+      if (err) reject(new Error((stderr || stdout || err.message).trim()));
+      else resolve();
+    });
+  });
+}
+
+/**
+ * Escritor del registro de eventos: write({ level: error|warning|info, id (1..1000), message })
+ */
+function createEventLogWriter({ source = DEFAULT_SOURCE } = {}) {
+  if (process.platform !== 'win32') throw new Error('El registro de eventos solo existe en Windows');
+
+  return {
+    write({ level = 'info', id = 1, message }) {
+      return eventcreate([
+        '/L', 'APPLICATION',
+        '/SO', source,
+        '/T', TYPES[level] || TYPES.info,
+        '/ID', String(id),
+        '/D', String(message).slice(0, MAX_MESSAGE)
+      ]);
+    }
+  };
+}
+
+/**
+ * Registra `source` escribiendo un primer evento (necesita permisos de administrador)
+ */
+function registerEventSource(source = DEFAULT_SOURCE) {
+  return createEventLogWriter({ source }).write({ level: 'info', id: 1, message: `${source}: origen de eventos registrado` });
+}
+
+/**
+ * Destino de log.js (addLogSink) hacia el registro de eventos; cada mensaje lanza un
+ * eventcreate, así que conviene limitarlo a warn. `onError` recibe el primer fallo
+ */
+function createEventLogSink(options, onError = () => {}) {
+  const writer = createEventLogWriter(options);
+  let failed = false;
+
+  return ({ level, text }) => {
+    writer.write({ level: LOG_TYPES[level], id: LOG_IDS[level], message: text }).catch((err) => {
+      if (failed) return;
+      failed = true;
+      onError(err);
+    });
+  };
+}
+
+module.exports = { DEFAULT_SOURCE, createEventLogWriter, createEventLogSink, registerEventSource };
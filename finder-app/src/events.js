@@ -0,0 +1,117 @@
+/**
+ * Seguimiento de disponibilidad entre escaneos
+ * Compara cada resultado con los anteriores y genera eventos:
+ *   discovered - primera vez que se ve el dispositivo
+ *   online     - vuelve a aparecer tras no estar en el escaneo anterior
+ *   offline    - estaba en el escaneo anterior y ya no responde
+ *   changed    - sigue ahí pero ha cambiado de versión, nombre o IP
+ *   cert-changed - su certificado TLS (o la clave del beacon) no es el fijado en el
+ *                  primer contacto: posible suplantación. Se avisa una vez, no en cada escaneo
+ *
+ * Un dispositivo se reconoce por su MAC o, si no hay otra cosa, por una IP en común;
+ * así un NAS que cambia de IP por DHCP es un `changed` y no un offline + discovered.
+ * El hostname no identifica: dos equipos pueden anunciar el mismo (pinas.local)
+ */
+function createAvailabilityTracker() {
+  // id interno -> último dispositivo visto
+  const known = new Map();
+  let online = new Set();
+  let nextId = 0;
+
+  return {
+    update(devices) {
+      const events = [];
+      const timestamp = new Date().toISOString();
+      const current = new Set();
+
+      for (const device of devices) {
+        const id = findKnown(known, device, current) ?? nextId++;
+        const previous = known.get(id);
+        current.add(id);
+
+        if (!previous) {
+          events.push({ type: 'discovered', device, timestamp });
+        } else if (!online.has(id)) {
+          events.push({ type: 'online', device, timestamp });
+        } else if (hasChanged(previous, device)) {
+          events.push({ type: 'changed', device, previous, timestamp });
+        }
+        if (isTrustBroken(device) && !(previous && isTrustBroken(previous))) {
+          events.push({ type: 'cert-changed', device, timestamp });
+        }
+        known.set(id, device);
+      }
+
+      for (const id of online) {
+        if (!current.has(id)) {
+          events.push({ type: 'offline', device: known.get(id), timestamp });
+        }
+      }
+
+      online = current;
+      return events;
+    }
+  };
+}
+
+/**
+ * id del dispositivo ya conocido que es este: misma MAC o alguna IP en común (la IP solo
+ * si las MAC no se contradicen). Se ignoran los ya emparejados en este escaneo
+ * Entre varios con la misma IP desempata el hostname, pero nunca basta por sí solo
+ */
+function findKnown(known, device, taken) {
+  const candidates = [...known].filter(([id]) => !taken.has(id));
+
+  const byMac = device.mac && candidates.find(([, previous]) => previous.mac === device.mac);
+  if (byMac) return byMac[0];
+
+  const addresses = deviceAddresses(device);
+  const byIp = candidates.filter(([, previous]) =>
+    deviceAddresses(previous).some((ip) => addresses.includes(ip)) &&
+    !(previous.mac && device.mac && previous.mac !== device.mac));
+  const hostname = hostKey(device.hostname);
+  const byName = hostname && byIp.find(([, previous]) => hostKey(previous.hostname) === hostname);
+  return (byName || byIp[0])?.[0] ?? null;
+}
+
+// IP principal y las demás de un NAS de doble pila (`addresses`)
+const deviceAddresses = (device) => [device.ip, ...device.addresses || []].filter(Boolean);
+const hostKey = (hostname) => String(hostname || '').toLowerCase().replace(/\.local$/, '');
+
+function isTrustBroken(device) {
+  return Boolean(device.certChanged || device.keyChanged);
+}
+
+function hasChanged(previous, device) {
+  return Boolean(device.version && previous.version && device.version !== previous.version) ||
+    previous.name !== device.name ||
+    previous.ip !== device.ip;
+}
+
+/**
+ * Texto corto y legible para un evento
+ */
+function describeEvent(event) {
+  const { device } = event;
+  const label = `${device.name || 'HomePiNAS'} (${device.ip})`;
+
+  switch (event.type) {
+    case 'discovered':
+      return `Nuevo HomePiNAS encontrado: ${label}`;
+    case 'online':
+      return `${label} vuelve a estar en línea`;
+    case 'offline':
+      return `${label} ha dejado de responder`;
+    case 'changed':
+      if (event.previous && event.previous.ip !== device.ip) {
+        return `${label} ha cambiado de IP (antes ${event.previous.ip})`;
+      }
+      return `${label} ha cambiado${device.version ? ` (versión ${device.version})` : ''}`;
+    case 'cert-changed':
+      return `ATENCIÓN: ${label} presenta un certificado distinto del primer contacto (posible suplantación)`;
+    default:
+      return `${label}: ${event.type}`;
+  }
+}
+
+module.exports = { createAvailabilityTracker, describeEvent, findKnown };
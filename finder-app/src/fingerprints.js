@@ -0,0 +1,126 @@
+/**
+ * Detectores: huellas para reconocer un HomePiNAS a partir de una respuesta HTTP
+ *
+ * Cada detector es un dato; se compila al registrarlo y se evalúan por prioridad
+ * (de mayor a menor) sobre la respuesta ya parseada. Gana el primero que encaja.
+ * Campos admitidos:
+ *   priority   - orden de evaluación (mayor primero)
+ *   confidence - 0..1, lo seguro que es el positivo; se copia al dispositivo
+ *   endpoints  - rutas que hay que pedir para que pueda encajar (se suman a las sondeadas)
+ *   status     - lista de códigos HTTP aceptados
+ *   json       - { campo: RegExp | true } sobre el cuerpo JSON (true = presente)
+ *   notJson    - el cuerpo no debe ser JSON
+ *   body       - RegExp sobre el cuerpo en bruto
+ *   headers    - { cabecera: RegExp }
+ *   cert       - { campo del subject: RegExp } del certificado TLS
+ *   detect     - función (res) => boolean para lo que no cabe en los campos anteriores
+ *
+ * Nuevas generaciones o marcas blancas se añaden con registerDetector(), sin tocar el escáner
+ */
+// Ninguno vale para "responde pero no es JSON": con HTTPS y HTTP sondeados en cada host,
+// cualquier router, impresora o cámara de la red saldría como HomePiNAS
+const FINGERPRINTS = [
+  { name: 'system-info', priority: 100, confidence: 1, endpoints: ['/api/system/info'], json: { product: /^HomePiNAS$/ } },
+  { name: 'system-hostname', priority: 90, confidence: 0.8, endpoints: ['/api/system/info'], json: { hostname: true } },
+  { name: 'system-status', priority: 80, confidence: 0.8, endpoints: ['/api/system/status'], json: { poolConfigured: true } },
+  { name: 'install-cert', priority: 70, confidence: 0.9, cert: { O: /^HomePiNAS$/ } },
+  { name: 'dashboard-title', priority: 60, confidence: 0.7, body: /<title>[^<]*HomePiNAS/i }
+];
+
+/**
+ * Convierte una huella en un predicado sobre la respuesta parseada
+ */
+function compile(fingerprint) {
+  const checks = [];
+
+  if (fingerprint.status) {
+    const codes = new Set(fingerprint.status);
+    checks.push((res) => codes.has(res.statusCode));
+  }
+  if (fingerprint.notJson) {
+    checks.push((res) => res.json === null);
+  }
+  if (fingerprint.json) {
+    for (const [field, rule] of Object.entries(fingerprint.json)) {
+      checks.push((res) => {
+        if (!res.json || !(field in res.json)) return false;
+        return rule === true ? Boolean(res.json[field]) : rule.test(String(res.json[field]));
+      });
+    }
+  }
+  if (fingerprint.body) {
+    checks.push((res) => fingerprint.body.test(res.body));
+  }
+  if (fingerprint.headers) {
+    for (const [header, rule] of Object.entries(fingerprint.headers)) {
+      checks.push((res) => rule.test(res.headers?.[header.toLowerCase()] || ''));
+    }
+  }
+  if (fingerprint.cert) {
+    for (const [field, rule] of Object.entries(fingerprint.cert)) {
+      checks.push((res) => Boolean(res.cert) && rule.test(res.cert.subject?.[field] || ''));
+    }
+  }
+  if (fingerprint.detect) {
+    checks.push((res) => {
+      try {
+        return Boolean(fingerprint.detect(res));
+      } catch {
+        // Un detector roto no debe tumbar el sondeo
+        return false;
+      }
+    });
+  }
+
+  return {
+    name: fingerprint.name,
+    priority: fingerprint.priority ?? 50,
+    confidence: Math.min(Math.max(fingerprint.confidence ?? 0.5, 0), 1),
+    endpoints: fingerprint.endpoints || [],
+    test: (res) => checks.every((check) => check(res))
+  };
+}
+
+const MATCHERS = [];
+
+/**
+ * Añade un detector (mismo formato que FINGERPRINTS); sustituye al que tenga el mismo nombre
+ */
+function registerDetector(fingerprint) {
+  if (!fingerprint?.name) throw new Error('El detector necesita un nombre');
+  const matcher = compile(fingerprint);
+  const existing = MATCHERS.findIndex((m) => m.name === matcher.name);
+  if (existing !== -1) MATCHERS.splice(existing, 1);
+  // Estable: a igual prioridad, el orden de registro
+  const index = MATCHERS.findIndex((m) => m.priority < matcher.priority);
+  MATCHERS.splice(index === -1 ? MATCHERS.length : index, 0, matcher);
+}
+
+FINGERPRINTS.forEach(registerDetector);
+
+/**
+ * Rutas a sondear en cada host: las que piden los detectores, por prioridad
+ */
+function probeEndpoints() {
+  return [...new Set(MATCHERS.flatMap((m) => m.endpoints))];
+}
+
+/**
+ * Primer detector (por prioridad) que encaja con la respuesta, o null
+ * Con `minConfidence` se ignoran los de confianza menor
+ * `res` = { statusCode, headers, body, cert }; el JSON se parsea una sola vez
+ */
+function matchFingerprint(res, minConfidence = 0) {
+  let json = null;
+  try {
+    json = JSON.parse(res.body);
+  } catch {
+    // Cuerpo no JSON: solo aplican las huellas de cuerpo/cabeceras/certificado
+  }
+
+  const parsed = { ...res, json: json && typeof json === 'object' ? json : null };
+  const matcher = MATCHERS.find((m) => m.confidence >= minConfidence && m.test(parsed));
+  return matcher ? { name: matcher.name, confidence: matcher.confidence, json: parsed.json } : null;
+}
+
+module.exports = { FINGERPRINTS, matchFingerprint, registerDetector, probeEndpoints };
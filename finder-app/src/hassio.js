@@ -0,0 +1,67 @@
+/**
+ * Complemento de Home Assistant (serve --container con SUPERVISOR_TOKEN): cada NAS del
+ * inventario como una entidad binary_sensor.homepinas_<id> de conectividad, a través de la
+ * API de Home Assistant que el Supervisor da a los complementos (homeassistant_api)
+ *
+ * Son estados sin registro: Home Assistant no los conserva al reiniciarse (vuelven con el
+ * siguiente escaneo) ni se pueden renombrar desde su interfaz. Para dispositivos completos
+ * sigue estando MQTT discovery (mqtt en config.json)
+ */
+const log = require('./log');
+const { postJson, mqttDeviceId } = require('./notify');
+
+const SUPERVISOR_URL = 'http://supervisor';
+
+/**
+ * ¿Corre como complemento? El Supervisor pone SUPERVISOR_TOKEN a todos sus complementos
+ */
+function isAddon() {
+  return Boolean(process.env.SUPERVISOR_TOKEN);
+}
+
+/**
+ * Estado de Home Assistant de un NAS del inventario; el mismo <id> que en MQTT (MAC o hostname)
+ */
+function deviceState(device) {
+  return {
+    entityId: `binary_sensor.homepinas_${mqttDeviceId(device)}`,
+    state: {
+      state: device.online ? 'on' : 'off',
+      attributes: {
+        friendly_name: device.alias || device.name || device.ip,
+        device_class: 'connectivity',
+        icon: 'mdi:nas',
+        ip: device.ip,
+        url: device.url || null,
+        version: device.version || null,
+        mac: device.mac || null,
+        last_seen: device.lastSeen || null
+      }
+    }
+  };
+}
+
+/**
+ * Publicador de los NAS en Home Assistant; `publish(devices)` nunca rechaza: un fallo de
+ * la API (Home Assistant reiniciándose) solo se avisa y se repite tras el siguiente escaneo
+ */
+function createSupervisorPublisher({ token = process.env.SUPERVISOR_TOKEN, url = SUPERVISOR_URL } = {}) {
+  if (!token) throw new Error('Falta SUPERVISOR_TOKEN: solo disponible como complemento de Home Assistant');
+  const headers = { Authorization: `Bearer ${token}` };
+
+  return {
+    async publish(devices) {
+      const results = await Promise.allSettled(devices.map((device) => {
+        const { entityId, state } = deviceState(device);
+        return postJson(`${url}/core/api/states/${entityId}`, state, headers);
+      }));
+      const failed = results.filter((result) => result.status === 'rejected');
+      if (failed.length > 0) {
+        log.warn(`[HomeAssistant] No se pudieron publicar ${failed.length} de ${devices.length} NAS: ${failed[0].reason.message}`);
+      }
+      return devices.length - failed.length;
+    }
+  };
+}
+
+module.exports = { isAddon, deviceState, createSupervisorPublisher };
@@ -0,0 +1,105 @@
+const fs = require('fs');
+const path = require('path');
+const log = require('./log');
+const { getConfigDir } = require('./config');
+const { findKnown } = require('./events');
+
+const STORE_FILE = 'scan-history.json';
+// Escaneos que se conservan; los más antiguos se descartan
+const MAX_SNAPSHOTS = 100;
+const SNAPSHOT_FIELDS = ['ip', 'name', 'hostname', 'version', 'mac', 'url', 'method'];
+
+/**
+ * Historial de escaneos completos: una instantánea de los NAS encontrados en cada uno
+ * Con `file` null solo vive en memoria (la red simulada no debe tocar el historial real)
+ */
+function openHistory(file = path.join(getConfigDir(), STORE_FILE)) {
+  let data = { nextId: 1, scans: [] };
+  let dirty = false;
+
+  try {
+    if (file !== null) data = { ...data, ...JSON.parse(fs.readFileSync(file, 'utf8')) };
+  } catch (err) {
+    if (err.code !== 'ENOENT') {
+      log.warn(`[History] No se pudo leer ${file}: ${err.message}`);
+    }
+  }
+
+  return {
+    /**
+     * Guarda la instantánea de un escaneo; `status` es getScanStatus() al terminar
+     */
+    add(devices, status = {}) {
+      const snapshot = {
+        id: data.nextId++,
+        startedAt: status.startedAt || new Date().toISOString(),
+        finishedAt: status.finishedAt || new Date().toISOString(),
+        devices: devices.map((device) => Object.fromEntries(SNAPSHOT_FIELDS
+          .filter((field) => device[field] !== undefined && device[field] !== '')
+          .map((field) => [field, device[field]])))
+      };
+      data.scans = [...data.scans, snapshot].slice(-MAX_SNAPSHOTS);
+      dirty = true;
+      return snapshot;
+    },
+
+    /**
+     * Resumen de cada escaneo, del más reciente al más antiguo
+     */
+    list() {
+      return data.scans
+        .map(({ id, startedAt, finishedAt, devices }) => ({ id, startedAt, finishedAt, found: devices.length }))
+        .reverse();
+    },
+
+    /**
+     * Escaneo por id; "latest" es el último y "previous" el anterior
+     */
+    get(ref) {
+      const { scans } = data;
+      if (ref === 'latest') return scans[scans.length - 1] || null;
+      if (ref === 'previous') return scans[scans.length - 2] || null;
+      return scans.find((scan) => scan.id === Number(ref)) || null;
+    },
+
+    save() {
+      if (!dirty || file === null) return;
+      fs.mkdirSync(path.dirname(file), { recursive: true });
+      const tmp = `${file}.tmp`;
+      fs.writeFileSync(tmp, JSON.stringify(data, null, 2), { mode: 0o600 });
+      fs.renameSync(tmp, file);
+      dirty = false;
+    }
+  };
+}
+
+/**
+ * Diferencias entre dos escaneos: NAS que aparecen, que desaparecen, que cambian de IP
+ * y que cambian de versión. Cada NAS se empareja por MAC o IP (ver events.js)
+ */
+function diffScans(from, to) {
+  const before = new Map(from.devices.map((device, i) => [i, device]));
+  const matched = new Set();
+  const diff = { from: from.id, to: to.id, appeared: [], vanished: [], moved: [], updated: [] };
+
+  for (const device of to.devices) {
+    const index = findKnown(before, device, matched);
+    if (index === null) {
+      diff.appeared.push(device);
+      continue;
+    }
+    matched.add(index);
+    const previous = before.get(index);
+    if (previous.ip !== device.ip) diff.moved.push({ ...device, previousIp: previous.ip });
+    if (previous.version && device.version && previous.version !== device.version) {
+      diff.updated.push({ ...device, previousVersion: previous.version });
+    }
+  }
+
+  for (const [index, device] of before) {
+    if (!matched.has(index)) diff.vanished.push(device);
+  }
+  return diff;
+}
+
+module.exports = { openHistory, diffScans };
@@ -0,0 +1,135 @@
+const { execFile } = require('child_process');
+const fs = require('fs');
+const os = require('os');
+const path = require('path');
+
+const BEGIN_MARKER = '# BEGIN homepinas-finder';
+const END_MARKER = '# END homepinas-finder';
+
+function defaultHostsPath() {
+  return process.platform === 'win32'
+    ? path.join(process.env.SystemRoot || 'C:\\Windows', 'System32', 'drivers', 'etc', 'hosts')
+    : '/etc/hosts';
+}
+
+// Una etiqueta DNS (RFC 1123): sin puntos, hasta 63 caracteres
+const LABEL = /^[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?$/;
+// Nombres que ya resuelve el propio sistema o que los navegadores consultan solos (WPAD, ISATAP)
+const RESERVED_LABELS = new Set([
+  'localhost', 'localdomain', 'local', 'broadcasthost', 'ip6-localhost', 'ip6-loopback',
+  'ip6-localnet', 'ip6-mcastprefix', 'ip6-allnodes', 'ip6-allrouters', 'ip6-allhosts', 'wpad', 'isatap'
+]);
+
+/**
+ * Sufijo de los nombres del bloque hosts (hostsSuffix en config.json): `local` o un dominio
+ * propio como `home.arpa`; lanza si no es un nombre DNS válido
+ */
+function hostsSuffix(value = 'local') {
+  const suffix = String(value).toLowerCase().replace(/^\.+|\.+$/g, '');
+  const labels = suffix.split('.');
+  if (suffix.length > 190 || !labels.every((label) => LABEL.test(label)) || labels.includes('localhost')) {
+    throw new Error(`hostsSuffix no válido: "${value}"`);
+  }
+  return suffix;
+}
+
+/**
+ * Etiqueta DNS de un NAS para el fichero hosts o '' si no lo es: se admite `nombre`,
+ * `nombre.local` o `nombre.<suffix>`. Cualquier otro nombre con puntos (accounts.google.com)
+ * y los reservados (localhost, wpad...) se descartan: el bloque no puede desviar otros dominios
+ */
+function toHostName(value, suffix = 'local') {
+  let name = String(value || '')
+    .toLowerCase()
+    .normalize('NFD').replace(/[\u0300-\u036f]/g, '')
+    .replace(/\.$/, '');
+  const ending = ['.local', `.${suffix}`].find((candidate) => name.endsWith(candidate));
+  if (ending) name = name.slice(0, -ending.length);
+  name = name.replace(/[^a-z0-9.-]+/g, '-').replace(/^-+|-+$/g, '');
+  return LABEL.test(name) && !RESERVED_LABELS.has(name) ? name : '';
+}
+
+/**
+ * Bloque nombre→IP en formato /etc/hosts, delimitado por marcadores; cada NAS como
+ * `<etiqueta>.<suffix>`
+ */
+function renderHostsSnippet(devices, { suffix = 'local' } = {}) {
+  const domain = hostsSuffix(suffix);
+  const lines = [BEGIN_MARKER];
+
+  for (const device of devices) {
+    const labels = [toHostName(device.hostname, domain), toHostName(device.name, domain)].filter(Boolean);
+    const names = [...new Set(labels)].map((label) => `${label}.${domain}`);
+    if (names.length > 0) {
+      lines.push(`${device.ip}\t${names.join(' ')}`);
+    }
+  }
+
+  lines.push(END_MARKER);
+  return lines.join(os.EOL) + os.EOL;
+}
+
+/**
+ * Sustituye (o añade) el bloque marcado conservando el resto del fichero
+ */
+function replaceBlock(content, snippet) {
+  const start = content.indexOf(BEGIN_MARKER);
+  const end = content.indexOf(END_MARKER);
+
+  if (start !== -1 && end > start) {
+    const after = content.slice(end + END_MARKER.length).replace(/^\r?\n/, '');
+    return content.slice(0, start) + snippet + after;
+  }
+
+  const separator = content === '' || content.endsWith('\n') ? '' : os.EOL;
+  return content + separator + snippet;
+}
+
+/**
+ * Copia `source` sobre `target` con privilegios de administrador
+ */
+function copyElevated(source, target) {
+  return new Promise((resolve, reject) => {
+    const done = (err) => (err ? reject(new Error(`No se pudo elevar privilegios: ${err.message}`)) : resolve());
+
+    if (process.platform === 'linux') {
+      execFile('pkexec', ['cp', source, target], done);
+    } else if (process.platform === 'darwin') {
+      const quote = (value) => `'${value.replace(/'/g, `'\\''`)}'`;
+      const script = `do shell script "cp ${quote(source)} ${quote(target)}" with administrator privileges`;
+      execFile('osascript', ['-e', script], done);
+    } else {
+      reject(new Error('Ejecuta HomePiNAS Finder como administrador para modificar el fichero hosts'));
+    }
+  });
+}
+
+/**
+ * Actualiza el bloque del Finder en el fichero hosts
+ * Intenta escribir directamente y, si no hay permisos, pide elevación al sistema
+ */
+async function updateHostsFile(devices, file = defaultHostsPath(), options = {}) {
+  const current = fs.readFileSync(file, 'utf8');
+  const updated = replaceBlock(current, renderHostsSnippet(devices, options));
+  if (updated === current) return false;
+
+  try {
+    fs.writeFileSync(file, updated);
+  } catch (err) {
+    if (err.code !== 'EACCES' && err.code !== 'EPERM') throw err;
+
+    // Directorio propio (0700) y fichero nuevo: nadie puede dejar antes un enlace con ese nombre
+    const dir = fs.mkdtempSync(path.join(os.tmpdir(), 'homepinas-hosts-'));
+    try {
+      const temp = path.join(dir, 'hosts');
+      fs.writeFileSync(temp, updated, { flag: 'wx', mode: 0o644 });
+      await copyElevated(temp, file);
+    } finally {
+      fs.rmSync(dir, { recursive: true, force: true });
+    }
+  }
+
+  return true;
+}
+
+module.exports = { renderHostsSnippet, replaceBlock, updateHostsFile, defaultHostsPath, toHostName, hostsSuffix };
@@ -0,0 +1,81 @@
+/**
+ * Una sola instancia de serve por directorio de configuración: un fichero de bloqueo
+ * con el pid y la URL de la que ya está corriendo. Un segundo arranque la encuentra
+ * y abre esa URL en vez de levantar otro servidor
+ */
+const fs = require('fs');
+const path = require('path');
+const { execFile } = require('child_process');
+const { getConfigDir } = require('./config');
+
+const LOCK_FILE = 'serve.lock';
+
+function isAlive(pid) {
+  try {
+    process.kill(pid, 0);
+    return true;
+  } catch (err) {
+    // EPERM: existe, pero es de otro usuario
+    return err.code === 'EPERM';
+  }
+}
+
+function readLock(file) {
+  try {
+    const lock = JSON.parse(fs.readFileSync(file, 'utf8'));
+    return Number.isInteger(lock.pid) && typeof lock.url === 'string' ? lock : null;
+  } catch {
+    return null;
+  }
+}
+
+/**
+ * Toma el bloqueo para `url`: { acquired: true, release() } o, si otra instancia
+ * viva lo tiene, { acquired: false, pid, url } con los datos de esa instancia
+ * Un bloqueo de un proceso que ya no existe (se cerró de golpe) se sustituye
+ */
+function acquireLock(url, { dir = getConfigDir() } = {}) {
+  const file = path.join(dir, LOCK_FILE);
+  fs.mkdirSync(dir, { recursive: true });
+
+  for (let attempt = 0; attempt < 2; attempt++) {
+    try {
+      fs.writeFileSync(file, JSON.stringify({ pid: process.pid, url, startedAt: new Date().toISOString() }), { flag: 'wx', mode: 0o600 });
+      return {
+        acquired: true,
+        release() {
+          // Solo se borra si sigue siendo el nuestro
+          if (readLock(file)?.pid === process.pid) fs.rmSync(file, { force: true });
+        }
+      };
+    } catch (err) {
+      if (err.code !== 'EEXIST') throw err;
+    }
+
+    const lock = readLock(file);
+    if (lock && lock.pid !== process.pid && isAlive(lock.pid)) {
+      return { acquired: false, pid: lock.pid, url: lock.url };
+    }
+    fs.rmSync(file, { force: true });
+  }
+  throw new Error(`No se pudo crear ${file}`);
+}
+
+/**
+ * Abre `url` en el navegador por defecto; rechaza si no hay con qué (máquinas sin escritorio)
+ */
+function openBrowser(url) {
+  if (process.platform === 'linux' && !process.env.DISPLAY && !process.env.WAYLAND_DISPLAY) {
+    return Promise.reject(new Error('no hay entorno gráfico'));
+  }
+  const [command, args] = process.platform === 'darwin'
+    ? ['open', [url]]
+    : process.platform === 'win32'
+      ? ['cmd', ['/c', 'start', '""', url.replace(/&/g, '^&')]]
+      : ['xdg-open', [url]];
+  return new Promise((resolve, reject) => {
+    execFile(command, args, { timeout: 10000, windowsHide: true }, (err) => (err ? reject(err) : resolve()));
+  });
+}
+
+module.exports = { acquireLock, openBrowser };
@@ -0,0 +1,70 @@
+const crypto = require('crypto');
+const fs = require('fs');
+const path = require('path');
+
+const MANIFEST_FILE = 'integrity.json';
+
+/**
+ * Ficheros de la app que entran en el manifiesto (todo src/ salvo el propio manifiesto)
+ */
+function listFiles(dir) {
+  return fs.readdirSync(dir, { withFileTypes: true })
+    .flatMap((entry) => {
+      const full = path.join(dir, entry.name);
+      if (entry.isDirectory()) return listFiles(full);
+      return entry.name === MANIFEST_FILE ? [] : [full];
+    })
+    .sort();
+}
+
+function hashFile(file) {
+  return crypto.createHash('sha256').update(fs.readFileSync(file)).digest('hex');
+}
+
+/**
+ * Genera el manifiesto SHA-256 de `dir` (se ejecuta al empaquetar)
+ */
+function writeManifest(dir) {
+  const files = {};
+  for (const file of listFiles(dir)) {
+    files[path.relative(dir, file).split(path.sep).join('/')] = hashFile(file);
+  }
+
+  fs.writeFileSync(path.join(dir, MANIFEST_FILE), JSON.stringify({ files }, null, 2) + '\n');
+  return Object.keys(files).length;
+}
+
+/**
+ * Comprueba los ficheros contra el manifiesto, y que no sobra ninguno: un .js añadido
+ * a src/ se cargaría igual con un require
+ * Devuelve { checked: false } en desarrollo (sin manifiesto) o la lista de problemas
+ */
+function verifyManifest(dir) {
+  let manifest;
+  try {
+    manifest = JSON.parse(fs.readFileSync(path.join(dir, MANIFEST_FILE), 'utf8'));
+  } catch (err) {
+    if (err.code === 'ENOENT') return { checked: false, problems: [] };
+    return { checked: true, problems: [`${MANIFEST_FILE}: ${err.message}`] };
+  }
+
+  const problems = [];
+  const expectedFiles = manifest.files || {};
+  for (const [name, expected] of Object.entries(expectedFiles)) {
+    try {
+      if (hashFile(path.join(dir, name)) !== expected) {
+        problems.push(`${name}: checksum distinto`);
+      }
+    } catch {
+      problems.push(`${name}: no encontrado`);
+    }
+  }
+  for (const file of listFiles(dir)) {
+    const name = path.relative(dir, file).split(path.sep).join('/');
+    if (!Object.hasOwn(expectedFiles, name)) problems.push(`${name}: no está en el manifiesto`);
+  }
+
+  return { checked: true, problems };
+}
+
+module.exports = { writeManifest, verifyManifest };
@@ -0,0 +1,177 @@
+const crypto = require('crypto');
+const fs = require('fs');
+const path = require('path');
+const log = require('./log');
+const { getConfigDir } = require('./config');
+const { findKnown } = require('./events');
+
+const STORE_FILE = 'inventory.json';
+// Datos del dispositivo que se guardan (el resto cambia en cada escaneo o no interesa)
+const DEVICE_FIELDS = ['ip', 'addresses', 'name', 'hostname', 'version', 'url', 'method', 'mac', 'vendor', 'model'];
+const MAX_ALIAS_LENGTH = 64;
+const MAX_TAGS = 20;
+const MAX_TAG_LENGTH = 32;
+const MAX_NOTES_LENGTH = 2000;
+
+/**
+ * Etiqueta normalizada: sin espacios a los lados y en minúsculas ("Backup" = "backup")
+ */
+function normalizeTag(tag) {
+  return String(tag).trim().toLowerCase();
+}
+
+// Campos que edita el usuario: validación y normalización de cada uno
+const EDITABLE = {
+  alias: (value) => {
+    if (typeof value !== 'string') throw new Error('El alias debe ser texto');
+    const alias = value.trim();
+    if (alias.length > MAX_ALIAS_LENGTH) throw new Error(`El alias admite como mucho ${MAX_ALIAS_LENGTH} caracteres`);
+    return alias;
+  },
+  favorite: (value) => {
+    if (typeof value !== 'boolean') throw new Error('favorite debe ser true o false');
+    return value;
+  },
+  tags: (value) => {
+    if (!Array.isArray(value) || value.some((tag) => typeof tag !== 'string')) {
+      throw new Error('Las etiquetas deben ser una lista de textos');
+    }
+    const tags = [...new Set(value.map(normalizeTag).filter(Boolean))];
+    if (tags.length > MAX_TAGS) throw new Error(`Como mucho ${MAX_TAGS} etiquetas`);
+    const long = tags.find((tag) => tag.length > MAX_TAG_LENGTH);
+    if (long) throw new Error(`Etiqueta demasiado larga (máximo ${MAX_TAG_LENGTH}): ${long}`);
+    return tags;
+  },
+  notes: (value) => {
+    if (typeof value !== 'string') throw new Error('Las notas deben ser texto');
+    const notes = value.trim();
+    if (notes.length > MAX_NOTES_LENGTH) throw new Error(`Las notas admiten como mucho ${MAX_NOTES_LENGTH} caracteres`);
+    return notes;
+  }
+};
+
+// Un valor vacío (alias o notas '', favorito false, sin etiquetas) se borra de la ficha
+const isEmpty = (value) => value === '' || value === false || (Array.isArray(value) && value.length === 0);
+
+/**
+ * Inventario persistente: todos los NAS vistos alguna vez, con firstSeen/lastSeen
+ * Un NAS se reconoce por su MAC o una IP en común (como en events.js), así que un cambio
+ * de IP actualiza su ficha en lugar de crear otra (y conserva lo que haya puesto el usuario)
+ * Con `file` null solo vive en memoria (la red simulada no debe tocar el inventario real)
+ */
+function openInventory(file = path.join(getConfigDir(), STORE_FILE)) {
+  // id -> { id, ...DEVICE_FIELDS, firstSeen, lastSeen, online, alias?, favorite?, tags?, notes?, paired? }
+  let records = {};
+  let dirty = false;
+
+  try {
+    if (file !== null) records = JSON.parse(fs.readFileSync(file, 'utf8')).devices || {};
+  } catch (err) {
+    if (err.code !== 'ENOENT') {
+      log.warn(`[Inventory] No se pudo leer ${file}: ${err.message}`);
+    }
+  }
+
+  const known = () => new Map(Object.entries(records));
+
+  return {
+    /**
+     * Registra un dispositivo recién visto y devuelve su id en el inventario
+     * `taken` (Set de ids) evita emparejar dos dispositivos del mismo escaneo con la misma ficha
+     */
+    record(device, taken = new Set()) {
+      const now = new Date().toISOString();
+      const id = (device.id && records[device.id] && !taken.has(device.id) ? device.id : null) ??
+        findKnown(known(), device, taken) ??
+        crypto.randomUUID();
+      const previous = records[id];
+
+      const data = {};
+      for (const field of DEVICE_FIELDS) {
+        if (device[field] !== undefined && device[field] !== '') data[field] = device[field];
+      }
+      records[id] = { ...previous, ...data, id, firstSeen: previous?.firstSeen || now, lastSeen: now, online: true };
+      taken.add(id);
+      dirty = true;
+      return id;
+    },
+
+    /**
+     * Cierra un escaneo completo: los que no aparecen en `devices` pasan a offline
+     */
+    finishScan(devices) {
+      const taken = new Set();
+      for (const device of devices) device.id = this.record(device, taken);
+      for (const record of Object.values(records)) {
+        if (!taken.has(record.id) && record.online) {
+          record.online = false;
+          dirty = true;
+        }
+      }
+    },
+
+    get(id) {
+      return records[id] || null;
+    },
+
+    /**
+     * Cambia los campos del usuario (ver EDITABLE) de una ficha; los vacíos se borran
+     * Devuelve la ficha actualizada
+     */
+    update(id, changes = {}) {
+      const record = records[id];
+      if (!record) throw new Error(`Dispositivo desconocido: ${id}`);
+
+      // Se valida todo antes de tocar la ficha: un campo erróneo no deja el cambio a medias
+      const normalized = Object.entries(changes).map(([field, value]) => {
+        if (!EDITABLE[field]) throw new Error(`Campo no editable: ${field}`);
+        return [field, EDITABLE[field](value)];
+      });
+      for (const [field, value] of normalized) {
+        if (isEmpty(value)) delete record[field];
+        else record[field] = value;
+      }
+      dirty = true;
+      return record;
+    },
+
+    /**
+     * Marca una ficha como emparejada ({ scopes, pairedAt }) o la desmarca con null
+     * El token no se guarda aquí sino en el almacén de secretos
+     */
+    setPaired(id, paired) {
+      const record = records[id];
+      if (!record) throw new Error(`Dispositivo desconocido: ${id}`);
+      if (paired) record.paired = paired;
+      else delete record.paired;
+      dirty = true;
+      return record;
+    },
+
+    /**
+     * Fichas ordenadas: favoritos, después las que están en línea y luego por IP
+     * `tag` deja solo las que llevan esa etiqueta
+     */
+    list({ tag } = {}) {
+      const wanted = tag ? normalizeTag(tag) : null;
+      return Object.values(records)
+        .filter((record) => !wanted || (record.tags || []).includes(wanted))
+        .sort((a, b) =>
+          Number(Boolean(b.favorite)) - Number(Boolean(a.favorite)) ||
+          Number(b.online) - Number(a.online) ||
+          a.ip.localeCompare(b.ip, 'en', { numeric: true }));
+    },
+
+    save() {
+      if (!dirty || file === null) return;
+      fs.mkdirSync(path.dirname(file), { recursive: true });
+      // Escritura atómica: un cierre a medias no deja el inventario corrupto
+      const tmp = `${file}.tmp`;
+      fs.writeFileSync(tmp, JSON.stringify({ devices: records }, null, 2), { mode: 0o600 });
+      fs.renameSync(tmp, file);
+      dirty = false;
+    }
+  };
+}
+
+module.exports = { openInventory };
@@ -0,0 +1,164 @@
+const { execFileSync } = require('child_process');
+const fs = require('fs');
+const path = require('path');
+const log = require('./log');
+
+// Servicio con el que se guardan las entradas en el llavero del sistema
+const SERVICE = 'homepinas-finder';
+const DPAPI_FILE = 'secrets.dpapi.json';
+const TOOL_TIMEOUT = 10000;
+
+/**
+ * Ejecuta una herramienta del sistema; el secreto va siempre por stdin, nunca en
+ * los argumentos (se verían en la lista de procesos)
+ */
+function run(command, args, input = '') {
+  return execFileSync(command, args, {
+    input,
+    encoding: 'utf8',
+    timeout: TOOL_TIMEOUT,
+    stdio: ['pipe', 'pipe', 'pipe'],
+    windowsHide: true
+  });
+}
+
+/**
+ * Llavero de macOS con la herramienta `security`
+ */
+function macKeychain() {
+  // Modo interactivo de `security`: las órdenes (y la contraseña) llegan por stdin
+  const quote = (value) => `"${String(value).replace(/["\\]/g, '\\$&')}"`;
+
+  return {
+    backend: 'keychain',
+    get(name) {
+      try {
+        return run('security', ['find-generic-password', '-s', SERVICE, '-a', name, '-w']).replace(/\n$/, '');
+      } catch (err) {
+        if (err.status === 44) return null; // no existe
+        throw err;
+      }
+    },
+    set(name, value) {
+      run('security', ['-i'], `add-generic-password -U -s ${quote(SERVICE)} -a ${quote(name)} -w ${quote(value)}\n`);
+    },
+    delete(name) {
+      try {
+        run('security', ['delete-generic-password', '-s', SERVICE, '-a', name]);
+      } catch (err) {
+        if (err.status !== 44) throw err;
+      }
+    }
+  };
+}
+
+/**
+ * Secret Service de freedesktop (GNOME Keyring, KWallet) con `secret-tool` (libsecret)
+ */
+function secretService() {
+  const attributes = (name) => ['service', SERVICE, 'account', name];
+
+  return {
+    backend: 'secret-service',
+    get(name) {
+      try {
+        return run('secret-tool', ['lookup', ...attributes(name)]);
+      } catch (err) {
+        // secret-tool sale con 1 y sin mensaje cuando la entrada no existe
+        if (err.status === 1 && !String(err.stderr).trim()) return null;
+        throw err;
+      }
+    },
+    set(name, value) {
+      run('secret-tool', ['store', `--label=HomePiNAS Finder: ${name}`, ...attributes(name)], String(value));
+    },
+    delete(name) {
+      try {
+        run('secret-tool', ['clear', ...attributes(name)]);
+      } catch (err) {
+        if (err.status !== 1 || String(err.stderr).trim()) throw err;
+      }
+    }
+  };
+}
+
+/**
+ * DPAPI de Windows (ámbito del usuario) vía PowerShell: Windows cifra cada valor con
+ * la clave de la cuenta y el resultado se guarda en secrets.dpapi.json
+ */
+function windowsDpapi(dir) {
+  const file = path.join(dir, DPAPI_FILE);
+  const script = (method, decode, encode) => [
+    '-NoProfile', '-NonInteractive', '-Command',
+    'Add-Type -AssemblyName System.Security; ' +
+    `$data = ${decode}([Console]::In.ReadToEnd()); ` +
+    `$out = [Security.Cryptography.ProtectedData]::${method}($data, $null, 'CurrentUser'); ` +
+    `[Console]::Out.Write(${encode}($out))`
+  ];
+  const protect = (value) => run('powershell.exe',
+    script('Protect', '[Text.Encoding]::UTF8.GetBytes', '[Convert]::ToBase64String'), value).trim();
+  const unprotect = (cipher) => run('powershell.exe',
+    script('Unprotect', '[Convert]::FromBase64String', '[Text.Encoding]::UTF8.GetString'), cipher);
+
+  const read = () => {
+    try {
+      return JSON.parse(fs.readFileSync(file, 'utf8')).entries || {};
+    } catch (err) {
+      if (err.code !== 'ENOENT') log.warn(`[Secrets] No se pudo leer ${file}: ${err.message}`);
+      return {};
+    }
+  };
+  const write = (entries) => {
+    fs.mkdirSync(dir, { recursive: true });
+    const tmp = `${file}.tmp`;
+    fs.writeFileSync(tmp, JSON.stringify({ entries }, null, 2), { mode: 0o600 });
+    fs.renameSync(tmp, file);
+  };
+
+  return {
+    backend: 'dpapi',
+    get(name) {
+      const cipher = read()[name];
+      return cipher ? unprotect(cipher) : null;
+    },
+    set(name, value) {
+      const entries = read();
+      entries[name] = protect(String(value));
+      write(entries);
+    },
+    delete(name) {
+      const entries = read();
+      if (!(name in entries)) return;
+      delete entries[name];
+      write(entries);
+    }
+  };
+}
+
+/**
+ * ¿Está la herramienta instalada? (ENOENT = no; cualquier otra salida = sí)
+ */
+function hasTool(command, args) {
+  try {
+    run(command, args);
+    return true;
+  } catch (err) {
+    return err.code !== 'ENOENT';
+  }
+}
+
+/**
+ * Llavero del sistema disponible en esta máquina o null:
+ * Keychain (macOS), DPAPI (Windows) o Secret Service (Linux con sesión D-Bus)
+ * Todos ofrecen { backend, get(name), set(name, value), delete(name) } síncronos
+ */
+function openKeyring(dir) {
+  if (process.platform === 'darwin' && hasTool('security', ['help'])) return macKeychain();
+  if (process.platform === 'win32') return windowsDpapi(dir);
+  if (process.platform === 'linux' && process.env.DBUS_SESSION_BUS_ADDRESS && hasTool('secret-tool', ['--help'])) {
+    return secretService();
+  }
+  return null;
+}
+
+module.exports = { openKeyring, SERVICE };
@@ -0,0 +1,71 @@
+/**
+ * Registro con niveles para la app y la CLI. En texto, como siempre: "[Ámbito] mensaje";
+ * en JSON, una línea por mensaje para mandarla a un agregador (Loki, Elasticsearch, journald)
+ * Todo va a stderr: stdout es para los datos de la CLI
+ *
+ *   log.warn(`[Trust] El certificado de ${ip} ha cambiado`, { ip });
+ *
+ * Los campos (opcionales) solo salen en JSON: el texto del mensaje debe bastar por sí solo
+ *
+ * Además de stderr, cada mensaje puede ir a destinos adicionales (syslog, registro de
+ * eventos de Windows) con su propio nivel mínimo: ver addLogSink
+ */
+const LEVELS = { debug: 10, info: 20, warn: 30, error: 40 };
+const LOG_FORMATS = ['text', 'json'];
+
+const settings = { level: 'info', format: 'text', stream: process.stderr };
+const sinks = new Set();
+
+/**
+ * Nivel mínimo (debug, info, warn, error) y formato (text, json); lanza si no son válidos
+ */
+function configureLogging({ level = settings.level, format = settings.format, stream = settings.stream } = {}) {
+  if (!Object.hasOwn(LEVELS, level)) throw new Error(`Nivel de registro no válido: ${level} (${Object.keys(LEVELS).join(', ')})`);
+  if (!LOG_FORMATS.includes(format)) throw new Error(`Formato de registro no válido: ${format} (${LOG_FORMATS.join(', ')})`);
+  Object.assign(settings, { level, format, stream });
+}
+
+/**
+ * Destino adicional: `write({ level, scope, msg, text, fields })` recibe cada mensaje desde
+ * `level`, aunque stderr tenga otro nivel. No debe lanzar. Devuelve la función que lo quita
+ */
+function addLogSink(write, { level = 'info' } = {}) {
+  if (!Object.hasOwn(LEVELS, level)) throw new Error(`Nivel de registro no válido: ${level} (${Object.keys(LEVELS).join(', ')})`);
+  const sink = { write, level };
+  sinks.add(sink);
+  return () => sinks.delete(sink);
+}
+
+function isEnabled(level) {
+  return LEVELS[level] >= LEVELS[settings.level];
+}
+
+function write(level, message, fields) {
+  const targets = [...sinks].filter((sink) => LEVELS[level] >= LEVELS[sink.level]);
+  if (!isEnabled(level) && targets.length === 0) return;
+  const text = String(message);
+  const [, scope, rest] = text.match(/^\[([^\]]+)\] ?(.*)$/s) || [];
+  const msg = scope ? rest : text;
+
+  if (isEnabled(level)) {
+    const line = settings.format === 'json'
+      ? JSON.stringify({ time: new Date().toISOString(), level, ...(scope ? { scope } : {}), msg, ...fields })
+      : text;
+    settings.stream.write(`${line}\n`);
+  }
+  for (const sink of targets) {
+    sink.write({ level, scope: scope || null, msg, text, fields: fields || {} });
+  }
+}
+
+module.exports = {
+  LEVELS,
+  LOG_FORMATS,
+  configureLogging,
+  addLogSink,
+  isEnabled,
+  debug: (message, fields) => write('debug', message, fields),
+  info: (message, fields) => write('info', message, fields),
+  warn: (message, fields) => write('warn', message, fields),
+  error: (message, fields) => write('error', message, fields)
+};
@@ -1,9 +1,143 @@
-const { app, BrowserWindow, ipcMain, shell } = require('electron');
+const { app, BrowserWindow, dialog, ipcMain, shell } = require('electron');
+const fs = require('fs');
 const path = require('path');
-const { scanNetwork } = require('./scanner');
+const { pathToFileURL } = require('url');
+const log = require('./log');
+const { scanNetwork, getScanStatus, resolveProbeSchemes } = require('./scanner');
+const { DEFAULTS, loadConfig } = require('./config');
+const { formatProfile } = require('./profile');
+const { openTrustStore } = require('./trust-store');
+const { auditAction, readAudit } = require('./audit');
+const { validateDeviceUrl } = require('./url-guard');
+const { verifyManifest } = require('./integrity');
+const { buildScanOptions, openNotifierSecrets, attachLogSinks } = require('./scan-options');
+const { createAvailabilityTracker } = require('./events');
+const { openInventory } = require('./inventory');
+const { openHistory, diffScans } = require('./history');
+const { createNotifier } = require('./notify');
+const { createMdnsProxy } = require('./mdns-proxy');
+const { parseNmapXml, nmapSeeds, formatNmapXml } = require('./nmap');
+const { renderHostsSnippet, updateHostsFile, defaultHostsPath } = require('./hosts-file');
+const { wakeOnLan } = require('./wol');
+const { probeDetails, deviceScheme } = require('./details');
+const { openSecretStore } = require('./secrets');
+const {
+  requestPairing, waitForApproval, manageDevice, loginUrl, storePairing, pairingToken, forgetPairing
+} = require('./pairing');
+const { createTray, notifyDevice } = require('./tray');
+const { createRefreshPlanner } = require('./refresh');
+const { SCHEME, parseProtocolUrl, findProtocolUrl, matchesRef } = require('./protocol');
+
+// --profile-scan: mide cada escaneo y vuelca el desglose en consola
+const profileScan = process.argv.includes('--profile-scan');
+// --allow-public: permite barrer subredes con IPs públicas
+const allowPublic = process.argv.includes('--allow-public');
+// --stealth: escaneo lento y aleatorio para redes monitorizadas
+const stealth = process.argv.includes('--stealth');
+// --arp-sweep: barrido ARP activo (arp-scan) y sondeo TCP solo de los hosts vivos
+const arpSweepFlag = process.argv.includes('--arp-sweep');
+// --ping-sweep: ping (fping o UDP) a la subred y sondeo TCP solo de los que responden
+const pingSweepFlag = process.argv.includes('--ping-sweep');
+// --simulate: red simulada (simulation.devices o unos de ejemplo) para desarrollar la interfaz y hacer demos
+const simulateFlag = process.argv.includes('--simulate');
+// --mdns-proxy: reanuncia los NAS descubiertos por mDNS (equivale a mdnsProxy.enabled)
+const mdnsProxyFlag = process.argv.includes('--mdns-proxy');
+// --tray: icono en la bandeja y la app sigue abierta al cerrar la ventana (equivale a tray.enabled)
+const trayFlag = process.argv.includes('--tray');
+// --register-protocol / --unregister-protocol: asocia (o suelta) los enlaces homepinas:// y sale
+const registerProtocolFlag = process.argv.includes('--register-protocol');
+const unregisterProtocolFlag = process.argv.includes('--unregister-protocol');
+// --log-level debug|info|warn|error y --log-format text|json: como en la CLI
+configureLogFlags();
+// syslog.logs y eventLog.logs: el registro también a syslog o al registro de eventos de Windows
+attachLogSinks(loadConfig());
+
+/**
+ * Valor de una opción de la línea de órdenes ("--name valor" o "--name=valor")
+ */
+function argValue(name) {
+  const index = process.argv.findIndex((arg) => arg === name || arg.startsWith(`${name}=`));
+  if (index === -1) return undefined;
+  return process.argv[index] === name ? process.argv[index + 1] : process.argv[index].slice(name.length + 1);
+}
+
+function configureLogFlags() {
+  try {
+    log.configureLogging({ level: argValue('--log-level'), format: argValue('--log-format') });
+  } catch (err) {
+    log.warn(`[App] ${err.message}`);
+  }
+}
+
+const INDEX_URL = pathToFileURL(path.join(__dirname, 'index.html')).href;
 
 let mainWindow;
 
+// Icono de la bandeja (solo en modo residente) y si el usuario ha pedido salir
+let tray = null;
+let quitting = false;
+let trayTimer = null;
+const MIN_TRAY_INTERVAL = 60; // segundos
+// Vueltas del temporizador de la bandeja: completas cada fullScanEvery, incrementales entre medias
+let trayRefresh = null;
+
+// IPs descubiertas en esta sesión; solo a ellas (o a la LAN) se abren URLs
+const discoveredHosts = new Set();
+
+// Eventos de aparición/desaparición entre escaneos sucesivos
+const availability = createAvailabilityTracker();
+
+// Resultado del último escaneo (exportación a hosts)
+let lastDevices = [];
+// NAS del último escaneo completo (sin cancelar): los que revisa una vuelta incremental
+let knownDevices = null;
+
+// Hosts importados de un XML de nmap que se sondean en cada escaneo
+let importedSeeds = [];
+
+// Cancelación del escaneo en curso
+let scanController = null;
+
+// Proxy de reanuncio mDNS (solo si está activado)
+let mdnsProxy = null;
+
+// Inventario de NAS conocidos; uno solo para que un escaneo no pise las ediciones del usuario
+// Con --simulate el inventario y el historial solo viven en memoria: los NAS falsos no
+// deben mezclarse con los de verdad ni dar por desconectados a estos
+let inventory = null;
+
+function getInventory() {
+  inventory = inventory || openInventory(simulateFlag ? null : undefined);
+  return inventory;
+}
+
+let simulatedHistory = null;
+
+function getHistory() {
+  if (!simulateFlag) return openHistory();
+  simulatedHistory = simulatedHistory || openHistory(null);
+  return simulatedHistory;
+}
+
+// Certificados fijados (TOFU); compartido por los escaneos y la confirmación de cambios
+let trustStore = null;
+
+function getTrustStore() {
+  trustStore = trustStore || openTrustStore();
+  return trustStore;
+}
+
+// Emparejamientos esperando la aprobación en el NAS: id del inventario -> { record, pairing, options }
+const pairings = new Map();
+
+/**
+ * Opciones de conexión a la API de un NAS: certificado cliente (mTLS) y certificado fijado (TOFU)
+ */
+function apiOptions(record) {
+  const { clientCertFor } = buildScanOptions(loadConfig());
+  return { clientCert: clientCertFor(record.ip), pin: getTrustStore().get(record.ip)?.fingerprint256 };
+}
+
 function createWindow() {
   mainWindow = new BrowserWindow({
     width: 500,
@@ -16,12 +150,25 @@ function createWindow() {
     webPreferences: {
       nodeIntegration: false,
       contextIsolation: true,
+      sandbox: true,
       preload: path.join(__dirname, 'preload.js')
     },
     icon: path.join(__dirname, '../assets/icon.png')
   });
 
+  // La UI nunca navega ni abre ventanas propias: los NAS se abren en el navegador del sistema
+  mainWindow.webContents.on('will-navigate', (event) => event.preventDefault());
+  mainWindow.webContents.setWindowOpenHandler(() => ({ action: 'deny' }));
+
   mainWindow.loadFile(path.join(__dirname, 'index.html'));
+
+  // En modo residente cerrar la ventana solo la oculta; se vuelve a abrir desde la bandeja
+  mainWindow.on('close', (event) => {
+    if (tray && !quitting) {
+      event.preventDefault();
+      mainWindow.hide();
+    }
+  });
   
   // Quitar menú en producción
   if (!process.argv.includes('--dev')) {
@@ -29,25 +176,579 @@ function createWindow() {
   }
 }
 
-app.whenReady().then(createWindow);
+/**
+ * Comprueba que los ficheros empaquetados no están dañados ni manipulados
+ * (binarios descargados de mirrors poco fiables). En desarrollo no hay manifiesto.
+ */
+function checkIntegrity() {
+  const { checked, problems } = verifyManifest(__dirname);
+  if (!checked || problems.length === 0) return true;
+
+  log.error(`[Integrity] Ficheros de la aplicación alterados:\n  ${problems.join('\n  ')}`, { problems });
+  dialog.showErrorBox(
+    'HomePiNAS Finder está dañado',
+    'Algunos ficheros de la aplicación no coinciden con los originales. ' +
+    'Vuelve a descargarla desde la página oficial.\n\n' + problems.join('\n')
+  );
+  return false;
+}
+
+// Enlace homepinas:// recibido antes de que haya ventana (arranque o macOS)
+let pendingLink = findProtocolUrl(process.argv);
+
+// Una sola ventana del Finder: abrirlo otra vez trae al frente la que ya está abierta
+// (y le pasa el enlace homepinas:// con el que se lanzó, si lo hay)
+if (!registerProtocolFlag && !unregisterProtocolFlag && !app.requestSingleInstanceLock()) {
+  app.quit();
+} else {
+  app.on('second-instance', (event, argv) => {
+    if (!app.isReady()) return;
+    const link = findProtocolUrl(argv);
+    if (link) handleLink(link);
+    else showWindow();
+  });
+}
+
+// macOS entrega los enlaces con este evento, también el que lanzó la app
+app.on('open-url', (event, url) => {
+  event.preventDefault();
+  if (app.isReady() && mainWindow) handleLink(url);
+  else pendingLink = url;
+});
+
+app.whenReady().then(() => {
+  if (registerProtocolFlag || unregisterProtocolFlag) {
+    registerProtocol(registerProtocolFlag);
+    app.quit();
+    return;
+  }
+  if (!app.hasSingleInstanceLock()) return;
+  if (!checkIntegrity()) {
+    app.quit();
+    return;
+  }
+  startMdnsProxy();
+  createWindow();
+  startTray();
+  if (pendingLink) handleLink(pendingLink);
+  pendingLink = null;
+});
+
+/**
+ * Asocia homepinas:// a esta app (o la desasocia). Sin empaquetar (npm start) hay
+ * que pasar electron y la ruta del proyecto para que el sistema sepa qué lanzar
+ */
+function registerProtocol(register) {
+  const args = process.defaultApp ? [process.execPath, [path.resolve(process.argv[1])]] : [];
+  const ok = register
+    ? app.setAsDefaultProtocolClient(SCHEME, ...args)
+    : app.removeAsDefaultProtocolClient(SCHEME, ...args);
+  const verb = register ? 'asociar' : 'desasociar';
+  if (ok) log.info(`[Link] ${SCHEME}:// ${register ? 'asociado a' : 'desasociado de'} HomePiNAS Finder`);
+  else log.error(`[Link] No se pudo ${verb} ${SCHEME}:// (en Linux hace falta xdg-utils y el .desktop de la app)`);
+}
+
+/**
+ * Enlace homepinas://: ventana al frente y, con device/<ref>, el NAS seleccionado
+ */
+function handleLink(value) {
+  showWindow();
+  const link = parseProtocolUrl(value);
+  if (!link) {
+    log.warn(`[Link] Enlace no válido: ${String(value).slice(0, 100)}`);
+    return;
+  }
+  if (link.action !== 'device') return;
+
+  const matches = getInventory().list().filter((record) => matchesRef(record, link.ref));
+  if (matches.length === 0) log.warn(`[Link] Ningún NAS del inventario es ${link.ref}`);
+  if (matches.length > 1) log.warn(`[Link] Varios NAS del inventario coinciden con ${link.ref}`);
+  const send = () => mainWindow.webContents.send('focus-device', matches.length === 1 ? matches[0].id : null, link.ref);
+  if (mainWindow.webContents.isLoading()) mainWindow.webContents.once('did-finish-load', send);
+  else send();
+}
+
+app.on('before-quit', () => {
+  quitting = true;
+});
+
+app.on('will-quit', () => {
+  mdnsProxy?.stop();
+  clearInterval(trayTimer);
+  tray?.destroy();
+});
+
+/**
+ * Ventana al frente (se crea de nuevo si se cerró)
+ */
+function showWindow() {
+  if (!mainWindow || mainWindow.isDestroyed()) createWindow();
+  mainWindow.show();
+  mainWindow.focus();
+}
+
+/**
+ * Modo residente: icono en la bandeja con la lista de NAS en línea
+ */
+function startTray() {
+  const options = { ...DEFAULTS.tray, ...loadConfig().tray };
+  if (!trayFlag && !options.enabled) return;
+
+  try {
+    tray = createTray(path.join(__dirname, '../assets/icon.png'), {
+      open: showWindow,
+      // Pedido a mano: siempre completo (click recibe el elemento del menú, no un planificador)
+      rescan: () => backgroundScan(),
+      openDevice: (id) => openDevice(id, 'tray').catch((err) => log.warn(`[Tray] ${err.message}`)),
+      quit: () => app.quit()
+    });
+    tray.update(getInventory().list());
+  } catch (err) {
+    log.warn(`[Tray] No se pudo crear el icono: ${err.message}`);
+    return;
+  }
+
+  // Escaneos en segundo plano; se salta la vuelta si ya hay uno en marcha
+  if (options.interval > 0) {
+    trayRefresh = createRefreshPlanner({ fullScanEvery: loadConfig().fullScanEvery });
+    trayTimer = setInterval(() => {
+      if (!scanController) backgroundScan(trayRefresh);
+    }, Math.max(options.interval, MIN_TRAY_INTERVAL) * 1000);
+  }
+}
+
+/**
+ * Escaneo lanzado desde la bandeja o el temporizador; la ventana recarga el inventario al acabar
+ * Con `refresh` (el temporizador) la vuelta puede ser incremental (ver refresh.js)
+ */
+function backgroundScan(refresh = null) {
+  return runScan(null, refresh)
+    .then(() => {
+      if (mainWindow && !mainWindow.isDestroyed()) mainWindow.webContents.send('inventory-changed');
+    })
+    .catch((err) => log.warn(`[Tray] Error en el escaneo: ${err.message}`));
+}
+
+/**
+ * Avisos del modo residente: NAS que no estaban en el inventario o que estaban
+ * sin conexión. `previous` = estado online de cada ficha antes del escaneo
+ */
+function notifyChanges(previous, devices) {
+  if (!tray || simulateFlag || loadConfig().tray?.notifications === false) return;
+  for (const device of devices) {
+    if (!device.id) continue;
+    const change = !previous.has(device.id) ? 'new' : previous.get(device.id) === false ? 'back' : null;
+    if (!change) continue;
+    notifyDevice({ ...getInventory().get(device.id), ...device }, change, () => {
+      openDevice(device.id, 'tray').catch((err) => log.warn(`[Tray] ${err.message}`));
+    });
+  }
+}
+
+function startMdnsProxy() {
+  const { mdnsProxy: options } = loadConfig();
+  // Los NAS simulados no se anuncian en la red de verdad
+  if (simulateFlag || (!mdnsProxyFlag && !options?.enabled)) return;
+
+  try {
+    mdnsProxy = createMdnsProxy(options);
+  } catch (err) {
+    log.warn(`[mDNS proxy] No se pudo iniciar: ${err.message}`);
+  }
+}
 
 app.on('window-all-closed', () => {
-  if (process.platform !== 'darwin') {
+  // Con la bandeja la app sigue en marcha hasta "Salir"
+  if (process.platform !== 'darwin' && !tray) {
     app.quit();
   }
 });
 
 app.on('activate', () => {
-  if (BrowserWindow.getAllWindows().length === 0) {
-    createWindow();
+  // Con la bandeja la ventana puede estar solo oculta
+  if (BrowserWindow.getAllWindows().length === 0 || tray) {
+    showWindow();
   }
 });
 
+/**
+ * Solo nuestra propia página puede disparar acciones
+ * Un iframe o una página cargada por error no debe poder escanear ni abrir URLs
+ */
+function isTrustedSender(event) {
+  const url = event.senderFrame?.url || '';
+  return event.sender === mainWindow?.webContents && url.split('#')[0] === INDEX_URL;
+}
+
+/**
+ * Registra un handler IPC que modifica estado, rechazando emisores no confiables
+ */
+function handleAction(channel, handler) {
+  ipcMain.handle(channel, (event, ...args) => {
+    if (!isTrustedSender(event)) {
+      log.warn(`[IPC] Rechazado ${channel} desde ${event.senderFrame?.url || 'origen desconocido'}`);
+      throw new Error('Unauthorized');
+    }
+    return handler(event, ...args);
+  });
+}
+
+/**
+ * Escaneo completo con la configuración actual: inventario, historial, notificaciones
+ * y bandeja. Lo lanzan la ventana (scan-network, que recibe NAS y progreso en `sender`)
+ * y el menú de la bandeja (la ventana solo se entera al final, con inventory-changed)
+ * `refresh` (createRefreshPlanner) decide si la vuelta es completa o incremental
+ */
+async function runScan(sender = null, refresh = null) {
+  const config = loadConfig();
+  const trustStore = getTrustStore();
+  const inventory = getInventory();
+  const recorded = new Set();
+  const send = (channel, payload) => {
+    if (sender && !sender.isDestroyed()) sender.send(channel, payload);
+  };
+  
+  scanController?.abort();
+  const controller = new AbortController();
+  scanController = controller;
+  tray?.setScanning(true);
+  const previous = new Map(inventory.list().map((record) => [record.id, record.online]));
+  const plan = refresh ? await refresh.next(knownDevices) : { full: true };
+  
+  const devices = await scanNetwork({
+    ...buildScanOptions(config, {
+      allowPublic,
+      stealth,
+      arpSweep: arpSweepFlag,
+      pingSweep: pingSweepFlag,
+      profile: profileScan,
+      simulate: simulateFlag
+    }),
+    signal: controller.signal,
+    trustStore,
+    seeds: importedSeeds,
+    ...plan.options,
+    onDevice: (device) => {
+      rememberHosts(device);
+      // El id del inventario permite a la UI sustituir la ficha guardada del mismo NAS
+      device.id = inventory.record(device, recorded);
+      const { alias, favorite, tags, notes, paired } = inventory.get(device.id);
+      send('device-found', { ...device, alias, favorite, tags, notes, paired });
+    },
+    onProgress: (progress) => send('scan-progress', progress)
+  }).finally(() => tray?.setScanning(false));
+  // Direcciones IPv6 unidas a un dispositivo después de notificarlo
+  devices.forEach(rememberHosts);
+  if (scanController === controller) scanController = null;
+  
+  try {
+    trustStore.save();
+  } catch (err) {
+    log.warn(`[Trust] No se pudieron guardar los certificados: ${err.message}`);
+  }
+  
+  // Solo un escaneo completo puede dar por desconectados a los que no han aparecido
+  if (!controller.signal.aborted) inventory.finishScan(devices);
+  try {
+    inventory.save();
+  } catch (err) {
+    log.warn(`[Inventory] No se pudo guardar el inventario: ${err.message}`);
+  }
+  if (!controller.signal.aborted) {
+    try {
+      const history = getHistory();
+      history.add(devices, getScanStatus());
+      history.save();
+    } catch (err) {
+      log.warn(`[History] No se pudo guardar el escaneo: ${err.message}`);
+    }
+  }
+  
+  lastDevices = devices;
+  if (!controller.signal.aborted) knownDevices = devices;
+  mdnsProxy?.update(devices);
+  tray?.update(inventory.list());
+  notifyChanges(previous, devices);
+  
+  // Un escaneo cancelado es parcial: daría por desconectados NAS que no llegó a sondear
+  // Los NAS simulados no se anuncian por ningún canal (chat, email, webhook, MQTT, syslog)
+  if (!controller.signal.aborted && !simulateFlag) {
+    createNotifier(config, openNotifierSecrets(config))
+      .publish(availability.update(devices))
+      .catch((err) => log.warn(`[Notify] ${err.message}`));
+  }
+  
+  const status = getScanStatus();
+  if (status.profile) {
+    log.info(formatProfile(status.profile), { profile: status.profile });
+  }
+  
+  return devices;
+}
+
 // IPC handlers
-ipcMain.handle('scan-network', async () => {
-  return await scanNetwork();
+handleAction('scan-network', (event) => runScan(event.sender));
+
+ipcMain.handle('scan-status', () => getScanStatus());
+
+ipcMain.handle('inventory', (event, filter) => getInventory().list(filter));
+
+/**
+ * Datos del usuario de un NAS del inventario: { alias, favorite, tags, notes }
+ */
+handleAction('update-device', (event, id, changes) => {
+  const inventory = getInventory();
+  const label = inventory.get(id)?.ip || id;
+  return auditAction('update-device', label, 'ui', () => {
+    const record = inventory.update(id, changes);
+    inventory.save();
+    return record;
+  });
+});
+
+/**
+ * Wake-on-LAN a un NAS del inventario (necesita su MAC)
+ */
+handleAction('wake-device', (event, id) => {
+  const record = getInventory().get(id);
+  if (!record) throw new Error(`Dispositivo desconocido: ${id}`);
+  if (!record.mac) throw new Error('No se conoce la MAC de este NAS');
+  const { port, broadcast } = loadConfig().wakeOnLan;
+  return auditAction('wake', record.ip, 'ui', () => wakeOnLan(record.mac, { ip: record.ip, port, broadcast }));
+});
+
+/**
+ * Sondeo ampliado de un NAS del inventario: info completa, puertos, certificado y latencia
+ */
+handleAction('device-details', (event, id) => {
+  const record = getInventory().get(id);
+  if (!record) throw new Error(`Dispositivo desconocido: ${id}`);
+  const { clientCertFor } = buildScanOptions(loadConfig());
+  return probeDetails(record, { clientCert: clientCertFor(record.ip) });
+});
+
+/**
+ * Acepta el certificado (o la clave del beacon) nuevo de un NAS del último escaneo,
+ * cuando el usuario confirma que el cambio es legítimo
+ */
+handleAction('trust-device', (event, id) => {
+  const record = getInventory().get(id);
+  const device = record && lastDevices.find((candidate) => candidate.ip === record.ip);
+  if (!device?.certChanged && !device?.keyChanged) {
+    throw new Error('Este NAS no tiene ningún cambio de certificado pendiente');
+  }
+
+  return auditAction('trust-cert', device.ip, 'ui', () => {
+    const store = getTrustStore();
+    if (device.certChanged) {
+      store.replace(device.ip, { fingerprint256: device.certFingerprint, subject: { CN: device.hostname } });
+      Object.assign(device, { tls: 'match', certChanged: false, pinnedFingerprint: undefined });
+    }
+    if (device.keyChanged) {
+      store.replace(`beacon:${device.ip}`, { fingerprint256: device.keyFingerprint, subject: { CN: device.name } });
+      Object.assign(device, { keyPin: 'match', keyChanged: false });
+    }
+    store.save();
+    return device;
+  });
 });
 
-ipcMain.handle('open-nas', (event, url) => {
-  shell.openExternal(url);
+/**
+ * Pide un código de emparejamiento a un NAS del inventario; la UI lo muestra para
+ * comprobarlo en el NAS y después espera el resultado con pairing-result
+ */
+handleAction('pair-device', async (event, id) => {
+  const record = getInventory().get(id);
+  if (!record) throw new Error(`Dispositivo desconocido: ${id}`);
+  const options = apiOptions(record);
+  const pairing = await requestPairing(record, options);
+  pairings.set(id, { record, pairing, options });
+  return { code: pairing.code, expiresIn: pairing.expiresIn };
 });
+
+/**
+ * Espera la aprobación del código en el NAS y guarda el token en el almacén de secretos
+ */
+handleAction('pairing-result', (event, id) => {
+  const pending = pairings.get(id);
+  if (!pending) throw new Error('No hay ningún emparejamiento en curso con este NAS');
+  const { record, pairing, options } = pending;
+
+  return auditAction('pair', record.ip, 'ui', async () => {
+    try {
+      const result = await waitForApproval(record, pairing, options);
+      const inventory = getInventory();
+      const updated = storePairing(openSecretStore(), inventory, id, result);
+      inventory.save();
+      return updated;
+    } finally {
+      pairings.delete(id);
+    }
+  });
+});
+
+/**
+ * Acción de gestión (reboot, shutdown, update) en un NAS emparejado
+ */
+handleAction('manage-device', (event, id, action) => {
+  const inventory = getInventory();
+  const record = inventory.get(id);
+  if (!record?.paired) throw new Error('Este NAS no está emparejado');
+
+  return auditAction(action, record.ip, 'ui', async () => {
+    const secrets = openSecretStore();
+    const token = pairingToken(secrets, id);
+    if (!token) throw new Error('No se encuentra el token de este NAS: vuelve a emparejarlo');
+    try {
+      return await manageDevice(record, action, token, apiOptions(record));
+    } catch (err) {
+      if (err.revoked) {
+        forgetPairing(secrets, inventory, id);
+        inventory.save();
+      }
+      throw err;
+    }
+  });
+});
+
+ipcMain.handle('scan-history', () => getHistory().list());
+
+/**
+ * Diferencias entre dos escaneos guardados (ids, "latest" o "previous")
+ */
+ipcMain.handle('scan-diff', (event, from = 'previous', to = 'latest') => {
+  const history = getHistory();
+  const before = history.get(from);
+  const after = history.get(to);
+  if (!before || !after) throw new Error(`No existe el escaneo ${before ? to : from}`);
+  return diffScans(before, after);
+});
+
+handleAction('cancel-scan', () => {
+  if (!scanController) return false;
+  scanController.abort();
+  return true;
+});
+
+/**
+ * Apunta todas las direcciones de un dispositivo como destinos válidos para abrir
+ */
+function rememberHosts(device) {
+  for (const ip of device.addresses || [device.ip]) {
+    discoveredHosts.add(ip.split('%')[0]);
+  }
+}
+
+handleAction('open-nas', (event, url) => {
+  return auditAction('open', deviceFromUrl(url), 'ui', () => {
+    const safeUrl = validateDeviceUrl(url, {
+      knownHosts: discoveredHosts,
+      allowPublic: allowPublic || loadConfig().allowPublicSubnets
+    });
+    return shell.openExternal(safeUrl);
+  });
+});
+
+/**
+ * Abre un NAS del inventario; si está emparejado con permiso login, con la sesión ya
+ * iniciada (ticket de un solo uso). Si el NAS no da el ticket se abre la página normal
+ * `source` para el registro de auditoría: ui (ventana) o tray
+ */
+async function openDevice(id, source) {
+  const inventory = getInventory();
+  const record = inventory.get(id);
+  if (!record) throw new Error(`Dispositivo desconocido: ${id}`);
+  const guard = { knownHosts: discoveredHosts, allowPublic: allowPublic || loadConfig().allowPublicSubnets };
+  const safeUrl = validateDeviceUrl(deviceScheme(record).url.href, guard);
+
+  const secrets = record.paired?.scopes?.includes('login') ? openSecretStore() : null;
+  const token = secrets && pairingToken(secrets, id);
+  if (!token) return auditAction('open', record.ip, source, () => shell.openExternal(safeUrl));
+
+  return auditAction('open-sso', record.ip, source, async () => {
+    let url = safeUrl;
+    try {
+      url = validateDeviceUrl(await loginUrl(record, token, apiOptions(record)), guard);
+    } catch (err) {
+      log.warn(`[Pairing] Sin inicio de sesión automático en ${record.ip}: ${err.message}`);
+      if (err.revoked) {
+        forgetPairing(secrets, inventory, id);
+        inventory.save();
+      }
+    }
+    return shell.openExternal(url);
+  });
+}
+
+handleAction('open-device', (event, id) => openDevice(id, 'ui'));
+
+ipcMain.handle('audit-log', (event, filter) => readAudit(filter));
+
+ipcMain.handle('hosts-snippet', () => renderHostsSnippet(lastDevices, { suffix: loadConfig().hostsSuffix }));
+
+/**
+ * Importa un escaneo de nmap (-oX): sus hosts con puertos web se sondean en los próximos escaneos
+ */
+handleAction('import-nmap', async () => {
+  const { canceled, filePaths } = await dialog.showOpenDialog(mainWindow, {
+    title: 'Importar escaneo de nmap',
+    filters: [{ name: 'nmap XML', extensions: ['xml'] }],
+    properties: ['openFile']
+  });
+  if (canceled || filePaths.length === 0) return null;
+
+  const hosts = parseNmapXml(fs.readFileSync(filePaths[0], 'utf8'));
+  const webPorts = new Set(resolveProbeSchemes(loadConfig().probePorts).map(({ port }) => port));
+  importedSeeds = nmapSeeds(hosts, webPorts).map(({ ip, hostname }) => ({ ip, hostname }));
+  return { hosts: hosts.length, seeds: importedSeeds.length };
+});
+
+/**
+ * Guarda el último escaneo como XML compatible con nmap
+ */
+handleAction('export-nmap', async () => {
+  const { canceled, filePath } = await dialog.showSaveDialog(mainWindow, {
+    title: 'Exportar en formato nmap',
+    defaultPath: 'homepinas-finder.xml',
+    filters: [{ name: 'nmap XML', extensions: ['xml'] }]
+  });
+  if (canceled || !filePath) return null;
+
+  const status = getScanStatus();
+  fs.writeFileSync(filePath, formatNmapXml(lastDevices, {
+    startedAt: new Date(status.startedAt || Date.now()),
+    finishedAt: new Date(status.finishedAt || Date.now()),
+    version: app.getVersion()
+  }));
+  return filePath;
+});
+
+/**
+ * Reescribe el bloque del Finder en el fichero hosts tras confirmación explícita
+ */
+handleAction('update-hosts', async () => {
+  const file = defaultHostsPath();
+  const { response } = await dialog.showMessageBox(mainWindow, {
+    type: 'question',
+    buttons: ['Actualizar', 'Cancelar'],
+    defaultId: 1,
+    cancelId: 1,
+    message: `¿Actualizar ${file}?`,
+    detail: 'Se reemplazará el bloque "homepinas-finder" con los dispositivos encontrados. ' +
+      'El sistema puede pedir la contraseña de administrador.'
+  });
+  if (response !== 0) return false;
+
+  return auditAction('hosts-update', file, 'ui', () => updateHostsFile(lastDevices, file, { suffix: loadConfig().hostsSuffix }));
+});
+
+/**
+ * Identificador del dispositivo (host) a partir de la URL que se abre
+ */
+function deviceFromUrl(url) {
+  try {
+    return new URL(url).hostname;
+  } catch {
+    return String(url);
+  }
+}
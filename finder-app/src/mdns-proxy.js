@@ -0,0 +1,121 @@
+const os = require('os');
+const multicastDns = require('multicast-dns');
+const log = require('./log');
+const { toHostName } = require('./hosts-file');
+
+const HOST_TTL = 120;
+const SERVICE_TTL = 4500;
+
+/**
+ * Registros DNS-SD de un dispositivo descubierto
+ * Se anuncian `<nombre>.local` (A) y su servicio _http/_https (PTR, SRV, TXT)
+ */
+function deviceRecords(device) {
+  const label = toHostName(device.hostname) || toHostName(device.name);
+  if (!label) return null;
+
+  const url = new URL(device.url || `https://${device.ip}`);
+  const type = `_${url.protocol.replace(':', '')}._tcp.local`;
+  const host = `${label}.local`;
+  const instance = `${String(device.name || label).replace(/\./g, '-')}.${type}`;
+  const port = Number(url.port) || (url.protocol === 'https:' ? 443 : 80);
+  const txt = ['product=HomePiNAS'].concat(device.version ? [`version=${device.version}`] : []);
+
+  return {
+    host,
+    type,
+    instance,
+    a: { name: host, type: 'A', ttl: HOST_TTL, data: device.ip },
+    ptr: { name: type, type: 'PTR', ttl: SERVICE_TTL, data: instance },
+    srv: { name: instance, type: 'SRV', ttl: HOST_TTL, data: { port, target: host, priority: 0, weight: 0 } },
+    txt: { name: instance, type: 'TXT', ttl: SERVICE_TTL, data: txt }
+  };
+}
+
+/**
+ * Respuesta a una pregunta mDNS con los registros proxificados que la satisfacen
+ */
+function answerQuestion(question, entries) {
+  const name = question.name.toLowerCase();
+  const any = question.type === 'ANY';
+  const answers = [];
+  const additionals = [];
+
+  for (const entry of entries) {
+    if (name === entry.host && (any || question.type === 'A')) {
+      answers.push(entry.a);
+    } else if (name === entry.type && (any || question.type === 'PTR')) {
+      answers.push(entry.ptr);
+      additionals.push(entry.srv, entry.txt, entry.a);
+    } else if (name === entry.instance.toLowerCase() && (any || question.type === 'SRV' || question.type === 'TXT')) {
+      if (any || question.type === 'SRV') answers.push(entry.srv);
+      if (any || question.type === 'TXT') answers.push(entry.txt);
+      additionals.push(entry.a);
+    }
+  }
+
+  return { answers, additionals };
+}
+
+/**
+ * Direcciones IPv4 de las interfaces donde se reanuncia
+ * Sin lista explícita se usan todas las interfaces no internas
+ */
+function proxyAddresses(names = []) {
+  const addresses = [];
+  for (const [name, ifaces] of Object.entries(os.networkInterfaces())) {
+    if (names.length > 0 && !names.includes(name)) continue;
+    for (const iface of ifaces) {
+      if (iface.family === 'IPv4' && !iface.internal) addresses.push(iface.address);
+    }
+  }
+  return addresses;
+}
+
+/**
+ * Proxy de reanuncio mDNS: responde por los NAS descubiertos en interfaces
+ * a las que sus propios anuncios no llegan (p. ej. aislamiento Wi-Fi),
+ * de modo que otras apps de la máquina también resuelvan nas.local
+ */
+function createMdnsProxy({ interfaces = [] } = {}) {
+  let entries = [];
+
+  const responders = proxyAddresses(interfaces).map((address) => {
+    const mdns = multicastDns({ interface: address, reuseAddr: true, loopback: true });
+
+    mdns.on('query', (query) => {
+      const response = { answers: [], additionals: [] };
+      for (const question of query.questions) {
+        const { answers, additionals } = answerQuestion(question, entries);
+        response.answers.push(...answers);
+        response.additionals.push(...additionals);
+      }
+      if (response.answers.length > 0) mdns.respond(response);
+    });
+    mdns.on('error', (err) => log.warn(`[mDNS proxy] ${address}: ${err.message}`));
+
+    return mdns;
+  });
+
+  return {
+    /**
+     * Sustituye los dispositivos anunciados y lanza un anuncio no solicitado
+     */
+    update(devices) {
+      entries = devices.map(deviceRecords).filter(Boolean);
+      const answers = entries.flatMap((entry) => [entry.ptr, entry.srv, entry.txt, entry.a]);
+      if (answers.length === 0) return;
+      for (const mdns of responders) {
+        mdns.respond({ answers });
+      }
+    },
+
+    stop() {
+      for (const mdns of responders) {
+        mdns.destroy();
+      }
+    }
+  };
+}
+
+module.exports = { createMdnsProxy, answerQuestion, proxyAddresses };
@@ -0,0 +1,147 @@
+/**
+ * Métricas de Prometheus para el modo watch (formato de texto 0.0.4)
+ * Acumula los resultados de cada escaneo y los sirve en /metrics
+ * También los NAS del inventario como objetivos de http_sd (/api/prometheus/sd de serve)
+ */
+const http = require('http');
+const { urlHost } = require('./netutil');
+
+// Límites del histograma de duración de escaneo (segundos)
+const DURATION_BUCKETS = [1, 2, 5, 10, 20, 30, 60, 120, 300];
+const DEFAULT_HOST = '127.0.0.1';
+// Puerto que se raspa en cada NAS si no se pide otro: el de node_exporter
+const SD_PORT = 9100;
+
+function labels(values) {
+  const pairs = Object.entries(values).map(([key, value]) =>
+    `${key}="${String(value).replace(/\\/g, '\\\\').replace(/"/g, '\\"').replace(/\n/g, '\\n')}"`);
+  return pairs.length > 0 ? `{${pairs.join(',')}}` : '';
+}
+
+function addTo(map, key, amount) {
+  map.set(key, (map.get(key) || 0) + amount);
+}
+
+function createMetrics() {
+  const scans = new Map(); // resultado (ok, cancelled, error) -> total
+  const buckets = DURATION_BUCKETS.map(() => 0);
+  const duration = { sum: 0, count: 0 };
+  const devicesFound = new Map(); // método -> total acumulado
+  const probeErrors = new Map(); // motivo -> total
+  let hostsProbed = 0;
+  let lastDevices = new Map(); // método -> dispositivos del último escaneo
+  let lastScan = 0;
+
+  return {
+    /**
+     * Un escaneo terminado: `status` es getScanStatus() y `devices` su resultado
+     * (vacío si falló, con `error` a true)
+     */
+    recordScan({ durationMs, status = {}, devices = [], error = false }) {
+      const result = error ? 'error' : status.cancelled ? 'cancelled' : 'ok';
+      addTo(scans, result, 1);
+
+      const seconds = durationMs / 1000;
+      DURATION_BUCKETS.forEach((limit, i) => {
+        if (seconds <= limit) buckets[i]++;
+      });
+      duration.sum += seconds;
+      duration.count++;
+
+      hostsProbed += status.progress?.probed || 0;
+      for (const [reason, count] of Object.entries(status.probeErrors || {})) addTo(probeErrors, reason, count);
+
+      // Un escaneo parcial no dice cuántos NAS hay: el gauge se queda con el último completo
+      if (result !== 'ok') return;
+      lastDevices = new Map();
+      for (const device of devices) {
+        addTo(devicesFound, device.method, 1);
+        addTo(lastDevices, device.method, 1);
+      }
+      lastScan = Date.now() / 1000;
+    },
+
+    render() {
+      const lines = [];
+      const metric = (name, type, help, samples) => {
+        lines.push(`# HELP ${name} ${help}`, `# TYPE ${name} ${type}`);
+        for (const [suffix, values, value] of samples) lines.push(`${name}${suffix}${labels(values)} ${value}`);
+      };
+      const byLabel = (map, label) => [...map].map(([key, value]) => ['', { [label]: key }, value]);
+
+      metric('homepinas_finder_scans_total', 'counter', 'Escaneos realizados por resultado', byLabel(scans, 'result'));
+      metric('homepinas_finder_scan_duration_seconds', 'histogram', 'Duración de los escaneos', [
+        ...DURATION_BUCKETS.map((limit, i) => ['_bucket', { le: limit }, buckets[i]]),
+        ['_bucket', { le: '+Inf' }, duration.count],
+        ['_sum', {}, duration.sum],
+        ['_count', {}, duration.count]
+      ]);
+      metric('homepinas_finder_hosts_probed_total', 'counter', 'Hosts procesados por los barridos (incluye los que omite la caché negativa)', [['', {}, hostsProbed]]);
+      metric('homepinas_finder_probe_errors_total', 'counter', 'Sondeos HTTP(S) fallidos por motivo', byLabel(probeErrors, 'reason'));
+      metric('homepinas_finder_devices_found_total', 'counter', 'Dispositivos encontrados por método, sumando todos los escaneos', byLabel(devicesFound, 'method'));
+      metric('homepinas_finder_devices', 'gauge', 'Dispositivos del último escaneo completo por método', byLabel(lastDevices, 'method'));
+      metric('homepinas_finder_last_scan_timestamp_seconds', 'gauge', 'Fin del último escaneo completo (epoch)', [['', {}, lastScan]]);
+
+      return lines.join('\n') + '\n';
+    }
+  };
+}
+
+/**
+ * "9464", "0.0.0.0:9464" o "[::1]:9464" -> { host, port }; por defecto solo en localhost
+ * (también la usa --listen de serve)
+ */
+function parseListen(value) {
+  const match = String(value).match(/^(?:\[([^\]]+)\]:|([^:]+):)?(\d+)$/);
+  const port = match ? Number(match[3]) : NaN;
+  if (!match || port < 1 || port > 65535) throw new Error(`Dirección no válida (se espera [host:]puerto): ${value}`);
+  return { host: match[1] || match[2] || DEFAULT_HOST, port };
+}
+
+/**
+ * Servidor HTTP que solo atiende GET /metrics; resuelve cuando está escuchando
+ */
+function startMetricsServer(metrics, { host = DEFAULT_HOST, port }) {
+  const server = http.createServer((req, res) => {
+    if (req.method !== 'GET' || req.url.split('?')[0] !== '/metrics') {
+      res.writeHead(404).end();
+      return;
+    }
+    res.writeHead(200, { 'Content-Type': 'text/plain; version=0.0.4; charset=utf-8' });
+    res.end(metrics.render());
+  });
+
+  return new Promise((resolve, reject) => {
+    server.once('error', reject);
+    server.listen(port, host, () => resolve(server));
+  });
+}
+
+/**
+ * Inventario -> formato http_sd de Prometheus: un grupo por NAS con `ip:port` y sus datos
+ * como etiquetas __meta_homepinas_* (para relabel_configs; Prometheus no las guarda)
+ */
+function serviceDiscovery(devices, { port = SD_PORT } = {}) {
+  return devices.filter((device) => device.ip).map((device) => {
+    const meta = {
+      id: device.id,
+      name: device.alias || device.name,
+      hostname: device.hostname,
+      version: device.version,
+      mac: device.mac,
+      url: device.url,
+      online: device.online === undefined ? undefined : String(device.online),
+      paired: device.paired === undefined ? undefined : String(Boolean(device.paired)),
+      // Como las de Prometheus: con comas a los lados, para filtrar con regex .*,backup,.*
+      tags: device.tags?.length > 0 ? `,${device.tags.join(',')},` : undefined
+    };
+    return {
+      targets: [`${urlHost(device.ip)}:${port}`],
+      labels: Object.fromEntries(Object.entries(meta)
+        .filter(([, value]) => value !== undefined && value !== null && value !== '')
+        .map(([key, value]) => [`__meta_homepinas_${key}`, String(value)]))
+    };
+  });
+}
+
+module.exports = { createMetrics, parseListen, startMetricsServer, serviceDiscovery, SD_PORT };
@@ -0,0 +1,123 @@
+const crypto = require('crypto');
+const net = require('net');
+const tls = require('tls');
+
+const CONNECT_TIMEOUT = 5000;
+const KEEPALIVE = 60; // segundos
+const CONNACK_ERRORS = {
+  1: 'versión de protocolo no aceptada',
+  2: 'client id rechazado',
+  3: 'broker no disponible',
+  4: 'usuario o contraseña incorrectos',
+  5: 'no autorizado'
+};
+
+/**
+ * Longitud restante de MQTT: entero de 7 bits por byte
+ */
+function encodeLength(length) {
+  const bytes = [];
+  do {
+    let byte = length % 128;
+    length = Math.floor(length / 128);
+    if (length > 0) byte |= 0x80;
+    bytes.push(byte);
+  } while (length > 0);
+  return Buffer.from(bytes);
+}
+
+function encodeString(value) {
+  const data = Buffer.from(String(value), 'utf8');
+  const length = Buffer.alloc(2);
+  length.writeUInt16BE(data.length);
+  return Buffer.concat([length, data]);
+}
+
+function packet(type, body) {
+  return Buffer.concat([Buffer.from([type]), encodeLength(body.length), body]);
+}
+
+/**
+ * CONNECT de MQTT 3.1.1 con sesión limpia y usuario/contraseña opcionales
+ */
+function connectPacket(clientId, username, password) {
+  let flags = 0x02;
+  if (username) flags |= 0x80;
+  if (username && password) flags |= 0x40;
+
+  return packet(0x10, Buffer.concat([
+    encodeString('MQTT'),
+    Buffer.from([4, flags, 0, KEEPALIVE]),
+    encodeString(clientId),
+    ...(username ? [encodeString(username)] : []),
+    ...(username && password ? [encodeString(password)] : [])
+  ]));
+}
+
+/**
+ * PUBLISH con QoS 0 (sin confirmación); `retain` para que el broker guarde el último valor
+ */
+function publishPacket(topic, payload, retain = false) {
+  return packet(0x30 | (retain ? 0x01 : 0), Buffer.concat([encodeString(topic), Buffer.from(payload, 'utf8')]));
+}
+
+/**
+ * Cliente MQTT mínimo, solo para publicar: conecta, espera el CONNACK y
+ * devuelve { publish(topic, payload, { retain }), end() }
+ * `url` = mqtt://host:1883 o mqtts://host:8883; `allowSelfSigned` acepta certificados autofirmados
+ */
+function connectMqtt(url, { username = '', password = '', clientId, allowSelfSigned = false } = {}) {
+  const target = new URL(url);
+  const secure = target.protocol === 'mqtts:';
+  const options = {
+    host: target.hostname.replace(/^\[|\]$/g, ''),
+    port: Number(target.port) || (secure ? 8883 : 1883)
+  };
+  const id = clientId || `homepinas-finder-${crypto.randomBytes(4).toString('hex')}`;
+
+  return new Promise((resolve, reject) => {
+    const socket = secure
+      ? tls.connect({ ...options, servername: net.isIP(options.host) ? undefined : options.host, rejectUnauthorized: !allowSelfSigned })
+      : net.createConnection(options);
+    let received = Buffer.alloc(0);
+    let connected = false;
+
+    const fail = (err) => {
+      socket.destroy();
+      reject(err);
+    };
+    socket.setTimeout(CONNECT_TIMEOUT, () => fail(new Error('timeout')));
+    socket.once('error', fail);
+    socket.once(secure ? 'secureConnect' : 'connect', () => socket.write(connectPacket(id, username, password)));
+
+    socket.on('data', (chunk) => {
+      if (connected) return;
+      received = Buffer.concat([received, chunk]);
+      if (received.length < 4) return;
+      if (received[0] !== 0x20) return fail(new Error('respuesta no MQTT'));
+
+      const code = received[3];
+      if (code !== 0) return fail(new Error(`conexión rechazada: ${CONNACK_ERRORS[code] || `código ${code}`}`));
+
+      connected = true;
+      socket.setTimeout(0);
+      socket.removeListener('error', fail);
+      // Los errores posteriores se ven al escribir
+      socket.on('error', () => {});
+      resolve({
+        publish(topic, payload, { retain = false } = {}) {
+          return new Promise((done, failWrite) => {
+            socket.write(publishPacket(topic, payload, retain), (err) => (err ? failWrite(err) : done()));
+          });
+        },
+        end() {
+          return new Promise((done) => {
+            socket.end(Buffer.from([0xe0, 0x00]), done);
+          });
+        }
+      });
+    });
+  });
+}
+
+module.exports = { connectMqtt };
@@ -0,0 +1,178 @@
+const crypto = require('crypto');
+const dgram = require('dgram');
+
+const NBNS_PORT = 137;
+const LLMNR_PORT = 5355;
+const NAME_TIMEOUT = 1000;
+
+/**
+ * Envía un datagrama y espera la primera respuesta que acepte `parse`
+ * Resuelve con el valor devuelto o '' si no llega nada a tiempo o se aborta `signal`
+ */
+function queryUdp(ip, port, packet, parse, { timeout = NAME_TIMEOUT, signal } = {}) {
+  return new Promise((resolve) => {
+    const socket = dgram.createSocket('udp4');
+    let timer;
+    let done = false;
+    const finish = (value) => {
+      if (done) return;
+      done = true;
+      clearTimeout(timer);
+      signal?.removeEventListener('abort', onAbort);
+      socket.close();
+      resolve(value);
+    };
+    const onAbort = () => finish('');
+    if (signal?.aborted) return finish('');
+    signal?.addEventListener('abort', onAbort, { once: true });
+
+    socket.on('message', (message, rinfo) => {
+      if (rinfo.address !== ip) return;
+      let value = '';
+      try {
+        value = parse(message);
+      } catch {
+        // Respuesta truncada o malformada: se ignora
+      }
+      if (value) finish(value);
+    });
+    socket.on('error', () => finish(''));
+
+    timer = setTimeout(() => finish(''), timeout);
+    socket.send(packet, port, ip, (err) => {
+      if (err) finish('');
+    });
+  });
+}
+
+/**
+ * Consulta NBSTAT ("*") de NetBIOS-NS: nombre de máquina Windows/Samba
+ */
+function nbstatQuery(id) {
+  const header = Buffer.alloc(12);
+  header.writeUInt16BE(id, 0);
+  header.writeUInt16BE(1, 4); // QDCOUNT
+
+  // "*" con relleno de nulos, codificado a nibbles (RFC 1002 §4.1)
+  const raw = Buffer.alloc(16);
+  raw[0] = 0x2a;
+  const encoded = Buffer.alloc(32);
+  raw.forEach((byte, i) => {
+    encoded[i * 2] = 0x41 + (byte >> 4);
+    encoded[i * 2 + 1] = 0x41 + (byte & 0x0f);
+  });
+
+  const question = Buffer.concat([Buffer.from([0x20]), encoded, Buffer.from([0x00, 0x00, 0x21, 0x00, 0x01])]);
+  return Buffer.concat([header, question]);
+}
+
+/**
+ * Primer nombre único de estación (sufijo 0x00) de una respuesta NBSTAT
+ */
+function parseNbstat(message, id) {
+  // Cabecera (12) + nombre (34) + tipo, clase, TTL y longitud (10)
+  const offset = 56;
+  if (message.length <= offset || message.readUInt16BE(0) !== id || message.readUInt16BE(6) === 0) return '';
+
+  const count = message[offset];
+  for (let i = 0; i < count; i++) {
+    const start = offset + 1 + i * 18;
+    if (start + 18 > message.length) break;
+
+    const suffix = message[start + 15];
+    const isGroup = (message.readUInt16BE(start + 16) & 0x8000) !== 0;
+    if (suffix === 0x00 && !isGroup) {
+      return message.subarray(start, start + 15).toString('latin1').trim().toLowerCase();
+    }
+  }
+  return '';
+}
+
+/**
+ * Pregunta PTR de DNS/LLMNR para la resolución inversa de una IPv4
+ */
+function ptrQuery(id, ip) {
+  const header = Buffer.alloc(12);
+  header.writeUInt16BE(id, 0);
+  header.writeUInt16BE(1, 4); // QDCOUNT
+
+  const labels = [...ip.split('.').reverse(), 'in-addr', 'arpa'];
+  const name = Buffer.concat([
+    ...labels.map((label) => Buffer.concat([Buffer.from([label.length]), Buffer.from(label, 'ascii')])),
+    Buffer.from([0x00])
+  ]);
+  return Buffer.concat([header, name, Buffer.from([0x00, 0x0c, 0x00, 0x01])]);
+}
+
+/**
+ * Lee un nombre DNS con punteros de compresión; devuelve [nombre, siguiente offset]
+ */
+function readName(message, offset) {
+  const labels = [];
+  let next = -1;
+
+  for (let jumps = 0; offset < message.length && jumps < 16;) {
+    const length = message[offset];
+    if (length === 0) {
+      offset++;
+      break;
+    }
+    if ((length & 0xc0) === 0xc0) {
+      if (next === -1) next = offset + 2;
+      offset = ((length & 0x3f) << 8) | message[offset + 1];
+      jumps++;
+      continue;
+    }
+    labels.push(message.subarray(offset + 1, offset + 1 + length).toString('utf8'));
+    offset += length + 1;
+  }
+
+  return [labels.join('.'), next === -1 ? offset : next];
+}
+
+/**
+ * Nombre del primer registro PTR de una respuesta LLMNR
+ */
+function parsePtr(message, id) {
+  if (message.length < 12 || message.readUInt16BE(0) !== id) return '';
+  const questions = message.readUInt16BE(4);
+  const answers = message.readUInt16BE(6);
+
+  let offset = 12;
+  for (let i = 0; i < questions; i++) {
+    offset = readName(message, offset)[1] + 4;
+  }
+  for (let i = 0; i < answers && offset < message.length; i++) {
+    offset = readName(message, offset)[1];
+    const type = message.readUInt16BE(offset);
+    const length = message.readUInt16BE(offset + 8);
+    if (type === 0x0c) return readName(message, offset + 10)[0];
+    offset += 10 + length;
+  }
+  return '';
+}
+
+/**
+ * Nombre anunciado por un host sin hostname: NetBIOS-NS y LLMNR en paralelo
+ * Devuelve el primero que responda o '' (p. ej. NAS sin Samba ni systemd-resolved)
+ * Opciones: `timeout` (ms) y `signal` (AbortSignal)
+ */
+async function lookupHostName(ip, options = {}) {
+  const id = crypto.randomInt(0x10000);
+  const queries = [
+    queryUdp(ip, NBNS_PORT, nbstatQuery(id), (message) => parseNbstat(message, id), options),
+    queryUdp(ip, LLMNR_PORT, ptrQuery(id, ip), (message) => parsePtr(message, id), options)
+  ];
+
+  try {
+    return await Promise.any(queries.map(async (query) => {
+      const name = await query;
+      if (!name) throw new Error('sin nombre');
+      return name;
+    }));
+  } catch {
+    return '';
+  }
+}
+
+module.exports = { lookupHostName };
@@ -0,0 +1,194 @@
+const { execFile } = require('child_process');
+const fs = require('fs');
+const log = require('./log');
+
+/**
+ * Tabla de vecinos (ARP) del sistema
+ * Devuelve Map ip -> { mac, reachable } o null si la plataforma no la expone
+ */
+async function readNeighborTable() {
+  try {
+    if (process.platform === 'linux') {
+      return parseProcArp(fs.readFileSync('/proc/net/arp', 'utf8'));
+    }
+    const output = await runArp();
+    return process.platform === 'win32' ? parseWindowsArp(output) : parseBsdArp(output);
+  } catch {
+    return null;
+  }
+}
+
+function runArp() {
+  // -n evita resoluciones DNS inversas (no existe en Windows)
+  return run('arp', process.platform === 'win32' ? ['-a'] : ['-an']);
+}
+
+/**
+ * Vecinos IPv6 (NDP) que han respondido; los de enlace local llevan la zona (fe80::1%eth0)
+ * Devuelve Map ip -> { mac, reachable } o null si la plataforma no expone la tabla
+ */
+async function readIPv6Neighbors() {
+  try {
+    if (process.platform === 'linux') {
+      return parseIpNeigh(await run('ip', ['-6', 'neigh', 'show']));
+    }
+    if (process.platform === 'darwin') {
+      return parseNdp(await run('ndp', ['-an']));
+    }
+  } catch {
+    // Sin herramienta de vecinos
+  }
+  return null;
+}
+
+function run(command, args, timeout = 5000, signal) {
+  return new Promise((resolve, reject) => {
+    execFile(command, args, { timeout, signal }, (err, stdout) => {
+      if (err) return reject(err);
+      resolve(stdout);
+    });
+  });
+}
+
+/**
+ * Linux: "fe80::1 dev eth0 lladdr aa:bb:cc:dd:ee:ff REACHABLE"
+ */
+function parseIpNeigh(text) {
+  const table = new Map();
+
+  for (const line of text.split('\n')) {
+    const match = line.match(/^([0-9a-f:]+) dev (\S+) lladdr (\S+)/i);
+    if (!match || /\b(FAILED|INCOMPLETE)\b/.test(line)) continue;
+    const ip = match[1].toLowerCase().startsWith('fe80:') ? `${match[1]}%${match[2]}` : match[1];
+    table.set(ip, { mac: normalizeMac(match[3]), reachable: true });
+  }
+
+  return table;
+}
+
+/**
+ * macOS: "fe80::1%en0  aa:bb:cc:dd:ee:ff  en0 23h59m58s S R"
+ */
+function parseNdp(text) {
+  const table = new Map();
+
+  for (const line of text.split('\n').slice(1)) {
+    const [ip, mac] = line.trim().split(/\s+/);
+    if (ip && mac && mac !== '(incomplete)' && ip.includes(':')) {
+      table.set(ip, { mac: normalizeMac(mac), reachable: true });
+    }
+  }
+
+  return table;
+}
+
+/**
+ * Barrido ARP activo con arp-scan (necesita root o CAP_NET_RAW)
+ * Encuentra hosts que descartan los SYN al 443 pero responden a ARP
+ * Devuelve Map ip -> { mac, reachable } o null si no se pudo ejecutar
+ * Abortar `signal` mata el arp-scan en curso
+ */
+async function arpSweep(interfaces, signal) {
+  const table = new Map();
+  let swept = false;
+
+  for (const name of new Set(interfaces.map((iface) => iface.name))) {
+    if (signal?.aborted) break;
+    try {
+      const output = await runArpScan(name, signal);
+      for (const [ip, entry] of parseArpScan(output)) table.set(ip, entry);
+      swept = true;
+    } catch (err) {
+      if (signal?.aborted) break;
+      log.warn(`[Neighbors] arp-scan no disponible en ${name} (${err.message}); se sigue sin barrido ARP`);
+    }
+  }
+
+  return swept ? table : null;
+}
+
+function runArpScan(iface, signal) {
+  return run('arp-scan', ['--localnet', '--plain', '--quiet', `--interface=${iface}`], 15000, signal);
+}
+
+/**
+ * arp-scan --plain: "192.168.1.1\taa:bb:cc:dd:ee:ff"
+ */
+function parseArpScan(text) {
+  const table = new Map();
+
+  for (const line of text.split('\n')) {
+    const match = line.match(/^(\d+\.\d+\.\d+\.\d+)\s+([0-9a-f:]{11,17})/i);
+    if (match) table.set(match[1], { mac: normalizeMac(match[2]), reachable: true });
+  }
+
+  return table;
+}
+
+/**
+ * /proc/net/arp: "IP  HWtype  Flags  HWaddress  Mask  Device"
+ * Flags 0x0 = entrada incompleta (nadie respondió al ARP)
+ */
+function parseProcArp(text) {
+  const table = new Map();
+
+  for (const line of text.split('\n').slice(1)) {
+    const [ip, , flags, mac] = line.trim().split(/\s+/);
+    if (!ip || !flags) continue;
+
+    const reachable = (Number.parseInt(flags, 16) & 0x2) !== 0;
+    table.set(ip, { mac: reachable ? normalizeMac(mac) : '', reachable });
+  }
+
+  return table;
+}
+
+/**
+ * macOS/BSD: "? (192.168.1.1) at aa:bb:cc:dd:ee:ff on en0 ifscope [ethernet]"
+ * Las entradas sin respuesta aparecen como "(incomplete)"
+ */
+function parseBsdArp(text) {
+  const table = new Map();
+
+  for (const line of text.split('\n')) {
+    const match = line.match(/\((\d+\.\d+\.\d+\.\d+)\) at (\S+)/);
+    if (!match) continue;
+
+    const reachable = match[2] !== '(incomplete)';
+    table.set(match[1], { mac: reachable ? normalizeMac(match[2]) : '', reachable });
+  }
+
+  return table;
+}
+
+/**
+ * Windows: "  192.168.1.1     aa-bb-cc-dd-ee-ff     dynamic"
+ * Windows no lista los vecinos fallidos, solo los válidos
+ */
+function parseWindowsArp(text) {
+  const table = new Map();
+
+  for (const line of text.split('\n')) {
+    const match = line.trim().match(/^(\d+\.\d+\.\d+\.\d+)\s+([0-9a-f-]{17})\s/i);
+    if (!match || match[2] === 'ff-ff-ff-ff-ff-ff') continue;
+
+    table.set(match[1], { mac: normalizeMac(match[2]), reachable: true });
+  }
+
+  return table;
+}
+
+/**
+ * Formato canónico aa:bb:cc:dd:ee:ff (macOS omite ceros a la izquierda)
+ */
+function normalizeMac(mac) {
+  if (!mac) return '';
+  const parts = mac.toLowerCase().split(/[:-]/);
+  if (parts.length !== 6) return '';
+  return parts.map((part) => part.padStart(2, '0')).join(':');
+}
+
+module.exports = {
+  readNeighborTable, readIPv6Neighbors, arpSweep, normalizeMac,
+  parseProcArp, parseBsdArp, parseWindowsArp, parseArpScan, parseIpNeigh, parseNdp
+};
@@ -0,0 +1,55 @@
+const net = require('net');
+
+// Rangos donde es razonable barrer: RFC1918 y link-local
+const PRIVATE_IPV4_RANGES = [
+  ['10.0.0.0', 8],
+  ['172.16.0.0', 12],
+  ['192.168.0.0', 16],
+  ['169.254.0.0', 16]
+];
+
+/**
+ * Convierte una IPv4 en entero sin signo
+ */
+function ipv4ToInt(ip) {
+  return ip.split('.').reduce((acc, octet) => ((acc << 8) | Number.parseInt(octet, 10)) >>> 0, 0);
+}
+
+/**
+ * Convierte un entero sin signo en IPv4
+ */
+function intToIpv4(value) {
+  return [24, 16, 8, 0].map((shift) => (value >>> shift) & 0xff).join('.');
+}
+
+/**
+ * Comprueba si una IPv4 pertenece a base/prefix
+ */
+function ipv4InRange(ip, base, prefix) {
+  const mask = prefix === 0 ? 0 : (~0 << (32 - prefix)) >>> 0;
+  return ((ipv4ToInt(ip) & mask) >>> 0) === ((ipv4ToInt(base) & mask) >>> 0);
+}
+
+/**
+ * Direcciones privadas o de enlace local (IPv4 RFC1918/169.254, IPv6 ULA/fe80::)
+ */
+function isPrivateAddress(ip) {
+  if (net.isIPv4(ip)) {
+    return PRIVATE_IPV4_RANGES.some(([base, prefix]) => ipv4InRange(ip, base, prefix));
+  }
+  if (net.isIPv6(ip.split('%')[0])) {
+    const first = Number.parseInt(ip.split(':')[0] || '0', 16);
+    return (first & 0xfe00) === 0xfc00 || (first & 0xffc0) === 0xfe80;
+  }
+  return false;
+}
+
+/**
+ * Host de una IP para usar en una URL: IPv6 entre corchetes y sin zona (%eth0),
+ * que los navegadores no admiten
+ */
+function urlHost(ip) {
+  return net.isIPv6(ip.split('%')[0]) ? `[${ip.split('%')[0]}]` : ip;
+}
+
+module.exports = { ipv4ToInt, intToIpv4, ipv4InRange, isPrivateAddress, urlHost };
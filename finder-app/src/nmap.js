@@ -0,0 +1,120 @@
+const WEB_PORTS = new Set([80, 443]);
+
+const XML_ENTITIES = { '&amp;': '&', '&lt;': '<', '&gt;': '>', '&quot;': '"', '&apos;': "'" };
+
+function unescapeXml(value) {
+  return value.replace(/&(amp|lt|gt|quot|apos);/g, (entity) => XML_ENTITIES[entity]);
+}
+
+function escapeXml(value) {
+  return String(value ?? '').replace(/[&<>"']/g, (c) => ({
+    '&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;', "'": '&apos;'
+  })[c]);
+}
+
+/**
+ * Atributos de una etiqueta XML (`<tag a="1" b="2">`)
+ */
+function attributes(fragment) {
+  const attrs = {};
+  for (const [, name, value] of fragment.matchAll(/([\w:-]+)="([^"]*)"/g)) {
+    attrs[name] = unescapeXml(value);
+  }
+  return attrs;
+}
+
+function tags(xml, tag) {
+  return Array.from(xml.matchAll(new RegExp(`<${tag}\\b[^>]*>`, 'g')), ([match]) => attributes(match));
+}
+
+/**
+ * Hosts activos de un fichero XML de nmap (`nmap -oX`)
+ * Devuelve [{ ip, mac, hostname, ports }] con los puertos TCP abiertos
+ */
+function parseNmapXml(xml) {
+  const hosts = [];
+
+  for (const [block] of xml.matchAll(/<host\b[\s\S]*?<\/host>/g)) {
+    const status = tags(block, 'status')[0];
+    if (status && status.state !== 'up') continue;
+
+    const addresses = tags(block, 'address');
+    const ip = addresses.find((addr) => addr.addrtype === 'ipv4')?.addr;
+    if (!ip) continue;
+
+    const ports = [];
+    for (const [, attrs, body] of block.matchAll(/<port\b([^>]*)>([\s\S]*?)<\/port>/g)) {
+      const port = attributes(attrs);
+      const id = Number.parseInt(port.portid, 10);
+      // Un portid que no es número (fichero editado o corrupto) no cuenta como puerto
+      if (port.protocol === 'tcp' && Number.isInteger(id) && tags(body, 'state')[0]?.state === 'open') {
+        ports.push(id);
+      }
+    }
+
+    hosts.push({
+      ip,
+      mac: addresses.find((addr) => addr.addrtype === 'mac')?.addr?.toLowerCase() || '',
+      hostname: tags(block, 'hostname')[0]?.name || '',
+      // Sin sección <ports> (p. ej. nmap -sn) no se sabe qué hay abierto
+      ports: block.includes('<ports') ? ports : null
+    });
+  }
+
+  return hosts;
+}
+
+/**
+ * Hosts del XML que merece la pena sondear: los que tienen un puerto web abierto (`webPorts`)
+ * o de los que nmap no sabe los puertos
+ */
+function nmapSeeds(hosts, webPorts = WEB_PORTS) {
+  return hosts.filter((host) => host.ports === null || host.ports.some((port) => webPorts.has(port)));
+}
+
+/**
+ * Resultados del Finder como XML compatible con nmap (`-oX`)
+ */
+function formatNmapXml(devices, { startedAt = new Date(), finishedAt = new Date(), version = '' } = {}) {
+  const start = Math.floor(startedAt.getTime() / 1000);
+  const end = Math.floor(finishedAt.getTime() / 1000);
+  const lines = [
+    '<?xml version="1.0" encoding="UTF-8"?>',
+    '<!DOCTYPE nmaprun>',
+    `<nmaprun scanner="homepinas-finder" args="homepinas-finder" start="${start}" ` +
+      `startstr="${escapeXml(startedAt.toString())}" version="${escapeXml(version)}" xmloutputversion="1.05">`
+  ];
+
+  for (const device of devices) {
+    const url = new URL(device.url || `https://${device.ip}`);
+    const service = url.protocol.replace(':', '');
+    const port = url.port || (service === 'https' ? '443' : '80');
+
+    lines.push(
+      `<host starttime="${start}" endtime="${end}">`,
+      '<status state="up" reason="user-set" reason_ttl="0"/>',
+      `<address addr="${escapeXml(device.ip)}" addrtype="ipv4"/>`,
+      device.hostname
+        ? `<hostnames><hostname name="${escapeXml(device.hostname)}" type="user"/></hostnames>`
+        : '<hostnames/>',
+      '<ports>',
+      `<port protocol="tcp" portid="${port}"><state state="open" reason="syn-ack" reason_ttl="0"/>` +
+        `<service name="${service}" product="HomePiNAS" version="${escapeXml(device.version || '')}" ` +
+        `extrainfo="${escapeXml(device.name || '')}" method="probed" conf="10"/></port>`,
+      '</ports>',
+      '</host>'
+    );
+  }
+
+  lines.push(
+    '<runstats>',
+    `<finished time="${end}" timestr="${escapeXml(finishedAt.toString())}" elapsed="${end - start}" exit="success"/>`,
+    `<hosts up="${devices.length}" down="0" total="${devices.length}"/>`,
+    '</runstats>',
+    '</nmaprun>'
+  );
+
+  return lines.join('\n') + '\n';
+}
+
+module.exports = { parseNmapXml, nmapSeeds, formatNmapXml };
@@ -0,0 +1,317 @@
+const http = require('http');
+const https = require('https');
+const log = require('./log');
+const { describeEvent } = require('./events');
+const { createSyslogSender } = require('./syslog');
+const { createEventLogWriter } = require('./eventlog');
+const { connectMqtt } = require('./mqtt');
+
+const EVENT_SEVERITY = { discovered: 'notice', online: 'info', offline: 'warning', changed: 'info', 'cert-changed': 'error' };
+const DEFAULT_TEMPLATE = '{message}';
+const POST_TIMEOUT = 10000;
+
+/**
+ * POST de un JSON (con `headers` extra, p. ej. Authorization); rechaza si la respuesta no es 2xx
+ */
+function postJson(url, body, headers = {}) {
+  return new Promise((resolve, reject) => {
+    const target = new URL(url);
+    const client = target.protocol === 'http:' ? http : https;
+    const payload = JSON.stringify(body);
+
+    const req = client.request(target, {
+      method: 'POST',
+      headers: { ...headers, 'Content-Type': 'application/json', 'Content-Length': Buffer.byteLength(payload) },
+      timeout: POST_TIMEOUT
+    }, (res) => {
+      res.resume();
+      res.on('end', () => {
+        if (res.statusCode >= 200 && res.statusCode < 300) resolve();
+        else reject(new Error(`HTTP ${res.statusCode}`));
+      });
+    });
+
+    req.on('timeout', () => req.destroy(new Error('timeout')));
+    req.on('error', reject);
+    req.end(payload);
+  });
+}
+
+/**
+ * Rellena una plantilla: {message} {event} {name} {ip} {version} {hostname}
+ */
+function renderTemplate(template, event) {
+  const values = {
+    message: describeEvent(event),
+    event: event.type,
+    name: event.device.name || '',
+    ip: event.device.ip || '',
+    version: event.device.version || '',
+    hostname: event.device.hostname || ''
+  };
+  return (template || DEFAULT_TEMPLATE).replace(/\{(\w+)\}/g, (match, key) => (key in values ? values[key] : match));
+}
+
+/**
+ * Canal genérico: filtra por tipo de evento y entrega el texto de la plantilla
+ */
+function chatChannel(name, options, deliver) {
+  const events = options.events ? new Set(options.events) : null;
+
+  return {
+    name,
+    send: (event) => {
+      if (events && !events.has(event.type)) return null;
+      return deliver(renderTemplate(options.template, event), event);
+    }
+  };
+}
+
+/**
+ * Canal syslog para eventos de descubrimiento y disponibilidad
+ */
+function syslogChannel(options) {
+  const sender = createSyslogSender(options);
+
+  return {
+    name: 'syslog',
+    send: (event) => sender.send({
+      severity: EVENT_SEVERITY[event.type] || 'info',
+      msgId: event.type,
+      message: describeEvent(event),
+      data: {
+        ip: event.device.ip,
+        name: event.device.name,
+        version: event.device.version,
+        method: event.device.method
+      }
+    })
+  };
+}
+
+// Ids del registro de eventos de Windows por tipo de evento (para filtrar en el visor)
+const EVENT_LOG_IDS = { discovered: 100, online: 101, offline: 102, changed: 103, 'cert-changed': 104 };
+const EVENT_LOG_LEVELS = { notice: 'info', info: 'info', warning: 'warning', error: 'error' };
+
+/**
+ * Canal del registro de eventos de Windows (Aplicación), p. ej. para watch como servicio
+ */
+function eventLogChannel(options) {
+  const writer = createEventLogWriter(options);
+
+  return {
+    name: 'eventLog',
+    send: (event) => writer.write({
+      level: EVENT_LOG_LEVELS[EVENT_SEVERITY[event.type]] || 'info',
+      id: EVENT_LOG_IDS[event.type] || 1,
+      message: describeEvent(event)
+    })
+  };
+}
+
+/**
+ * Webhook genérico (Home Assistant, n8n, Slack...): POST con el evento en JSON
+ * `text` lleva el mensaje legible, así que un webhook entrante de Slack también lo acepta
+ */
+function webhookChannel(options, index) {
+  const events = options.events ? new Set(options.events) : null;
+  const pick = (device) => ({
+    ip: device.ip,
+    name: device.name || '',
+    hostname: device.hostname || '',
+    version: device.version || '',
+    url: device.url || '',
+    method: device.method || '',
+    mac: device.mac || ''
+  });
+
+  return {
+    name: options.name || `webhook ${index + 1}`,
+    send: (event) => {
+      if (events && !events.has(event.type)) return null;
+      return postJson(options.url, {
+        event: event.type,
+        timestamp: event.timestamp,
+        text: describeEvent(event),
+        device: pick(event.device),
+        ...(event.previous ? { previous: pick(event.previous) } : {})
+      });
+    }
+  };
+}
+
+/**
+ * Identificador estable para los topics: la MAC, el hostname o, en último caso, la IP
+ */
+function mqttDeviceId(device) {
+  const raw = device.mac || device.hostname || device.ip;
+  return String(raw).toLowerCase().replace(/[^a-z0-9]+/g, '_').replace(/^_|_$/g, '');
+}
+
+/**
+ * Entidades de Home Assistant (MQTT discovery) de un NAS: [componente, objeto, config]
+ * Un device_tracker para la presencia y sensores de IP y versión, agrupados en un dispositivo
+ */
+function homeAssistantEntities(device, id, topic) {
+  const uniqueId = `homepinas_${id}`;
+  const haDevice = {
+    identifiers: [uniqueId],
+    name: device.name || device.hostname || device.ip,
+    manufacturer: 'HomePiNAS',
+    ...(device.model ? { model: device.model } : {}),
+    ...(device.version ? { sw_version: device.version } : {}),
+    ...(device.url ? { configuration_url: device.url } : {}),
+    ...(device.mac ? { connections: [['mac', device.mac]] } : {})
+  };
+  const sensor = (field, name, icon) => ['sensor', field, {
+    name,
+    unique_id: `${uniqueId}_${field}`,
+    state_topic: `${topic}/attributes`,
+    value_template: `{{ value_json.${field} }}`,
+    icon,
+    device: haDevice
+  }];
+
+  return [
+    ['device_tracker', 'presence', {
+      name: null,
+      unique_id: `${uniqueId}_presence`,
+      state_topic: `${topic}/presence`,
+      payload_home: 'home',
+      payload_not_home: 'not_home',
+      source_type: 'router',
+      json_attributes_topic: `${topic}/attributes`,
+      device: haDevice
+    }],
+    sensor('ip', 'IP', 'mdi:ip-network'),
+    sensor('version', 'Versión', 'mdi:package-variant')
+  ];
+}
+
+/**
+ * Canal MQTT con autodescubrimiento de Home Assistant
+ * Todo se publica retenido: Home Assistant recupera el estado al reiniciarse
+ * La contraseña del broker sale del almacén de secretos (`mqtt.password`)
+ */
+function mqttChannel(options, secrets) {
+  const discoveryPrefix = options.discoveryPrefix || 'homeassistant';
+  const topicPrefix = options.topicPrefix || 'homepinas-finder';
+  const retain = { retain: true };
+  // Una conexión por tanda de eventos: se abre con el primero y se cierra en close()
+  let client = null;
+  const connect = () => {
+    client = client || connectMqtt(options.url, {
+      username: options.username,
+      password: options.username ? secrets?.get('mqtt.password') || '' : '',
+      allowSelfSigned: options.allowSelfSigned
+    });
+    return client;
+  };
+
+  return {
+    name: 'mqtt',
+    async send(event) {
+      const mqtt = await connect();
+      const id = mqttDeviceId(event.device);
+      const topic = `${topicPrefix}/${id}`;
+
+      if (event.type === 'offline') {
+        await mqtt.publish(`${topic}/presence`, 'not_home', retain);
+        return;
+      }
+
+      for (const [component, object, config] of homeAssistantEntities(event.device, id, topic)) {
+        await mqtt.publish(`${discoveryPrefix}/${component}/homepinas_${id}/${object}/config`, JSON.stringify(config), retain);
+      }
+      const { ip, name, hostname, version, url, mac } = event.device;
+      await mqtt.publish(`${topic}/attributes`, JSON.stringify({
+        ip, name, hostname: hostname || '', version: version || '', url: url || '', mac: mac || ''
+      }), retain);
+      await mqtt.publish(`${topic}/presence`, 'home', retain);
+    },
+    async close() {
+      const pending = client;
+      client = null;
+      await pending?.then((mqtt) => mqtt.end()).catch(() => {});
+    }
+  };
+}
+
+/**
+ * Canal de email (SMTP); la contraseña sale del almacén de secretos (`smtp.password`)
+ */
+function emailChannel(options, secrets) {
+  // Carga diferida: solo se necesita nodemailer si el email está configurado
+  const nodemailer = require('nodemailer');
+  const password = secrets?.get('smtp.password');
+
+  const transporter = nodemailer.createTransport({
+    host: options.host,
+    port: options.port || (options.secure ? 465 : 587),
+    secure: Boolean(options.secure),
+    auth: options.user ? { user: options.user, pass: password || '' } : undefined
+  });
+
+  return chatChannel('email', options, (text, event) => transporter.sendMail({
+    from: options.from || options.user,
+    to: options.to,
+    subject: renderTemplate(options.subject || 'HomePiNAS Finder: {message}', event),
+    text
+  }));
+}
+
+/**
+ * Crea los canales configurados y reparte cada evento entre ellos
+ * Un canal que falla no impide que los demás reciban el evento
+ * `secrets` (opcional) da acceso a credenciales cifradas
+ */
+function createNotifier(config, secrets = null) {
+  const channels = [];
+
+  const chat = config.notifications || {};
+
+  if (config.syslog?.enabled) {
+    channels.push(syslogChannel(config.syslog));
+  }
+  if (config.eventLog?.enabled && process.platform === 'win32') {
+    channels.push(eventLogChannel(config.eventLog));
+  }
+  if (chat.slack?.webhookUrl) {
+    channels.push(chatChannel('slack', chat.slack, (text) => postJson(chat.slack.webhookUrl, { text })));
+  }
+  if (chat.discord?.webhookUrl) {
+    channels.push(chatChannel('discord', chat.discord, (content) => postJson(chat.discord.webhookUrl, { content })));
+  }
+  if (chat.telegram?.botToken && chat.telegram?.chatId) {
+    const url = `https://api.telegram.org/bot${chat.telegram.botToken}/sendMessage`;
+    channels.push(chatChannel('telegram', chat.telegram, (text) => postJson(url, { chat_id: chat.telegram.chatId, text })));
+  }
+  if (chat.email?.host && chat.email?.to) {
+    channels.push(emailChannel(chat.email, secrets));
+  }
+  (chat.webhooks || []).forEach((webhook, index) => {
+    if (webhook?.url) channels.push(webhookChannel(webhook, index));
+  });
+  if (config.mqtt?.enabled && config.mqtt.url) {
+    channels.push(mqttChannel(config.mqtt, secrets));
+  }
+
+  return {
+    channels,
+    async publish(events) {
+      for (const event of events) {
+        await Promise.all(channels.map(async (channel) => {
+          try {
+            await channel.send(event);
+          } catch (err) {
+            log.warn(`[Notify] ${channel.name}: ${err.message}`);
+          }
+        }));
+      }
+      // Canales con conexión abierta durante la tanda (MQTT)
+      await Promise.all(channels.map((channel) => channel.close?.()));
+    }
+  };
+}
+
+module.exports = { createNotifier, postJson, renderTemplate, mqttDeviceId };
@@ -0,0 +1,503 @@
+/**
+ * Documento OpenAPI 3 de la interfaz web de serve (/api/openapi.json), para que otros
+ * puedan generar clientes. Describe las mismas rutas que atiende web.js: una ruta nueva
+ * allí va también aquí (lo comprueba __tests__/openapi.test.js)
+ */
+const { version } = require('../package.json');
+
+const json = (schema, description = 'OK') => ({
+  description,
+  content: { 'application/json': { schema } }
+});
+const ref = (name) => ({ $ref: `#/components/schemas/${name}` });
+const error = (description) => json(ref('Error'), description);
+
+const TOO_MANY = error('Límite de peticiones superado (cabecera Retry-After)');
+
+const SCHEMAS = {
+  Error: {
+    type: 'object',
+    properties: { error: { type: 'string' }, retryAfter: { type: 'integer', description: 'Segundos (solo en 429)' } },
+    required: ['error']
+  },
+  Device: {
+    type: 'object',
+    description: 'NAS del inventario o de un escaneo',
+    properties: {
+      id: { type: 'string', description: 'Id del inventario' },
+      ip: { type: 'string' },
+      addresses: { type: 'array', items: { type: 'string' }, description: 'Todas sus IPs (doble pila)' },
+      name: { type: 'string' },
+      hostname: { type: 'string' },
+      version: { type: 'string' },
+      url: { type: 'string', format: 'uri' },
+      method: { type: 'string', description: 'Cómo se encontró (HTTP, mDNS, beacon...)' },
+      mac: { type: 'string' },
+      vendor: { type: 'string' },
+      model: { type: 'string' },
+      online: { type: 'boolean' },
+      firstSeen: { type: 'string', format: 'date-time' },
+      lastSeen: { type: 'string', format: 'date-time' },
+      alias: { type: 'string' },
+      favorite: { type: 'boolean' },
+      tags: { type: 'array', items: { type: 'string' } },
+      notes: { type: 'string' },
+      paired: { type: 'boolean' }
+    },
+    required: ['ip']
+  },
+  Progress: {
+    type: 'object',
+    properties: {
+      probed: { type: 'integer' },
+      total: { type: 'integer' },
+      methods: {
+        type: 'object',
+        additionalProperties: { type: 'string', enum: ['pending', 'running', 'done', 'failed', 'cancelled'] }
+      },
+      subnets: { type: 'array', items: ref('SubnetProgress') }
+    }
+  },
+  SubnetProgress: {
+    type: 'object',
+    description: 'Avance del barrido de una subred (la de una interfaz o un rango de targets)',
+    properties: {
+      range: { type: 'string', description: 'CIDR, p. ej. 192.168.1.0/24' },
+      probed: { type: 'integer' },
+      total: { type: 'integer' },
+      found: { type: 'integer', description: 'NAS que contestaron en esa subred' }
+    }
+  },
+  ScanStatus: {
+    type: 'object',
+    description: 'Estado del último escaneo',
+    properties: {
+      running: { type: 'boolean' },
+      cancelled: { type: 'boolean' },
+      startedAt: { type: 'string', format: 'date-time' },
+      finishedAt: { type: 'string', format: 'date-time', nullable: true },
+      found: { type: 'integer' },
+      progress: ref('Progress'),
+      probeErrors: { type: 'object', additionalProperties: { type: 'integer' }, description: 'Sondeos fallidos por motivo' },
+      workerErrors: { type: 'object', properties: { count: { type: 'integer' }, recent: { type: 'array', items: { type: 'object' } } } }
+    }
+  },
+  ScanStats: {
+    type: 'object',
+    properties: { scans: { type: 'array', items: { type: 'object', description: 'Telemetría de un escaneo terminado' } } }
+  },
+  ScanJob: {
+    type: 'object',
+    properties: {
+      id: { type: 'string', format: 'uuid' },
+      state: { type: 'string', enum: ['running', 'done', 'cancelled', 'failed'] },
+      createdAt: { type: 'string', format: 'date-time' },
+      finishedAt: { type: 'string', format: 'date-time', nullable: true },
+      progress: { allOf: [ref('Progress')], nullable: true },
+      found: { type: 'integer' },
+      error: { type: 'string' }
+    },
+    required: ['id', 'state']
+  },
+  ScanSummary: {
+    type: 'object',
+    description: 'Escaneo completo guardado en el historial',
+    properties: {
+      id: { type: 'integer' },
+      startedAt: { type: 'string', format: 'date-time' },
+      finishedAt: { type: 'string', format: 'date-time' },
+      found: { type: 'integer' }
+    }
+  },
+  ScanDiff: {
+    type: 'object',
+    description: 'Cambios entre dos escaneos; cada NAS se empareja por MAC o IP',
+    properties: {
+      from: { type: 'integer' },
+      to: { type: 'integer' },
+      appeared: { type: 'array', items: ref('Device') },
+      vanished: { type: 'array', items: ref('Device') },
+      moved: { type: 'array', items: ref('Device'), description: 'Con previousIp' },
+      updated: { type: 'array', items: ref('Device'), description: 'Con previousVersion' }
+    }
+  },
+  Details: {
+    type: 'object',
+    description: 'Sondeo ampliado de un NAS, como homepinas-finder details',
+    properties: {
+      ip: { type: 'string' },
+      url: { type: 'string', format: 'uri' },
+      checkedAt: { type: 'string', format: 'date-time' },
+      latency: {
+        type: 'object',
+        properties: { connectMs: { type: 'integer', nullable: true }, responseMs: { type: 'integer', nullable: true } }
+      },
+      info: { type: 'object', nullable: true, description: 'Respuesta completa de /api/system/info' },
+      infoError: { type: 'string' },
+      ports: {
+        type: 'array',
+        items: {
+          type: 'object',
+          properties: {
+            port: { type: 'integer' },
+            service: { type: 'string' },
+            state: { type: 'string', enum: ['open', 'closed', 'filtered'] }
+          }
+        }
+      },
+      certificate: { type: 'object', nullable: true }
+    }
+  },
+  Diagnosis: {
+    type: 'object',
+    properties: {
+      host: { type: 'string' },
+      ip: { type: 'string', nullable: true },
+      verdict: { type: 'string' },
+      steps: {
+        type: 'array',
+        items: {
+          type: 'object',
+          properties: {
+            id: { type: 'string' },
+            title: { type: 'string' },
+            status: { type: 'string', enum: ['ok', 'warn', 'fail', 'skip'] },
+            detail: { type: 'string' },
+            hint: { type: 'string' }
+          }
+        }
+      }
+    }
+  },
+  Registration: {
+    type: 'object',
+    description: 'Alta firmada de un NAS (docs/register-protocol.md)',
+    properties: {
+      magic: { type: 'string', enum: ['HOMEPINAS-REGISTER'] },
+      v: { type: 'integer', enum: [1] },
+      ip: { type: 'string', description: 'La IP desde la que llama' },
+      name: { type: 'string' },
+      hostname: { type: 'string' },
+      version: { type: 'string' },
+      scheme: { type: 'string', enum: ['http', 'https'] },
+      port: { type: 'integer' },
+      nonce: { type: 'string', pattern: '^[0-9a-f]{32}$' },
+      timestamp: { type: 'string', format: 'date-time' },
+      publicKey: { type: 'string', description: 'Clave pública Ed25519 del beacon (SPKI DER en base64)' },
+      signature: { type: 'string', description: 'Firma Ed25519 del resto de campos en forma canónica' }
+    },
+    required: ['magic', 'v', 'ip', 'nonce', 'timestamp', 'publicKey', 'signature']
+  },
+  AuditEntry: {
+    type: 'object',
+    description: 'Acción sobre un NAS registrada en audit.log',
+    properties: {
+      timestamp: { type: 'string', format: 'date-time' },
+      action: { type: 'string', description: 'wake, reboot, shutdown, update, pair, open, update-device...' },
+      device: { type: 'string', description: 'IP del NAS (o fichero, en hosts-update)' },
+      client: { type: 'string', description: 'Desde dónde: ui (ventana), tray, cli o web' },
+      result: { type: 'string', enum: ['ok', 'error'] },
+      error: { type: 'string' }
+    },
+    required: ['timestamp', 'action', 'result']
+  },
+  TargetGroup: {
+    type: 'object',
+    description: 'Grupo de objetivos de http_sd de Prometheus',
+    properties: {
+      targets: { type: 'array', items: { type: 'string' } },
+      labels: { type: 'object', additionalProperties: { type: 'string' } }
+    }
+  }
+};
+
+const SCAN_ID = { name: 'id', in: 'path', required: true, schema: { type: 'string', format: 'uuid' } };
+const DEVICE_ID = { name: 'id', in: 'path', required: true, schema: { type: 'string' }, description: 'Id del inventario' };
+
+const PATHS = {
+  '/healthz': {
+    get: { summary: 'Sonda de vida', security: [], tags: ['probes'], responses: { 200: json({ type: 'object' }) } }
+  },
+  '/readyz': {
+    get: {
+      summary: 'Sonda de disponibilidad (en modo contenedor, tras el primer escaneo)',
+      security: [],
+      tags: ['probes'],
+      responses: { 200: json({ type: 'object' }), 503: json({ type: 'object' }, 'Aún no está listo') }
+    }
+  },
+  '/login': {
+    get: {
+      summary: 'Cambia el token por una cookie de sesión y redirige a la página',
+      security: [],
+      tags: ['auth'],
+      parameters: [{ name: 'token', in: 'query', required: true, schema: { type: 'string' } }],
+      responses: { 303: { description: 'Sesión abierta (Set-Cookie)' }, 401: { description: 'Token no válido' } }
+    }
+  },
+  '/api/devices': {
+    get: {
+      summary: 'NAS del inventario',
+      tags: ['devices'],
+      parameters: [{ name: 'tag', in: 'query', schema: { type: 'string' }, description: 'Solo los que llevan esa etiqueta (sin distinguir mayúsculas)' }],
+      responses: { 200: json({ type: 'object', properties: { devices: { type: 'array', items: ref('Device') } } }) }
+    }
+  },
+  '/api/devices/{id}': {
+    patch: {
+      summary: 'Cambia alias, favorito, etiquetas o notas de una ficha; un texto o lista vacíos borran el campo (queda en audit.log)',
+      tags: ['devices'],
+      parameters: [DEVICE_ID],
+      requestBody: {
+        required: true,
+        content: {
+          'application/json': {
+            schema: {
+              type: 'object',
+              additionalProperties: false,
+              properties: {
+                alias: { type: 'string', maxLength: 64 },
+                favorite: { type: 'boolean' },
+                tags: { type: 'array', items: { type: 'string', maxLength: 32 }, maxItems: 20 },
+                notes: { type: 'string', maxLength: 2000 }
+              }
+            }
+          }
+        }
+      },
+      responses: { 200: json(ref('Device')), 400: error('Campo no editable o valor no válido'), 404: error('No está en el inventario') }
+    }
+  },
+  '/api/devices/{ip}/details': {
+    get: {
+      summary: 'Sondeo ampliado de un NAS del inventario: info completa, puertos de servicio, certificado y latencia',
+      tags: ['devices'],
+      parameters: [{ name: 'ip', in: 'path', required: true, schema: { type: 'string' }, description: 'Cualquiera de sus IPs del inventario' }],
+      responses: { 200: json(ref('Details')), 404: error('No está en el inventario'), 429: TOO_MANY }
+    }
+  },
+  '/api/devices/{id}/wake': {
+    post: {
+      summary: 'Manda el paquete mágico de Wake-on-LAN (queda en audit.log)',
+      tags: ['devices'],
+      parameters: [DEVICE_ID],
+      responses: {
+        200: json({ type: 'object', properties: { sent: { type: 'array', items: { type: 'string' }, description: 'Direcciones de difusión' } } }),
+        404: error('No está en el inventario'),
+        409: error('No se conoce su MAC'),
+        429: TOO_MANY
+      }
+    }
+  },
+  '/api/scan': {
+    get: { summary: 'Estado del último escaneo', tags: ['scans'], responses: { 200: json(ref('ScanStatus')) } },
+    post: {
+      summary: 'Escanea y responde al terminar (con uno en marcha, espera a ese)',
+      tags: ['scans'],
+      responses: {
+        200: json({ type: 'object', properties: { devices: { type: 'array', items: ref('Device') } } }),
+        429: TOO_MANY
+      }
+    }
+  },
+  '/api/scan/progress': {
+    get: {
+      summary: 'Avance del escaneo en curso (o del último): hosts sondeados, estado de cada método y cada subred',
+      tags: ['scans'],
+      responses: {
+        200: json({
+          allOf: [
+            ref('Progress'),
+            {
+              type: 'object',
+              properties: {
+                running: { type: 'boolean' },
+                startedAt: { type: 'string', format: 'date-time', nullable: true },
+                found: { type: 'integer' }
+              }
+            }
+          ]
+        })
+      }
+    }
+  },
+  '/api/scan/stats': {
+    get: { summary: 'Telemetría de los últimos escaneos', tags: ['scans'], responses: { 200: json(ref('ScanStats')) } }
+  },
+  '/api/scans': {
+    post: {
+      summary: 'Escaneo en segundo plano (con uno en marcha, devuelve ese)',
+      tags: ['scans'],
+      responses: {
+        202: {
+          ...json(ref('ScanJob'), 'Escaneo en marcha'),
+          headers: { Location: { schema: { type: 'string' } } }
+        },
+        429: TOO_MANY
+      }
+    }
+  },
+  '/api/scans/history': {
+    get: {
+      summary: 'Escaneos completos guardados, del más reciente al más antiguo',
+      tags: ['scans'],
+      responses: { 200: json({ type: 'object', properties: { scans: { type: 'array', items: ref('ScanSummary') } } }) }
+    }
+  },
+  '/api/scans/diff': {
+    get: {
+      summary: 'NAS que aparecen, desaparecen, cambian de IP o de versión entre dos escaneos',
+      tags: ['scans'],
+      parameters: [
+        { name: 'from', in: 'query', schema: { type: 'string', default: 'previous' }, description: 'Id del historial, latest o previous' },
+        { name: 'to', in: 'query', schema: { type: 'string', default: 'latest' }, description: 'Id del historial, latest o previous' }
+      ],
+      responses: { 200: json(ref('ScanDiff')), 400: error('Escaneo no válido'), 404: error('No existe ese escaneo') }
+    }
+  },
+  '/api/scans/{id}': {
+    get: {
+      summary: 'Estado y progreso de un escaneo en segundo plano',
+      tags: ['scans'],
+      parameters: [SCAN_ID],
+      responses: { 200: json(ref('ScanJob')), 404: error('No existe o ha caducado') }
+    }
+  },
+  '/api/scans/{id}/results': {
+    get: {
+      summary: 'NAS encontrados por un escaneo en segundo plano',
+      tags: ['scans'],
+      parameters: [SCAN_ID],
+      responses: {
+        200: json({
+          type: 'object',
+          properties: { id: { type: 'string' }, state: { type: 'string' }, devices: { type: 'array', items: ref('Device') } }
+        }),
+        404: error('No existe o ha caducado'),
+        409: error('Aún no ha terminado o falló')
+      }
+    }
+  },
+  '/api/diagnose': {
+    post: {
+      summary: 'Por qué no aparece un NAS: diagnóstico por etapas',
+      tags: ['devices'],
+      parameters: [{ name: 'host', in: 'query', required: true, schema: { type: 'string' }, description: 'IP o nombre' }],
+      responses: { 200: json(ref('Diagnosis')), 400: error('Host no válido'), 429: TOO_MANY }
+    }
+  },
+  '/api/register': {
+    post: {
+      summary: 'Alta de un NAS sin escanear (lo llama el propio NAS; lo autentica su firma)',
+      security: [],
+      tags: ['devices'],
+      requestBody: { required: true, content: { 'application/json': { schema: ref('Registration') } } },
+      responses: {
+        200: json({
+          type: 'object',
+          properties: { id: { type: 'string' }, keyPin: { type: 'string', enum: ['new', 'match'] } }
+        }),
+        400: error('Registro mal formado'),
+        401: error('Firma no válida, caducada o repetida'),
+        403: error('IP distinta de la de origen, pública, excluida o con otra clave fijada'),
+        413: error('Cuerpo demasiado grande'),
+        429: TOO_MANY
+      }
+    }
+  },
+  '/api/audit': {
+    get: {
+      summary: 'Últimas acciones sobre los NAS (audit.log), de la más antigua a la más reciente',
+      tags: ['devices'],
+      parameters: [
+        { name: 'device', in: 'query', schema: { type: 'string' }, description: 'IP del NAS' },
+        { name: 'action', in: 'query', schema: { type: 'string' } },
+        { name: 'client', in: 'query', schema: { type: 'string' }, description: 'ui, tray, cli o web' },
+        { name: 'result', in: 'query', schema: { type: 'string', enum: ['ok', 'error'] } },
+        { name: 'since', in: 'query', schema: { type: 'string', format: 'date-time' } },
+        { name: 'limit', in: 'query', schema: { type: 'integer', minimum: 1, maximum: 1000, default: 100 } }
+      ],
+      responses: {
+        200: json({ type: 'object', properties: { entries: { type: 'array', items: ref('AuditEntry') } } }),
+        400: error('Filtro no válido')
+      }
+    }
+  },
+  '/api/prometheus/sd': {
+    get: {
+      summary: 'Inventario como objetivos de http_sd de Prometheus',
+      tags: ['integrations'],
+      parameters: [{ name: 'port', in: 'query', schema: { type: 'integer', minimum: 1, maximum: 65535, default: 9100 } }],
+      responses: { 200: json({ type: 'array', items: ref('TargetGroup') }), 400: error('Puerto no válido') }
+    }
+  },
+  '/ws': {
+    get: {
+      summary: 'WebSocket del escaneo: órdenes start-scan y cancel-scan; el servidor manda status, ' +
+        'scan-started, progress, device-found, scan-finished y error (JSON con `type`)',
+      tags: ['scans'],
+      parameters: [{ name: 'csrf', in: 'query', schema: { type: 'string' }, description: 'Token de la página (con cookie o Basic)' }],
+      responses: { 101: { description: 'Conexión WebSocket abierta' }, 426: error('No es una petición WebSocket') }
+    }
+  },
+  '/api/openapi.json': {
+    get: { summary: 'Este documento', tags: ['meta'], responses: { 200: json({ type: 'object' }) } }
+  }
+};
+
+// Solo con serve --debug
+const DEBUG_PATHS = {
+  '/api/debug/trace': {
+    get: {
+      summary: 'Traza de decisiones del último escaneo',
+      tags: ['debug'],
+      parameters: [{ name: 'ip', in: 'query', schema: { type: 'string' } }],
+      responses: { 200: json({ type: 'object' }), 404: error('Aún no hay ningún escaneo con traza') }
+    }
+  },
+  '/api/debug/runtime': {
+    get: { summary: 'Diagnóstico del proceso', tags: ['debug'], responses: { 200: json({ type: 'object' }) } }
+  },
+  '/api/debug/cpu-profile': {
+    get: {
+      summary: 'Perfil de CPU (.cpuprofile)',
+      tags: ['debug'],
+      parameters: [{ name: 'seconds', in: 'query', schema: { type: 'integer' } }],
+      responses: { 200: json({ type: 'object' }) }
+    }
+  },
+  '/api/debug/heap-snapshot': {
+    get: { summary: 'Instantánea del heap (.heapsnapshot)', tags: ['debug'], responses: { 200: json({ type: 'object' }) } }
+  }
+};
+
+/**
+ * Documento de este servidor; `debug` añade las rutas de /api/debug/ y `basePath` es el
+ * prefijo con el que llega el cliente (el de ingress en Home Assistant)
+ */
+function buildOpenApi({ debug = false, basePath = '' } = {}) {
+  return {
+    openapi: '3.0.3',
+    info: {
+      title: 'HomePiNAS Finder',
+      version,
+      description: 'Interfaz web del modo serve. Las llamadas con la cookie de sesión o con ' +
+        'autenticación básica deben llevar además X-CSRF-Token (el de la página servida). ' +
+        'Como complemento de Home Assistant solo se llega por ingress, con la sesión de Home Assistant'
+    },
+    servers: [{ url: `${basePath}/` }],
+    security: [{ bearer: [] }, { basic: [], csrf: [] }, { session: [], csrf: [] }],
+    paths: { ...PATHS, ...(debug ? DEBUG_PATHS : {}) },
+    components: {
+      schemas: SCHEMAS,
+      securitySchemes: {
+        bearer: { type: 'http', scheme: 'bearer', description: 'Token del secreto web.token' },
+        basic: { type: 'http', scheme: 'basic', description: 'web.user y el secreto web.password' },
+        session: { type: 'apiKey', in: 'cookie', name: 'finder_session', description: 'Tras /login?token=' },
+        csrf: { type: 'apiKey', in: 'header', name: 'X-CSRF-Token', description: 'Token anti-CSRF de la página' }
+      }
+    }
+  };
+}
+
+module.exports = { buildOpenApi };
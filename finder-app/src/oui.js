@@ -0,0 +1,42 @@
+/**
+ * Fabricante de una MAC por su OUI (los tres primeros bytes)
+ * Tabla mínima: las placas Raspberry Pi, donde corre HomePiNAS, y los NAS
+ * comerciales que suelen compartir red con él
+ */
+const RASPBERRY_PI = 'Raspberry Pi';
+
+const OUI_VENDORS = {
+  'b8:27:eb': RASPBERRY_PI,
+  'dc:a6:32': RASPBERRY_PI,
+  'e4:5f:01': RASPBERRY_PI,
+  '28:cd:c1': RASPBERRY_PI,
+  'd8:3a:dd': RASPBERRY_PI,
+  '2c:cf:67': RASPBERRY_PI,
+  '3a:35:41': RASPBERRY_PI,
+  '88:a2:9e': RASPBERRY_PI,
+  '00:11:32': 'Synology',
+  '00:08:9b': 'QNAP',
+  '24:5e:be': 'QNAP'
+};
+
+/**
+ * MAC administrada localmente (bit 0x02 del primer byte): aleatoria o virtual,
+ * su OUI no dice nada del fabricante
+ */
+function isLocalMac(mac) {
+  return (Number.parseInt(String(mac).slice(0, 2), 16) & 0x02) !== 0;
+}
+
+/**
+ * Fabricante conocido de una MAC normalizada (aa:bb:cc:dd:ee:ff) o ''
+ */
+function lookupVendor(mac) {
+  if (!mac) return '';
+  return OUI_VENDORS[mac.toLowerCase().slice(0, 8)] || '';
+}
+
+function isRaspberryPi(mac) {
+  return lookupVendor(mac) === RASPBERRY_PI;
+}
+
+module.exports = { OUI_VENDORS, lookupVendor, isRaspberryPi, isLocalMac };
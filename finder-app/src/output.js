@@ -0,0 +1,212 @@
+const { describeEvent } = require('./events');
+
+// Campos de cada dispositivo, siempre en este orden en todos los formatos
+const FIELDS = [
+  'ip', 'name', 'hostname', 'version', 'url', 'method', 'mac', 'vendor', 'model', 'fingerprint', 'confidence', 'tls',
+  'certExpires', 'addresses'
+];
+// Columnas de la tabla legible (el resto solo en json/csv/yaml)
+const TABLE_FIELDS = ['ip', 'name', 'version', 'url', 'method'];
+
+const FORMATS = ['table', 'json', 'csv', 'yaml'];
+// El modo watch escribe un evento por línea: texto o NDJSON
+const WATCH_FORMATS = ['table', 'json'];
+// Historial y diferencias entre escaneos
+const HISTORY_FORMATS = ['table', 'json'];
+
+/**
+ * Dispositivo con los campos de FIELDS en orden fijo; los que faltan quedan vacíos
+ */
+function normalizeDevice(device) {
+  const row = {};
+  for (const field of FIELDS) {
+    row[field] = field === 'addresses' ? [...(device.addresses || [device.ip])] : String(device[field] ?? '');
+  }
+  // Caducidad del certificado TLS (solo HTTPS), del resumen de certificates.js
+  row.certExpires = device.certificate?.validTo || '';
+  return row;
+}
+
+function csvCell(value) {
+  const text = Array.isArray(value) ? value.join(' ') : value;
+  return /[",\r\n]/.test(text) ? `"${text.replace(/"/g, '""')}"` : text;
+}
+
+function formatCsv(rows) {
+  return [FIELDS, ...rows.map((row) => FIELDS.map((field) => row[field]))]
+    .map((cells) => cells.map(csvCell).join(','))
+    .join('\r\n') + '\r\n';
+}
+
+/**
+ * YAML mínimo: lista de mapas con las cadenas entre comillas dobles
+ * (el escapado de JSON es YAML válido)
+ */
+function formatYaml(rows) {
+  if (rows.length === 0) return '[]\n';
+  return rows.map((row) => FIELDS.map((field, i) => {
+    const key = `${i === 0 ? '- ' : '  '}${field}:`;
+    const value = row[field];
+    if (!Array.isArray(value)) return `${key} ${JSON.stringify(value)}`;
+    if (value.length === 0) return `${key} []`;
+    return [key, ...value.map((item) => `    - ${JSON.stringify(item)}`)].join('\n');
+  }).join('\n')).join('\n') + '\n';
+}
+
+function formatTable(rows) {
+  if (rows.length === 0) return 'No se encontraron dispositivos HomePiNAS\n';
+
+  const headers = TABLE_FIELDS.map((field) => field.toUpperCase());
+  const cells = rows.map((row) => TABLE_FIELDS.map((field) => row[field]));
+  const widths = headers.map((header, i) => Math.max(header.length, ...cells.map((line) => line[i].length)));
+  const line = (values) => values.map((value, i) => value.padEnd(widths[i])).join('  ').trimEnd();
+
+  return [line(headers), ...cells.map(line)].join('\n') + '\n';
+}
+
+/**
+ * Resultados de un escaneo en el formato pedido (table, json, csv o yaml)
+ * Orden estable: dispositivos por IP y campos según FIELDS, para poder comparar salidas
+ */
+function formatDevices(devices, format = 'table') {
+  const rows = devices
+    .map(normalizeDevice)
+    .sort((a, b) => a.ip.localeCompare(b.ip, 'en', { numeric: true }));
+
+  switch (format) {
+    case 'json':
+      return JSON.stringify(rows, null, 2) + '\n';
+    case 'csv':
+      return formatCsv(rows);
+    case 'yaml':
+      return formatYaml(rows);
+    case 'table':
+      return formatTable(rows);
+    default:
+      throw new Error(`Formato de salida desconocido: ${format} (${FORMATS.join(', ')})`);
+  }
+}
+
+/**
+ * Un evento de disponibilidad (events.js) como línea: texto legible o un objeto JSON
+ * con `type`, `timestamp`, los campos del dispositivo y, en `changed`, la IP y versión anteriores
+ */
+function formatEvent(event, format = 'table') {
+  if (format === 'json') {
+    const { previous } = event;
+    return JSON.stringify({
+      type: event.type,
+      timestamp: event.timestamp,
+      ...normalizeDevice(event.device),
+      ...(previous ? { previousIp: previous.ip, previousVersion: String(previous.version ?? '') } : {})
+    }) + '\n';
+  }
+  return `${event.timestamp}  ${describeEvent(event)}\n`;
+}
+
+/**
+ * Fichas del inventario (inventory.js): tabla o JSON
+ */
+function formatInventory(records, format = 'table') {
+  if (format === 'json') return JSON.stringify(records, null, 2) + '\n';
+  if (records.length === 0) return 'No hay dispositivos en el inventario\n';
+
+  return records.map((record) => {
+    const star = record.favorite ? '★' : ' ';
+    const state = record.online ? 'en línea' : 'sin conexión';
+    const tags = record.tags?.length ? `  [${record.tags.join(', ')}]` : '';
+    const notes = record.notes ? `\n      ${record.notes.replace(/\n/g, '\n      ')}` : '';
+    return `${star} ${record.ip.padEnd(15)}  ${record.alias || record.name || record.hostname || 'HomePiNAS'} (${state})${tags}${notes}`;
+  }).join('\n') + '\n';
+}
+
+/**
+ * Sondeo ampliado de un NAS (details.js): texto legible o JSON
+ */
+function formatDetails(details, format = 'table') {
+  if (format === 'json') return JSON.stringify(details, null, 2) + '\n';
+
+  const ms = (value) => (value === null ? '-' : `${value} ms`);
+  const open = details.ports.filter((port) => port.state === 'open');
+  const cert = details.certificate;
+  const lines = [
+    `${details.ip}  ${details.url}`,
+    `Latencia:    conexión ${ms(details.latency.connectMs)}, respuesta ${ms(details.latency.responseMs)}`,
+    `Puertos:     ${open.length > 0 ? open.map((port) => `${port.port}/${port.service}`).join(', ') : 'ninguno abierto'}`
+  ];
+  if (cert) {
+    lines.push(
+      `Certificado: ${cert.subject}${cert.organization ? ` (${cert.organization})` : ''}${cert.selfSigned ? ', autofirmado' : `, emitido por ${cert.issuer}`}`,
+      ...(cert.altNames.length > 0 ? [`SAN:         ${cert.altNames.join(', ')}`] : []),
+      `Caduca:      ${cert.validTo} (${cert.daysLeft} días${cert.expiringSoon ? ', RENOVAR' : ''})`,
+      `SHA-256:     ${cert.fingerprint256}`
+    );
+  }
+  lines.push(details.info
+    ? `/api/system/info:\n${JSON.stringify(details.info, null, 2)}`
+    : `/api/system/info: ${details.infoError}`);
+  return lines.join('\n') + '\n';
+}
+
+/**
+ * Lista de escaneos guardados (history.js): tabla o JSON
+ */
+function formatHistory(scans, format = 'table') {
+  if (format === 'json') return JSON.stringify(scans, null, 2) + '\n';
+  if (scans.length === 0) return 'No hay escaneos guardados\n';
+  return scans.map(({ id, finishedAt, found }) => `${String(id).padStart(4)}  ${finishedAt}  ${found} dispositivo(s)`).join('\n') + '\n';
+}
+
+/**
+ * Diferencias entre dos escaneos (diffScans): tabla legible o JSON
+ */
+function formatDiff(diff, format = 'table') {
+  if (format === 'json') return JSON.stringify(diff, null, 2) + '\n';
+
+  const label = (device) => `${device.name || device.hostname || 'HomePiNAS'} (${device.ip})`;
+  const lines = [
+    ...diff.appeared.map((device) => `+ ${label(device)}`),
+    ...diff.vanished.map((device) => `- ${label(device)}`),
+    ...diff.moved.map((device) => `~ ${label(device)}: antes ${device.previousIp}`),
+    ...diff.updated.map((device) => `~ ${label(device)}: versión ${device.previousVersion} → ${device.version}`)
+  ];
+  const header = `Escaneo ${diff.from} → ${diff.to}`;
+  return [header, ...(lines.length > 0 ? lines : ['Sin cambios'])].join('\n') + '\n';
+}
+
+/**
+ * Resultado de doctor: una línea por comprobación y, debajo, qué hacer; o JSON
+ */
+function formatDoctor(checks, format = 'table') {
+  if (format === 'json') return JSON.stringify(checks, null, 2) + '\n';
+
+  const marks = { ok: 'OK   ', warn: 'AVISO', fail: 'FALLO', skip: '-    ' };
+  const width = Math.max(...checks.map((check) => check.title.length));
+  return checks.map((check) => [
+    `${marks[check.status]}  ${check.title.padEnd(width)}  ${check.detail}`,
+    ...check.hints.map((hint) => `${' '.repeat(width + 9)}→ ${hint}`)
+  ].join('\n')).join('\n') + '\n';
+}
+
+/**
+ * Diagnóstico de un host (doctor <host>): una línea por etapa y el veredicto al final
+ */
+function formatDiagnosis(diagnosis, format = 'table') {
+  if (format === 'json') return JSON.stringify(diagnosis, null, 2) + '\n';
+
+  const marks = { ok: 'OK   ', warn: 'AVISO', fail: 'FALLO', skip: '-    ' };
+  const width = Math.max(...diagnosis.steps.map((step) => step.title.length));
+  return [
+    ...diagnosis.steps.map((step) => [
+      `${marks[step.status]}  ${step.title.padEnd(width)}  ${step.detail}`,
+      ...(step.hint ? [`${' '.repeat(width + 9)}→ ${step.hint}`] : [])
+    ].join('\n')),
+    '',
+    diagnosis.verdict
+  ].join('\n') + '\n';
+}
+
+module.exports = {
+  FORMATS, WATCH_FORMATS, HISTORY_FORMATS,
+  formatDevices, formatEvent, formatHistory, formatDiff, formatInventory, formatDetails, formatDoctor, formatDiagnosis
+};
@@ -0,0 +1,142 @@
+const os = require('os');
+const { setTimeout: sleep } = require('timers/promises');
+const { httpRequest } = require('./scanner');
+const { deviceScheme } = require('./details');
+
+const PAIRING_API = '/api/pairing';
+const POLL_INTERVAL = 2000;
+// Acciones de gestión que desbloquea el emparejamiento y el permiso (scope) que exige cada una
+const ACTIONS = {
+  reboot: { path: '/api/system/reboot', scope: 'power' },
+  shutdown: { path: '/api/system/shutdown', scope: 'power' },
+  update: { path: '/api/update/apply', scope: 'update' }
+};
+
+// El token de cada NAS va en el almacén de secretos; el inventario solo sabe que está emparejado
+const secretName = (id) => `pairing.${id}`;
+
+/**
+ * Llamada JSON a la API del NAS; los errores HTTP llevan `statusCode`
+ * `pin` (huella del certificado fijado) evita mandar el token a un impostor
+ */
+async function callApi(device, path, { method = 'GET', headers, body, clientCert, pin, signal } = {}) {
+  let reason = '';
+  const res = await httpRequest(deviceScheme(device), device.ip, path, {
+    method, headers, body, clientCert, pin, signal,
+    onError: (code) => { reason = code; }
+  });
+  if (!res) {
+    throw new Error(reason === 'CERT_PIN_MISMATCH'
+      ? 'El certificado del NAS no es el fijado: no se envían credenciales'
+      : `El NAS no responde (${reason || 'sin respuesta'})`);
+  }
+
+  let data = {};
+  try {
+    data = JSON.parse(res.body);
+  } catch {
+    // Respuesta vacía o no JSON
+  }
+  if (res.statusCode >= 400) {
+    throw Object.assign(new Error(data.error || `HTTP ${res.statusCode}`), { statusCode: res.statusCode });
+  }
+  return data;
+}
+
+/**
+ * Pide al NAS un código de emparejamiento: { requestId, code, pollSecret, expiresIn }
+ * El usuario comprueba el código en el panel del NAS (Sistema → Dispositivos emparejados)
+ */
+function requestPairing(device, options = {}) {
+  return callApi(device, `${PAIRING_API}/request`, {
+    ...options,
+    method: 'POST',
+    body: { clientName: `HomePiNAS Finder (${os.hostname()})` }
+  });
+}
+
+/**
+ * Espera a que el usuario apruebe o rechace el código en el NAS
+ * Devuelve { token, scopes }; el NAS entrega el token una sola vez
+ */
+async function waitForApproval(device, pairing, { interval = POLL_INTERVAL, signal, ...options } = {}) {
+  const path = `${PAIRING_API}/status/${encodeURIComponent(pairing.requestId)}`;
+  const deadline = Date.now() + pairing.expiresIn * 1000;
+
+  while (Date.now() < deadline) {
+    let status;
+    try {
+      status = await callApi(device, path, { ...options, signal, headers: { 'X-Pairing-Secret': pairing.pollSecret } });
+    } catch (err) {
+      if (err.statusCode === 404) break;
+      throw err;
+    }
+    if (status.status === 'approved') return { token: status.token, scopes: status.scopes };
+    if (status.status === 'denied') throw new Error('El emparejamiento se ha rechazado en el NAS');
+    await sleep(interval, null, { signal });
+  }
+  throw new Error('El código de emparejamiento ha caducado');
+}
+
+/**
+ * Acción de gestión (ver ACTIONS) con el token del emparejamiento
+ * Un 401 significa que el NAS ha revocado el token: el error lleva `revoked`
+ */
+async function manageDevice(device, action, token, options = {}) {
+  const target = ACTIONS[action];
+  if (!target) throw new Error(`Acción desconocida: ${action} (${Object.keys(ACTIONS).join(', ')})`);
+
+  try {
+    return await callApi(device, target.path, { ...options, method: 'POST', headers: { Authorization: `Bearer ${token}` } });
+  } catch (err) {
+    if (err.statusCode === 401) {
+      throw Object.assign(new Error('El NAS ya no reconoce este equipo: vuelve a emparejarlo'), { revoked: true });
+    }
+    if (err.statusCode === 403) throw new Error(`El emparejamiento no permite la acción ${action}`);
+    throw err;
+  }
+}
+
+/**
+ * URL del panel del NAS que inicia sesión sola: el token se cambia por un ticket de un
+ * solo uso (caduca en un minuto) que viaja en el fragmento (#sso=...), nunca al servidor web
+ * Exige el permiso login; un 401 significa token revocado, como en manageDevice
+ */
+async function loginUrl(device, token, options = {}) {
+  let ticket;
+  try {
+    ({ ticket } = await callApi(device, `${PAIRING_API}/login-ticket`, {
+      ...options, method: 'POST', headers: { Authorization: `Bearer ${token}` }
+    }));
+  } catch (err) {
+    if (err.statusCode === 401) {
+      throw Object.assign(new Error('El NAS ya no reconoce este equipo: vuelve a emparejarlo'), { revoked: true });
+    }
+    throw err;
+  }
+
+  const url = new URL('/', deviceScheme(device).url);
+  url.hash = `sso=${ticket}`;
+  return url.href;
+}
+
+/**
+ * Guarda el token de un NAS del inventario y lo marca como emparejado
+ */
+function storePairing(secrets, inventory, id, { token, scopes }) {
+  secrets.set(secretName(id), token);
+  return inventory.setPaired(id, { scopes, pairedAt: new Date().toISOString() });
+}
+
+function pairingToken(secrets, id) {
+  return secrets.get(secretName(id));
+}
+
+function forgetPairing(secrets, inventory, id) {
+  secrets.delete(secretName(id));
+  return inventory.setPaired(id, null);
+}
+
+module.exports = {
+  ACTIONS, requestPairing, waitForApproval, manageDevice, loginUrl, storePairing, pairingToken, forgetPairing
+};
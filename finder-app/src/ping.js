@@ -0,0 +1,56 @@
+const { execFile } = require('child_process');
+const dgram = require('dgram');
+
+// Puerto base de traceroute: casi nunca hay nada escuchando
+const UDP_PING_PORT = 33434;
+
+/**
+ * ICMP echo a toda la lista con un solo proceso de fping
+ * Devuelve Set con las IPs que respondieron; rechaza si fping no está instalado
+ */
+function fpingSweep(targets, timeout, signal) {
+  return new Promise((resolve, reject) => {
+    const child = execFile('fping', ['-a', '-q', '-r', '0', '-i', '5', '-t', String(timeout)], {
+      signal,
+      timeout: 30000,
+      maxBuffer: 4 * 1024 * 1024
+    }, (err, stdout) => {
+      // Código 1: algún host no respondió; 2: alguna dirección no válida. Ninguno es un fallo
+      if (err && !(err.code === 1 || err.code === 2)) return reject(err);
+      resolve(new Set(stdout.split('\n').map((line) => line.trim()).filter(Boolean)));
+    });
+    child.stdin.on('error', () => {});
+    child.stdin.end(targets.join('\n'));
+  });
+}
+
+/**
+ * "Ping" UDP sin privilegios: un datagrama vacío a un puerto cerrado
+ * Un host vivo contesta ICMP port unreachable, que llega como ECONNREFUSED
+ * Resuelve true si respondió; los que filtran ICMP dan false
+ */
+function udpPing(ip, timeout) {
+  return new Promise((resolve) => {
+    const socket = dgram.createSocket('udp4');
+    let timer;
+    let done = false;
+    const finish = (alive) => {
+      if (done) return;
+      done = true;
+      clearTimeout(timer);
+      socket.close();
+      resolve(alive);
+    };
+
+    socket.on('error', (err) => finish(err.code === 'ECONNREFUSED'));
+    timer = setTimeout(() => finish(false), timeout);
+    socket.connect(UDP_PING_PORT, ip, (err) => {
+      if (err) return finish(false);
+      socket.send(Buffer.alloc(0), (sendErr) => {
+        if (sendErr) finish(sendErr.code === 'ECONNREFUSED');
+      });
+    });
+  });
+}
+
+module.exports = { fpingSweep, udpPing };
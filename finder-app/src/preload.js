@@ -2,5 +2,27 @@ const { contextBridge, ipcRenderer } = require('electron');
 
 contextBridge.exposeInMainWorld('finder', {
   scanNetwork: () => ipcRenderer.invoke('scan-network'),
-  openNAS: (url) => ipcRenderer.invoke('open-nas', url)
+  cancelScan: () => ipcRenderer.invoke('cancel-scan'),
+  scanStatus: () => ipcRenderer.invoke('scan-status'),
+  inventory: (filter) => ipcRenderer.invoke('inventory', filter),
+  updateDevice: (id, changes) => ipcRenderer.invoke('update-device', id, changes),
+  wakeDevice: (id) => ipcRenderer.invoke('wake-device', id),
+  deviceDetails: (id) => ipcRenderer.invoke('device-details', id),
+  trustDevice: (id) => ipcRenderer.invoke('trust-device', id),
+  pairDevice: (id) => ipcRenderer.invoke('pair-device', id),
+  pairingResult: (id) => ipcRenderer.invoke('pairing-result', id),
+  manageDevice: (id, action) => ipcRenderer.invoke('manage-device', id, action),
+  scanHistory: () => ipcRenderer.invoke('scan-history'),
+  scanDiff: (from, to) => ipcRenderer.invoke('scan-diff', from, to),
+  onDeviceFound: (callback) => ipcRenderer.on('device-found', (event, device) => callback(device)),
+  onScanProgress: (callback) => ipcRenderer.on('scan-progress', (event, progress) => callback(progress)),
+  onInventoryChanged: (callback) => ipcRenderer.on('inventory-changed', () => callback()),
+  onFocusDevice: (callback) => ipcRenderer.on('focus-device', (event, id, ref) => callback(id, ref)),
+  openNAS: (url) => ipcRenderer.invoke('open-nas', url),
+  openDevice: (id) => ipcRenderer.invoke('open-device', id),
+  auditLog: (filter) => ipcRenderer.invoke('audit-log', filter),
+  hostsSnippet: () => ipcRenderer.invoke('hosts-snippet'),
+  updateHosts: () => ipcRenderer.invoke('update-hosts'),
+  importNmap: () => ipcRenderer.invoke('import-nmap'),
+  exportNmap: () => ipcRenderer.invoke('export-nmap')
 });
@@ -0,0 +1,129 @@
+/**
+ * Perfilado de escaneos: se hace siempre (/api/scan/stats) y --profile-scan lo muestra
+ * Acumula tiempos por método, por fase y por host, y los sondeos fallidos por categoría,
+ * para localizar cuellos de botella y medir si una versión escanea más lento que otra
+ */
+
+const SLOWEST_HOSTS = 10;
+
+function createProfile() {
+  return {
+    backends: {},
+    // Tiempo acumulado de todos los hosts en cada fase (se solapan en paralelo)
+    phases: { liveness: 0, httpProbe: 0, fingerprint: 0 },
+    hosts: new Map(),
+    // Sondeos fallidos por categoría (connect-failed, tls-error, request-failed; ver trace.js)
+    errors: {}
+  };
+}
+
+/**
+ * Cuenta un sondeo fallido en su categoría
+ */
+function countError(profile, category) {
+  if (!profile) return;
+  profile.errors[category] = (profile.errors[category] || 0) + 1;
+}
+
+/**
+ * Percentil `p` (0-100) de una lista ya ordenada
+ */
+function percentile(sorted, p) {
+  if (sorted.length === 0) return 0;
+  return sorted[Math.min(Math.ceil(sorted.length * p / 100) - 1, sorted.length - 1)];
+}
+
+/**
+ * Mide `fn` y suma su duración a la fase indicada
+ */
+async function timePhase(profile, phase, fn) {
+  if (!profile) return fn();
+
+  const start = Date.now();
+  try {
+    return await fn();
+  } finally {
+    profile.phases[phase] = (profile.phases[phase] || 0) + Date.now() - start;
+  }
+}
+
+/**
+ * Mide el tiempo real que se tarda en resolver un host
+ */
+async function timeHost(profile, ip, fn) {
+  if (!profile) return fn();
+
+  const start = Date.now();
+  try {
+    return await fn();
+  } finally {
+    profile.hosts.set(ip, Date.now() - start);
+  }
+}
+
+/**
+ * Mide la duración total de un método de descubrimiento
+ */
+async function timeBackend(profile, backend, fn) {
+  if (!profile) return fn();
+
+  const start = Date.now();
+  try {
+    return await fn();
+  } finally {
+    profile.backends[backend] = Date.now() - start;
+  }
+}
+
+/**
+ * Resumen serializable del perfil
+ */
+function summarizeProfile(profile) {
+  const slowestHosts = Array.from(profile.hosts, ([ip, ms]) => ({ ip, ms }))
+    .sort((a, b) => b.ms - a.ms)
+    .slice(0, SLOWEST_HOSTS);
+  const timings = [...profile.hosts.values()].sort((a, b) => a - b);
+
+  return {
+    backends: { ...profile.backends },
+    phases: { ...profile.phases },
+    hostsProbed: profile.hosts.size,
+    hostTimings: {
+      p50: percentile(timings, 50),
+      p95: percentile(timings, 95),
+      max: timings.length > 0 ? timings[timings.length - 1] : 0
+    },
+    slowestHosts,
+    errors: { ...profile.errors }
+  };
+}
+
+/**
+ * Texto legible del resumen para la consola
+ */
+function formatProfile(summary) {
+  const lines = ['[Profile] Tiempo por método:'];
+  for (const [backend, ms] of Object.entries(summary.backends)) {
+    lines.push(`  ${backend.padEnd(12)} ${ms} ms`);
+  }
+
+  lines.push('[Profile] Tiempo acumulado por fase:');
+  for (const [phase, ms] of Object.entries(summary.phases)) {
+    lines.push(`  ${phase.padEnd(12)} ${ms} ms`);
+  }
+
+  const { p50, p95, max } = summary.hostTimings;
+  lines.push(`[Profile] Hosts más lentos (${summary.hostsProbed} sondeados; p50 ${p50} ms, p95 ${p95} ms, máx. ${max} ms):`);
+  for (const host of summary.slowestHosts) {
+    lines.push(`  ${host.ip.padEnd(15)} ${host.ms} ms`);
+  }
+
+  const errors = Object.entries(summary.errors);
+  if (errors.length > 0) {
+    lines.push(`[Profile] Sondeos fallidos: ${errors.map(([category, count]) => `${category} ${count}`).join(', ')}`);
+  }
+
+  return lines.join('\n');
+}
+
+module.exports = { createProfile, timePhase, timeHost, timeBackend, countError, summarizeProfile, formatProfile };
@@ -0,0 +1,61 @@
+/**
+ * Enlaces homepinas:// (documentación, panel del NAS) que abren el Finder:
+ *
+ *   homepinas://open              La ventana al frente
+ *   homepinas://device/<ref>      Y salta a ese NAS del inventario: id, MAC, IP,
+ *                                 hostname (con o sin .local), nombre o alias
+ *
+ * Nunca abren nada en el navegador ni lanzan acciones: como mucho seleccionan un NAS
+ */
+const SCHEME = 'homepinas';
+const MAX_LINK_LENGTH = 512;
+
+/**
+ * Enlace como { action: 'open' } o { action: 'device', ref }; null si no es válido
+ */
+function parseProtocolUrl(value) {
+  if (typeof value !== 'string' || value.length > MAX_LINK_LENGTH) return null;
+  let url;
+  try {
+    url = new URL(value);
+  } catch {
+    return null;
+  }
+  if (url.protocol !== `${SCHEME}:`) return null;
+
+  // homepinas://device/x: "device" es el host; homepinas:device/x también se acepta
+  const parts = `${url.host}${url.pathname}`.split('/').filter(Boolean).map((part) => {
+    try {
+      return decodeURIComponent(part);
+    } catch {
+      return null;
+    }
+  });
+  const [action = 'open', ref, ...rest] = parts;
+  if (action === 'open' && !ref) return { action };
+  if (action === 'device' && ref && rest.length === 0) return { action, ref };
+  return null;
+}
+
+/**
+ * Primer enlace homepinas:// de una línea de órdenes (Windows y Linux lo pasan como argumento)
+ */
+function findProtocolUrl(argv) {
+  return argv.find((arg) => typeof arg === 'string' && arg.toLowerCase().startsWith(`${SCHEME}:`)) ?? null;
+}
+
+/**
+ * ¿Es `record` (ficha del inventario) el NAS al que apunta `ref`?
+ */
+function matchesRef(record, ref) {
+  const wanted = ref.toLowerCase();
+  const bare = wanted.replace(/\.local$/, '');
+  const mac = (value) => (value || '').toLowerCase().replace(/[^0-9a-f]/g, '');
+  return record.id === ref ||
+    (mac(record.mac) !== '' && mac(record.mac) === mac(ref) && mac(ref).length === 12) ||
+    (record.addresses || [record.ip]).some((ip) => ip && ip.split('%')[0].toLowerCase() === wanted) ||
+    (Boolean(record.hostname) && record.hostname.toLowerCase().replace(/\.local$/, '') === bare) ||
+    [record.name, record.alias].some((name) => (name || '').toLowerCase() === wanted);
+}
+
+module.exports = { SCHEME, parseProtocolUrl, findProtocolUrl, matchesRef };
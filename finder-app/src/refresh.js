@@ -0,0 +1,76 @@
+/**
+ * Reescaneos periódicos (watch y la bandeja) sin barrer la subred en cada vuelta:
+ * un barrido completo cada `fullScanEvery` vueltas y, entre medias, solo mDNS y lo que
+ * ha cambiado en la tabla ARP desde la vuelta anterior
+ *
+ * En una vuelta incremental se sondean las IPs que acaban de aparecer, las que han
+ * cambiado de MAC y los NAS conocidos sin entrada en la tabla; un NAS conocido que sigue
+ * en su IP con la misma MAC pasa tal cual, sin sondeo. Casi no hace ruido en la red ni
+ * gasta CPU, y un NAS nuevo aparece igual en la vuelta siguiente si se anuncia por mDNS
+ * o habla con esta máquina (entra en la tabla ARP)
+ */
+const log = require('./log');
+const { readNeighborTable } = require('./neighbors');
+
+const FULL_SCAN_EVERY = 10;
+// Métodos de una vuelta incremental: los anuncios mDNS y las IPs que se le pasan
+const INCREMENTAL_METHODS = ['mdns', 'seeds'];
+
+function resolveFullScanEvery(value) {
+  if (value === undefined || value === null) return FULL_SCAN_EVERY;
+  const every = Number(value);
+  if (!Number.isInteger(every) || every < 1) {
+    log.warn(`[Refresh] fullScanEvery no válido: ${value} (entero desde 1); se usa ${FULL_SCAN_EVERY}`);
+    return FULL_SCAN_EVERY;
+  }
+  return every;
+}
+
+/**
+ * IP -> MAC de las entradas de la tabla ARP que han respondido
+ */
+function reachableMacs(neighbors) {
+  return new Map([...neighbors || []].filter(([, { reachable }]) => reachable).map(([ip, { mac }]) => [ip, mac]));
+}
+
+/**
+ * Planificador de vueltas; `next(known)` recibe los NAS de la vuelta anterior (null si
+ * no hubo ninguna completa) y devuelve { full: true } o { full: false, options }, con
+ * `options` para scanNetwork (se suman a las de siempre): `seeds` a sondear y
+ * `carried`, los NAS que se dan por buenos sin sondear
+ */
+function createRefreshPlanner({ fullScanEvery } = {}) {
+  const every = resolveFullScanEvery(fullScanEvery);
+  let cycle = 0;
+  let seen = null; // IP -> MAC de la tabla ARP en la vuelta anterior
+
+  return {
+    async next(known) {
+      const full = !known || !seen || cycle % every === 0;
+      cycle++;
+      const previous = seen;
+      seen = reachableMacs(await readNeighborTable());
+      if (full) return { full: true };
+
+      // Una MAC que ahora responde en otra IP: el NAS se ha movido y su IP anterior no vale
+      const moved = new Set([...seen].filter(([ip, mac]) => previous.get(ip) !== mac).map(([, mac]) => mac));
+      const carried = [];
+      const targets = new Map();
+      for (const device of known) {
+        const unchanged = device.mac && seen.get(device.ip) === device.mac &&
+          previous.get(device.ip) === device.mac && !moved.has(device.mac);
+        if (unchanged) carried.push(device);
+        else targets.set(device.ip, { ip: device.ip, hostname: device.hostname || '' });
+      }
+      // IPs nuevas o con otra MAC que en la vuelta anterior
+      for (const [ip, mac] of seen) {
+        if (previous.get(ip) !== mac && !targets.has(ip)) targets.set(ip, { ip, hostname: '' });
+      }
+      log.debug(`[Refresh] Vuelta incremental: ${targets.size} hosts a sondear, ${carried.length} sin cambios (completa cada ${every})`,
+        { targets: targets.size, carried: carried.length });
+      return { full: false, options: { methods: INCREMENTAL_METHODS, seeds: [...targets.values()], carried } };
+    }
+  };
+}
+
+module.exports = { createRefreshPlanner, FULL_SCAN_EVERY };
@@ -0,0 +1,118 @@
+/**
+ * Alta de un NAS sin escanear (POST /api/register de serve): al arrancar o al cambiar de
+ * red, el NAS manda un JSON firmado con la misma clave Ed25519 que su beacon
+ * (docs/register-protocol.md). No lleva el token de la interfaz web: lo autentica la firma,
+ * con la clave fijada por IP como en el beacon, y solo puede registrar la IP desde la que llama
+ */
+const crypto = require('crypto');
+const { canonicalPayload } = require('./beacon');
+const { isPrivateAddress } = require('./netutil');
+const { compileDenylist } = require('./denylist');
+const { deviceUrl } = require('./scanner');
+
+const REGISTER_MAGIC = 'HOMEPINAS-REGISTER';
+const PROTOCOL_VERSION = 1;
+// Diferencia de reloj tolerada y, por tanto, cuánto se recuerda cada nonce (contra reenvíos)
+const MAX_CLOCK_SKEW = 5 * 60 * 1000;
+
+function httpError(status, message) {
+  return Object.assign(new Error(message), { status });
+}
+
+/**
+ * Registro firmado con la clave Ed25519 del NAS (lado NAS); `fields` = { ip, name, hostname,
+ * version, scheme, port }
+ */
+function signRegistration(fields, privateKey, now = Date.now()) {
+  const publicKey = crypto.createPublicKey(privateKey).export({ type: 'spki', format: 'der' });
+  const registration = {
+    ...fields,
+    magic: REGISTER_MAGIC,
+    v: PROTOCOL_VERSION,
+    nonce: crypto.randomBytes(16).toString('hex'),
+    timestamp: new Date(now).toISOString(),
+    publicKey: publicKey.toString('base64')
+  };
+  registration.signature = crypto.sign(null, Buffer.from(canonicalPayload(registration)), privateKey).toString('base64');
+  return registration;
+}
+
+/**
+ * Comprueba formato, vigencia y firma; devuelve la huella SHA-256 de la clave o lanza
+ * un error con `status` (400 mal formado, 401 caducado, reenviado o mal firmado)
+ */
+function verifySignature(registration, now) {
+  if (registration?.magic !== REGISTER_MAGIC || registration.v !== PROTOCOL_VERSION) {
+    throw httpError(400, 'No es un registro de HomePiNAS (magic, v)');
+  }
+  for (const field of ['ip', 'nonce', 'timestamp', 'publicKey', 'signature']) {
+    if (typeof registration[field] !== 'string') throw httpError(400, `Falta ${field}`);
+  }
+  if (!/^[0-9a-f]{32}$/.test(registration.nonce)) throw httpError(400, 'nonce no válido');
+  const sent = Date.parse(registration.timestamp);
+  if (!(Math.abs(now - sent) <= MAX_CLOCK_SKEW)) {
+    throw httpError(401, `timestamp fuera de plazo (±${MAX_CLOCK_SKEW / 60000} minutos): revisa el reloj del NAS`);
+  }
+
+  let der;
+  let valid = false;
+  try {
+    der = Buffer.from(registration.publicKey, 'base64');
+    const key = crypto.createPublicKey({ key: der, format: 'der', type: 'spki' });
+    valid = key.asymmetricKeyType === 'ed25519' &&
+      crypto.verify(null, Buffer.from(canonicalPayload(registration)), key, Buffer.from(registration.signature, 'base64'));
+  } catch {
+    valid = false;
+  }
+  if (!valid) throw httpError(401, 'Firma no válida');
+
+  const digest = crypto.createHash('sha256').update(der).digest('hex').toUpperCase();
+  return digest.match(/../g).join(':');
+}
+
+/**
+ * Verificador de registros; `register(registration, source)` recibe el JSON y la IP de
+ * origen de la petición y devuelve el dispositivo para el inventario, o lanza un error con
+ * `status` (403: otra IP, pública, excluida o con otra clave fijada)
+ * `trustStore`: el de los certificados (la clave se fija como `beacon:<ip>`)
+ */
+function createRegistrar({ trustStore, allowPublic = false, exclude = [], now = Date.now }) {
+  const denied = compileDenylist(exclude);
+  const nonces = new Map(); // nonce -> ms en que deja de importar
+
+  return {
+    register(registration, source) {
+      const time = now();
+      const keyFingerprint = verifySignature(registration, time);
+      for (const [nonce, expires] of nonces) {
+        if (expires <= time) nonces.delete(nonce);
+      }
+      if (nonces.has(registration.nonce)) throw httpError(401, 'Registro repetido (nonce ya usado)');
+
+      const ip = source.replace(/^::ffff:/, '');
+      if (registration.ip !== ip) throw httpError(403, `La IP firmada (${registration.ip}) no es la de origen (${ip})`);
+      if (!allowPublic && !isPrivateAddress(ip)) throw httpError(403, `IP pública: ${ip} (allowPublicSubnets)`);
+      if (denied(ip)) throw httpError(403, `${ip} está en la lista de exclusión`);
+
+      const name = String(registration.name || 'HomePiNAS');
+      const keyPin = trustStore.check(`beacon:${ip}`, { fingerprint256: keyFingerprint, subject: { CN: name } });
+      if (keyPin === 'mismatch') throw httpError(403, `La clave de ${ip} no es la fijada en el primer contacto`);
+      trustStore.save();
+      nonces.set(registration.nonce, time + 2 * MAX_CLOCK_SKEW);
+
+      const protocol = registration.scheme === 'http' ? 'http' : 'https';
+      return {
+        ip,
+        name,
+        hostname: String(registration.hostname || ''),
+        version: String(registration.version || ''),
+        method: 'register',
+        url: deviceUrl(protocol, ip, Number.parseInt(registration.port, 10)),
+        keyPin,
+        keyFingerprint
+      };
+    }
+  };
+}
+
+module.exports = { signRegistration, createRegistrar };
@@ -0,0 +1,516 @@
+const scanBtn = document.getElementById('scanBtn');
+const results = document.getElementById('results');
+const emptyState = document.getElementById('emptyState');
+const deviceList = document.getElementById('deviceList');
+const count = document.getElementById('count');
+const statusBar = document.getElementById('statusBar');
+const copyHostsBtn = document.getElementById('copyHostsBtn');
+const updateHostsBtn = document.getElementById('updateHostsBtn');
+const importNmapBtn = document.getElementById('importNmapBtn');
+const exportNmapBtn = document.getElementById('exportNmapBtn');
+const progressBar = document.getElementById('progress');
+const progressFill = document.getElementById('progressFill');
+const tagFilterBtn = document.getElementById('tagFilter');
+
+let found = 0;
+let percent = 0;
+// id del inventario -> { device, state } de cada ficha pintada, para repintarla al editarla
+const cards = new Map();
+// Dispositivos del último escaneo por id: aportan lo que el inventario no guarda (avisos TLS...)
+const liveDevices = new Map();
+// Etiqueta por la que se filtra la lista (null = todas) y si el inventario ya se comprobó
+let tagFilter = null;
+let inventoryChecked = false;
+
+// Los dispositivos llegan uno a uno mientras el escaneo sigue en curso
+window.finder.onDeviceFound((device) => {
+  found++;
+  count.textContent = found;
+  if (device.id) liveDevices.set(device.id, device);
+  if (!tagFilter || (device.tags || []).includes(tagFilter)) renderDevice(device);
+  results.style.display = 'block';
+  showScanning();
+});
+
+// Progreso: hosts sondeados sobre previstos; no llega al 100% mientras quede algún método
+window.finder.onScanProgress(({ probed, total, methods }) => {
+  if (!scanning) return;
+  const states = Object.values(methods);
+  const pending = states.some((state) => state === 'pending' || state === 'running');
+  const ratio = total > 0 ? Math.min(probed / total, 1) : 0;
+  percent = Math.round((pending ? Math.min(ratio, 0.99) : 1) * 100);
+  progressFill.style.width = `${percent}%`;
+  showScanning();
+});
+
+// Escaneo lanzado desde la bandeja: al terminar se repinta la lista con el inventario
+window.finder.onInventoryChanged(async () => {
+  if (scanning) return;
+  try {
+    const records = await showInventory(true);
+    statusBar.textContent = `${records.filter((record) => record.online).length} dispositivo(s) en línea`;
+  } catch (err) {
+    statusBar.textContent = 'No se pudo leer el inventario: ' + err.message;
+  }
+});
+
+// Enlace homepinas://device/<ref>: se resalta ese NAS en la lista (id null = no está o hay varios)
+window.finder.onFocusDevice(async (id, ref) => {
+  if (!id) {
+    statusBar.textContent = `No hay un único NAS "${ref}" en el inventario`;
+    return;
+  }
+  const findCard = () => [...deviceList.children].find((card) => card.dataset.id === id);
+  try {
+    if (tagFilter) await filterByTag(null);
+    if (!findCard()) await showInventory(inventoryChecked);
+  } catch (err) {
+    statusBar.textContent = 'No se pudo leer el inventario: ' + err.message;
+    return;
+  }
+  const card = findCard();
+  if (!card) return;
+  card.scrollIntoView({ block: 'center', behavior: 'smooth' });
+  card.classList.add('focused');
+  setTimeout(() => card.classList.remove('focused'), 3000);
+});
+
+function showScanning() {
+  statusBar.textContent = found > 0
+    ? `Escaneando... ${percent}% · ${found} dispositivo(s) encontrado(s)`
+    : `Escaneando red local... ${percent}%`;
+}
+
+let scanning = false;
+
+const SCAN_BUTTON = `
+    <svg width="18" height="18" viewBox="0 0 24 24" fill="none" stroke="currentColor" stroke-width="2">
+      <circle cx="11" cy="11" r="8"/>
+      <path d="M21 21l-4.35-4.35"/>
+    </svg>
+    Buscar dispositivos
+  `;
+
+/**
+ * Pinta los NAS del inventario: al arrancar todos como "sin comprobar" y,
+ * tras un escaneo completo, los que no respondieron como desconectados
+ */
+async function showInventory(checked) {
+  inventoryChecked = checked;
+  const records = await window.finder.inventory(tagFilter ? { tag: tagFilter } : undefined);
+  deviceList.innerHTML = '';
+  cards.clear();
+  for (const record of records) {
+    const device = { ...liveDevices.get(record.id), ...record };
+    renderDevice(device, !checked ? 'stale' : record.online ? 'online' : 'offline');
+  }
+  count.textContent = records.filter((record) => checked && record.online).length;
+  if (records.length > 0 || tagFilter) results.style.display = 'block';
+  return records;
+}
+
+/**
+ * Filtra la lista por una etiqueta (null la quita)
+ */
+async function filterByTag(tag) {
+  tagFilter = tag;
+  tagFilterBtn.textContent = tag ? `#${tag} ✕` : '';
+  tagFilterBtn.style.display = tag ? 'inline-block' : 'none';
+  try {
+    await showInventory(inventoryChecked);
+  } catch (err) {
+    statusBar.textContent = 'No se pudo leer el inventario: ' + err.message;
+  }
+}
+
+async function startScan() {
+  scanning = true;
+  scanBtn.innerHTML = '<div class="spinner"></div> Cancelar';
+  emptyState.style.display = 'none';
+  // Las fichas conocidas se quedan, atenuadas, hasta que su NAS responda
+  for (const card of deviceList.querySelectorAll('.device-card')) card.classList.add('stale');
+  count.textContent = 0;
+  found = 0;
+  liveDevices.clear();
+  percent = 0;
+  progressFill.style.width = '0%';
+  progressBar.style.display = 'block';
+  statusBar.textContent = 'Escaneando red local...';
+  
+  try {
+    const devices = await window.finder.scanNetwork();
+    const { cancelled } = await window.finder.scanStatus();
+    // Un escaneo cancelado es parcial: las fichas sin respuesta se quedan sin comprobar
+    const known = cancelled ? [] : await showInventory(true);
+    const offline = known.filter((record) => !record.online).length;
+    const suspicious = devices.filter((device) => device.certChanged || device.keyChanged).length;
+    
+    if (devices.length > 0 || deviceList.children.length > 0) {
+      results.style.display = 'block';
+      statusBar.textContent = cancelled
+        ? `Escaneo cancelado: ${devices.length} dispositivo(s) encontrado(s)`
+        : `Encontrados ${devices.length} dispositivo(s)${offline > 0 ? ` · ${offline} sin conexión` : ''}` +
+          (suspicious > 0 ? ` · ⚠ ${suspicious} con el certificado cambiado` : '');
+    } else {
+      emptyState.style.display = 'block';
+      statusBar.textContent = cancelled ? 'Escaneo cancelado' : 'No se encontraron dispositivos';
+    }
+  } catch (err) {
+    statusBar.textContent = 'Error al escanear: ' + err.message;
+    emptyState.style.display = 'block';
+  }
+  
+  scanning = false;
+  progressBar.style.display = 'none';
+  scanBtn.disabled = false;
+  scanBtn.innerHTML = SCAN_BUTTON;
+}
+
+async function cancelScan() {
+  scanBtn.disabled = true;
+  statusBar.textContent = 'Cancelando...';
+  await window.finder.cancelScan();
+}
+
+/**
+ * Ficha de un NAS; `state` = online (recién encontrado), stale (del inventario, sin comprobar)
+ * u offline (no respondió en el último escaneo). Sustituye a la que tenga el mismo id
+ */
+function renderDevice(device, state = 'online') {
+  const seen = device.lastSeen ? new Date(device.lastSeen).toLocaleString() : '';
+  if (device.id) cards.set(device.id, { device, state });
+  const html = `
+    <div class="device-card ${state === 'online' ? '' : state}" data-id="${escapeHtml(device.id || '')}"
+         data-url="${escapeHtml(device.url || `https://${device.ip}`)}">
+      <div class="device-icon">
+        <svg viewBox="0 0 24 24">
+          <path d="M4 6a2 2 0 012-2h12a2 2 0 012 2v4a2 2 0 01-2 2H6a2 2 0 01-2-2V6zM4 14a2 2 0 012-2h12a2 2 0 012 2v4a2 2 0 01-2 2H6a2 2 0 01-2-2v-4z"/>
+          <circle cx="8" cy="8" r="1" fill="currentColor"/>
+          <circle cx="8" cy="16" r="1" fill="currentColor"/>
+        </svg>
+      </div>
+      <div class="device-info">
+        <div class="device-name">
+          ${escapeHtml(device.alias || device.name)}
+          ${device.alias ? `<span class="device-original">${escapeHtml(device.name)}</span>` : ''}
+        </div>
+        <div class="device-ip">${escapeHtml(device.ip)}</div>
+        ${device.version ? `<div class="device-version">v${escapeHtml(device.version)}</div>` : ''}
+        ${device.verified === false ? '<div class="device-warning">Certificado no verificado</div>' : ''}
+        ${device.certificate?.expiringSoon ? `<div class="device-warning">${device.certificate.daysLeft < 0
+          ? 'El certificado ha caducado'
+          : `El certificado caduca en ${device.certificate.daysLeft} días`}: hay que renovarlo</div>` : ''}
+        ${device.certChanged || device.keyChanged ? `
+        <div class="device-danger">
+          ⚠ ${device.certChanged ? 'El certificado' : 'La clave del beacon'} no es el del primer contacto: posible suplantación
+          <button class="device-trust" data-action="trust">Confiar en el nuevo</button>
+        </div>` : ''}
+        ${state === 'stale' && seen ? `<div class="device-seen">Visto por última vez: ${escapeHtml(seen)}</div>` : ''}
+        ${state === 'offline' ? `<div class="device-seen">Sin conexión · visto ${escapeHtml(seen)}</div>` : ''}
+        ${device.notes ? `<div class="device-notes" title="${escapeHtml(device.notes)}">${escapeHtml(device.notes)}</div>` : ''}
+        ${device.tags?.length ? `<div class="device-tags">${device.tags.map((tag) =>
+          `<button class="device-tag" data-tag="${escapeHtml(tag)}" title="Ver solo #${escapeHtml(tag)}">#${escapeHtml(tag)}</button>`).join('')}</div>` : ''}
+      </div>
+      ${device.id ? `
+      <div class="device-actions">
+        <button class="device-action ${device.favorite ? 'active' : ''}" data-action="favorite"
+                title="${device.favorite ? 'Quitar de favoritos' : 'Marcar como favorito'}">${device.favorite ? '★' : '☆'}</button>
+        ${device.mac && state !== 'online' ? '<button class="device-action" data-action="wake" title="Despertar (Wake-on-LAN)">⏻</button>' : ''}
+        ${state === 'online' && !device.paired ? '<button class="device-action" data-action="pair" title="Emparejar para reiniciar o actualizar el NAS desde aquí">🔗</button>' : ''}
+        ${state === 'online' && device.paired ? `
+        <button class="device-action" data-action="reboot" title="Reiniciar">↻</button>
+        <button class="device-action" data-action="update" title="Instalar actualización">⇪</button>` : ''}
+        <button class="device-action" data-action="details" title="Detalles">ⓘ</button>
+        <button class="device-action" data-action="edit" title="Nombre, etiquetas y notas">✎</button>
+      </div>` : ''}
+      <div class="device-arrow">
+        <svg width="20" height="20" viewBox="0 0 24 24" fill="none" stroke="currentColor" stroke-width="2">
+          <path d="M9 18l6-6-6-6"/>
+        </svg>
+      </div>
+    </div>
+  `;
+  
+  const existing = device.id && [...deviceList.children].find((card) => card.dataset.id === device.id);
+  if (existing) {
+    existing.insertAdjacentHTML('afterend', html);
+    existing.remove();
+  } else {
+    deviceList.insertAdjacentHTML('beforeend', html);
+  }
+}
+
+function openNAS(url) {
+  window.finder.openNAS(url);
+}
+
+/**
+ * Guarda los datos del usuario en el inventario y repinta la ficha con el resultado
+ */
+async function updateDevice(id, changes) {
+  const { device, state } = cards.get(id);
+  try {
+    const { alias, favorite, tags, notes } = await window.finder.updateDevice(id, changes);
+    renderDevice({ ...device, alias, favorite, tags, notes }, state);
+  } catch (err) {
+    statusBar.textContent = 'No se pudo guardar el cambio: ' + err.message;
+    renderDevice(device, state);
+  }
+}
+
+async function wakeDevice(id) {
+  const { device } = cards.get(id);
+  const name = device.alias || device.name;
+  try {
+    await window.finder.wakeDevice(id);
+    statusBar.textContent = `Paquete Wake-on-LAN enviado a ${name}; puede tardar un par de minutos en arrancar`;
+  } catch (err) {
+    statusBar.textContent = `No se pudo despertar ${name}: ${err.message}`;
+  }
+}
+
+/**
+ * Acepta el certificado nuevo de un NAS tras confirmarlo el usuario
+ */
+async function trustDevice(id) {
+  const { device, state } = cards.get(id);
+  const name = device.alias || device.name;
+  const confirmed = confirm(`El certificado de ${name} (${device.ip}) ha cambiado desde la primera vez que se vio.\n\n` +
+    (device.pinnedFingerprint ? `Antes:  ${device.pinnedFingerprint}\nAhora:  ${device.certFingerprint}\n\n` : '') +
+    'Acéptalo solo si sabes por qué ha cambiado (NAS reinstalado, certificado renovado...). ¿Confiar en el nuevo?');
+  if (!confirmed) return;
+
+  try {
+    const { tls, certChanged, keyPin, keyChanged } = await window.finder.trustDevice(id);
+    const updated = { ...device, tls, certChanged, keyPin, keyChanged };
+    liveDevices.set(id, { ...liveDevices.get(id), tls, certChanged, keyPin, keyChanged });
+    renderDevice(updated, state);
+    statusBar.textContent = `Certificado de ${name} aceptado`;
+  } catch (err) {
+    statusBar.textContent = 'No se pudo aceptar el certificado: ' + err.message;
+  }
+}
+
+/**
+ * Emparejamiento: el NAS da un código que se muestra en la ficha para comprobarlo
+ * en su panel (Sistema → Dispositivos emparejados); al aprobarlo se guarda el token
+ */
+async function pairDevice(card) {
+  const { device, state } = cards.get(card.dataset.id);
+  const name = device.alias || device.name;
+  try {
+    const { code, expiresIn } = await window.finder.pairDevice(device.id);
+    card.querySelector('.device-info').insertAdjacentHTML('beforeend', `
+      <div class="device-pairing">
+        Código <strong>${escapeHtml(code.replace(/(\d{3})(\d{3})/, '$1 $2'))}</strong>:
+        apruébalo en el NAS (Sistema → Dispositivos emparejados) antes de ${Math.round(expiresIn / 60)} min
+      </div>`);
+    statusBar.textContent = `Esperando la aprobación en ${name}...`;
+
+    const { paired } = await window.finder.pairingResult(device.id);
+    liveDevices.set(device.id, { ...liveDevices.get(device.id), paired });
+    renderDevice({ ...device, paired }, state);
+    statusBar.textContent = `${name} emparejado: ya se puede reiniciar y actualizar desde aquí`;
+  } catch (err) {
+    renderDevice(device, state);
+    statusBar.textContent = `No se pudo emparejar ${name}: ${err.message}`;
+  }
+}
+
+const MANAGE_LABELS = { reboot: 'reiniciar', update: 'instalar la actualización de' };
+
+/**
+ * Reinicio o actualización de un NAS emparejado, tras confirmarlo el usuario
+ */
+async function manageDevice(id, action) {
+  const { device } = cards.get(id);
+  const name = device.alias || device.name;
+  if (!confirm(`¿Seguro que quieres ${MANAGE_LABELS[action]} ${name} (${device.ip})?`)) return;
+
+  try {
+    await window.finder.manageDevice(id, action);
+    statusBar.textContent = action === 'reboot'
+      ? `${name} se está reiniciando`
+      : `Actualización en marcha en ${name}; el servicio se reiniciará en unos segundos`;
+  } catch (err) {
+    statusBar.textContent = `No se pudo ${MANAGE_LABELS[action]} ${name}: ${err.message}`;
+  }
+}
+
+/**
+ * Panel de detalles bajo la ficha: se abre con el sondeo ampliado y se cierra al volver a pulsar
+ */
+async function toggleDetails(card) {
+  if (card.nextElementSibling?.classList.contains('device-details')) {
+    card.nextElementSibling.remove();
+    return;
+  }
+  card.insertAdjacentHTML('afterend', '<div class="device-details">Consultando el NAS...</div>');
+  const panel = card.nextElementSibling;
+
+  try {
+    panel.innerHTML = renderDetails(await window.finder.deviceDetails(card.dataset.id));
+  } catch (err) {
+    panel.textContent = 'No se pudieron obtener los detalles: ' + err.message;
+  }
+}
+
+function renderDetails(details) {
+  const ms = (value) => (value === null ? '—' : `${value} ms`);
+  const open = details.ports.filter((port) => port.state === 'open');
+  const cert = details.certificate;
+  const row = (label, value) => `<div class="detail-row"><span>${label}</span><span>${value}</span></div>`;
+
+  return `
+    ${row('Latencia', `conexión ${ms(details.latency.connectMs)} · respuesta ${ms(details.latency.responseMs)}`)}
+    ${row('Puertos abiertos', open.length > 0
+      ? open.map((port) => `${port.port} (${escapeHtml(port.service)})`).join(', ')
+      : 'ninguno de los comprobados')}
+    ${cert ? `
+      ${row('Certificado', `${escapeHtml(cert.subject || '—')}${cert.organization ? ` · ${escapeHtml(cert.organization)}` : ''}${cert.selfSigned ? ' (autofirmado)' : ` · emitido por ${escapeHtml(cert.issuer)}`}`)}
+      ${cert.altNames.length > 0 ? row('Nombres (SAN)', escapeHtml(cert.altNames.join(', '))) : ''}
+      ${row('Caduca', `<span class="${cert.expiringSoon ? 'detail-warning' : ''}">${escapeHtml(new Date(cert.validTo).toLocaleDateString())} (${cert.daysLeft < 0 ? 'caducado' : `${cert.daysLeft} días`})</span>`)}
+      ${row('SHA-256', `<code>${escapeHtml(cert.fingerprint256)}</code>`)}
+    ` : ''}
+    ${details.info
+      ? `<pre class="detail-info">${escapeHtml(JSON.stringify(details.info, null, 2))}</pre>`
+      : row('/api/system/info', escapeHtml(details.infoError))}
+  `;
+}
+
+/**
+ * Formulario dentro de la ficha para alias, etiquetas (separadas por comas) y notas
+ * Enter (fuera de las notas) guarda y Escape cancela; un alias vacío vuelve al nombre del NAS
+ */
+function editDevice(card) {
+  const { device } = cards.get(card.dataset.id);
+  const info = card.querySelector('.device-info');
+  info.innerHTML = `
+    <div class="device-edit">
+      <input name="alias" maxlength="64" placeholder="${escapeHtml(device.name)}" value="${escapeHtml(device.alias || '')}">
+      <input name="tags" placeholder="Etiquetas: backup, casa de mamá..." value="${escapeHtml((device.tags || []).join(', '))}">
+      <textarea name="notes" rows="3" maxlength="2000" placeholder="Notas">${escapeHtml(device.notes || '')}</textarea>
+      <div class="device-edit-buttons">
+        <button class="link-btn" data-action="cancel">Cancelar</button>
+        <button class="link-btn" data-action="save">Guardar</button>
+      </div>
+    </div>
+  `;
+  info.querySelector('input').focus();
+}
+
+function finishEdit(card, save) {
+  const { device, state } = cards.get(card.dataset.id);
+  if (!save) {
+    renderDevice(device, state);
+    return;
+  }
+  const field = (name) => card.querySelector(`.device-edit [name="${name}"]`).value;
+  updateDevice(device.id, {
+    alias: field('alias'),
+    tags: field('tags').split(','),
+    notes: field('notes')
+  });
+}
+
+async function copyHosts() {
+  try {
+    await navigator.clipboard.writeText(await window.finder.hostsSnippet());
+    statusBar.textContent = 'Entradas para el fichero hosts copiadas al portapapeles';
+  } catch (err) {
+    statusBar.textContent = 'No se pudieron copiar las entradas: ' + err.message;
+  }
+}
+
+async function updateHosts() {
+  try {
+    const changed = await window.finder.updateHosts();
+    if (changed) statusBar.textContent = 'Fichero hosts actualizado';
+  } catch (err) {
+    statusBar.textContent = 'No se pudo actualizar el fichero hosts: ' + err.message;
+  }
+}
+
+async function importNmap() {
+  try {
+    const imported = await window.finder.importNmap();
+    if (imported) {
+      statusBar.textContent = `Importados ${imported.seeds} de ${imported.hosts} hosts de nmap; se sondearán al buscar`;
+    }
+  } catch (err) {
+    statusBar.textContent = 'No se pudo importar el escaneo: ' + err.message;
+  }
+}
+
+async function exportNmap() {
+  try {
+    const file = await window.finder.exportNmap();
+    if (file) statusBar.textContent = `Resultados exportados a ${file}`;
+  } catch (err) {
+    statusBar.textContent = 'No se pudieron exportar los resultados: ' + err.message;
+  }
+}
+
+// Sin manejadores inline: la CSP solo permite scripts de este fichero
+scanBtn.addEventListener('click', () => (scanning ? cancelScan() : startScan()));
+copyHostsBtn.addEventListener('click', copyHosts);
+updateHostsBtn.addEventListener('click', updateHosts);
+importNmapBtn.addEventListener('click', importNmap);
+exportNmapBtn.addEventListener('click', exportNmap);
+tagFilterBtn.addEventListener('click', () => filterByTag(null));
+deviceList.addEventListener('click', (event) => {
+  const card = event.target.closest('.device-card');
+  if (!card) return;
+
+  const action = event.target.closest('[data-action]')?.dataset.action;
+  const tag = event.target.closest('.device-tag')?.dataset.tag;
+  if (action === 'favorite') {
+    updateDevice(card.dataset.id, { favorite: !cards.get(card.dataset.id).device.favorite });
+  } else if (action === 'trust') {
+    trustDevice(card.dataset.id);
+  } else if (action === 'details') {
+    toggleDetails(card);
+  } else if (action === 'wake') {
+    wakeDevice(card.dataset.id);
+  } else if (action === 'pair') {
+    pairDevice(card);
+  } else if (action === 'reboot' || action === 'update') {
+    manageDevice(card.dataset.id, action);
+  } else if (action === 'edit') {
+    editDevice(card);
+  } else if (action === 'save' || action === 'cancel') {
+    finishEdit(card, action === 'save');
+  } else if (tag) {
+    filterByTag(tag);
+  } else if (!event.target.closest('.device-edit')) {
+    // Un NAS con el certificado cambiado podría ser un impostor pidiendo la contraseña
+    const device = cards.get(card.dataset.id)?.device;
+    if ((device?.certChanged || device?.keyChanged) &&
+        !confirm('El certificado de este NAS ha cambiado desde el primer contacto. No escribas tu contraseña si no sabes por qué. ¿Abrir igualmente?')) {
+      return;
+    }
+    // Los NAS emparejados con permiso login se abren con la sesión ya iniciada
+    if (device?.paired?.scopes?.includes('login')) window.finder.openDevice(card.dataset.id);
+    else openNAS(card.dataset.url);
+  }
+});
+deviceList.addEventListener('keydown', (event) => {
+  const card = event.target.closest('.device-edit') && event.target.closest('.device-card');
+  if (!card) return;
+  if (event.key === 'Escape') finishEdit(card, false);
+  if (event.key === 'Enter' && event.target.tagName === 'INPUT') finishEdit(card, true);
+});
+
+// NAS conocidos de otras sesiones, a la vista antes del primer escaneo
+showInventory(false).then((records) => {
+  if (records.length > 0) {
+    statusBar.textContent = `${records.length} dispositivo(s) conocido(s). Pulsa "Buscar" para comprobarlos`;
+  }
+}).catch(() => {});
+
+// Los datos vienen de la red: se escapan también las comillas para usarlos en atributos
+function escapeHtml(text) {
+  return String(text ?? '').replace(/[&<>"']/g, (c) => ({
+    '&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;', "'": '&#39;'
+  })[c]);
+}
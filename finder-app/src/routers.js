@@ -0,0 +1,272 @@
+const crypto = require('crypto');
+const dgram = require('dgram');
+const http = require('http');
+const https = require('https');
+const log = require('./log');
+const { normalizeMac } = require('./neighbors');
+
+const REQUEST_TIMEOUT = 5000;
+const MAX_BODY_SIZE = 2 * 1024 * 1024;
+const SSDP_GROUP = '239.255.255.250';
+const SSDP_PORT = 1900;
+const IGD_SERVICES = [
+  'urn:schemas-upnp-org:service:WANIPConnection:1',
+  'urn:schemas-upnp-org:service:WANIPConnection:2',
+  'urn:schemas-upnp-org:service:WANPPPConnection:1'
+];
+// Tope de entradas de port mapping que se piden a un IGD
+const MAX_PORT_MAPPINGS = 256;
+
+/**
+ * Petición HTTP(S) que devuelve { statusCode, headers, body }
+ * `allowSelfSigned` acepta el certificado autofirmado típico de los routers
+ * `signal` (AbortSignal) corta la petición en curso
+ */
+function request(url, { method = 'GET', headers = {}, body, allowSelfSigned = false, signal } = {}) {
+  return new Promise((resolve, reject) => {
+    const target = new URL(url);
+    const client = target.protocol === 'http:' ? http : https;
+
+    const req = client.request(target, {
+      method,
+      headers: body ? { ...headers, 'Content-Length': Buffer.byteLength(body) } : headers,
+      timeout: REQUEST_TIMEOUT,
+      signal,
+      rejectUnauthorized: !allowSelfSigned
+    }, (res) => {
+      let data = '';
+      res.setEncoding('utf8');
+      res.on('data', (chunk) => {
+        data += chunk;
+        if (data.length > MAX_BODY_SIZE) req.destroy(new Error('respuesta demasiado grande'));
+      });
+      res.on('end', () => resolve({ statusCode: res.statusCode, headers: res.headers, body: data }));
+    });
+
+    req.on('timeout', () => req.destroy(new Error('timeout')));
+    req.on('error', reject);
+    req.end(body);
+  });
+}
+
+/**
+ * Petición con autenticación HTTP Digest (RFC 7616, MD5 + qop=auth) como la de TR-064
+ */
+async function digestRequest(url, options, username, password) {
+  const first = await request(url, options);
+  const challenge = first.headers['www-authenticate'];
+  if (first.statusCode !== 401 || !/^Digest /i.test(challenge || '')) return first;
+
+  const params = {};
+  for (const [, key, quoted, plain] of challenge.matchAll(/(\w+)=(?:"([^"]*)"|([^,\s]*))/g)) {
+    params[key] = quoted ?? plain;
+  }
+
+  const md5 = (value) => crypto.createHash('md5').update(value).digest('hex');
+  const uri = new URL(url).pathname + new URL(url).search;
+  const cnonce = crypto.randomBytes(8).toString('hex');
+  const nc = '00000001';
+  const ha1 = md5(`${username}:${params.realm}:${password}`);
+  const ha2 = md5(`${options.method || 'GET'}:${uri}`);
+  const response = md5(`${ha1}:${params.nonce}:${nc}:${cnonce}:auth:${ha2}`);
+
+  const authorization = `Digest username="${username}", realm="${params.realm}", nonce="${params.nonce}", ` +
+    `uri="${uri}", qop=auth, nc=${nc}, cnonce="${cnonce}", response="${response}"` +
+    (params.opaque ? `, opaque="${params.opaque}"` : '');
+
+  return request(url, { ...options, headers: { ...options.headers, Authorization: authorization } });
+}
+
+function expectOk(res, what) {
+  if (res.statusCode < 200 || res.statusCode >= 300) {
+    throw new Error(`${what}: HTTP ${res.statusCode}`);
+  }
+  return res;
+}
+
+function xmlValues(xml, tag) {
+  return Array.from(xml.matchAll(new RegExp(`<(?:[\\w-]+:)?${tag}>([^<]*)</(?:[\\w-]+:)?${tag}>`, 'g')), (m) => m[1].trim());
+}
+
+function soapEnvelope(serviceType, action, args = {}) {
+  const body = Object.entries(args).map(([key, value]) => `<${key}>${value}</${key}>`).join('');
+  return '<?xml version="1.0" encoding="utf-8"?>' +
+    '<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">' +
+    `<s:Body><u:${action} xmlns:u="${serviceType}">${body}</u:${action}></s:Body></s:Envelope>`;
+}
+
+function soapHeaders(serviceType, action) {
+  return { 'Content-Type': 'text/xml; charset="utf-8"', SOAPAction: `"${serviceType}#${action}"` };
+}
+
+/**
+ * OpenWrt: JSON-RPC de ubus (rpcd + luci-rpc)
+ */
+async function openwrtLeases({ url, username = 'root', password = '', allowSelfSigned, signal }) {
+  const endpoint = new URL('/ubus', url).href;
+  let id = 0;
+  const call = async (session, object, method, args) => {
+    const res = expectOk(await request(endpoint, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ jsonrpc: '2.0', id: ++id, method: 'call', params: [session, object, method, args] }),
+      allowSelfSigned,
+      signal
+    }), 'ubus');
+    const [status, result] = JSON.parse(res.body).result || [];
+    if (status !== 0) throw new Error(`ubus ${object}.${method}: código ${status}`);
+    return result;
+  };
+
+  const { ubus_rpc_session: session } = await call('0'.repeat(32), 'session', 'login', { username, password });
+  const { dhcp_leases: leases = [] } = await call(session, 'luci-rpc', 'getDHCPLeases', {});
+  return leases.map((lease) => ({ ip: lease.ipaddr, mac: lease.macaddr, hostname: lease.hostname }));
+}
+
+/**
+ * pfSense: paquete REST API (v2) con clave de API
+ */
+async function pfsenseLeases({ url, password = '', allowSelfSigned, signal }) {
+  const res = expectOk(await request(new URL('/api/v2/status/dhcp_server/leases', url).href, {
+    headers: { 'X-API-Key': password, Accept: 'application/json' },
+    allowSelfSigned,
+    signal
+  }), 'pfSense');
+  return (JSON.parse(res.body).data || [])
+    .filter((lease) => lease.active !== false)
+    .map((lease) => ({ ip: lease.ip, mac: lease.mac, hostname: lease.hostname }));
+}
+
+/**
+ * Fritz!Box: TR-064 (servicio Hosts), con la lista completa vía X_AVM-DE_GetHostListPath
+ */
+async function fritzboxLeases({ url = 'http://fritz.box:49000', username = '', password = '', signal }) {
+  const serviceType = 'urn:dslforum-org:service:Hosts:1';
+  const action = 'X_AVM-DE_GetHostListPath';
+  const res = expectOk(await digestRequest(new URL('/upnp/control/hosts', url).href, {
+    method: 'POST',
+    headers: soapHeaders(serviceType, action),
+    body: soapEnvelope(serviceType, action),
+    signal
+  }, username, password), 'TR-064');
+
+  const [path] = xmlValues(res.body, 'NewX_AVM-DE_HostListPath');
+  if (!path) throw new Error('TR-064: sin lista de hosts');
+
+  const list = expectOk(await request(new URL(path, url).href, { signal }), 'TR-064');
+  return Array.from(list.body.matchAll(/<Item>([\s\S]*?)<\/Item>/g), ([, item]) => ({
+    ip: xmlValues(item, 'IPAddress')[0],
+    mac: xmlValues(item, 'MACAddress')[0],
+    hostname: xmlValues(item, 'HostName')[0],
+    active: xmlValues(item, 'Active')[0] === '1'
+  })).filter((host) => host.active);
+}
+
+/**
+ * Localiza el IGD por SSDP si no se indica la URL de su descripción
+ */
+function discoverIgd(timeout = 2000, signal) {
+  return new Promise((resolve) => {
+    const socket = dgram.createSocket('udp4');
+    const search = Buffer.from([
+      'M-SEARCH * HTTP/1.1',
+      `HOST: ${SSDP_GROUP}:${SSDP_PORT}`,
+      'MAN: "ssdp:discover"',
+      'MX: 2',
+      'ST: urn:schemas-upnp-org:device:InternetGatewayDevice:1',
+      '', ''
+    ].join('\r\n'));
+    let done = false;
+    const finish = (location) => {
+      if (done) return;
+      done = true;
+      clearTimeout(timer);
+      signal?.removeEventListener('abort', onAbort);
+      socket.close();
+      resolve(location);
+    };
+    const onAbort = () => finish(null);
+    const timer = setTimeout(onAbort, timeout);
+    signal?.addEventListener('abort', onAbort, { once: true });
+
+    socket.on('message', (message) => {
+      const location = message.toString().match(/^location:\s*(\S+)/im)?.[1];
+      if (location) finish(location);
+    });
+    socket.on('error', () => finish(null));
+    socket.send(search, SSDP_PORT, SSDP_GROUP);
+  });
+}
+
+/**
+ * UPnP IGD genérico: no expone las concesiones DHCP, pero sí los hosts
+ * internos con port mappings (NewInternalClient), que sirven de candidatos
+ */
+async function upnpLeases({ url, signal }) {
+  const location = url || await discoverIgd(undefined, signal);
+  if (!location) throw new Error('UPnP: no se encontró ningún IGD');
+
+  const description = expectOk(await request(location, { signal }), 'UPnP').body;
+  let service = null;
+  for (const [, block] of description.matchAll(/<service>([\s\S]*?)<\/service>/g)) {
+    const [type] = xmlValues(block, 'serviceType');
+    if (IGD_SERVICES.includes(type)) {
+      service = { type, controlUrl: new URL(xmlValues(block, 'controlURL')[0], location).href };
+      break;
+    }
+  }
+  if (!service) throw new Error('UPnP: el IGD no tiene servicio WANIPConnection');
+
+  const hosts = new Map();
+  const action = 'GetGenericPortMappingEntry';
+  for (let index = 0; index < MAX_PORT_MAPPINGS; index++) {
+    const res = await request(service.controlUrl, {
+      method: 'POST',
+      headers: soapHeaders(service.type, action),
+      body: soapEnvelope(service.type, action, { NewPortMappingIndex: index }),
+      signal
+    });
+    // Fin de la tabla: SpecifiedArrayIndexInvalid (HTTP 500)
+    if (res.statusCode !== 200) break;
+
+    const [ip] = xmlValues(res.body, 'NewInternalClient');
+    const [description] = xmlValues(res.body, 'NewPortMappingDescription');
+    if (ip && !hosts.has(ip)) hosts.set(ip, { ip, mac: '', hostname: '', description });
+  }
+  return [...hosts.values()];
+}
+
+const ROUTERS = {
+  openwrt: openwrtLeases,
+  pfsense: pfsenseLeases,
+  fritzbox: fritzboxLeases,
+  upnp: upnpLeases
+};
+
+/**
+ * Concesiones DHCP del router configurado (`router` en config.json)
+ * Devuelve Map ip -> { mac, hostname } o null si no hay integración, falla o se aborta `signal`
+ */
+async function fetchRouterLeases(options, signal) {
+  if (!options?.type) return null;
+
+  const fetchLeases = ROUTERS[options.type];
+  if (!fetchLeases) {
+    log.warn(`[Router] Tipo de router desconocido: ${options.type}`);
+    return null;
+  }
+
+  try {
+    const leases = new Map();
+    for (const lease of await fetchLeases({ ...options, signal })) {
+      if (lease.ip) leases.set(lease.ip, { mac: normalizeMac(lease.mac), hostname: lease.hostname || '' });
+    }
+    return leases;
+  } catch (err) {
+    if (signal?.aborted) return null;
+    log.warn(`[Router] No se pudieron leer las concesiones de ${options.type}: ${err.message}`);
+    return null;
+  }
+}
+
+module.exports = { fetchRouterLeases };
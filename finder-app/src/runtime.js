@@ -0,0 +1,106 @@
+/**
+ * Diagnóstico del proceso para serve --debug: recursos abiertos (sockets, temporizadores),
+ * descriptores, memoria, retardo del bucle de eventos y ocupación de los grupos de sondeo,
+ * más perfiles de CPU y volcados del heap que se abren con las DevTools de Chrome
+ * Sirve para ver si un escaneo grande deja sockets o sondeos colgados
+ */
+const fs = require('fs');
+const inspector = require('inspector');
+const v8 = require('v8');
+const { monitorEventLoopDelay } = require('perf_hooks');
+const { getPoolStats, getFdLimit, getScanStatus } = require('./scanner');
+
+const MAX_PROFILE_SECONDS = 60;
+// Muestreo del bucle de eventos (ms); el histograma incluye el propio intervalo y se descuenta
+const LOOP_RESOLUTION = 10;
+
+/**
+ * Descriptores abiertos del proceso (solo Linux; null en el resto)
+ */
+function countOpenFds() {
+  try {
+    return fs.readdirSync('/proc/self/fd').length;
+  } catch {
+    return null;
+  }
+}
+
+function countByType(resources) {
+  const counts = {};
+  for (const type of resources) counts[type] = (counts[type] || 0) + 1;
+  return counts;
+}
+
+/**
+ * Diagnóstico en marcha; el retardo del bucle de eventos se mide desde que se crea
+ */
+function createRuntimeMonitor() {
+  const loopDelay = monitorEventLoopDelay({ resolution: LOOP_RESOLUTION });
+  loopDelay.enable();
+  let profiling = false;
+
+  return {
+    /**
+     * Foto del proceso: recursos activos por tipo (TCPSocketWrap, Timeout...), descriptores,
+     * memoria, bucle de eventos y grupos de sondeo del escaneo
+     */
+    snapshot() {
+      const ms = (ns) => Math.max(Math.round(ns / 1e4 - LOOP_RESOLUTION * 100) / 100, 0);
+      const memory = process.memoryUsage();
+      const snapshot = {
+        pid: process.pid,
+        node: process.version,
+        uptime: Math.round(process.uptime()),
+        resources: countByType(process.getActiveResourcesInfo()),
+        fds: { open: countOpenFds(), limit: getFdLimit() },
+        memoryMb: Object.fromEntries(Object.entries(memory).map(([name, bytes]) => [name, Math.round(bytes / 1024 / 1024 * 10) / 10])),
+        eventLoopDelayMs: {
+          mean: ms(loopDelay.mean),
+          p99: ms(loopDelay.percentile(99)),
+          max: ms(loopDelay.max)
+        },
+        pools: getPoolStats(),
+        scanRunning: Boolean(getScanStatus().running)
+      };
+      loopDelay.reset();
+      return snapshot;
+    },
+
+    /**
+     * Perfil de CPU de `seconds` segundos (formato .cpuprofile de las DevTools)
+     */
+    async cpuProfile(seconds) {
+      const duration = Math.min(Math.max(Number(seconds) || 10, 1), MAX_PROFILE_SECONDS);
+      if (profiling) throw Object.assign(new Error('Ya hay un perfil de CPU en marcha'), { status: 409 });
+      profiling = true;
+      const session = new inspector.Session();
+      session.connect();
+      const post = (method, params) => new Promise((resolve, reject) => {
+        session.post(method, params, (err, result) => (err ? reject(err) : resolve(result)));
+      });
+      try {
+        await post('Profiler.enable');
+        await post('Profiler.start');
+        await new Promise((resolve) => setTimeout(resolve, duration * 1000));
+        const { profile } = await post('Profiler.stop');
+        return profile;
+      } finally {
+        session.disconnect();
+        profiling = false;
+      }
+    },
+
+    /**
+     * Volcado del heap (.heapsnapshot) como stream; bloquea el proceso mientras se genera
+     */
+    heapSnapshot() {
+      return v8.getHeapSnapshot();
+    },
+
+    stop() {
+      loopDelay.disable();
+    }
+  };
+}
+
+module.exports = { createRuntimeMonitor, MAX_PROFILE_SECONDS };
@@ -0,0 +1,119 @@
+const fs = require('fs');
+const log = require('./log');
+const { createSyslogLogSink } = require('./syslog');
+const { createEventLogSink } = require('./eventlog');
+const { loadClientCertificates } = require('./client-certs');
+const { openSecretStore } = require('./secrets');
+const { DEMO_DEVICES } = require('./simulate');
+
+/**
+ * Abre el almacén de secretos; si falla se sigue sin credenciales
+ */
+function openSecretStoreSafe() {
+  try {
+    return openSecretStore();
+  } catch (err) {
+    log.warn(`[Secrets] Almacén no disponible: ${err.message}`);
+    return null;
+  }
+}
+
+/**
+ * Almacén de secretos solo si hay certificados cliente (evita derivar la clave en cada escaneo)
+ */
+function openClientCertSecrets(config) {
+  if (Object.keys(config.clientCertificates || {}).length === 0) return null;
+  return openSecretStoreSafe();
+}
+
+/**
+ * Almacén de secretos solo si algún canal de notificación tiene contraseña (SMTP, MQTT)
+ */
+function openNotifierSecrets(config) {
+  if (!config.notifications?.email?.user && !(config.mqtt?.enabled && config.mqtt.username)) return null;
+  return openSecretStoreSafe();
+}
+
+/**
+ * Integración con el router; la contraseña (o clave de API) va en el almacén de secretos
+ */
+function routerOptions(config) {
+  if (!config.router?.type) return null;
+  const secrets = config.router.type === 'upnp' ? null : openSecretStoreSafe();
+  return { ...config.router, password: secrets?.get('router.password') || '' };
+}
+
+/**
+ * CA para el modo TLS estricto (`strictTls` + `tlsCaFile` en config.json)
+ */
+function loadStrictCa(config) {
+  if (!config.strictTls) return null;
+  if (!config.tlsCaFile) {
+    log.warn('[TLS] strictTls activo pero falta tlsCaFile; se ignora');
+    return null;
+  }
+  try {
+    return fs.readFileSync(config.tlsCaFile, 'utf8');
+  } catch (err) {
+    log.warn(`[TLS] No se pudo leer ${config.tlsCaFile}: ${err.message}`);
+    return null;
+  }
+}
+
+/**
+ * Opciones de scanNetwork a partir de config.json y de los flags de línea de comandos
+ * (`allowPublic`, `stealth`, `arpSweep`, `pingSweep`, `profile`, `trace`, `simulate`); común a la app y a la CLI
+ */
+function buildScanOptions(config, flags = {}) {
+  return {
+    concurrency: config.concurrency,
+    ports: config.probePorts,
+    schemeOrder: config.schemeOrder,
+    connectTimeout: config.connectTimeout,
+    httpTimeout: config.httpTimeout,
+    minConfidence: config.minConfidence,
+    allowPublic: Boolean(flags.allowPublic || config.allowPublicSubnets),
+    priorityRange: config.priorityRange,
+    exclude: config.exclude,
+    stealth: Boolean(flags.stealth || config.stealth),
+    arpSweep: Boolean(flags.arpSweep || config.arpSweep),
+    pingSweep: Boolean(flags.pingSweep || config.pingSweep),
+    router: routerOptions(config),
+    snmp: config.snmp?.enabled ? { community: config.snmp.community } : null,
+    profile: Boolean(flags.profile),
+    trace: Boolean(flags.trace),
+    ca: loadStrictCa(config),
+    targets: config.scanTargets,
+    simulation: flags.simulate ? (config.simulation?.devices?.length > 0 ? config.simulation.devices : DEMO_DEVICES) : null,
+    clientCertFor: loadClientCertificates(config.clientCertificates, openClientCertSecrets(config))
+  };
+}
+
+/**
+ * Mensajes de registro también a syslog y al registro de eventos de Windows según
+ * `syslog.logs` y `eventLog.logs`; devuelve la función que los desconecta
+ */
+function attachLogSinks(config) {
+  const detach = [];
+  const attach = (name, level, createSink) => {
+    if (!Object.hasOwn(log.LEVELS, level)) {
+      log.warn(`[Config] ${name}.logs no válido: ${level} (${Object.keys(log.LEVELS).join(', ')} o false); se ignora`);
+      return;
+    }
+    detach.push(log.addLogSink(createSink(), { level }));
+  };
+  if (config.syslog?.enabled && config.syslog.logs) {
+    const { host, port } = config.syslog;
+    attach('syslog', config.syslog.logs, () => createSyslogLogSink(config.syslog, (err) => {
+      log.warn(`[Syslog] No se pudo enviar el registro a ${host}:${port}: ${err.message}`);
+    }));
+  }
+  if (config.eventLog?.enabled && config.eventLog.logs && process.platform === 'win32') {
+    attach('eventLog', config.eventLog.logs, () => createEventLogSink(config.eventLog, (err) => {
+      log.warn(`[EventLog] No se pudo escribir en el registro de eventos: ${err.message}`);
+    }));
+  }
+  return () => detach.forEach((remove) => remove());
+}
+
+module.exports = { buildScanOptions, openSecretStoreSafe, openNotifierSecrets, attachLogSinks };
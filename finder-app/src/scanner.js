@@ -1,199 +1,1515 @@
 const Bonjour = require('bonjour-service').Bonjour;
+const { execFile, execFileSync } = require('child_process');
+const fs = require('fs');
 const net = require('net');
 const os = require('os');
 const http = require('http');
+const https = require('https');
+const tls = require('tls');
+const dgram = require('dgram');
+const crypto = require('crypto');
+const { setMaxListeners } = require('events');
+const log = require('./log');
+const { readNeighborTable, readIPv6Neighbors, arpSweep } = require('./neighbors');
+const { isPrivateAddress, ipv4InRange, ipv4ToInt, intToIpv4, urlHost } = require('./netutil');
+const { BEACON_PORT, BEACON_GROUP, createProbe, verifyReply } = require('./beacon');
+const { matchFingerprint, probeEndpoints } = require('./fingerprints');
+const { compileDenylist } = require('./denylist');
+const { lookupVendor, isRaspberryPi, isLocalMac } = require('./oui');
+const { describeCertificate } = require('./certificates');
+const { lookupHostName } = require('./names');
+const { querySystem } = require('./snmp');
+const { probeWsDiscovery } = require('./wsdiscovery');
+const { fetchRouterLeases } = require('./routers');
+const { fpingSweep, udpPing } = require('./ping');
+const { createProfile, timePhase, timeHost, timeBackend, countError, summarizeProfile } = require('./profile');
+const { createTrace, traceEvent, classifyProbeError, summarizeTrace } = require('./trace');
+const { createSimulatedMethod } = require('./simulate');
 
 const NAS_PORT = 443;
+const DEFAULT_PORTS = { https: 443, http: 80 };
+const PROBE_SCHEMES = [
+  { protocol: 'https', port: NAS_PORT },
+  { protocol: 'http', port: DEFAULT_PORTS.http }
+];
+// Puertos que suelen llevar TLS cuando `ports` no indica el protocolo
+const TLS_PORTS = new Set([443, 3001, 5001, 8443, 9443]);
+// Tipos DNS-SD escuchados: el propio de HomePiNAS y los web genéricos
+const MDNS_SERVICE_TYPES = ['homepinas', 'https', 'http'];
+// Modo sigiloso: un único endpoint público que todo HomePiNAS sirve
+const STEALTH_ENDPOINTS = ['/api/system/status'];
+const STEALTH_CONCURRENCY = 4;
+const STEALTH_RATE = 5; // hosts por segundo
+const MAX_RESPONSE_SIZE = 64 * 1024;
+// Espera por defecto a que acepte la conexión y, después, a cada lectura de la respuesta (ms)
+const CONNECT_TIMEOUT = 1500;
+const HTTP_TIMEOUT = 1500;
+// Confianza que pierde una detección heurística si la MAC es de otro fabricante que Raspberry Pi
+const NON_PI_PENALTY = 0.2;
+const MIN_TIMEOUT = 100;
 const SCAN_TIMEOUT = 3000;
+// Tiempo que se esperan respuestas al beacon UDP
+const BEACON_TIMEOUT = 1500;
+const NEGATIVE_CACHE_TTL = 60000;
+// Escaneos cuya telemetría se guarda (getScanStats)
+const STATS_HISTORY = 20;
+// Fallos inesperados (excepciones) de un escaneo que se guardan con detalle y se avisan
+const MAX_WORKER_ERRORS = 10;
+const DEFAULT_CONCURRENCY = 50;
+// Descriptores reservados para Electron, mDNS, logs, etc.
+const FD_HEADROOM = 64;
+// Rango típico de los pools DHCP domésticos (último octeto)
+const DEFAULT_PRIORITY_RANGE = [2, 150];
+// Tope de hosts barridos por subred (una /20); las mayores se recortan alrededor de la IP local
+const MAX_SUBNET_HOSTS = 4096;
+// Barrido de ping previo: espera por host (ms) y pings UDP simultáneos sin fping
+const PING_TIMEOUT = 500;
+const PING_CONCURRENCY = 64;
+// Intervalo mínimo entre avisos de progreso (ms)
+const PROGRESS_INTERVAL = 250;
+
+/**
+ * Lo que se conserva entre escaneos. La app y la CLI comparten el del módulo;
+ * cada Scanner de discovery.js lleva el suyo
+ */
+function createScanState() {
+  return {
+    // IPs sondeadas recientemente sin encontrar HomePiNAS: ip -> expiración (ms)
+    // Las caducadas se borran al consultarlas y al empezar cada escaneo (ver pruneNegativeCache)
+    negativeCache: new Map(),
+    // IPs donde ya se encontró un HomePiNAS en escaneos anteriores
+    knownHosts: new Set(),
+    // Estado del último escaneo (o del que está en curso)
+    status: { running: false, startedAt: null, finishedAt: null, found: 0 },
+    // Traza de decisiones del último escaneo con `trace` (null si ninguno la pidió)
+    trace: null,
+    // Telemetría de los últimos escaneos terminados, del más antiguo al más reciente
+    stats: []
+  };
+}
+
+const sharedState = createScanState();
+
+// Métodos de descubrimiento; `options.methods` permite usar solo algunos
+const METHODS = {
+  mdns: scanMDNS,
+  beacon: scanBeacon,
+  wsd: scanWsDiscovery,
+  subnet: scanSubnet,
+  ipv6: scanIPv6,
+  hostnames: scanKnownHostnames,
+  seeds: scanSeeds,
+  targets: scanTargets
+};
 
 /**
  * Escanea la red buscando dispositivos HomePiNAS
- * Métodos: mDNS, hostname, subnet scan
+ * Métodos: mDNS, beacon UDP, WS-Discovery, hostname, subnet scan (IPv4), vecinos IPv6, semillas importadas (`seeds`, p. ej. de nmap)
+ * y rangos CIDR configurados (`targets`)
+ *
+ * Cada dispositivo se notifica vía `onDevice` en cuanto se confirma,
+ * sin esperar a que terminen el resto de métodos.
+ *
+ * `signal` (AbortSignal) cancela el escaneo: se devuelve lo encontrado hasta ese momento.
+ *
+ * `onProgress` recibe el progreso ({ probed, total, methods, subnets }) como mucho cada 250 ms
+ * y en cada cambio de estado de un método.
+ *
+ * `methods` limita los métodos (claves de METHODS) y `state` (createScanState) aísla
+ * la caché y el estado de los de otros escaneos.
+ *
+ * `trace` anota cada decisión de los sondeos (ver trace.js y getScanTrace).
+ *
+ * `simulation` (dispositivos falsos, ver simulate.js) sustituye todos los métodos por
+ * la red simulada: no se envía ni se lee nada de la red.
+ *
+ * `carried` son dispositivos de un escaneo anterior que se dan por buenos sin sondearlos
+ * (las vueltas incrementales de watch y la bandeja, ver refresh.js).
+ *
+ * Los tiempos por método, por fase y por host y los fallos por categoría se miden siempre
+ * (ver getScanStats); `profile` además los deja en el estado del escaneo.
+ *
+ * Una excepción en el sondeo de un host, en un método o en `onDevice` no tumba el escaneo:
+ * se anota en `workerErrors` del estado y se devuelve lo encontrado por el resto.
  */
-async function scanNetwork() {
+async function scanNetwork(options = {}) {
   const devices = new Map();
+  const onDevice = options.onDevice || (() => {});
+  const onProgress = options.onProgress || (() => {});
+  const profile = createProfile();
+  const trace = options.trace ? createTrace() : null;
   
-  // Ejecutar todos los métodos en paralelo
-  const results = await Promise.allSettled([
-    scanMDNS(),
-    scanSubnet(),
-    scanKnownHostnames()
-  ]);
-  
-  // Combinar resultados
-  for (const result of results) {
-    if (result.status === 'fulfilled' && result.value) {
-      for (const device of result.value) {
-        // Usar IP como key para evitar duplicados
-        if (!devices.has(device.ip)) {
-          devices.set(device.ip, device);
-        }
+  const signal = options.signal || new AbortController().signal;
+  // Cada sondeo en vuelo escucha la cancelación: tantos oyentes como `concurrency`
+  setMaxListeners(0, signal);
+  
+  const state = options.state || sharedState;
+  if (trace) state.trace = trace;
+  // watch, serve y la bandeja escanean durante días: la caché no debe crecer con cada IP barrida
+  pruneNegativeCache(state.negativeCache);
+  const scanStatus = state.status = {
+    running: true,
+    startedAt: new Date().toISOString(),
+    finishedAt: null,
+    found: 0,
+    // Hosts sondeados / previstos, estado de cada método (pending, running, done, failed, cancelled)
+    // y cada subred barrida: { range, probed, total, found }
+    progress: { probed: 0, total: 0, methods: {}, subnets: [] },
+    // Sondeos HTTP(S) fallidos por motivo (ECONNREFUSED, timeout...): motivo -> cantidad
+    probeErrors: {},
+    // Excepciones aisladas (un fallo del código, no de la red): total y las primeras { method, ip, error }
+    workerErrors: { count: 0, recent: [] }
+  };
+  const { progress } = scanStatus;
+  let lastProgress = 0;
+  let progressClosed = false;
+  const emitProgress = (force = false) => {
+    // Tras cancelar, los sondeos que aún terminan no deben avisar de nada
+    if (progressClosed) return;
+    const now = Date.now();
+    if (!force && now - lastProgress < PROGRESS_INTERVAL) return;
+    lastProgress = now;
+    onProgress(getScanStatus(state).progress);
+  };
+  // Un fallo de un sondeo o de un método: se cuenta y se sigue con el resto
+  const workerError = (err, { method = null, ip = null } = {}) => {
+    const { workerErrors } = scanStatus;
+    workerErrors.count++;
+    countError(profile, 'worker-failed');
+    traceEvent(trace, ip, 'worker', 'failed', { method, error: err?.message || String(err) });
+    if (workerErrors.recent.length >= MAX_WORKER_ERRORS) return;
+    workerErrors.recent.push({ method, ip, error: err?.message || String(err) });
+    log.warn(`[Scanner] Fallo inesperado${method ? ` en ${method}` : ''}${ip ? ` (${ip})` : ''}: ${err?.message || err}`,
+      { method, ip, stack: err?.stack });
+  };
+  const runMethod = (name, fn) => {
+    progress.methods[name] = 'running';
+    emitProgress(true);
+    return timeBackend(profile, name, fn).catch((err) => {
+      progress.methods[name] = 'failed';
+      workerError(err, { method: name });
+    }).finally(() => {
+      if (progress.methods[name] === 'running') progress.methods[name] = 'done';
+      emitProgress(true);
+    });
+  };
+  
+  const simulated = Array.isArray(options.simulation);
+  let neighbors = simulated ? null : await timePhase(profile, 'liveness', readNeighborTable);
+  
+  // Barrido ARP activo: si funciona, el barrido TCP se limita a los hosts que respondieron
+  const swept = options.arpSweep && !simulated ? await timePhase(profile, 'arp-sweep', () => arpSweep(getLocalInterfaces(), signal)) : null;
+  if (swept) {
+    neighbors = new Map([...(neighbors || []), ...swept]);
+  }
+  
+  // Concesiones DHCP del router: lista de candidatos en lugar de las 254 IPs
+  const leases = options.router && !simulated ? await timePhase(profile, 'leases', () => fetchRouterLeases(options.router, signal)) : null;
+  if (leases) {
+    const active = [...leases].map(([ip, { mac }]) => [ip, { mac, reachable: true }]);
+    neighbors = new Map([...(neighbors || []), ...active]);
+  }
+  const denied = compileDenylist(options.exclude);
+  
+  // Contexto compartido por todos los métodos de este escaneo
+  const stealth = Boolean(options.stealth);
+  const schemes = resolveProbeSchemes(options.ports);
+  const scan = {
+    concurrency: stealth
+      ? Math.min(STEALTH_CONCURRENCY, resolveConcurrency(options.concurrency, schemes.length))
+      : resolveConcurrency(options.concurrency, schemes.length),
+    stealth,
+    // Sigiloso: ritmo lento, compartido por todos los barridos
+    throttle: stealth ? createRateLimiter(STEALTH_RATE) : null,
+    // Esquema y puerto de cada sondeo HTTP(S) por host
+    schemes,
+    // Protocolos en orden de preferencia: se prueban uno tras otro (null = todos a la vez)
+    schemeOrder: resolveSchemeOrder(options.schemeOrder, schemes),
+    connectTimeout: resolveTimeout(options.connectTimeout, CONNECT_TIMEOUT),
+    httpTimeout: resolveTimeout(options.httpTimeout, HTTP_TIMEOUT),
+    // Confianza mínima de un detector para dar por bueno un dispositivo (0 = cualquiera)
+    minConfidence: Number(options.minConfidence) || 0,
+    signal,
+    allowPublic: Boolean(options.allowPublic),
+    priorityRange: options.priorityRange || DEFAULT_PRIORITY_RANGE,
+    sourceFor: createSourceResolver(getLocalInterfaces()),
+    trustStore: options.trustStore || null,
+    // Modo TLS estricto: solo se confirman dispositivos firmados por esta CA
+    ca: options.ca || null,
+    // ip => { cert, key, passphrase } para NAS que exigen certificado cliente
+    clientCertFor: options.clientCertFor || (() => null),
+    // SNMP v2c opcional ({ community }); en sigiloso no se usa
+    snmp: stealth ? null : options.snmp || null,
+    profile,
+    trace,
+    neighbors,
+    liveOnly: Boolean(swept || leases),
+    negativeCache: state.negativeCache,
+    knownHosts: state.knownHosts,
+    // Barrido de ping antes del TCP; en sigiloso no se usa
+    pingSweep: Boolean(options.pingSweep) && !stealth,
+    // ip -> { mac, hostname } según el router
+    leases,
+    // Hosts conocidos de antemano: [{ ip, hostname }]
+    seeds: options.seeds || [],
+    // Rangos CIDR adicionales: [{ address, prefix }]
+    targets: parseTargets(options.targets),
+    // Lista de exclusión: ningún método sondea ni informa de estos hosts
+    isExcluded: (ip) => denied(ip, neighbors?.get(ip)?.mac),
+    // MAC de la caché ARP/NDP tras un sondeo con éxito
+    lookupMac: createMacLookup(getLocalInterfaces()),
+    // Progreso: cada método suma los hosts que va a sondear; probeHost cuenta los hechos
+    addTargets: (count) => {
+      progress.total += count;
+      emitProgress();
+    },
+    // Progreso de una subred (la de una interfaz o un rango de `targets`); sweepRanges lo va sumando
+    addSubnet: (range, total) => {
+      const subnet = { range, probed: 0, total, found: 0 };
+      progress.subnets.push(subnet);
+      return subnet;
+    },
+    probeDone: () => {
+      progress.probed++;
+      emitProgress();
+    },
+    workerError,
+    probeError: (reason, protocol) => {
+      scanStatus.probeErrors[reason] = (scanStatus.probeErrors[reason] || 0) + 1;
+      countError(profile, classifyProbeError(reason, protocol));
+    },
+    report: (device) => {
+      // Usar IP como key para evitar duplicados
+      if (!device || signal.aborted || devices.has(device.ip)) return;
+      // La MAC sale gratis de la tabla ARP
+      const mac = device.mac || neighbors?.get(device.ip)?.mac;
+      // Otra vez con la MAC aprendida en el sondeo: antes solo se sabía la de la tabla ARP
+      if (denied(device.ip, mac)) {
+        traceEvent(trace, device.ip, 'report', 'excluded', { method: device.method });
+        return;
+      }
+      device.addresses = [...new Set([device.ip, ...(device.addresses || [])])];
+      
+      // Doble pila: la misma máquina vista por IPv4 e IPv6 se une en un solo dispositivo
+      const same = findSameHost(devices, device, mac);
+      if (same) {
+        same.addresses = [...new Set([...same.addresses, ...device.addresses])];
+        traceEvent(trace, device.ip, 'report', 'merged', { method: device.method, into: same.ip });
+        return;
+      }
+      
+      if (mac) device.mac = mac;
+      if (lookupVendor(mac)) device.vendor = lookupVendor(mac);
+      devices.set(device.ip, device);
+      state.knownHosts.add(device.ip);
+      scanStatus.found = devices.size;
+      traceEvent(trace, device.ip, 'report', 'found', { method: device.method });
+      log.debug(`[Scanner] ${device.ip} encontrado por ${device.method}`, { ip: device.ip, method: device.method });
+      // El dispositivo ya cuenta aunque quien escucha falle
+      try {
+        onDevice(device);
+      } catch (err) {
+        workerError(err, { method: 'onDevice', ip: device.ip });
       }
     }
+  };
+  
+  // Ejecutar todos los métodos en paralelo; una cancelación no espera a que terminen
+  // (cada método cierra por su cuenta sockets, conexiones y procesos al abortar)
+  const methods = simulated
+    ? { simulated: createSimulatedMethod(options.simulation) }
+    : options.methods
+      ? Object.fromEntries(Object.entries(METHODS).filter(([name]) => options.methods.includes(name)))
+      : METHODS;
+  for (const name of Object.keys(methods)) progress.methods[name] = 'pending';
+  
+  for (const device of simulated ? [] : options.carried || []) {
+    traceEvent(trace, device.ip, 'host', 'carried');
+    scan.report({ ...device, addresses: [...device.addresses || []] });
+  }
+  
+  if (!signal.aborted) {
+    const cancelled = new Promise((resolve) => signal.addEventListener('abort', resolve, { once: true }));
+    await Promise.race([
+      cancelled,
+      Promise.allSettled(Object.entries(methods).map(([name, method]) => runMethod(name, () => method(scan))))
+    ]);
+  }
+  
+  scanStatus.running = false;
+  scanStatus.cancelled = signal.aborted;
+  for (const [name, state] of Object.entries(progress.methods)) {
+    if (state !== 'done' && state !== 'failed') progress.methods[name] = 'cancelled';
   }
+  emitProgress(true);
+  progressClosed = true;
+  scanStatus.finishedAt = new Date().toISOString();
+  const summary = summarizeProfile(profile);
+  if (options.profile) scanStatus.profile = summary;
+  state.stats = [...state.stats, {
+    startedAt: scanStatus.startedAt,
+    finishedAt: scanStatus.finishedAt,
+    durationMs: Date.parse(scanStatus.finishedAt) - Date.parse(scanStatus.startedAt),
+    cancelled: scanStatus.cancelled,
+    found: devices.size,
+    probed: progress.probed,
+    workerErrors: scanStatus.workerErrors.count,
+    ...summary,
+    probeErrors: { ...scanStatus.probeErrors }
+  }].slice(-STATS_HISTORY);
+  log.debug(`[Scanner] Escaneo terminado: ${devices.size} NAS, ${progress.probed}/${progress.total} hosts sondeados`, {
+    found: devices.size,
+    probed: progress.probed,
+    cancelled: scanStatus.cancelled,
+    probeErrors: scanStatus.probeErrors,
+    workerErrors: scanStatus.workerErrors.count
+  });
   
   return Array.from(devices.values());
 }
 
 /**
- * Busca via mDNS/Bonjour
+ * Estado del último escaneo; incluye `profile` si se pidió perfilado
+ */
+function getScanStatus(state = sharedState) {
+  const status = { ...state.status };
+  if (status.progress) {
+    status.progress = {
+      ...status.progress,
+      methods: { ...status.progress.methods },
+      subnets: (status.progress.subnets || []).map((subnet) => ({ ...subnet }))
+    };
+  }
+  if (status.probeErrors) status.probeErrors = { ...status.probeErrors };
+  if (status.workerErrors) status.workerErrors = { ...status.workerErrors, recent: [...status.workerErrors.recent] };
+  return status;
+}
+
+/**
+ * Telemetría de los últimos escaneos terminados (STATS_HISTORY): duración por método
+ * (`backends`) y por fase, tiempos por host (p50, p95, máximo y los más lentos) y sondeos
+ * fallidos por categoría (`errors`) y por motivo (`probeErrors`)
+ */
+function getScanStats(state = sharedState) {
+  return { scans: state.stats.map((scan) => ({ ...scan })) };
+}
+
+/**
+ * Traza del último escaneo que la pidió (ver trace.js); `ip` filtra un host. null si no hay
+ */
+function getScanTrace({ ip = null } = {}, state = sharedState) {
+  return state.trace ? summarizeTrace(state.trace, { ip }) : null;
+}
+
+/**
+ * Dispositivo ya encontrado que es la misma máquina: alguna dirección en común o
+ * la misma MAC (IPv4 por ARP, IPv6 por NDP). El nombre no cuenta: dos NAS recién
+ * instalados anuncian los dos pinas.local
  */
-function scanMDNS() {
+function findSameHost(devices, device, mac) {
+  for (const other of devices.values()) {
+    if (device.addresses.some((ip) => other.addresses.includes(ip))) return other;
+    if (mac && mac === other.mac) return other;
+  }
+  return null;
+}
+
+/**
+ * URL del panel web; el puerto solo aparece si no es el del esquema
+ */
+function deviceUrl(protocol, ip, port) {
+  const portSuffix = port && port !== DEFAULT_PORTS[protocol] ? `:${port}` : '';
+  return `${protocol}://${urlHost(ip)}${portSuffix}`;
+}
+
+/**
+ * Busca via mDNS/Bonjour (DNS-SD)
+ * Escucha _homepinas._tcp y, para NAS anteriores, _https._tcp y _http._tcp
+ */
+function scanMDNS(scan) {
   return new Promise((resolve) => {
-    const devices = [];
     const bonjour = new Bonjour();
     
-    const browser = bonjour.find({ type: 'http' }, (service) => {
-      // Buscar servicios HomePiNAS
-      if (service.name?.toLowerCase().includes('homepinas') || 
-          service.port === NAS_PORT) {
-        const ip = service.addresses?.find(a => a.includes('.')) || service.host;
-        if (ip) {
-          devices.push({
-            ip: ip.replace(/\.local$/, ''),
-            name: service.name || 'HomePiNAS',
-            hostname: service.host || '',
-            method: 'mDNS'
-          });
+    // Un anuncio malformado no debe llegar como excepción al bucle de eventos
+    const browsers = MDNS_SERVICE_TYPES.map((type) => bonjour.find({ type }, (service) => {
+      try {
+        const device = serviceToDevice(service);
+        if (!device) {
+          const ip = (service.addresses || []).find((a) => net.isIPv4(a)) || service.host || null;
+          traceEvent(scan.trace, ip, 'mdns', 'not-homepinas', { service: service.name, type: service.type, port: service.port });
         }
+        scan.report(device);
+      } catch (err) {
+        scan.workerError?.(err, { method: 'mdns' });
       }
-    });
+    }));
     
-    setTimeout(() => {
-      browser.stop();
+    const finish = () => {
+      clearTimeout(timer);
+      scan.signal?.removeEventListener('abort', finish);
+      browsers.forEach((browser) => browser.stop());
       bonjour.destroy();
-      resolve(devices);
-    }, SCAN_TIMEOUT);
+      resolve();
+    };
+    const timer = setTimeout(finish, SCAN_TIMEOUT);
+    scan.signal?.addEventListener('abort', finish, { once: true });
   });
 }
 
 /**
- * Escanea la subnet local en puerto 443
+ * Dispositivo a partir de un anuncio DNS-SD, o null si no es un HomePiNAS
+ * Se reconoce por el tipo _homepinas._tcp, por `product=HomePiNAS` en el TXT
+ * o, como antes, por el nombre del servicio o el puerto 443
  */
-async function scanSubnet() {
-  const devices = [];
-  const localIPs = getLocalIPs();
+function serviceToDevice(service) {
+  const txt = service.txt || {};
+  const isHomePiNAS = service.type === 'homepinas' ||
+    String(txt.product || '').toLowerCase() === 'homepinas' ||
+    service.name?.toLowerCase().includes('homepinas') ||
+    service.port === NAS_PORT;
+  if (!isHomePiNAS) return null;
+  
+  const addresses = (service.addresses || []).filter((a) => net.isIP(a));
+  const ip = addresses.find((a) => net.isIPv4(a)) || addresses[0] || service.host?.replace(/\.local$/, '');
+  if (!ip) return null;
   
-  for (const localIP of localIPs) {
-    const subnet = localIP.split('.').slice(0, 3).join('.');
-    const promises = [];
+  // _homepinas._tcp indica el esquema en el TXT (por defecto HTTPS)
+  const protocol = service.type === 'homepinas'
+    ? (txt.scheme === 'http' ? 'http' : 'https')
+    : service.type;
+  
+  const device = {
+    ip,
+    addresses,
+    name: service.name || 'HomePiNAS',
+    hostname: service.host || '',
+    method: 'mDNS',
+    url: deviceUrl(protocol, ip, service.port)
+  };
+  if (txt.version) device.version = txt.version;
+  if (txt.model) device.model = txt.model;
+  return device;
+}
+
+/**
+ * Beacon UDP: un sondeo por broadcast y multicast al que los HomePiNAS
+ * responden con un JSON firmado (docs/beacon-protocol.md)
+ * La clave pública de cada NAS se fija en el primer contacto, como los certificados
+ */
+function scanBeacon(scan) {
+  return new Promise((resolve) => {
+    const nonce = crypto.randomBytes(16).toString('hex');
+    const probe = createProbe(nonce);
+    const socket = dgram.createSocket({ type: 'udp4', reuseAddr: true });
+    let timer;
+    let done = false;
+    const finish = () => {
+      if (done) return;
+      done = true;
+      clearTimeout(timer);
+      scan.signal?.removeEventListener('abort', finish);
+      socket.close();
+      resolve();
+    };
+    scan.signal?.addEventListener('abort', finish, { once: true });
     
-    // Escanear rango 1-254
-    for (let i = 1; i <= 254; i++) {
-      const ip = `${subnet}.${i}`;
-      promises.push(checkHomePiNAS(ip));
-    }
+    socket.on('message', (packet, rinfo) => {
+      try {
+        scan.report(beaconReplyDevice(packet, rinfo.address, nonce, scan));
+      } catch (err) {
+        scan.workerError?.(err, { method: 'beacon', ip: rinfo.address });
+      }
+    });
+    socket.on('error', (err) => {
+      log.warn(`[Scanner] Beacon UDP no disponible: ${err.message}`);
+      finish();
+    });
     
-    const results = await Promise.allSettled(promises);
-    for (const result of results) {
-      if (result.status === 'fulfilled' && result.value) {
-        devices.push(result.value);
+    socket.bind(0, () => {
+      if (done) return;
+      socket.setBroadcast(true);
+      for (const iface of getLocalInterfaces()) {
+        const mask = iface.prefix === 0 ? 0 : (~0 << (32 - iface.prefix)) >>> 0;
+        const broadcast = intToIpv4((ipv4ToInt(iface.address) | ~mask) >>> 0);
+        socket.send(probe, BEACON_PORT, broadcast);
+        try {
+          socket.setMulticastInterface(iface.address);
+          socket.send(probe, BEACON_PORT, BEACON_GROUP);
+        } catch {
+          // Interfaz sin multicast: basta con el broadcast
+        }
       }
+      
+      timer = setTimeout(finish, BEACON_TIMEOUT);
+    });
+  });
+}
+
+/**
+ * Dispositivo de una respuesta al sondeo `nonce` llegada desde `address`, o null si no es
+ * válida (formato, nonce o firma) o viene de una IP pública sin `allowPublic`. La IP es la
+ * de origen del paquete, nunca la que diga el JSON
+ */
+function beaconReplyDevice(packet, address, nonce, { allowPublic = false, trustStore = null } = {}) {
+  const verified = verifyReply(packet, nonce);
+  if (!verified) return null;
+  if (!allowPublic && !isPrivateAddress(address)) return null;
+  return beaconToDevice(address, verified, trustStore);
+}
+
+/**
+ * Dispositivo a partir de una respuesta de beacon ya verificada
+ */
+function beaconToDevice(ip, { reply, keyFingerprint }, trustStore) {
+  const protocol = reply.scheme === 'http' ? 'http' : 'https';
+  
+  const device = {
+    ip,
+    name: String(reply.name || 'HomePiNAS'),
+    hostname: String(reply.hostname || ''),
+    version: String(reply.version || ''),
+    method: 'beacon',
+    url: deviceUrl(protocol, ip, Number.parseInt(reply.port, 10))
+  };
+  
+  if (trustStore) {
+    device.keyPin = trustStore.check(`beacon:${ip}`, { fingerprint256: keyFingerprint, subject: { CN: device.name } });
+    device.keyFingerprint = keyFingerprint;
+    if (device.keyPin === 'mismatch') {
+      device.keyChanged = true;
+      log.warn(`[Trust] La clave de beacon de ${ip} ha cambiado desde el primer contacto`);
     }
   }
+  return device;
+}
+
+/**
+ * WS-Discovery (UDP 3702): muchos NAS se anuncian así a los equipos Windows
+ * Los que responden se confirman con el sondeo HTTP habitual
+ */
+async function scanWsDiscovery(scan) {
+  const responders = await probeWsDiscovery(getLocalIPs(), { signal: scan.signal });
+  const candidates = [...responders].filter(([ip]) => scan.allowPublic || isPrivateAddress(ip));
+  scan.addTargets?.(candidates.length);
   
-  return devices;
+  await runPool(candidates, scan.concurrency, async ([ip, { xaddrs }]) => {
+    scan.report(await probeHost(ip, hostFromXAddrs(xaddrs), scan));
+  }, scan.signal, (err, [ip]) => scan.workerError?.(err, { method: 'wsd', ip }));
+}
+
+/**
+ * Nombre del equipo si alguna XAddr lo usa en lugar de la IP
+ */
+function hostFromXAddrs(xaddrs) {
+  for (const xaddr of xaddrs) {
+    try {
+      const { hostname } = new URL(xaddr);
+      if (hostname && !net.isIP(hostname.replace(/^\[|\]$/g, ''))) return hostname;
+    } catch {
+      // XAddr no es una URL
+    }
+  }
+  return '';
+}
+
+/**
+ * Escanea la subnet local en puerto 443, con la máscara real de cada interfaz
+ * Las IPs que la tabla ARP marca como inexistentes no se sondean;
+ * si la plataforma no expone la tabla se sondea todo a ciegas
+ *
+ * Las subredes públicas (IPs enrutables asignadas por algunos ISP de fibra)
+ * solo se barren con `allowPublic`.
+ */
+async function scanSubnet(scan) {
+  const interfaces = getLocalInterfaces().filter(({ address }) => {
+    if (scan.allowPublic || isPrivateAddress(address)) return true;
+    log.warn(`[Scanner] Omitiendo subred pública de ${address} (usa --allow-public para barrerla)`);
+    traceEvent(scan.trace, null, 'subnet', 'public-skipped', { address });
+    return false;
+  });
+  
+  await sweepRanges(scan, interfaces, scan.neighbors, scan.liveOnly, scan.isExcluded);
+}
+
+/**
+ * Barre rangos CIDR indicados en la configuración (`targets`), p. ej. la VLAN
+ * de almacenamiento o IoT donde vive el NAS. No hay tabla ARP de otras redes,
+ * así que se barren enteros; lo que ya cubre una subred local se deja a scanSubnet
+ */
+async function scanTargets(scan) {
+  const ranges = scan.targets.filter(({ address, prefix }) => {
+    if (scan.allowPublic || isPrivateAddress(address)) return true;
+    log.warn(`[Scanner] Omitiendo rango público ${address}/${prefix} (usa --allow-public para barrerlo)`);
+    traceEvent(scan.trace, null, 'targets', 'public-skipped', { range: `${address}/${prefix}` });
+    return false;
+  });
+  if (ranges.length === 0) return;
+  
+  const local = getLocalInterfaces().filter(({ address }) => scan.allowPublic || isPrivateAddress(address));
+  const isLocal = (ip) => local.some(({ address, prefix }) => ipv4InRange(ip, address, prefix));
+  
+  await sweepRanges(scan, ranges, null, false, (ip) => scan.isExcluded(ip) || isLocal(ip));
+}
+
+/**
+ * Sondea las IPs de unos rangos ({ address, prefix }), con barrido de ping previo si se pidió
+ */
+async function sweepRanges(scan, ranges, neighbors, liveOnly, isExcluded) {
+  for (const { address, prefix } of ranges) {
+    const hosts = prefix >= 31 ? 2 ** (32 - prefix) : 2 ** (32 - prefix) - 2;
+    if (hosts > MAX_SUBNET_HOSTS) {
+      log.warn(`[Scanner] ${address}/${prefix} tiene ${hosts} hosts; se barren los ${MAX_SUBNET_HOSTS} más cercanos a ${address}`);
+    }
+  }
+  
+  // En redes poco pobladas, un ping a toda la subred evita cientos de conexiones TCP a IPs vacías
+  if (scan.pingSweep && !liveOnly) {
+    const all = [...subnetTargets(ranges, neighbors, scan.priorityRange, isExcluded, false, scan.knownHosts)];
+    const live = await timePhase(scan.profile, 'ping-sweep', () => pingLiveHosts(all, scan.signal));
+    if (live) {
+      neighbors = new Map(neighbors || []);
+      for (const [ip, entry] of live) {
+        neighbors.set(ip, { mac: entry.mac || neighbors.get(ip)?.mac || '', reachable: true });
+      }
+      liveOnly = true;
+    }
+  }
+  
+  const targetsFor = () => subnetTargets(ranges, neighbors, scan.priorityRange, isExcluded, liveOnly, scan.knownHosts);
+  let targets = targetsFor();
+  // Se recorre una vez más solo para contar, sin materializar la lista; cada IP cuenta en el
+  // primer rango que la contiene (el progreso por subred)
+  const rangeOf = (ip) => ranges.findIndex(({ address, prefix }) => ipv4InRange(ip, address, prefix));
+  const counts = ranges.map(() => 0);
+  for (const ip of targetsFor()) counts[rangeOf(ip)]++;
+  const count = counts.reduce((sum, hosts) => sum + hosts, 0);
+  scan.addTargets?.(count);
+  const subnets = ranges.map((range, i) => scan.addSubnet?.(rangeLabel(range), counts[i]));
+  // Solo vivos (ARP, ping o DHCP): un NAS que no contestó a eso no llega a sondearse
+  traceEvent(scan.trace, null, 'sweep', liveOnly ? 'live-only' : 'full', {
+    ranges: ranges.map(({ address, prefix }) => `${address}/${prefix}`),
+    hosts: count
+  });
+  
+  // Sigiloso: orden aleatorio para no parecer un barrido de puertos
+  if (scan.stealth) {
+    targets = shuffle([...targets]);
+  }
+  
+  await runPool(targets, scan.concurrency, async (ip) => {
+    await scan.throttle?.();
+    const device = await probeHost(ip, scan.leases?.get(ip)?.hostname || '', scan);
+    // En sigiloso no se añade tráfico extra por host
+    if (device && !device.hostname && !scan.stealth) await enrichName(device, scan.signal);
+    scan.report(device);
+    const subnet = subnets[rangeOf(ip)];
+    if (subnet) {
+      subnet.probed++;
+      if (device) subnet.found++;
+    }
+  }, scan.signal, (err, ip) => scan.workerError?.(err, { method: 'sweep', ip }));
+}
+
+/**
+ * Hosts vivos según un barrido de ping: ICMP con fping o, sin él, "ping" UDP
+ * Se añaden los vecinos que la tabla ARP marca ahora como vivos: contestan
+ * a ARP aunque filtren ICMP. Devuelve Map ip -> { mac, reachable } o null si
+ * no se encontró ninguno (se barre entonces la subred completa)
+ */
+async function pingLiveHosts(targets, signal) {
+  let live;
+  try {
+    live = await fpingSweep(targets, PING_TIMEOUT, signal);
+  } catch (err) {
+    if (signal?.aborted) return null;
+    log.warn(`[Scanner] fping no disponible (${err.message}); se usa ping UDP`);
+    live = new Set();
+    await runPool(targets, PING_CONCURRENCY, async (ip) => {
+      if (await udpPing(ip, PING_TIMEOUT)) live.add(ip);
+    }, signal);
+  }
+  
+  const wanted = new Set(targets);
+  const hosts = new Map([...live].map((ip) => [ip, { mac: '', reachable: true }]));
+  for (const [ip, entry] of (await readNeighborTable()) || []) {
+    if (entry.reachable && wanted.has(ip)) hosts.set(ip, entry);
+  }
+  return hosts.size > 0 ? hosts : null;
+}
+
+/**
+ * Completa el nombre de un NAS encontrado solo por IP con NetBIOS-NS / LLMNR
+ */
+async function enrichName(device, signal) {
+  const name = await lookupHostName(device.ip, { signal });
+  if (!name) return;
+  device.hostname = name;
+  if (device.name === 'HomePiNAS') device.name = name;
+}
+
+/**
+ * Red de un rango en notación CIDR: 192.168.1.0/24 para una interfaz 192.168.1.37/24
+ */
+function rangeLabel({ address, prefix }) {
+  const mask = prefix === 0 ? 0 : (~0 << (32 - prefix)) >>> 0;
+  return `${intToIpv4((ipv4ToInt(address) & mask) >>> 0)}/${prefix}`;
+}
+
+/**
+ * Mezcla un array en sitio (Fisher-Yates)
+ */
+function shuffle(items) {
+  for (let i = items.length - 1; i > 0; i--) {
+    const j = Math.floor(Math.random() * (i + 1));
+    [items[i], items[j]] = [items[j], items[i]];
+  }
+  return items;
+}
+
+/**
+ * Devuelve una función que espera lo necesario para no superar `perSecond` llamadas/s
+ */
+function createRateLimiter(perSecond) {
+  const interval = 1000 / perSecond;
+  let nextSlot = 0;
+  
+  return () => {
+    const now = Date.now();
+    const wait = Math.max(0, nextSlot - now);
+    nextSlot = Math.max(now, nextSlot) + interval;
+    return new Promise((resolve) => setTimeout(resolve, wait));
+  };
+}
+
+/**
+ * Trozos de como mucho 256 direcciones ([inicio, fin] como enteros) de la subred de una interfaz
+ * Empieza por el de la IP local y se aleja hacia ambos lados hasta `maxHosts`;
+ * sin dirección de red ni de broadcast (salvo en /31, punto a punto; una /32 es un solo host)
+ */
+function subnetBlocks({ address, prefix }, maxHosts = MAX_SUBNET_HOSTS) {
+  if (prefix >= 32) return [[ipv4ToInt(address), ipv4ToInt(address)]];
+  
+  const size = 2 ** (32 - prefix);
+  const own = ipv4ToInt(address);
+  const network = prefix === 0 ? 0 : (own & (~0 << (32 - prefix))) >>> 0;
+  const firstHost = prefix >= 31 ? network : network + 1;
+  const lastHost = prefix >= 31 ? network + size - 1 : network + size - 2;
+  const home = Math.max(network, (own & 0xffffff00) >>> 0);
+  
+  const blocks = [];
+  let hosts = 0;
+  const add = (start) => {
+    if (start < network || start >= network + size || hosts >= maxHosts) return false;
+    const from = Math.max(start, firstHost);
+    const to = Math.min(start + 255, lastHost, from + (maxHosts - hosts) - 1);
+    if (from <= to) {
+      blocks.push([from, to]);
+      hosts += to - from + 1;
+    }
+    return true;
+  };
+  
+  add(home);
+  for (let step = 256; hosts < maxHosts; step += 256) {
+    const above = add(home + step);
+    const below = add(home - step);
+    if (!above && !below) break;
+  }
+  return blocks;
+}
+
+/**
+ * Genera las IPs a sondear bajo demanda, sin materializar la lista completa
+ * Orden: hosts ya vistos, vecinos vivos de la tabla ARP, rango DHCP probable
+ * y después el resto de la subred, para que el NAS típico aparezca en los primeros segundos
+ * La subred sale del prefijo de cada interfaz (/22, /25...) y se recorre por trozos de /24,
+ * del más cercano a la IP local al más lejano (ver subnetBlocks)
+ * Con `liveOnly` (tras un barrido ARP o con las concesiones del router) solo se sondean los vecinos vivos
+ */
+function* subnetTargets(interfaces, neighbors, priorityRange = DEFAULT_PRIORITY_RANGE, isExcluded = () => false,
+  liveOnly = false, knownHosts = sharedState.knownHosts) {
+  const [first, last] = priorityRange;
+  const blocks = interfaces.flatMap((iface) => subnetBlocks(iface));
+  const inSubnet = (ip) => net.isIPv4(ip) && interfaces.some(({ address, prefix }) => ipv4InRange(ip, address, prefix));
+  const seen = new Set();
+  const skip = (ip) => {
+    const entry = neighbors && neighbors.get(ip);
+    return seen.has(ip) || (entry && !entry.reachable) || isExcluded(ip);
+  };
+  
+  for (const ip of knownHosts) {
+    if (inSubnet(ip) && !skip(ip)) {
+      seen.add(ip);
+      yield ip;
+    }
+  }
+  
+  // En redes concurridas la tabla ARP ya contiene casi todos los hosts vivos;
+  // las Raspberry Pi (por la MAC) van primero, son las candidatas más probables
+  for (const piFirst of [true, false]) {
+    for (const [ip, entry] of neighbors || []) {
+      if (isRaspberryPi(entry.mac) !== piFirst) continue;
+      if (entry.reachable && inSubnet(ip) && !skip(ip)) {
+        seen.add(ip);
+        yield ip;
+      }
+    }
+  }
+  
+  if (liveOnly) return;
+  
+  for (const inPriority of [true, false]) {
+    for (const [from, to] of blocks) {
+      for (let value = from; value <= to; value++) {
+        // El rango prioritario se refiere al último octeto
+        const octet = value & 0xff;
+        if ((octet >= first && octet <= last) !== inPriority) continue;
+        
+        const ip = intToIpv4(value);
+        if (skip(ip)) continue;
+        // Interfaces con subredes solapadas no repiten IPs
+        seen.add(ip);
+        yield ip;
+      }
+    }
+  }
+}
+
+// Grupos de runPool en marcha ({ limit, active }): su ocupación sale en /api/debug/runtime
+const activePools = new Set();
+
+/**
+ * Ejecuta `worker` sobre cada elemento con como mucho `limit` en vuelo
+ * Acepta cualquier iterable; los elementos se consumen a medida que hay hueco
+ * Tras abortar `signal` no se empieza ningún elemento más
+ * Si `worker` lanza, `onError(err, item)` lo recibe y el hueco sigue con el siguiente
+ */
+async function runPool(items, limit, worker, signal, onError = () => {}) {
+  const iterator = items[Symbol.iterator]();
+  const pool = { limit, active: 0 };
+  activePools.add(pool);
+  
+  const lanes = Array.from({ length: limit }, async () => {
+    for (let next = iterator.next(); !next.done && !signal?.aborted; next = iterator.next()) {
+      pool.active++;
+      try {
+        await worker(next.value);
+      } catch (err) {
+        // Un sondeo fallido no detiene el resto
+        onError(err, next.value);
+      } finally {
+        pool.active--;
+      }
+    }
+  });
+  
+  try {
+    await Promise.all(lanes);
+  } finally {
+    activePools.delete(pool);
+  }
+}
+
+/**
+ * Ocupación de los grupos de sondeo: { pools, slots (huecos), busy (en vuelo) }
+ * Con el escaneo terminado debe volver a cero; si no, algún sondeo se ha quedado colgado
+ */
+function getPoolStats() {
+  const pools = [...activePools];
+  return {
+    pools: pools.length,
+    slots: pools.reduce((sum, pool) => sum + pool.limit, 0),
+    busy: pools.reduce((sum, pool) => sum + pool.active, 0)
+  };
+}
+
+/**
+ * Rangos "10.0.20.0/24" (o IPs sueltas) de la configuración como { address, prefix }
+ */
+function parseTargets(entries) {
+  const ranges = [];
+  for (const entry of Array.isArray(entries) ? entries : []) {
+    const [address, bits = '32'] = String(entry).trim().split('/');
+    const prefix = Number.parseInt(bits, 10);
+    if (!net.isIPv4(address) || !/^\d{1,2}$/.test(bits) || prefix > 32) {
+      log.warn(`[Scanner] Rango de escaneo no válido: ${entry}`);
+      continue;
+    }
+    ranges.push({ name: 'config', address, prefix });
+  }
+  return ranges;
+}
+
+/**
+ * Esquemas a sondear a partir de la lista de puertos de la configuración
+ * Cada entrada es "https:8443", "http:8080" o un número: los típicos de TLS
+ * (443, 5001, 8443...) van por HTTPS, 80 por HTTP y el resto se prueban con ambos
+ * Sin lista (o sin ninguna entrada válida) se usan 443 y 80
+ */
+function resolveProbeSchemes(ports) {
+  if (!Array.isArray(ports) || ports.length === 0) return PROBE_SCHEMES;
+  
+  const schemes = new Map();
+  for (const entry of ports) {
+    const match = String(entry).trim().toLowerCase().match(/^(?:(https?):)?(\d{1,5})$/);
+    const port = match ? Number.parseInt(match[2], 10) : 0;
+    if (port < 1 || port > 65535) {
+      log.warn(`[Scanner] Puerto de sondeo no válido: ${entry}`);
+      continue;
+    }
+    
+    let protocols = ['https', 'http'];
+    if (match[1]) protocols = [match[1]];
+    else if (TLS_PORTS.has(port)) protocols = ['https'];
+    else if (port === DEFAULT_PORTS.http) protocols = ['http'];
+    for (const protocol of protocols) schemes.set(`${protocol}:${port}`, { protocol, port });
+  }
+  
+  return schemes.size > 0 ? [...schemes.values()] : PROBE_SCHEMES;
+}
+
+/**
+ * Orden de protocolos de la configuración (["http", "https"]); los que no
+ * aparecen no se sondean. Null si no hay orden: todos los esquemas a la vez
+ */
+function resolveSchemeOrder(order, schemes) {
+  if (!Array.isArray(order) || order.length === 0) return null;
+  
+  const protocols = [...new Set(order.map((protocol) => String(protocol).toLowerCase()))]
+    .filter((protocol) => schemes.some((scheme) => scheme.protocol === protocol));
+  if (protocols.length === 0) {
+    log.warn(`[Scanner] schemeOrder no coincide con ningún puerto de sondeo: ${order.join(', ')}`);
+    return null;
+  }
+  return protocols;
+}
+
+/**
+ * Timeout en ms de la configuración, o el valor por defecto si no es válido
+ */
+function resolveTimeout(value, fallback) {
+  const ms = Number.parseInt(value, 10);
+  return Number.isFinite(ms) && ms >= MIN_TIMEOUT ? ms : fallback;
+}
+
+/**
+ * Concurrencia efectiva: la configurada, limitada por RLIMIT_NOFILE
+ * Cada sondeo abre un socket por esquema; se deja margen para el resto del proceso
+ */
+function resolveConcurrency(requested, perHost = PROBE_SCHEMES.length) {
+  let concurrency = Number.parseInt(requested, 10);
+  if (!Number.isFinite(concurrency) || concurrency < 1) {
+    concurrency = DEFAULT_CONCURRENCY;
+  }
+  
+  const fdLimit = getFdLimit();
+  if (fdLimit) {
+    concurrency = Math.min(concurrency, Math.max(1, Math.floor((fdLimit - FD_HEADROOM) / perHost)));
+  }
+  
+  return concurrency;
+}
+
+/**
+ * Límite blando de descriptores abiertos del proceso (null si no aplica)
+ */
+function getFdLimit() {
+  try {
+    if (process.platform === 'linux') {
+      const limits = fs.readFileSync('/proc/self/limits', 'utf8');
+      const match = limits.match(/^Max open files\s+(\S+)/m);
+      if (match && match[1] !== 'unlimited') return Number.parseInt(match[1], 10);
+    } else if (process.platform === 'darwin') {
+      const value = execFileSync('/bin/sh', ['-c', 'ulimit -n'], { encoding: 'utf8' }).trim();
+      if (value !== 'unlimited') return Number.parseInt(value, 10);
+    }
+  } catch {
+    // Sin información: no se limita
+  }
+  return null;
 }
 
 /**
  * Prueba hostnames conocidos
+ * Se sondean todas las direcciones (A y AAAA): un NAS solo IPv6 también cuenta
  */
-async function scanKnownHostnames() {
-  const devices = [];
+async function scanKnownHostnames(scan) {
   const hostnames = ['pinas', 'pinas.local', 'homepinas', 'homepinas.local', 'nas', 'nas.local'];
   
   const promises = hostnames.map(async (hostname) => {
     try {
       const { lookup } = require('dns').promises;
-      const result = await lookup(hostname);
-      return checkHomePiNAS(result.address, hostname);
+      const results = await lookup(hostname, { all: true });
+      scan.addTargets?.(results.length);
+      await Promise.all(results.map(async ({ address }) => {
+        try {
+          scan.report(await probeHost(address, hostname, scan));
+        } catch (err) {
+          scan.workerError?.(err, { method: 'hostnames', ip: address });
+        }
+      }));
     } catch {
-      return null;
+      // Hostname no resuelve
     }
   });
   
-  const results = await Promise.allSettled(promises);
-  for (const result of results) {
-    if (result.status === 'fulfilled' && result.value) {
-      devices.push(result.value);
+  await Promise.allSettled(promises);
+}
+
+/**
+ * Descubrimiento IPv6: ping a ff02::1 (todos los nodos del enlace) en cada interfaz
+ * y sondeo de los vecinos que responden. En IPv6 no hay subred que barrer.
+ */
+async function scanIPv6(scan) {
+  const interfaces = getIPv6Interfaces();
+  if (interfaces.length === 0) return;
+  
+  await Promise.allSettled(interfaces.map((iface) => pingAllNodes(iface, scan.signal)));
+  const neighbors = (await readIPv6Neighbors()) || new Map();
+  scan.addTargets?.(neighbors.size);
+  
+  await runPool(neighbors, scan.concurrency, async ([ip, { mac }]) => {
+    const device = await probeHost(ip, '', scan);
+    if (device && mac) device.mac = mac;
+    scan.report(device);
+  }, scan.signal, (err, [ip]) => scan.workerError?.(err, { method: 'ipv6', ip }));
+}
+
+/**
+ * ping a ff02::1 para poblar la tabla de vecinos IPv6
+ */
+function pingAllNodes(iface, signal) {
+  return new Promise((resolve) => {
+    const [command, args] = process.platform === 'darwin'
+      ? ['ping6', ['-c', '2', '-I', iface, 'ff02::1']]
+      : ['ping', ['-6', '-c', '2', '-w', '3', `ff02::1%${iface}`]];
+    execFile(command, args, { timeout: 5000, signal }, () => resolve());
+  });
+}
+
+/**
+ * Interfaces con IPv6 (no internas); Windows no permite ping a multicast
+ */
+function getIPv6Interfaces() {
+  if (process.platform === 'win32') return [];
+  
+  const interfaces = os.networkInterfaces();
+  return Object.keys(interfaces).filter((name) =>
+    interfaces[name].some((iface) => iface.family === 'IPv6' && !iface.internal));
+}
+
+/**
+ * Sondea los hosts importados (p. ej. de un XML de nmap), aunque estén fuera de la subred local
+ */
+async function scanSeeds(scan) {
+  const seeds = scan.seeds.filter(({ ip }) => scan.allowPublic || isPrivateAddress(ip));
+  scan.addTargets?.(seeds.length);
+  
+  await runPool(seeds, scan.concurrency, async ({ ip, hostname }) => {
+    scan.report(await probeHost(ip, hostname, scan));
+  }, scan.signal, (err, { ip }) => scan.workerError?.(err, { method: 'seeds', ip }));
+}
+
+/**
+ * Sondea una IP saltándose las que ya sabemos vacías
+ * Evita repetir el barrido completo cuando se pulsa "Buscar" varias veces seguidas
+ */
+async function probeHost(ip, hostname = '', scan = {}) {
+  try {
+    if (scan.signal?.aborted) return null;
+    if (scan.isExcluded && scan.isExcluded(ip)) {
+      traceEvent(scan.trace, ip, 'host', 'excluded');
+      return null;
+    }
+    
+    const negativeCache = scan.negativeCache || sharedState.negativeCache;
+    const expires = negativeCache.get(ip);
+    if (expires && expires > Date.now()) {
+      traceEvent(scan.trace, ip, 'host', 'cached-empty', { retryInMs: expires - Date.now() });
+      return null;
+    }
+    if (expires) negativeCache.delete(ip);
+    
+    let device = await timeHost(scan.profile, ip, () => checkHomePiNAS(ip, hostname, scan));
+    if (device && !device.mac && scan.lookupMac) device.mac = await scan.lookupMac(ip);
+    const detected = device;
+    device = applyVendorConfidence(device, scan.minConfidence);
+    if (detected && !device) {
+      traceEvent(scan.trace, ip, 'vendor', 'rejected', {
+        mac: detected.mac, vendor: lookupVendor(detected.mac) || null, confidence: detected.confidence, minConfidence: scan.minConfidence
+      });
+    }
+    if (!scan.signal?.aborted) {
+      traceEvent(scan.trace, ip, 'host', device ? 'homepinas' : 'not-homepinas',
+        device ? { method: device.method, fingerprint: device.fingerprint, confidence: device.confidence } : {});
+    }
+    if (device) {
+      negativeCache.delete(ip);
+    } else if (!scan.signal?.aborted) {
+      // Un sondeo cortado por la cancelación no demuestra que la IP esté vacía
+      negativeCache.set(ip, Date.now() + NEGATIVE_CACHE_TTL);
+    }
+    return device;
+  } finally {
+    scan.probeDone?.();
+  }
+}
+
+/**
+ * Borra de la caché negativa las entradas caducadas
+ */
+function pruneNegativeCache(negativeCache, now = Date.now()) {
+  for (const [ip, expires] of negativeCache) {
+    if (expires <= now) negativeCache.delete(ip);
+  }
+}
+
+/**
+ * HomePiNAS corre en Raspberry Pi: una detección heurística (confianza < 1) en un
+ * equipo cuya MAC es de otro fabricante pierde NON_PI_PENALTY y se descarta si
+ * queda por debajo de `minConfidence`. Sin MAC, o con una aleatoria, no cambia
+ */
+function applyVendorConfidence(device, minConfidence = 0) {
+  if (!device?.mac || isLocalMac(device.mac) || isRaspberryPi(device.mac)) return device;
+  if (device.confidence === undefined || device.confidence >= 1) return device;
+
+  const confidence = Math.round(Math.max(device.confidence - NON_PI_PENALTY, 0) * 100) / 100;
+  return confidence >= minConfidence ? { ...device, confidence } : null;
+}
+
+// Rechazo de un esquema que no encontró nada (Promise.any sigue con los demás)
+const NOT_FOUND = new Error('not found');
+
+/**
+ * Verifica si una IP tiene HomePiNAS corriendo
+ * HTTPS y HTTP se sondean a la vez; el primero que confirma gana y el otro se cancela
+ * Con `scan.schemeOrder` se prueba un protocolo tras otro y solo se pasa al siguiente si el anterior falla
+ * Con SNMP activo se consulta sysName/sysDescr en paralelo
+ * Cancelar el escaneo (`scan.signal`) corta al momento las conexiones en curso
+ */
+async function checkHomePiNAS(ip, hostname = '', scan = {}) {
+  const controller = new AbortController();
+  const cancel = () => controller.abort();
+  scan.signal?.addEventListener('abort', cancel, { once: true });
+  const snmp = scan.snmp ? querySystem(ip, { ...scan.snmp, signal: scan.signal }) : Promise.resolve(null);
+  let device = null;
+  
+  const schemes = scan.schemes || PROBE_SCHEMES;
+  const groups = scan.schemeOrder
+    ? scan.schemeOrder.map((protocol) => schemes.filter((scheme) => scheme.protocol === protocol))
+    : [schemes];
+  
+  try {
+    for (const group of groups) {
+      if (controller.signal.aborted) break;
+      try {
+        device = await Promise.any(group.map(async (scheme) => {
+          const found = await probeScheme(ip, hostname, scheme, controller.signal, scan);
+          if (!found) throw NOT_FOUND;
+          return found;
+        }));
+        break;
+      } catch (err) {
+        device = null;
+        // Una excepción del sondeo (un fallo del código) no es un host vacío: sube a quien lo aísla
+        const failure = err.errors?.find((reason) => reason !== NOT_FOUND);
+        if (failure) throw failure;
+      }
     }
+  } finally {
+    controller.abort();
+    scan.signal?.removeEventListener('abort', cancel);
   }
   
-  return devices;
+  return applySnmp(device, await snmp, ip, hostname, scan.trace);
 }
 
 /**
- * Verifica si una IP tiene HomePiNAS corriendo
+ * Completa un dispositivo con sysName/sysDescr, o lo identifica por SNMP
+ * cuando su panel web no está en los puertos sondeados (sysDescr debe mencionar HomePiNAS)
+ */
+function applySnmp(device, system, ip, hostname, trace = null) {
+  if (!system) return device;
+  if (!device) {
+    const matched = /homepinas/i.test(system.sysDescr);
+    traceEvent(trace, ip, 'snmp', matched ? 'matched' : 'no-match', { sysDescr: String(system.sysDescr).slice(0, 200) });
+    if (!matched) return null;
+    device = { ip, name: system.sysName || hostname || 'HomePiNAS', hostname, version: '', method: 'SNMP' };
+  }
+  if (!device.hostname && system.sysName) device.hostname = system.sysName;
+  if (!device.model && system.sysDescr) device.model = system.sysDescr.slice(0, 200);
+  return device;
+}
+
+/**
+ * Prueba los endpoints conocidos sobre un esquema concreto
+ * Si el puerto no responde no se insiste con el resto de endpoints
+ */
+async function probeScheme(ip, hostname, scheme, signal, scan) {
+  const { profile } = scan;
+  const request = {
+    signal,
+    connectTimeout: scan.connectTimeout,
+    timeout: scan.httpTimeout,
+    localAddress: scan.sourceFor ? scan.sourceFor(ip) : undefined,
+    ca: scan.ca || undefined,
+    clientCert: scheme.protocol === 'https' && scan.clientCertFor ? scan.clientCertFor(ip) : null
+  };
+  
+  const endpoints = scan.stealth ? STEALTH_ENDPOINTS : probeEndpoints();
+  
+  for (const endpoint of endpoints) {
+    const url = `${deviceUrl(scheme.protocol, ip, scheme.port)}${endpoint}`;
+    const onError = (reason) => {
+      scan.probeError?.(reason, scheme.protocol);
+      traceEvent(scan.trace, ip, 'request', classifyProbeError(reason, scheme.protocol), { url, reason });
+    };
+    const res = await timePhase(profile, 'httpProbe', () => httpGet(scheme, ip, endpoint, { ...request, onError }));
+    if (!res) return null;
+    
+    const device = await timePhase(profile, 'fingerprint', () => parseResponse(res, ip, hostname, scan.minConfidence));
+    traceEvent(scan.trace, ip, 'response', device ? 'matched' : 'no-match', {
+      url,
+      status: res.statusCode,
+      ...(device ? { fingerprint: device.fingerprint, confidence: device.confidence } : {})
+    });
+    if (device) {
+      device.url = deviceUrl(scheme.protocol, ip, scheme.port);
+      if (res.cert) {
+        device.certificate = describeCertificate(res.cert);
+        if (device.certificate.expiringSoon) {
+          const { daysLeft } = device.certificate;
+          log.warn(`[Trust] El certificado de ${ip} ${daysLeft < 0 ? 'ha caducado' : `caduca en ${daysLeft} días`}`);
+        }
+      }
+      if (res.cert && scan.trustStore) {
+        pinCertificate(device, res.cert, scan.trustStore);
+      }
+      if (scan.ca) {
+        // Sin firma de la CA (o por HTTP) se muestra, pero como no verificado
+        device.verified = res.authorized === true;
+      }
+      return device;
+    }
+  }
+  
+  return null;
+}
+
+/**
+ * Comprueba el certificado contra el almacén TOFU y marca el dispositivo
+ * Los NAS usan certificados autofirmados: en vez de validar la cadena se fija
+ * el primero que se ve y se avisa si cambia (posible MITM en la LAN)
+ */
+function pinCertificate(device, cert, trustStore) {
+  device.tls = trustStore.check(device.ip, cert);
+  device.certFingerprint = cert.fingerprint256;
+  if (device.tls === 'mismatch') {
+    device.certChanged = true;
+    device.pinnedFingerprint = trustStore.get(device.ip).fingerprint256;
+    log.warn(`[Trust] El certificado de ${device.ip} ha cambiado desde el primer contacto`);
+  }
+}
+
+/**
+ * Interpreta la respuesta de un endpoint de HomePiNAS con los detectores de fingerprints.js
+ */
+function parseResponse(res, ip, hostname, minConfidence = 0) {
+  const match = matchFingerprint(res, minConfidence);
+  if (!match) return null;
+  
+  const info = match.json || {};
+  const certName = res.cert?.subject?.CN || '';
+  
+  return {
+    ip,
+    name: info.hostname || info.name || hostname || certName || 'HomePiNAS',
+    hostname: hostname || info.hostname || certName,
+    version: info.version || '',
+    method: 'HTTP',
+    fingerprint: match.name,
+    confidence: match.confidence
+  };
+}
+
+/**
+ * Petición HTTP(S) con timeout y cancelación; devuelve null si no hay respuesta
+ * `method`, `headers` y `body` (objeto, se envía como JSON) para las llamadas a la API del NAS
+ * `localAddress` fija la IP de origen en equipos con varias interfaces
+ * Los NAS usan certificados autofirmados: la conexión no se rechaza por la
+ * cadena; el certificado se devuelve para fijarlo con pinCertificate() y
+ * `authorized` indica si lo firma la CA indicada en `ca`
+ * `clientCert` ({ cert, key, passphrase }) se presenta a los NAS que exigen mTLS
+ * `connectTimeout` limita el establecimiento de la conexión y `timeout` cada espera posterior
+ * `onError(motivo)` recibe el código de cada fallo (no los cortes por `signal`)
+ * `pin` (huella SHA-256) solo envía la petición si el certificado es el fijado
  */
-function checkHomePiNAS(ip, hostname = '') {
+function httpRequest(scheme, ip, path, {
+  method = 'GET', headers = {}, body, signal, localAddress, ca, clientCert, pin,
+  connectTimeout = CONNECT_TIMEOUT, timeout = HTTP_TIMEOUT, onError
+} = {}) {
+  const payload = body === undefined ? null : JSON.stringify(body);
   return new Promise((resolve) => {
+    // Un destroy() tras el timeout también emite 'error': solo cuenta el primer fallo
+    let settled = false;
+    const fail = (reason) => {
+      if (settled) return;
+      settled = true;
+      if (onError && !signal?.aborted) onError(reason);
+      resolve(null);
+    };
+    const client = scheme.protocol === 'https' ? https : http;
     const options = {
       hostname: ip,
-      port: NAS_PORT,
-      path: '/api/system/info',
-      method: 'GET',
-      timeout: 1500
+      port: scheme.port,
+      path,
+      method,
+      headers: payload === null
+        ? headers
+        : { ...headers, 'Content-Type': 'application/json', 'Content-Length': Buffer.byteLength(payload) },
+      timeout,
+      signal,
+      localAddress,
+      ca,
+      rejectUnauthorized: false,
+      ...(pin && scheme.protocol === 'https' ? { agent: pinnedAgent(pin) } : {}),
+      ...(clientCert || {})
     };
     
-    const req = http.request(options, (res) => {
+    const req = client.request(options, (res) => {
+      const cert = scheme.protocol === 'https' ? res.socket.getPeerCertificate() : null;
+      const authorized = Boolean(res.socket.authorized);
       let data = '';
-      res.on('data', chunk => data += chunk);
+      res.setEncoding('utf8');
+      res.on('data', (chunk) => {
+        data += chunk;
+        if (data.length > MAX_RESPONSE_SIZE) req.destroy();
+      });
       res.on('end', () => {
-        try {
-          const info = JSON.parse(data);
-          if (info.product === 'HomePiNAS' || info.hostname) {
-            resolve({
-              ip,
-              name: info.hostname || info.name || 'HomePiNAS',
-              hostname: hostname || info.hostname || '',
-              version: info.version || '',
-              method: 'HTTP'
-            });
-          } else {
-            resolve(null);
-          }
-        } catch {
-          // Si el puerto responde pero no es JSON válido, podría ser HomePiNAS
-          if (res.statusCode === 200 || res.statusCode === 401) {
-            resolve({
-              ip,
-              name: hostname || 'HomePiNAS',
-              hostname: hostname || '',
-              method: 'HTTP'
-            });
-          } else {
-            resolve(null);
-          }
-        }
+        settled = true;
+        resolve({
+          statusCode: res.statusCode,
+          headers: res.headers,
+          body: data,
+          cert: cert && cert.subject ? cert : null,
+          authorized
+        });
       });
+      res.on('error', (err) => fail(err.code || 'error'));
     });
     
-    req.on('error', () => resolve(null));
+    req.on('error', (err) => fail(err.code || 'error'));
     req.on('timeout', () => {
       req.destroy();
-      resolve(null);
+      fail('timeout');
+    });
+    req.on('socket', (socket) => {
+      if (!socket.connecting) return;
+      const timer = setTimeout(() => {
+        req.destroy();
+        fail('connect-timeout');
+      }, connectTimeout);
+      socket.once('connect', () => clearTimeout(timer));
+      socket.once('close', () => clearTimeout(timer));
     });
     
-    req.end();
+    req.end(payload ?? undefined);
   });
 }
 
+function httpGet(scheme, ip, path, options = {}) {
+  return httpRequest(scheme, ip, path, { ...options, method: 'GET' });
+}
+
+/**
+ * Agente cuyas conexiones TLS solo se entregan a la petición si el certificado tiene
+ * la huella `pin`: las cabeceras (un token, por ejemplo) no llegan a salir hacia un impostor
+ */
+function pinnedAgent(pin) {
+  const agent = new https.Agent();
+  agent.createConnection = (options, callback) => {
+    const socket = tls.connect(options);
+    socket.once('timeout', () => socket.destroy(Object.assign(new Error('timeout'), { code: 'timeout' })));
+    socket.once('error', callback);
+    socket.once('secureConnect', () => {
+      socket.removeListener('error', callback);
+      if (socket.getPeerCertificate().fingerprint256 === pin) {
+        callback(null, socket);
+        return;
+      }
+      socket.destroy();
+      callback(Object.assign(new Error('El certificado no es el fijado'), { code: 'CERT_PIN_MISMATCH' }));
+    });
+  };
+  return agent;
+}
+
 /**
  * Obtiene las IPs locales del sistema
  */
 function getLocalIPs() {
-  const ips = [];
+  return getLocalInterfaces().map((iface) => iface.address);
+}
+
+/**
+ * Interfaces IPv4 externas con su prefijo de red
+ */
+function getLocalInterfaces() {
+  const result = [];
   const interfaces = os.networkInterfaces();
   
   for (const name of Object.keys(interfaces)) {
     for (const iface of interfaces[name]) {
       if (iface.family === 'IPv4' && !iface.internal) {
-        ips.push(iface.address);
+        const prefix = Number.parseInt((iface.cidr || '').split('/')[1], 10);
+        result.push({ name, address: iface.address, prefix: Number.isFinite(prefix) ? prefix : 24 });
       }
     }
   }
   
-  return ips;
+  return result;
+}
+
+/**
+ * Devuelve una función async ip -> MAC ('' si no se sabe)
+ * Un host que acaba de responder por TCP ya está en la caché ARP (o NDP), aunque no
+ * estuviera en la tabla leída al empezar; fuera de las subredes locales solo se ve
+ * la MAC del router, así que no se busca. Las lecturas simultáneas se comparten
+ */
+function createMacLookup(interfaces) {
+  const reads = { v4: null, v6: null };
+  const read = (family) => {
+    if (!reads[family]) {
+      const reader = family === 'v4' ? readNeighborTable : readIPv6Neighbors;
+      reads[family] = reader().finally(() => { reads[family] = null; });
+    }
+    return reads[family];
+  };
+
+  return async (ip) => {
+    if (net.isIPv4(ip) && !interfaces.some(({ address, prefix }) => ipv4InRange(ip, address, prefix))) return '';
+    const table = await read(net.isIPv4(ip) ? 'v4' : 'v6');
+    return table?.get(ip)?.mac || '';
+  };
+}
+
+/**
+ * Devuelve una función ip -> IP local de la interfaz cuya subred la contiene
+ * Así un equipo multi-homed no enruta los sondeos por la puerta de enlace por defecto;
+ * para destinos fuera de cualquier subred local se deja decidir al sistema
+ */
+function createSourceResolver(interfaces) {
+  // Los prefijos más largos primero: la subred más específica gana
+  const sorted = [...interfaces].sort((a, b) => b.prefix - a.prefix);
+  
+  return (ip) => {
+    if (!net.isIPv4(ip)) return undefined;
+    const iface = sorted.find((candidate) => ipv4InRange(ip, candidate.address, candidate.prefix));
+    return iface ? iface.address : undefined;
+  };
 }
 
-module.exports = { scanNetwork };
+module.exports = {
+  scanNetwork, getScanStatus, getScanStats, getScanTrace, getPoolStats, getFdLimit, createScanState, resolveProbeSchemes,
+  getLocalInterfaces, applyVendorConfidence, httpGet, httpRequest, deviceUrl, beaconReplyDevice, METHOD_NAMES: Object.keys(METHODS)
+};
@@ -0,0 +1,204 @@
+const crypto = require('crypto');
+const { execFileSync } = require('child_process');
+const fs = require('fs');
+const path = require('path');
+const log = require('./log');
+const { getConfigDir, loadConfig } = require('./config');
+const { openKeyring } = require('./keyring');
+
+const SECRETS_FILE = 'secrets.enc.json';
+const KEY_FILE = 'secret.key';
+const ALGORITHM = 'aes-256-gcm';
+
+/**
+ * Secreto de la máquina para derivar la clave cuando no hay frase de paso
+ * Linux: /etc/machine-id · macOS: IOPlatformUUID · Windows: MachineGuid
+ */
+function getMachineSecret() {
+  try {
+    if (process.platform === 'linux') {
+      return fs.readFileSync('/etc/machine-id', 'utf8').trim() || null;
+    }
+    if (process.platform === 'darwin') {
+      const out = execFileSync('ioreg', ['-rd1', '-c', 'IOPlatformExpertDevice'], { encoding: 'utf8' });
+      return out.match(/"IOPlatformUUID" = "([^"]+)"/)?.[1] || null;
+    }
+    if (process.platform === 'win32') {
+      const out = execFileSync('reg', ['query', 'HKLM\\SOFTWARE\\Microsoft\\Cryptography', '/v', 'MachineGuid'], { encoding: 'utf8' });
+      return out.match(/MachineGuid\s+REG_SZ\s+(\S+)/)?.[1] || null;
+    }
+  } catch {
+    // Sin identificador de máquina
+  }
+  return null;
+}
+
+/**
+ * Material para la clave: HOMEPINAS_FINDER_PASSPHRASE, el secreto de la máquina
+ * o, como último recurso, una clave aleatoria guardada con permisos 0600
+ */
+function getKeyMaterial(dir) {
+  if (process.env.HOMEPINAS_FINDER_PASSPHRASE) {
+    return process.env.HOMEPINAS_FINDER_PASSPHRASE;
+  }
+
+  const machineSecret = getMachineSecret();
+  if (machineSecret) return machineSecret;
+
+  const keyFile = path.join(dir, KEY_FILE);
+  try {
+    return fs.readFileSync(keyFile, 'utf8').trim();
+  } catch {
+    const key = crypto.randomBytes(32).toString('hex');
+    fs.mkdirSync(dir, { recursive: true });
+    fs.writeFileSync(keyFile, key, { mode: 0o600 });
+    log.warn(`[Secrets] Sin frase de paso ni identificador de máquina; clave generada en ${keyFile}`);
+    return key;
+  }
+}
+
+function encrypt(key, plaintext) {
+  const iv = crypto.randomBytes(12);
+  const cipher = crypto.createCipheriv(ALGORITHM, key, iv);
+  const data = Buffer.concat([cipher.update(plaintext, 'utf8'), cipher.final()]);
+  return {
+    iv: iv.toString('base64'),
+    tag: cipher.getAuthTag().toString('base64'),
+    data: data.toString('base64')
+  };
+}
+
+function decrypt(key, entry) {
+  const decipher = crypto.createDecipheriv(ALGORITHM, key, Buffer.from(entry.iv, 'base64'));
+  decipher.setAuthTag(Buffer.from(entry.tag, 'base64'));
+  return Buffer.concat([
+    decipher.update(Buffer.from(entry.data, 'base64')),
+    decipher.final()
+  ]).toString('utf8');
+}
+
+/**
+ * Fichero cifrado (AES-256-GCM): cada valor se cifra por separado con una clave
+ * derivada con scrypt, que solo se calcula la primera vez que hace falta
+ */
+function openEncryptedFile(dir) {
+  const file = path.join(dir, SECRETS_FILE);
+  let store = { salt: crypto.randomBytes(16).toString('base64'), entries: {} };
+
+  try {
+    store = JSON.parse(fs.readFileSync(file, 'utf8'));
+  } catch (err) {
+    if (err.code !== 'ENOENT') {
+      log.warn(`[Secrets] No se pudo leer ${file}: ${err.message}`);
+    }
+  }
+
+  let key = null;
+  const getKey = () => {
+    key = key || crypto.scryptSync(getKeyMaterial(dir), Buffer.from(store.salt, 'base64'), 32);
+    return key;
+  };
+
+  const save = () => {
+    fs.mkdirSync(dir, { recursive: true });
+    // Escritura atómica: un cierre a medias no deja los secretos corruptos
+    const tmp = `${file}.tmp`;
+    fs.writeFileSync(tmp, JSON.stringify(store, null, 2), { mode: 0o600 });
+    fs.renameSync(tmp, file);
+  };
+
+  return {
+    backend: 'file',
+
+    /**
+     * Valor en claro o null si no existe o no se puede descifrar
+     * (p. ej. la frase de paso ha cambiado)
+     */
+    get(name) {
+      const entry = store.entries[name];
+      if (!entry) return null;
+      try {
+        return decrypt(getKey(), entry);
+      } catch {
+        log.warn(`[Secrets] No se pudo descifrar ${name}`);
+        return null;
+      }
+    },
+
+    set(name, value) {
+      store.entries[name] = encrypt(getKey(), String(value));
+      save();
+    },
+
+    delete(name) {
+      if (!(name in store.entries)) return;
+      delete store.entries[name];
+      save();
+    }
+  };
+}
+
+/**
+ * Almacén de tokens y credenciales (tokens de los NAS emparejados, credenciales SSH,
+ * contraseñas de integraciones): el llavero del sistema si lo hay y, si no, un
+ * fichero cifrado. `backend` ('auto', 'keyring' o 'file'; por defecto `secretStore`
+ * de config.json) fuerza uno de los dos
+ * Los secretos que quedaran en el fichero pasan al llavero la primera vez que se leen
+ */
+function openSecretStore(dir = getConfigDir(), { backend = loadConfig().secretStore } = {}) {
+  const file = openEncryptedFile(dir);
+  const keyring = backend === 'file' ? null : openKeyring(dir);
+  if (!keyring) {
+    if (backend === 'keyring') throw new Error('No hay llavero del sistema disponible');
+    return file;
+  }
+
+  return {
+    backend: keyring.backend,
+
+    get(name) {
+      let value;
+      try {
+        value = keyring.get(name);
+      } catch (err) {
+        log.warn(`[Secrets] No se pudo leer ${name} del llavero (${keyring.backend}): ${err.message}`);
+        return file.get(name);
+      }
+      if (value !== null) return value;
+
+      const legacy = file.get(name);
+      if (legacy === null) return null;
+      try {
+        keyring.set(name, legacy);
+        file.delete(name);
+        log.warn(`[Secrets] ${name} trasladado del fichero cifrado al llavero (${keyring.backend})`);
+      } catch (err) {
+        log.warn(`[Secrets] No se pudo trasladar ${name} al llavero: ${err.message}`);
+      }
+      return legacy;
+    },
+
+    set(name, value) {
+      try {
+        keyring.set(name, value);
+      } catch (err) {
+        // Llavero bloqueado o sin servicio: mejor cifrado en fichero que perder el secreto
+        log.warn(`[Secrets] No se pudo guardar ${name} en el llavero, se usa el fichero cifrado: ${err.message}`);
+        file.set(name, value);
+        return;
+      }
+      file.delete(name);
+    },
+
+    delete(name) {
+      try {
+        keyring.delete(name);
+      } catch (err) {
+        log.warn(`[Secrets] No se pudo borrar ${name} del llavero: ${err.message}`);
+      }
+      file.delete(name);
+    }
+  };
+}
+
+module.exports = { openSecretStore, getKeyMaterial, encrypt, decrypt };
@@ -0,0 +1,369 @@
+/**
+ * El Finder como servicio del sistema: `watch` arrancado solo y reiniciado si cae.
+ * En Linux, una unidad de usuario de systemd; en macOS, un LaunchAgent; en Windows, un
+ * servicio del administrador de servicios (SCM) que arranca con el equipo, a través de un
+ * envoltorio compilado al instalar (node no habla el protocolo del SCM), y que escribe los
+ * eventos en el registro de eventos
+ */
+const fs = require('fs');
+const os = require('os');
+const path = require('path');
+const { execFile } = require('child_process');
+const { getConfigDir, loadConfig } = require('./config');
+const { DEFAULT_SOURCE, registerEventSource } = require('./eventlog');
+
+const SERVICE_NAME = 'homepinas-finder';
+const DISPLAY_NAME = 'HomePiNAS Finder';
+const LAUNCHD_LABEL = 'com.homelabs.homepinas-finder';
+const CLI_PATH = path.join(__dirname, 'cli.js');
+// Variables que el servicio hereda de quien lo instala (misma configuración)
+const INHERITED_ENV = ['HOMEPINAS_FINDER_HOME'];
+
+function run(command, args) {
+  return new Promise((resolve, reject) => {
+    execFile(command, args, { timeout: 30000, windowsHide: true }, (err, stdout, stderr) => {
+      if (err && err.code === 'ENOENT') {
+        reject(new Error(`No se encuentra ${command}`));
+      } else {
+        resolve({ code: err ? (typeof err.code === 'number' ? err.code : 1) : 0, stdout, stderr });
+      }
+    });
+  });
+}
+
+async function runChecked(command, args) {
+  const result = await run(command, args);
+  if (result.code !== 0) {
+    throw new Error(`${command} ${args.join(' ')}: ${(result.stderr || result.stdout).trim() || `código ${result.code}`}`);
+  }
+  return result;
+}
+
+/**
+ * Lo que ejecuta el servicio: { program, args, env }; `extraArgs` son opciones de watch
+ */
+function serviceCommand(extraArgs = []) {
+  const env = Object.fromEntries(INHERITED_ENV.filter((name) => process.env[name]).map((name) => [name, process.env[name]]));
+  return { program: process.execPath, args: [CLI_PATH, 'watch', ...extraArgs], env };
+}
+
+// Comillas de systemd: % y $ también se expanden dentro de ellas
+function systemdQuote(value) {
+  const escaped = value.replace(/\\/g, '\\\\').replace(/"/g, '\\"').replace(/%/g, '%%').replace(/\$/g, '$$$$');
+  return /[\s"'\\]/.test(value) || value === '' ? `"${escaped}"` : escaped;
+}
+
+const systemd = {
+  unitFile: () => path.join(process.env.XDG_CONFIG_HOME || path.join(os.homedir(), '.config'), 'systemd', 'user', `${SERVICE_NAME}.service`),
+
+  renderUnit({ program, args, env }) {
+    return [
+      '[Unit]',
+      'Description=HomePiNAS Finder (watch)',
+      '',
+      '[Service]',
+      'Type=simple',
+      `ExecStart=${[program, ...args].map(systemdQuote).join(' ')}`,
+      ...Object.entries(env).map(([name, value]) => `Environment=${systemdQuote(`${name}=${value}`)}`),
+      'Restart=on-failure',
+      'RestartSec=10',
+      '',
+      '[Install]',
+      'WantedBy=default.target',
+      ''
+    ].join('\n');
+  },
+
+  async install(command) {
+    const file = systemd.unitFile();
+    fs.mkdirSync(path.dirname(file), { recursive: true });
+    fs.writeFileSync(file, systemd.renderUnit(command));
+    await runChecked('systemctl', ['--user', 'daemon-reload']);
+    await runChecked('systemctl', ['--user', 'enable', '--now', `${SERVICE_NAME}.service`]);
+    return {
+      location: file,
+      // Sin "linger" el servicio de usuario solo corre mientras haya una sesión abierta
+      hint: `Para que arranque sin iniciar sesión: loginctl enable-linger ${os.userInfo().username}`
+    };
+  },
+
+  async uninstall() {
+    const file = systemd.unitFile();
+    if (!fs.existsSync(file)) return false;
+    await run('systemctl', ['--user', 'disable', '--now', `${SERVICE_NAME}.service`]);
+    fs.rmSync(file, { force: true });
+    await runChecked('systemctl', ['--user', 'daemon-reload']);
+    return true;
+  },
+
+  async status() {
+    const file = systemd.unitFile();
+    if (!fs.existsSync(file)) return { installed: false, location: file };
+    const enabled = await run('systemctl', ['--user', 'is-enabled', `${SERVICE_NAME}.service`]);
+    const active = await run('systemctl', ['--user', 'is-active', `${SERVICE_NAME}.service`]);
+    return {
+      installed: true,
+      location: file,
+      enabled: enabled.code === 0,
+      running: active.code === 0,
+      detail: active.stdout.trim()
+    };
+  }
+};
+
+/**
+ * PowerShell con el script en -EncodedCommand: sin problemas de comillas en la línea de órdenes
+ */
+async function powershell(script) {
+  const encoded = Buffer.from(`$ErrorActionPreference = 'Stop'\n${script}`, 'utf16le').toString('base64');
+  const result = await run('powershell.exe', ['-NoProfile', '-NonInteractive', '-EncodedCommand', encoded]);
+  if (result.code !== 0) throw new Error((result.stderr || result.stdout).trim() || `PowerShell: código ${result.code}`);
+  return result.stdout.trim();
+}
+
+const psQuote = (value) => `'${value.replace(/'/g, "''")}'`;
+const csQuote = (value) => `@"${value.replace(/"/g, '""')}"`;
+
+// Una línea de órdenes de Windows a partir de argumentos (reglas de CommandLineToArgvW)
+function windowsQuote(arg) {
+  if (arg !== '' && !/[\s"]/.test(arg)) return arg;
+  return `"${arg.replace(/(\\*)"/g, '$1$1\\"').replace(/(\\+)$/, '$1$1')}"`;
+}
+
+async function requireAdmin() {
+  const admin = await powershell('([Security.Principal.WindowsPrincipal][Security.Principal.WindowsIdentity]::GetCurrent())' +
+    '.IsInRole([Security.Principal.WindowsBuiltInRole]::Administrator)');
+  if (admin !== 'True') throw new Error('El servicio de Windows se instala y desinstala desde una consola de administrador');
+}
+
+const windows = {
+  location: `Servicio de Windows: ${SERVICE_NAME} (${DISPLAY_NAME})`,
+  // Fuera del perfil del usuario: lo ejecuta LocalSystem y solo los administradores pueden cambiarlo
+  hostDir: () => path.join(process.env.ProgramData || 'C:\\ProgramData', DISPLAY_NAME, 'service'),
+  hostExe: () => path.join(windows.hostDir(), 'FinderService.exe'),
+
+  /**
+   * Envoltorio en C# (se compila al instalar con el compilador de .NET Framework que trae
+   * Windows): habla con el administrador de servicios, arranca node sin ventana y, al parar,
+   * lo cierra con sus hijos. Si node termina solo, el envoltorio sale con error y el SCM
+   * lo reinicia (sc failure)
+   */
+  renderHost({ program, args, env }) {
+    return [
+      'using System;',
+      'using System.Diagnostics;',
+      'using System.ServiceProcess;',
+      '',
+      'public class FinderService : ServiceBase {',
+      `  const string Program = ${csQuote(program)};`,
+      `  const string Arguments = ${csQuote(args.map(windowsQuote).join(' '))};`,
+      '  static readonly string[][] Variables = {',
+      ...Object.entries(env).map(([name, value]) => `    new[] { ${csQuote(name)}, ${csQuote(value)} },`),
+      '  };',
+      '  Process child;',
+      '  volatile bool stopping;',
+      '',
+      `  public FinderService() { ServiceName = ${csQuote(SERVICE_NAME)}; CanStop = true; CanShutdown = true; }`,
+      '',
+      '  protected override void OnStart(string[] args) {',
+      '    var info = new ProcessStartInfo(Program, Arguments) { UseShellExecute = false, CreateNoWindow = true };',
+      '    foreach (var pair in Variables) info.EnvironmentVariables[pair[0]] = pair[1];',
+      '    child = new Process { StartInfo = info, EnableRaisingEvents = true };',
+      '    child.Exited += (sender, e) => { if (!stopping) Environment.Exit(1); };',
+      '    child.Start();',
+      '  }',
+      '',
+      '  protected override void OnStop() { Terminate(); }',
+      '  protected override void OnShutdown() { Terminate(); }',
+      '',
+      '  void Terminate() {',
+      '    stopping = true;',
+      '    if (child == null || child.HasExited) return;',
+      '    var kill = Process.Start(new ProcessStartInfo("taskkill.exe", "/T /F /PID " + child.Id) { UseShellExecute = false, CreateNoWindow = true });',
+      '    kill.WaitForExit(10000);',
+      '  }',
+      '',
+      '  public static void Main() { ServiceBase.Run(new FinderService()); }',
+      '}',
+      ''
+    ].join('\r\n');
+  },
+
+  /**
+   * Estado en el SCM ({ status, startType }, en inglés sea cual sea el idioma) o null si no existe
+   */
+  async query() {
+    const state = await powershell(`$service = Get-Service -Name ${psQuote(SERVICE_NAME)} -ErrorAction SilentlyContinue\n` +
+      'if ($service) { "$($service.Status) $($service.StartType)" }');
+    if (!state) return null;
+    const [status, startType] = state.split(' ');
+    return { status, startType };
+  },
+
+  async remove() {
+    // Parar espera a que el envoltorio cierre node: hasta entonces no se puede borrar el .exe
+    await powershell([
+      `Stop-Service -Name ${psQuote(SERVICE_NAME)} -Force -ErrorAction SilentlyContinue`,
+      `(Get-Service -Name ${psQuote(SERVICE_NAME)}).WaitForStatus('Stopped', '00:00:30')`
+    ].join('\n'));
+    await runChecked('sc.exe', ['delete', SERVICE_NAME]);
+  },
+
+  /**
+   * Las versiones anteriores instalaban una tarea programada al iniciar sesión; true si había una
+   */
+  async removeLegacyTask() {
+    const found = await powershell(`if (Get-ScheduledTask -TaskName ${psQuote(DISPLAY_NAME)} -ErrorAction SilentlyContinue) { 'yes' }`);
+    if (found !== 'yes') return false;
+    // Parar la tarea solo cierra el lanzador: node se busca por la ruta del CLI
+    await powershell([
+      `Stop-ScheduledTask -TaskName ${psQuote(DISPLAY_NAME)}`,
+      `Unregister-ScheduledTask -TaskName ${psQuote(DISPLAY_NAME)} -Confirm:$false`,
+      "Get-CimInstance Win32_Process -Filter \"Name = 'node.exe'\" |",
+      `  Where-Object { $_.CommandLine -like ${psQuote(`*${CLI_PATH}* watch*`)} } |`,
+      '  ForEach-Object { Stop-Process -Id $_.ProcessId -Force }'
+    ].join('\n'));
+    fs.rmSync(path.join(getConfigDir(), 'service.vbs'), { force: true });
+    return true;
+  },
+
+  async install(command) {
+    await requireAdmin();
+    // Los eventos van al registro de eventos: sin consola no los vería nadie
+    const withEventLog = command.args.includes('--event-log') ? command : { ...command, args: [...command.args, '--event-log'] };
+    await windows.removeLegacyTask();
+    if (await windows.query()) await windows.remove();
+
+    const dir = windows.hostDir();
+    fs.mkdirSync(dir, { recursive: true });
+    // Sin herencia: Administradores y SYSTEM controlan el directorio, Usuarios solo leen (SID: vale en cualquier idioma)
+    await runChecked('icacls', [dir, '/inheritance:r', '/grant:r',
+      '*S-1-5-32-544:(OI)(CI)F', '*S-1-5-18:(OI)(CI)F', '*S-1-5-32-545:(OI)(CI)RX']);
+    const source = path.join(dir, 'FinderService.cs');
+    // LocalSystem tiene otro perfil: se fija el directorio de configuración de quien instala
+    fs.writeFileSync(source, windows.renderHost({ ...withEventLog, env: { HOMEPINAS_FINDER_HOME: getConfigDir(), ...withEventLog.env } }));
+    await powershell(`Add-Type -Path ${psQuote(source)} -ReferencedAssemblies System.ServiceProcess ` +
+      `-OutputAssembly ${psQuote(windows.hostExe())} -OutputType ConsoleApplication`);
+
+    // Arranque automático retrasado (con la red ya levantada) y reinicio al minuto si cae
+    await runChecked('sc.exe', ['create', SERVICE_NAME, 'binPath=', `"${windows.hostExe()}"`,
+      'start=', 'delayed-auto', 'DisplayName=', DISPLAY_NAME]);
+    await runChecked('sc.exe', ['description', SERVICE_NAME, 'Vigila la red y avisa de los NAS HomePiNAS (homepinas-finder watch)']);
+    await runChecked('sc.exe', ['failure', SERVICE_NAME, 'reset=', '86400', 'actions=', 'restart/60000/restart/60000/restart/60000']);
+    await runChecked('sc.exe', ['start', SERVICE_NAME]);
+
+    await registerEventSource(loadConfig().eventLog?.source || DEFAULT_SOURCE);
+    // DPAPI cifra con la cuenta del usuario: LocalSystem no puede leer esos secretos
+    return {
+      location: windows.location,
+      hint: 'Corre como LocalSystem: para los secretos guardados con DPAPI (emparejamientos, notificaciones) ' +
+        'cambia la cuenta en services.msc (Iniciar sesión) o usa HOMEPINAS_FINDER_PASSPHRASE'
+    };
+  },
+
+  async uninstall() {
+    const legacy = await windows.removeLegacyTask();
+    if (!(await windows.query())) return legacy;
+    await requireAdmin();
+    await windows.remove();
+    fs.rmSync(windows.hostDir(), { recursive: true, force: true });
+    return true;
+  },
+
+  async status() {
+    const service = await windows.query();
+    if (!service) return { installed: false, location: windows.location };
+    return {
+      installed: true,
+      location: windows.location,
+      enabled: service.startType !== 'Disabled',
+      running: service.status === 'Running',
+      detail: `${service.status} (${service.startType})`
+    };
+  }
+};
+
+const xmlEscape = (value) => String(value).replace(/&/g, '&amp;').replace(/</g, '&lt;').replace(/>/g, '&gt;');
+
+// Home real del usuario: dentro del sandbox de macOS $HOME apunta al contenedor de la app,
+// y launchd busca los agentes en ~/Library/LaunchAgents del usuario
+const realHome = () => os.userInfo().homedir;
+
+const launchd = {
+  plistFile: () => path.join(realHome(), 'Library', 'LaunchAgents', `${LAUNCHD_LABEL}.plist`),
+  logFile: () => path.join(realHome(), 'Library', 'Logs', 'HomePiNAS Finder', 'watch.log'),
+  domain: () => `gui/${os.userInfo().uid}`,
+
+  renderPlist({ program, args, env }) {
+    const string = (value) => `<string>${xmlEscape(value)}</string>`;
+    // launchd arranca con un PATH mínimo: sin él no se encuentran arp-scan, fping o nmap
+    const environment = { PATH: process.env.PATH || '/usr/bin:/bin:/usr/sbin:/sbin', ...env };
+    return [
+      '<?xml version="1.0" encoding="UTF-8"?>',
+      '<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">',
+      '<plist version="1.0">',
+      '<dict>',
+      `  <key>Label</key>${string(LAUNCHD_LABEL)}`,
+      '  <key>ProgramArguments</key>',
+      '  <array>',
+      ...[program, ...args].map((arg) => `    ${string(arg)}`),
+      '  </array>',
+      '  <key>EnvironmentVariables</key>',
+      '  <dict>',
+      ...Object.entries(environment).map(([name, value]) => `    <key>${xmlEscape(name)}</key>${string(value)}`),
+      '  </dict>',
+      '  <key>RunAtLoad</key><true/>',
+      // Se reinicia si cae, pero no si termina bien (service uninstall, Ctrl+C)
+      '  <key>KeepAlive</key>',
+      '  <dict><key>SuccessfulExit</key><false/></dict>',
+      '  <key>ThrottleInterval</key><integer>10</integer>',
+      `  <key>StandardOutPath</key>${string(launchd.logFile())}`,
+      `  <key>StandardErrorPath</key>${string(launchd.logFile())}`,
+      '</dict>',
+      '</plist>',
+      ''
+    ].join('\n');
+  },
+
+  async install(command) {
+    const file = launchd.plistFile();
+    fs.mkdirSync(path.dirname(file), { recursive: true });
+    // launchd no crea el directorio del log: sin él el agente no arranca
+    fs.mkdirSync(path.dirname(launchd.logFile()), { recursive: true });
+    // El agente fuera del sandbox vería otro directorio de configuración: se fija el de quien instala
+    fs.writeFileSync(file, launchd.renderPlist({ ...command, env: { HOMEPINAS_FINDER_HOME: getConfigDir(), ...command.env } }));
+    // Si ya estaba cargado hay que descargarlo para que lea el plist nuevo
+    await run('launchctl', ['bootout', `${launchd.domain()}/${LAUNCHD_LABEL}`]);
+    await runChecked('launchctl', ['bootstrap', launchd.domain(), file]);
+    return { location: file, hint: `Registro: ${launchd.logFile()}` };
+  },
+
+  async uninstall() {
+    const file = launchd.plistFile();
+    if (!fs.existsSync(file)) return false;
+    await run('launchctl', ['bootout', `${launchd.domain()}/${LAUNCHD_LABEL}`]);
+    fs.rmSync(file, { force: true });
+    return true;
+  },
+
+  async status() {
+    const file = launchd.plistFile();
+    if (!fs.existsSync(file)) return { installed: false, location: file };
+    const result = await run('launchctl', ['print', `${launchd.domain()}/${LAUNCHD_LABEL}`]);
+    const state = result.code === 0 ? result.stdout.match(/^\s*state = (.+)$/m)?.[1].trim() : 'no cargado';
+    return { installed: true, location: file, enabled: result.code === 0, running: state === 'running', detail: state };
+  }
+};
+
+const BACKENDS = { linux: systemd, darwin: launchd, win32: windows };
+
+/**
+ * Instalador del servicio en este sistema: { install(command), uninstall(), status() }
+ */
+function getServiceBackend(platform = process.platform) {
+  const backend = BACKENDS[platform];
+  if (!backend) throw new Error(`El servicio no está disponible en ${platform}`);
+  return backend;
+}
+
+module.exports = { SERVICE_NAME, getServiceBackend, serviceCommand };
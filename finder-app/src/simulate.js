@@ -0,0 +1,137 @@
+/**
+ * Red simulada (--simulate): dispositivos falsos con latencia y fallos configurables, sin
+ * tocar la red. Sirve para trabajar en la interfaz, hacer demos y pruebas de integración
+ *
+ * Los dispositivos salen de `simulation.devices` en config.json o, si está vacío, de
+ * DEMO_DEVICES (ver buildScanOptions). Las IPs de ejemplo son de 192.0.2.0/24
+ * (TEST-NET-1, RFC 5737): nunca coinciden con un NAS de verdad
+ */
+const net = require('net');
+const { setTimeout: sleep } = require('timers/promises');
+const log = require('./log');
+const { urlHost } = require('./netutil');
+const { timeHost } = require('./profile');
+const { traceEvent, classifyProbeError } = require('./trace');
+
+// Fallos que se pueden simular: motivo con el que se anota (como los de httpRequest) y protocolo
+const FAILURES = {
+  offline: { reason: 'connect-timeout', wait: 'connect' },
+  refused: { reason: 'ECONNREFUSED' },
+  timeout: { reason: 'timeout', wait: 'http' },
+  'tls-error': { reason: 'ERR_SSL_WRONG_VERSION_NUMBER', protocol: 'https' },
+  flaky: { reason: 'timeout', wait: 'http' },
+  // Una excepción en el sondeo: prueba el aislamiento de fallos del escáner
+  crash: null
+};
+const METHODS = ['HTTP', 'mDNS', 'beacon'];
+const DEFAULT_PORTS = { https: 443, http: 80 };
+const FLAKY_RATE = 0.5;
+
+const DEMO_DEVICES = [
+  { ip: '192.0.2.10', name: 'HomePiNAS Salón', hostname: 'pinas.local', version: '2.4.1', method: 'mDNS', mac: 'dc:a6:32:00:00:10', latencyMs: 40 },
+  { ip: '192.0.2.11', name: 'Copias', hostname: 'copias.local', version: '2.3.0', method: 'beacon', latencyMs: 120, jitterMs: 80 },
+  { ip: '192.0.2.12', name: 'Estudio', hostname: 'estudio.local', version: '2.4.0', latencyMs: 300, jitterMs: 200, failure: 'flaky' },
+  { ip: '192.0.2.13', name: 'Garaje', hostname: 'garaje.local', version: '2.1.5', failure: 'offline' },
+  { ip: '192.0.2.14', name: 'Antiguo', hostname: 'antiguo.local', version: '1.9.2', port: 5001, failure: 'tls-error' }
+];
+
+/**
+ * Entrada de `simulation.devices` → dispositivo simulado, o null (con aviso) si no es válida
+ */
+function normalizeDevice(spec) {
+  if (!spec || !net.isIP(String(spec.ip || ''))) {
+    log.warn(`[Simulate] Dispositivo sin IP válida: ${JSON.stringify(spec)}; se ignora`);
+    return null;
+  }
+  if (spec.failure && !Object.hasOwn(FAILURES, spec.failure)) {
+    log.warn(`[Simulate] Fallo no válido en ${spec.ip}: ${spec.failure} (${Object.keys(FAILURES).join(', ')}); se ignora`);
+    return null;
+  }
+  const scheme = spec.scheme === 'http' ? 'http' : 'https';
+  const port = Number.parseInt(spec.port, 10) || DEFAULT_PORTS[scheme];
+  return {
+    ip: spec.ip,
+    name: String(spec.name || 'HomePiNAS'),
+    hostname: String(spec.hostname || ''),
+    version: String(spec.version || ''),
+    method: METHODS.includes(spec.method) ? spec.method : 'HTTP',
+    mac: spec.mac ? String(spec.mac).toLowerCase() : null,
+    url: `${scheme}://${urlHost(spec.ip)}${port !== DEFAULT_PORTS[scheme] ? `:${port}` : ''}`,
+    scheme,
+    latencyMs: Math.max(Number(spec.latencyMs) || 0, 0),
+    jitterMs: Math.max(Number(spec.jitterMs) || 0, 0),
+    failure: spec.failure || null,
+    failureRate: Math.min(Math.max(Number(spec.failureRate ?? FLAKY_RATE), 0), 1)
+  };
+}
+
+/**
+ * Espera cancelable; false si se canceló antes
+ */
+async function wait(ms, signal) {
+  try {
+    await sleep(ms, undefined, { signal });
+    return true;
+  } catch {
+    return false;
+  }
+}
+
+/**
+ * Un sondeo simulado: espera la latencia (o el timeout del fallo) y devuelve el dispositivo o null
+ */
+async function probeSimulated(device, scan) {
+  const latency = device.latencyMs + Math.random() * device.jitterMs;
+  const failing = device.failure === 'flaky' ? Math.random() < device.failureRate : Boolean(device.failure);
+  const failure = failing ? FAILURES[device.failure] : undefined;
+  if (failing && !failure) throw new Error(`Fallo simulado en ${device.ip}`);
+
+  const waited = failure?.wait === 'connect' ? scan.connectTimeout
+    : failure?.wait === 'http' ? latency + scan.httpTimeout
+      : latency;
+  if (!await wait(waited, scan.signal)) return null;
+
+  if (failure) {
+    const protocol = failure.protocol || device.scheme;
+    scan.probeError?.(failure.reason, protocol);
+    traceEvent(scan.trace, device.ip, 'request', classifyProbeError(failure.reason, protocol), {
+      url: device.url, reason: failure.reason, simulated: true
+    });
+    return null;
+  }
+
+  const { ip, name, hostname, version, method, url, mac } = device;
+  return {
+    ip, name, hostname, version, method, url,
+    ...(mac ? { mac } : {}),
+    ...(method === 'HTTP' ? { fingerprint: 'system-info', confidence: 1 } : {}),
+    simulated: true
+  };
+}
+
+/**
+ * Método de descubrimiento que sustituye a todos los reales en modo simulado
+ */
+function createSimulatedMethod(specs) {
+  const devices = specs.map(normalizeDevice).filter(Boolean);
+
+  return async function scanSimulated(scan) {
+    scan.addTargets?.(devices.length);
+    await Promise.all(devices.map(async (device) => {
+      try {
+        if (scan.signal?.aborted) return;
+        const found = await timeHost(scan.profile, device.ip, () => probeSimulated(device, scan));
+        if (!scan.signal?.aborted) {
+          traceEvent(scan.trace, device.ip, 'host', found ? 'homepinas' : 'not-homepinas', found ? { method: found.method } : {});
+        }
+        scan.report(found);
+      } catch (err) {
+        scan.workerError?.(err, { method: 'simulated', ip: device.ip });
+      } finally {
+        scan.probeDone?.();
+      }
+    }));
+  };
+}
+
+module.exports = { createSimulatedMethod, DEMO_DEVICES };
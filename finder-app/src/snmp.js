@@ -0,0 +1,168 @@
+const crypto = require('crypto');
+const dgram = require('dgram');
+
+const SNMP_PORT = 161;
+const SNMP_TIMEOUT = 1000;
+const SYS_DESCR = '1.3.6.1.2.1.1.1.0';
+const SYS_NAME = '1.3.6.1.2.1.1.5.0';
+
+// Etiquetas BER usadas por SNMP v2c
+const TAG = {
+  INTEGER: 0x02,
+  OCTET_STRING: 0x04,
+  NULL: 0x05,
+  OID: 0x06,
+  SEQUENCE: 0x30,
+  GET_REQUEST: 0xa0,
+  RESPONSE: 0xa2
+};
+
+function encodeLength(length) {
+  if (length < 0x80) return Buffer.from([length]);
+  const bytes = [];
+  for (let value = length; value > 0; value >>= 8) bytes.unshift(value & 0xff);
+  return Buffer.from([0x80 | bytes.length, ...bytes]);
+}
+
+function tlv(tag, value) {
+  return Buffer.concat([Buffer.from([tag]), encodeLength(value.length), value]);
+}
+
+function encodeInteger(value) {
+  const bytes = [];
+  let rest = value;
+  do {
+    bytes.unshift(rest & 0xff);
+    rest >>= 8;
+  } while (rest > 0);
+  if (bytes[0] & 0x80) bytes.unshift(0);
+  return tlv(TAG.INTEGER, Buffer.from(bytes));
+}
+
+function encodeOid(oid) {
+  const [first, second, ...rest] = oid.split('.').map(Number);
+  const bytes = [first * 40 + second];
+  for (const part of rest) {
+    const chunk = [part & 0x7f];
+    for (let value = part >> 7; value > 0; value >>= 7) chunk.unshift(0x80 | (value & 0x7f));
+    bytes.push(...chunk);
+  }
+  return tlv(TAG.OID, Buffer.from(bytes));
+}
+
+/**
+ * GetRequest SNMP v2c de los OIDs indicados
+ */
+function getRequest(requestId, community, oids) {
+  const varbinds = tlv(TAG.SEQUENCE, Buffer.concat(oids.map((oid) =>
+    tlv(TAG.SEQUENCE, Buffer.concat([encodeOid(oid), tlv(TAG.NULL, Buffer.alloc(0))])))));
+  const pdu = tlv(TAG.GET_REQUEST, Buffer.concat([
+    encodeInteger(requestId), encodeInteger(0), encodeInteger(0), varbinds
+  ]));
+  return tlv(TAG.SEQUENCE, Buffer.concat([encodeInteger(1), tlv(TAG.OCTET_STRING, Buffer.from(community)), pdu]));
+}
+
+/**
+ * Lee un TLV en `offset`; devuelve { tag, value, end }
+ */
+function readTlv(buffer, offset) {
+  const tag = buffer[offset];
+  let length = buffer[offset + 1];
+  let start = offset + 2;
+  if (length & 0x80) {
+    const count = length & 0x7f;
+    length = 0;
+    for (let i = 0; i < count; i++) length = (length << 8) | buffer[start + i];
+    start += count;
+  }
+  if (start + length > buffer.length) throw new Error('TLV truncado');
+  return { tag, value: buffer.subarray(start, start + length), end: start + length };
+}
+
+function children(value) {
+  const items = [];
+  for (let offset = 0; offset < value.length;) {
+    const item = readTlv(value, offset);
+    items.push(item);
+    offset = item.end;
+  }
+  return items;
+}
+
+function decodeInteger(value) {
+  return value.reduce((acc, byte) => acc * 256 + byte, 0);
+}
+
+function decodeOid(value) {
+  const parts = [Math.floor(value[0] / 40), value[0] % 40];
+  let current = 0;
+  for (const byte of value.subarray(1)) {
+    current = current * 128 + (byte & 0x7f);
+    if (!(byte & 0x80)) {
+      parts.push(current);
+      current = 0;
+    }
+  }
+  return parts.join('.');
+}
+
+/**
+ * Respuesta a nuestra petición: Map oid -> texto, o null si no corresponde
+ */
+function parseResponse(message, requestId) {
+  const [, , pdu] = children(readTlv(message, 0).value);
+  if (!pdu || pdu.tag !== TAG.RESPONSE) return null;
+
+  const [id, errorStatus, , varbinds] = children(pdu.value);
+  if (decodeInteger(id.value) !== requestId || decodeInteger(errorStatus.value) !== 0) return null;
+
+  const values = new Map();
+  for (const varbind of children(varbinds.value)) {
+    const [oid, value] = children(varbind.value);
+    if (value.tag === TAG.OCTET_STRING) values.set(decodeOid(oid.value), value.value.toString('utf8'));
+  }
+  return values;
+}
+
+/**
+ * sysName y sysDescr de un host por SNMP v2c
+ * Devuelve { sysName, sysDescr } o null si no responde (SNMP desactivado o comunidad incorrecta)
+ * o si se aborta `signal`
+ */
+function querySystem(ip, { community = 'public', timeout = SNMP_TIMEOUT, signal } = {}) {
+  return new Promise((resolve) => {
+    const requestId = crypto.randomInt(1, 0x7fffffff);
+    const socket = dgram.createSocket(ip.includes(':') ? 'udp6' : 'udp4');
+    let timer;
+    let done = false;
+    const finish = (value) => {
+      if (done) return;
+      done = true;
+      clearTimeout(timer);
+      signal?.removeEventListener('abort', onAbort);
+      socket.close();
+      resolve(value);
+    };
+    const onAbort = () => finish(null);
+    if (signal?.aborted) return finish(null);
+    signal?.addEventListener('abort', onAbort, { once: true });
+
+    socket.on('message', (message) => {
+      let values = null;
+      try {
+        values = parseResponse(message, requestId);
+      } catch {
+        // Respuesta malformada: se ignora
+      }
+      if (values) finish({ sysName: values.get(SYS_NAME) || '', sysDescr: values.get(SYS_DESCR) || '' });
+    });
+    socket.on('error', () => finish(null));
+
+    timer = setTimeout(() => finish(null), timeout);
+    socket.send(getRequest(requestId, community, [SYS_DESCR, SYS_NAME]), SNMP_PORT, ip, (err) => {
+      if (err) finish(null);
+    });
+  });
+}
+
+module.exports = { querySystem };
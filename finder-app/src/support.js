@@ -0,0 +1,29 @@
+/**
+ * Paquete de soporte (doctor --capture): un JSON para adjuntar a una incidencia con la
+ * versión, el sistema, el resultado de doctor y la captura saneada de mDNS y SSDP
+ */
+const fs = require('fs');
+const os = require('os');
+const path = require('path');
+const { version } = require('../package.json');
+
+/**
+ * Escribe el paquete en `dir` (por defecto el directorio actual) y devuelve su ruta
+ */
+function writeSupportBundle({ checks = null, diagnosis = null, capture }, dir = process.cwd()) {
+  const createdAt = new Date();
+  const bundle = {
+    createdAt: createdAt.toISOString(),
+    finder: version,
+    system: { platform: process.platform, release: os.release(), arch: process.arch, node: process.version },
+    ...(checks ? { doctor: checks } : {}),
+    ...(diagnosis ? { diagnosis } : {}),
+    capture
+  };
+  const stamp = createdAt.toISOString().replace(/[-:]/g, '').replace(/\..*$/, '').replace('T', '-');
+  const file = path.join(dir, `homepinas-finder-support-${stamp}.json`);
+  fs.writeFileSync(file, JSON.stringify(bundle, null, 2) + '\n');
+  return file;
+}
+
+module.exports = { writeSupportBundle };
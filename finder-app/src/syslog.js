@@ -0,0 +1,88 @@
+const dgram = require('dgram');
+const net = require('net');
+const os = require('os');
+
+const FACILITIES = {
+  user: 1, daemon: 3,
+  local0: 16, local1: 17, local2: 18, local3: 19,
+  local4: 20, local5: 21, local6: 22, local7: 23
+};
+const SEVERITIES = { error: 3, warning: 4, notice: 5, info: 6, debug: 7 };
+const APP_NAME = 'homepinas-finder';
+// Niveles de log.js → severidad syslog
+const LOG_SEVERITIES = { debug: 'debug', info: 'info', warn: 'warning', error: 'error' };
+
+/**
+ * Mensaje RFC 5424: <PRI>1 TIMESTAMP HOST APP PROCID MSGID SD MSG
+ */
+function formatRfc5424({ facility = 'user', severity = 'info', msgId = '-', message, data }) {
+  const pri = (FACILITIES[facility] ?? FACILITIES.user) * 8 + (SEVERITIES[severity] ?? SEVERITIES.info);
+  const structured = data
+    ? `[finder@32473 ${Object.entries(data)
+      .filter(([, value]) => value !== undefined && value !== '')
+      .map(([key, value]) => `${key}="${String(value).replace(/["\\\]]/g, '\\$&')}"`)
+      .join(' ')}]`
+    : '-';
+
+  return `<${pri}>1 ${new Date().toISOString()} ${os.hostname() || '-'} ${APP_NAME} ${process.pid} ${msgId} ${structured} ${message}`;
+}
+
+/**
+ * Emisor syslog hacia un servidor local o remoto (UDP por defecto, TCP opcional)
+ * config: { host, port = 514, protocol = 'udp', facility = 'user' }
+ */
+function createSyslogSender({ host = '127.0.0.1', port = 514, protocol = 'udp', facility = 'user' } = {}) {
+  return {
+    send({ severity, msgId, message, data }) {
+      const line = formatRfc5424({ facility, severity, msgId, message, data });
+
+      if (protocol === 'tcp') {
+        // RFC 6587: octet counting
+        return new Promise((resolve, reject) => {
+          const payload = `${Buffer.byteLength(line)} ${line}`;
+          const socket = net.createConnection({ host, port }, () => socket.end(payload));
+          socket.setTimeout(5000, () => socket.destroy(new Error('timeout')));
+          socket.on('close', resolve);
+          socket.on('error', reject);
+        });
+      }
+
+      return new Promise((resolve, reject) => {
+        const socket = dgram.createSocket(net.isIPv6(host) ? 'udp6' : 'udp4');
+        socket.send(line, port, host, (err) => {
+          socket.close();
+          if (err) reject(err);
+          else resolve();
+        });
+      });
+    }
+  };
+}
+
+/**
+ * Destino de log.js (addLogSink) hacia syslog: el ámbito ("[Scanner]") va como MSGID y
+ * los campos como datos estructurados. `onError` recibe el primer fallo de envío
+ */
+function createSyslogLogSink(options, onError = () => {}) {
+  const sender = createSyslogSender(options);
+  let failed = false;
+
+  return ({ level, scope, msg, fields }) => {
+    const data = Object.fromEntries(Object.entries(fields)
+      .filter(([key]) => /^[\x21-\x7e]{1,32}$/.test(key) && !/[= \]"]/.test(key))
+      .map(([key, value]) => [key, typeof value === 'object' && value !== null ? JSON.stringify(value) : value]));
+    sender.send({
+      severity: LOG_SEVERITIES[level],
+      msgId: scope ? scope.replace(/[^\x21-\x7e]/g, '-').slice(0, 32) : '-',
+      message: msg,
+      data: Object.keys(data).length > 0 ? data : undefined
+    }).catch((err) => {
+      // Solo el primero: si syslog no responde, cada aviso del fallo generaría otro envío
+      if (failed) return;
+      failed = true;
+      onError(err);
+    });
+  };
+}
+
+module.exports = { formatRfc5424, createSyslogSender, createSyslogLogSink };
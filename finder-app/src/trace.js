@@ -0,0 +1,57 @@
+/**
+ * Traza de decisiones del escaneo (serve --debug, /api/debug/trace)
+ * Cada sondeo anota por qué se dio por bueno o se descartó un host (conexión fallida,
+ * error TLS, 404, qué detector encajó...) para saber exactamente por qué no aparece un NAS
+ *
+ * Evento: { t (ms desde el inicio), ip (null = todo el escaneo), step, result, ...detalles }
+ */
+
+// Un barrido de /16 recortado son miles de hosts con varios intentos cada uno
+const MAX_EVENTS = 20000;
+
+// Códigos de fallo de httpRequest que indican que no se llegó a conectar
+const CONNECT_ERRORS = new Set([
+  'ECONNREFUSED', 'EHOSTUNREACH', 'ENETUNREACH', 'EHOSTDOWN', 'ETIMEDOUT', 'EADDRNOTAVAIL', 'connect-timeout'
+]);
+
+function createTrace() {
+  return { startedAt: Date.now(), events: [], dropped: 0 };
+}
+
+/**
+ * Anota una decisión; sin traza (modo normal) no hace nada
+ */
+function traceEvent(trace, ip, step, result, details = {}) {
+  if (!trace) return;
+  if (trace.events.length >= MAX_EVENTS) {
+    trace.dropped++;
+    return;
+  }
+  trace.events.push({ t: Date.now() - trace.startedAt, ip: ip || null, step, result, ...details });
+}
+
+/**
+ * Tipo de fallo de una petición: connect-failed, tls-error o request-failed
+ * Por HTTPS un ECONNRESET suele ser el NAS cortando el saludo TLS (p. ej. exige mTLS)
+ */
+function classifyProbeError(reason, protocol) {
+  if (CONNECT_ERRORS.has(reason)) return 'connect-failed';
+  if (/^(ERR_SSL|ERR_TLS|EPROTO$)/.test(reason)) return 'tls-error';
+  if (protocol === 'https' && reason === 'ECONNRESET') return 'tls-error';
+  return 'request-failed';
+}
+
+/**
+ * Resumen serializable; `ip` deja solo los eventos de ese host (y los del escaneo)
+ */
+function summarizeTrace(trace, { ip = null } = {}) {
+  const events = ip ? trace.events.filter((event) => event.ip === ip || event.ip === null) : trace.events;
+  return {
+    startedAt: new Date(trace.startedAt).toISOString(),
+    hosts: new Set(trace.events.map((event) => event.ip).filter(Boolean)).size,
+    dropped: trace.dropped,
+    events: events.map((event) => ({ ...event }))
+  };
+}
+
+module.exports = { createTrace, traceEvent, classifyProbeError, summarizeTrace };
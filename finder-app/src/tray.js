@@ -0,0 +1,79 @@
+const { Menu, Notification, Tray, nativeImage } = require('electron');
+
+// NAS que caben en el menú; el resto, en la ventana
+const MAX_MENU_DEVICES = 15;
+
+/**
+ * Icono de la bandeja del sistema (Windows), barra de menús (macOS) o appindicator (Linux)
+ * con "Abrir Finder", "Reescanear" y la lista de NAS en línea
+ * `actions` = { open(), rescan(), openDevice(id), quit() }
+ */
+function createTray(iconPath, actions) {
+  const icon = nativeImage.createFromPath(iconPath).resize({ width: 16, height: 16 });
+  if (process.platform === 'darwin') icon.setTemplateImage(true);
+  const tray = new Tray(icon);
+  tray.setToolTip('HomePiNAS Finder');
+
+  let devices = [];
+  let scanning = false;
+
+  const render = () => {
+    const online = devices.filter((device) => device.online);
+    const items = online.slice(0, MAX_MENU_DEVICES).map((device) => ({
+      label: `${device.alias || device.name} — ${device.ip}`,
+      click: () => actions.openDevice(device.id)
+    }));
+    if (online.length > MAX_MENU_DEVICES) {
+      items.push({ label: `y ${online.length - MAX_MENU_DEVICES} más…`, click: actions.open });
+    }
+
+    tray.setContextMenu(Menu.buildFromTemplate([
+      { label: 'Abrir Finder', click: actions.open },
+      { label: scanning ? 'Escaneando…' : 'Reescanear', enabled: !scanning, click: actions.rescan },
+      { type: 'separator' },
+      ...(items.length > 0 ? items : [{ label: scanning ? 'Buscando NAS…' : 'Ningún NAS en línea', enabled: false }]),
+      { type: 'separator' },
+      { label: 'Salir', click: actions.quit }
+    ]));
+    tray.setToolTip(`HomePiNAS Finder: ${online.length} NAS en línea`);
+  };
+
+  // En Windows y Linux el clic abre la ventana; en macOS el clic ya despliega el menú
+  if (process.platform !== 'darwin') tray.on('click', actions.open);
+  render();
+
+  return {
+    /**
+     * Fichas del inventario (con `online`) que se listan en el menú
+     */
+    update(list) {
+      devices = list;
+      render();
+    },
+    setScanning(value) {
+      scanning = value;
+      render();
+    },
+    destroy() {
+      tray.destroy();
+    }
+  };
+}
+
+/**
+ * Notificación del sistema para un NAS nuevo (`change` = new) o que vuelve a estar
+ * en línea (`change` = back); al pulsarla se llama a `onClick`
+ */
+function notifyDevice(device, change, onClick) {
+  if (!Notification.isSupported()) return;
+  const name = device.alias || device.hostname || device.name;
+  const notification = new Notification({
+    title: change === 'new' ? 'Nuevo HomePiNAS encontrado' : 'HomePiNAS de nuevo en línea',
+    body: `${name} — ${device.ip}`,
+    silent: change !== 'new'
+  });
+  notification.on('click', onClick);
+  notification.show();
+}
+
+module.exports = { createTray, notifyDevice };
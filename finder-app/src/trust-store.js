@@ -0,0 +1,72 @@
+const fs = require('fs');
+const path = require('path');
+const log = require('./log');
+const { getConfigDir } = require('./config');
+
+const STORE_FILE = 'known-certs.json';
+
+/**
+ * Almacén TOFU de certificados TLS por dispositivo
+ * El primer contacto fija la huella SHA-256; los siguientes deben coincidir
+ */
+function openTrustStore(file = path.join(getConfigDir(), STORE_FILE)) {
+  let pins = {};
+  let dirty = false;
+
+  try {
+    pins = JSON.parse(fs.readFileSync(file, 'utf8'));
+  } catch (err) {
+    if (err.code !== 'ENOENT') {
+      log.warn(`[Trust] No se pudo leer ${file}: ${err.message}`);
+    }
+  }
+
+  return {
+    /**
+     * 'new' (primera vez, queda fijado), 'match' o 'mismatch'
+     * Un cambio de certificado nunca sustituye el fijado automáticamente
+     */
+    check(key, cert) {
+      const pinned = pins[key];
+      if (!pinned) {
+        pins[key] = {
+          fingerprint256: cert.fingerprint256,
+          subject: cert.subject?.CN || '',
+          firstSeen: new Date().toISOString()
+        };
+        dirty = true;
+        return 'new';
+      }
+      return pinned.fingerprint256 === cert.fingerprint256 ? 'match' : 'mismatch';
+    },
+
+    /**
+     * Fija un certificado nuevo en lugar del anterior; solo cuando el usuario
+     * confirma que el cambio es legítimo (NAS reinstalado, certificado renovado...)
+     */
+    replace(key, cert) {
+      pins[key] = {
+        fingerprint256: cert.fingerprint256,
+        subject: cert.subject?.CN || '',
+        firstSeen: new Date().toISOString(),
+        replaced: pins[key]?.fingerprint256 || ''
+      };
+      dirty = true;
+    },
+
+    get(key) {
+      return pins[key] || null;
+    },
+
+    save() {
+      if (!dirty) return;
+      fs.mkdirSync(path.dirname(file), { recursive: true });
+      const tmp = `${file}.tmp`;
+      fs.writeFileSync(tmp, JSON.stringify(pins, null, 2), { mode: 0o600 });
+      fs.renameSync(tmp, file);
+      dirty = false;
+    }
+  };
+}
+
+module.exports = { openTrustStore };
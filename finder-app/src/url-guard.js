@@ -0,0 +1,42 @@
+const net = require('net');
+const { isPrivateAddress } = require('./netutil');
+
+const ALLOWED_PROTOCOLS = new Set(['http:', 'https:']);
+
+/**
+ * Valida una URL antes de entregarla al sistema operativo
+ * Los datos vienen de respuestas de red: solo se abren http(s) sin credenciales
+ * y hacia IPs privadas, nombres .local / de una etiqueta o hosts ya descubiertos
+ *
+ * Devuelve la URL normalizada o lanza un Error
+ */
+function validateDeviceUrl(raw, { knownHosts = new Set(), allowPublic = false } = {}) {
+  let url;
+  try {
+    url = new URL(String(raw));
+  } catch {
+    throw new Error('URL no válida');
+  }
+
+  if (!ALLOWED_PROTOCOLS.has(url.protocol)) {
+    throw new Error(`Protocolo no permitido: ${url.protocol}`);
+  }
+  if (url.username || url.password) {
+    throw new Error('La URL no puede incluir credenciales');
+  }
+
+  const host = url.hostname.replace(/^\[|\]$/g, '');
+  if (!isAllowedHost(host, knownHosts, allowPublic)) {
+    throw new Error(`Host no permitido: ${host}`);
+  }
+
+  return url.href;
+}
+
+function isAllowedHost(host, knownHosts, allowPublic) {
+  if (knownHosts.has(host)) return true;
+  if (net.isIP(host)) return allowPublic || isPrivateAddress(host);
+  return host.endsWith('.local') || /^[a-z0-9-]+$/i.test(host);
+}
+
+module.exports = { validateDeviceUrl };
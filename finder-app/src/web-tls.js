@@ -0,0 +1,171 @@
+/**
+ * Certificado TLS de la interfaz web de serve: el que indique el usuario o uno
+ * autofirmado (ECDSA P-256) que se genera en el directorio de configuración
+ * Node no sabe crear certificados X.509, así que se construye el DER a mano
+ */
+const crypto = require('crypto');
+const fs = require('fs');
+const net = require('net');
+const os = require('os');
+const path = require('path');
+const { getConfigDir } = require('./config');
+
+const CERT_FILE = 'web-cert.pem';
+const KEY_FILE = 'web-key.pem';
+const VALID_DAYS = 397; // lo máximo que aceptan los navegadores
+const RENEW_DAYS = 30; // se regenera cuando le queda menos de esto
+const DAY = 24 * 60 * 60 * 1000;
+
+// DER mínimo: lo justo para un certificado
+function der(tag, content) {
+  const length = content.length < 0x80
+    ? Buffer.from([content.length])
+    : (() => {
+      const bytes = [];
+      for (let n = content.length; n > 0; n >>= 8) bytes.unshift(n & 0xff);
+      return Buffer.from([0x80 | bytes.length, ...bytes]);
+    })();
+  return Buffer.concat([Buffer.from([tag]), length, content]);
+}
+const sequence = (...items) => der(0x30, Buffer.concat(items));
+const integer = (bytes) => der(0x02, bytes[0] & 0x80 ? Buffer.concat([Buffer.from([0]), bytes]) : bytes);
+const utf8 = (text) => der(0x0c, Buffer.from(text, 'utf8'));
+const bitString = (bytes) => der(0x03, Buffer.concat([Buffer.from([0]), bytes]));
+const octetString = (bytes) => der(0x04, bytes);
+const explicit = (n, content) => der(0xa0 + n, content);
+
+function oid(text) {
+  const [first, second, ...rest] = text.split('.').map(Number);
+  const bytes = [40 * first + second];
+  for (const value of rest) {
+    const chunk = [value & 0x7f];
+    for (let n = value >> 7; n > 0; n >>= 7) chunk.unshift(0x80 | (n & 0x7f));
+    bytes.push(...chunk);
+  }
+  return der(0x06, Buffer.from(bytes));
+}
+
+// UTCTime hasta 2049, GeneralizedTime después (RFC 5280)
+function time(date) {
+  const iso = date.toISOString().replace(/[-:T]/g, '').slice(0, 14) + 'Z';
+  return date.getUTCFullYear() < 2050 ? der(0x17, Buffer.from(iso.slice(2))) : der(0x18, Buffer.from(iso));
+}
+
+function ipBytes(ip) {
+  if (net.isIPv4(ip)) return Buffer.from(ip.split('.').map(Number));
+  // IPv6: se expande "::" a los grupos que falten
+  const [head, tail = ''] = ip.split('::');
+  const groups = (part) => (part ? part.split(':') : []);
+  const missing = 8 - groups(head).length - groups(tail).length;
+  const all = ip.includes('::') ? [...groups(head), ...Array(missing).fill('0'), ...groups(tail)] : groups(head);
+  return Buffer.concat(all.map((group) => {
+    const bytes = Buffer.alloc(2);
+    bytes.writeUInt16BE(parseInt(group, 16));
+    return bytes;
+  }));
+}
+
+/**
+ * Certificado autofirmado para `names` (hostnames e IPs), con su clave: { cert, key } en PEM
+ */
+function createSelfSigned(names, { days = VALID_DAYS } = {}) {
+  const { publicKey, privateKey } = crypto.generateKeyPairSync('ec', { namedCurve: 'prime256v1' });
+  const ecdsaSha256 = sequence(oid('1.2.840.10045.4.3.2'));
+  const subject = sequence(der(0x31, sequence(oid('2.5.4.3'), utf8(`HomePiNAS Finder (${os.hostname()})`))));
+  const notBefore = new Date(Date.now() - DAY);
+  const notAfter = new Date(Date.now() + days * DAY);
+
+  // dNSName [2] e iPAddress [7] del subjectAltName
+  const altNames = Buffer.concat(names.map((name) => (net.isIP(name)
+    ? der(0x87, ipBytes(name))
+    : der(0x82, Buffer.from(name, 'ascii')))));
+  const extensions = explicit(3, sequence(
+    sequence(oid('2.5.29.19'), octetString(sequence())), // basicConstraints: no es una CA
+    sequence(oid('2.5.29.37'), octetString(sequence(oid('1.3.6.1.5.5.7.3.1')))), // extKeyUsage: serverAuth
+    sequence(oid('2.5.29.17'), octetString(der(0x30, altNames)))
+  ));
+
+  const tbs = sequence(
+    explicit(0, integer(Buffer.from([2]))), // v3
+    integer(crypto.randomBytes(16).fill(0x7f, 0, 1)), // número de serie positivo
+    ecdsaSha256,
+    subject,
+    sequence(time(notBefore), time(notAfter)),
+    subject,
+    publicKey.export({ type: 'spki', format: 'der' }),
+    extensions
+  );
+  const signature = crypto.sign('sha256', tbs, privateKey);
+  const certificate = sequence(tbs, ecdsaSha256, bitString(signature));
+
+  const body = certificate.toString('base64').match(/.{1,64}/g).join('\n');
+  return {
+    cert: `-----BEGIN CERTIFICATE-----\n${body}\n-----END CERTIFICATE-----\n`,
+    key: privateKey.export({ type: 'pkcs8', format: 'pem' })
+  };
+}
+
+/**
+ * Nombres con los que se llega a esta máquina: localhost, su hostname (y .local) y sus IPs
+ */
+function localNames() {
+  const hostname = os.hostname().toLowerCase();
+  const addresses = Object.values(os.networkInterfaces()).flat()
+    .filter((iface) => !iface.address.startsWith('fe80'))
+    .map((iface) => iface.address);
+  return [...new Set(['localhost', hostname, `${hostname.replace(/\.local$/, '')}.local`, ...addresses])];
+}
+
+/**
+ * ¿Sirve todavía el certificado? Le quedan más de RENEW_DAYS días y cubre todos los `names`
+ */
+function isUsable(pem, names) {
+  try {
+    const x509 = new crypto.X509Certificate(pem);
+    if (new Date(x509.validTo).getTime() - Date.now() < RENEW_DAYS * DAY) return false;
+    // Las IPs se comparan en binario: Node escribe las IPv6 del certificado sin abreviar
+    const key = (name) => (net.isIP(name) ? ipBytes(name).toString('hex') : name.toLowerCase());
+    const covered = (x509.subjectAltName || '').split(', ').map((entry) => key(entry.split(':').slice(1).join(':')));
+    return names.every((name) => covered.includes(key(name)));
+  } catch {
+    return false;
+  }
+}
+
+/**
+ * Certificado y clave de la interfaz web: { cert, key, fingerprint256, generated }
+ * Con `certFile` y `keyFile` se usan esos; si no, el autofirmado del directorio de
+ * configuración, que se regenera si caduca pronto o cambia alguna IP de la máquina
+ */
+function loadWebTls({ certFile = '', keyFile = '', dir = getConfigDir() } = {}) {
+  let cert;
+  let key;
+  let generated = false;
+
+  if (certFile || keyFile) {
+    if (!certFile || !keyFile) throw new Error('Hacen falta el certificado y la clave (web.certFile y web.keyFile)');
+    cert = fs.readFileSync(certFile, 'utf8');
+    key = fs.readFileSync(keyFile, 'utf8');
+  } else {
+    const certPath = path.join(dir, CERT_FILE);
+    const keyPath = path.join(dir, KEY_FILE);
+    try {
+      cert = fs.readFileSync(certPath, 'utf8');
+      key = fs.readFileSync(keyPath, 'utf8');
+    } catch (err) {
+      if (err.code !== 'ENOENT') throw err;
+    }
+
+    if (!cert || !key || !isUsable(cert, localNames())) {
+      ({ cert, key } = createSelfSigned(localNames()));
+      fs.mkdirSync(dir, { recursive: true });
+      fs.writeFileSync(keyPath, key, { mode: 0o600 });
+      fs.writeFileSync(certPath, cert);
+      generated = true;
+    }
+  }
+
+  return { cert, key, fingerprint256: new crypto.X509Certificate(cert).fingerprint256, generated };
+}
+
+module.exports = { createSelfSigned, loadWebTls };
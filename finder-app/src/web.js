@@ -0,0 +1,759 @@
+/**
+ * Interfaz web del modo serve: la lista de NAS y el botón de escanear para abrirla
+ * desde el móvil o la tablet cuando el Finder corre en un servidor de casa
+ *
+ * Todo exige autenticación: el token (cabecera Bearer, o /login?token= una vez
+ * para abrir una sesión con cookie) o usuario y contraseña (Basic) si hay contraseña
+ * /ws es un WebSocket con el que la página lanza y cancela escaneos y recibe su progreso
+ *
+ * Salvo /healthz y /readyz, para las sondas de Docker y Kubernetes: no dicen nada de la red,
+ * y POST /api/register, con el que un NAS se da de alta: lo autentica su firma (register.js)
+ *
+ * Contra DNS rebinding y CSRF: solo se atienden los Host de confianza (IPs, localhost y
+ * `allowedHosts`), /api rechaza otro Origin y, si el navegador pone las credenciales
+ * solo (cookie o Basic), exige el token anti-CSRF que lleva la página servida
+ *
+ * Como complemento de Home Assistant (`ingress`) solo se atiende al proxy de ingress del
+ * Supervisor, que ya ha autenticado al usuario: la página va dentro de un iframe de Home
+ * Assistant bajo el prefijo de X-Ingress-Path, por eso usa rutas relativas
+ */
+const crypto = require('crypto');
+const fs = require('fs');
+const http = require('http');
+const https = require('https');
+const net = require('net');
+const path = require('path');
+const log = require('./log');
+const { serviceDiscovery } = require('./metrics');
+const { buildOpenApi } = require('./openapi');
+const { acceptWebSocket } = require('./websocket');
+
+const WEB_DIR = path.join(__dirname, 'web');
+const DEFAULT_PORT = 8088;
+const COOKIE = 'finder_session';
+const SESSION_TTL = 12 * 60 * 60 * 1000; // 12 horas
+const REALM = 'HomePiNAS Finder';
+// Límites por cliente (IP): cada escaneo son cientos de conexiones a la red
+const LIMITS = {
+  scans: { max: 5, windowMs: 10 * 60 * 1000 }, // escaneos pedidos
+  diagnoses: { max: 20, windowMs: 10 * 60 * 1000 }, // diagnósticos y sondeos ampliados de un host (/api/diagnose, details)
+  failedAuth: { max: 10, windowMs: 15 * 60 * 1000 }, // intentos con token o contraseña erróneos
+  registrations: { max: 30, windowMs: 10 * 60 * 1000 }, // altas de NAS (POST /api/register)
+  actions: { max: 30, windowMs: 10 * 60 * 1000 }, // acciones sobre un NAS (Wake-on-LAN)
+  requests: { max: 300, windowMs: 60 * 1000 } // cualquier petición
+};
+const MAX_CONNECTIONS = 64;
+// Cuerpo de POST /api/register (un JSON firmado pequeño)
+const MAX_BODY = 4096;
+// Escaneos en segundo plano (POST /api/scans) que se recuerdan, y durante cuánto tiempo
+const MAX_JOBS = 20;
+const JOB_TTL = 60 * 60 * 1000; // 1 hora
+const JOB_PATH = /^\/api\/scans\/([0-9a-f-]{36})(\/results)?$/;
+// Escaneo del historial en /api/scans/diff: su id, "latest" o "previous"
+const SCAN_REF = /^(\d+|latest|previous)$/;
+// Entradas de audit.log que devuelve como mucho GET /api/audit
+const MAX_AUDIT = 1000;
+// Acciones sobre un NAS del inventario, por su id
+const WAKE_PATH = /^\/api\/devices\/([\w-]+)\/wake$/;
+const DEVICE_PATH = /^\/api\/devices\/([\w-]+)$/;
+const DETAILS_PATH = /^\/api\/devices\/([\d.]+|[0-9a-fA-F:]+)\/details$/;
+
+// Únicos ficheros que se sirven: nada de rutas arbitrarias del disco. Se leen al arrancar
+// (`page`: lleva el token anti-CSRF de quien la pide)
+const STATIC_FILES = {
+  '/': { file: 'index.html', type: 'text/html; charset=utf-8', page: true },
+  '/app.js': { file: 'app.js', type: 'text/javascript; charset=utf-8' }
+};
+const CSRF_HEADER = 'x-csrf-token';
+const CSRF_META = '<meta name="csrf-token" content="">';
+
+const CSP = "default-src 'none'; script-src 'self'; style-src 'self' 'unsafe-inline'; " +
+  "img-src 'self' data:; connect-src 'self'; base-uri 'none'; form-action 'none'; frame-ancestors";
+const SECURITY_HEADERS = {
+  'Content-Security-Policy': `${CSP} 'none'`,
+  'X-Content-Type-Options': 'nosniff',
+  'Referrer-Policy': 'no-referrer',
+  'Cache-Control': 'no-store'
+};
+// Por ingress la página va en un iframe del propio Home Assistant (mismo origen que el proxy)
+const INGRESS_HEADERS = { ...SECURITY_HEADERS, 'Content-Security-Policy': `${CSP} 'self'` };
+// Proxy de ingress del Supervisor en la red interna de Home Assistant (hassio)
+const INGRESS_PROXY = '172.30.32.2';
+
+/**
+ * Comparación en tiempo constante (también con longitudes distintas)
+ */
+function safeEqual(a, b) {
+  const hash = (value) => crypto.createHash('sha256').update(String(value)).digest();
+  return crypto.timingSafeEqual(hash(a), hash(b));
+}
+
+function parseCookies(header = '') {
+  return Object.fromEntries(header.split(';')
+    .map((pair) => pair.trim().split(/=(.*)/s))
+    .filter(([name, value]) => name && value !== undefined));
+}
+
+/**
+ * Autenticación del servidor web: `token` siempre; `password` (con `user`) activa Basic
+ * Las sesiones viven en memoria: reiniciar el servidor obliga a volver a entrar
+ */
+function createWebAuth({ token, user = 'admin', password = null }) {
+  if (!token) throw new Error('El servidor web necesita un token');
+  const sessions = new Map(); // id -> { expires (ms), csrf }
+  // El navegador reenvía solo la contraseña de Basic o la cookie de ingress de Home Assistant:
+  // su token anti-CSRF dura lo que el proceso
+  const processCsrf = crypto.randomBytes(24).toString('hex');
+
+  return {
+    basic: Boolean(password),
+
+    /**
+     * Método con el que se autentica la petición (token, basic, session) o null
+     */
+    check(req) {
+      const header = req.headers.authorization || '';
+      if (header.startsWith('Bearer ')) {
+        return safeEqual(header.slice('Bearer '.length).trim(), token) ? 'token' : null;
+      }
+      if (header.startsWith('Basic ') && password) {
+        const [name, ...rest] = Buffer.from(header.slice('Basic '.length), 'base64').toString('utf8').split(':');
+        // Las dos comparaciones siempre: no se revela si falló el usuario o la contraseña
+        const matches = [safeEqual(name, user), safeEqual(rest.join(':'), password)];
+        return matches.every(Boolean) ? 'basic' : null;
+      }
+
+      const id = parseCookies(req.headers.cookie)[COOKIE];
+      const session = id && sessions.get(id);
+      if (session && session.expires > Date.now()) return 'session';
+      if (session) sessions.delete(id);
+      return null;
+    },
+
+    /**
+     * Token anti-CSRF para una petición autenticada con `method`: el de su sesión o,
+     * con Basic o ingress, el del proceso. null con el token (Bearer), que el navegador no pone solo
+     */
+    csrfToken(req, method) {
+      if (method === 'basic' || method === 'ingress') return processCsrf;
+      if (method !== 'session') return null;
+      return sessions.get(parseCookies(req.headers.cookie)[COOKIE])?.csrf || null;
+    },
+
+    /**
+     * Cambia el token por una sesión nueva; null si no es el token
+     */
+    login(candidate) {
+      if (!candidate || !safeEqual(candidate, token)) return null;
+      const now = Date.now();
+      for (const [id, session] of sessions) {
+        if (session.expires <= now) sessions.delete(id);
+      }
+      const id = crypto.randomBytes(32).toString('hex');
+      sessions.set(id, { expires: now + SESSION_TTL, csrf: crypto.randomBytes(24).toString('hex') });
+      return id;
+    }
+  };
+}
+
+/**
+ * Límite de ventana deslizante por clave: `hit(key)` apunta un uso y devuelve 0 si
+ * cabe o los segundos que faltan para que quepa; `blocked(key)` solo consulta
+ */
+function createRateLimiter({ max, windowMs }) {
+  const hits = new Map(); // clave -> instantes (ms) dentro de la ventana
+
+  const recent = (key, now) => {
+    const times = (hits.get(key) || []).filter((time) => time > now - windowMs);
+    if (times.length === 0) hits.delete(key);
+    else hits.set(key, times);
+    return times;
+  };
+  const wait = (times, now) => Math.ceil((times[0] + windowMs - now) / 1000);
+
+  return {
+    blocked(key) {
+      const now = Date.now();
+      const times = recent(key, now);
+      return times.length >= max ? wait(times, now) : 0;
+    },
+    hit(key) {
+      const now = Date.now();
+      const times = recent(key, now);
+      if (times.length >= max) return wait(times, now);
+      hits.set(key, [...times, now]);
+      return 0;
+    }
+  };
+}
+
+function sendJson(res, status, body) {
+  res.writeHead(status, { ...SECURITY_HEADERS, 'Content-Type': 'application/json; charset=utf-8' });
+  res.end(JSON.stringify(body));
+}
+
+function sendText(res, status, text, headers = {}) {
+  res.writeHead(status, { ...SECURITY_HEADERS, 'Content-Type': 'text/plain; charset=utf-8', ...headers });
+  res.end(`${text}\n`);
+}
+
+/**
+ * Nombre de la cabecera Host sin puerto ni corchetes, en minúsculas; null si no hay
+ */
+function requestHost(req) {
+  if (!req.headers.host) return null;
+  try {
+    return new URL(`http://${req.headers.host}`).hostname.replace(/^\[|\]$/g, '').replace(/\.$/, '').toLowerCase();
+  } catch {
+    return null;
+  }
+}
+
+/**
+ * DNS rebinding: una página que hace apuntar su dominio a esta máquina llega con ese
+ * dominio en Host. Valen las IPs (un ataque siempre usa un nombre), localhost y los
+ * nombres de `allowedHosts`
+ */
+function hostAllowed(req, allowedHosts) {
+  const host = requestHost(req);
+  if (!host) return false;
+  return net.isIP(host) > 0 || host === 'localhost' || host.endsWith('.localhost') || allowedHosts.has(host);
+}
+
+/**
+ * Una petición a /api debe venir de la propia página: si el navegador manda Origin,
+ * tiene que ser el mismo host al que va dirigida (por ingress, el de Home Assistant,
+ * que el proxy pasa en X-Forwarded-Host)
+ */
+function sameOrigin(req, ingress = false) {
+  const { origin } = req.headers;
+  if (!origin) return true;
+  const host = (ingress && req.headers['x-forwarded-host']) || req.headers.host;
+  try {
+    return new URL(origin).host === host;
+  } catch {
+    return false;
+  }
+}
+
+/**
+ * Prefijo de ingress de la petición (/api/hassio_ingress/<token>) o '' fuera de ingress
+ * Solo las rutas que el navegador sigue (Location) lo necesitan: la página usa rutas relativas
+ */
+function ingressPath(req) {
+  const prefix = String(req.headers['x-ingress-path'] || '');
+  return /^\/api\/hassio_ingress\/[\w-]+$/.test(prefix) ? prefix : '';
+}
+
+/**
+ * Escaneos en segundo plano para clientes que no pueden esperar la respuesta (una /16
+ * tarda más de lo que aguanta un navegador o un proxy): POST /api/scans devuelve un id
+ * y el progreso y el resultado se consultan después. Como con api.scan(), nunca hay dos
+ * a la vez: pedir uno con otro en marcha devuelve ese mismo
+ */
+function createScanJobs(api) {
+  const jobs = new Map(); // id -> { id, state, createdAt, finishedAt, status, devices, error }
+  let current = null;
+
+  const prune = () => {
+    const now = Date.now();
+    for (const [id, job] of jobs) {
+      if (job.state !== 'running' && (jobs.size > MAX_JOBS || now - Date.parse(job.finishedAt) > JOB_TTL)) jobs.delete(id);
+    }
+  };
+
+  return {
+    running: () => current,
+    get: (id) => jobs.get(id) || null,
+
+    start() {
+      if (current) return current;
+      prune();
+      const job = { id: crypto.randomUUID(), state: 'running', createdAt: new Date().toISOString(), finishedAt: null, status: null, devices: null, error: null };
+      jobs.set(job.id, job);
+      current = job;
+      api.scan().then((devices) => {
+        job.status = api.status();
+        job.state = job.status.cancelled ? 'cancelled' : 'done';
+        job.devices = devices;
+      }, (err) => {
+        job.status = api.status();
+        job.state = 'failed';
+        job.error = err.message;
+      }).finally(() => {
+        job.finishedAt = new Date().toISOString();
+        current = null;
+      });
+      return job;
+    },
+
+    /**
+     * Lo que se cuenta de un trabajo: estado y, mientras corre, el progreso del escaneo en curso
+     */
+    view(job) {
+      const { progress = null, found = 0 } = (job.state === 'running' ? api.status() : job.status) || {};
+      const { id, state, createdAt, finishedAt, error } = job;
+      return { id, state, createdAt, finishedAt, progress, found, ...(error ? { error } : {}) };
+    }
+  };
+}
+
+/**
+ * Canal /ws de la página: órdenes { type: 'start-scan' } y { type: 'cancel-scan' }. El servidor
+ * manda el estado al conectar (status) y después scan-started, progress, device-found y
+ * scan-finished de cualquier escaneo, también de los que lanzan otras pestañas o /api/scans
+ * `scanAllowed()` aplica el límite de escaneos: 0 o los segundos que faltan
+ */
+function openScanChannel(ws, { api, jobs, scanAllowed }) {
+  const send = (type, data = {}) => ws.send(JSON.stringify({ type, ...data }));
+  const listeners = {
+    'scan-started': () => send('scan-started'),
+    progress: (progress) => send('progress', { progress, found: api.status().found }),
+    'device-found': (device) => send('device-found', { device }),
+    'scan-finished': (result) => send('scan-finished', result)
+  };
+  for (const [event, listener] of Object.entries(listeners)) api.events.on(event, listener);
+  ws.on('close', () => {
+    for (const [event, listener] of Object.entries(listeners)) api.events.off(event, listener);
+  });
+
+  ws.on('message', (text) => {
+    let message;
+    try {
+      message = JSON.parse(text);
+    } catch {
+      return send('error', { error: 'El mensaje no es JSON' });
+    }
+    if (message?.type === 'start-scan') {
+      // Unirse al escaneo en curso no cuenta para el límite (como en /api/scans)
+      const retryAfter = jobs.running() || api.status().running ? 0 : scanAllowed();
+      if (retryAfter) {
+        send('error', { error: `Como mucho ${LIMITS.scans.max} escaneos cada ${LIMITS.scans.windowMs / 60000} minutos`, retryAfter });
+      } else {
+        jobs.start();
+      }
+    } else if (message?.type === 'cancel-scan') {
+      if (!api.cancel()) send('error', { error: 'No hay ningún escaneo en marcha' });
+    } else {
+      send('error', { error: `Mensaje desconocido: ${message?.type}` });
+    }
+  });
+
+  send('status', api.status());
+}
+
+/**
+ * Cuerpo de la petición como JSON; rechaza con `status` 413 si pasa de `limit` bytes y 400 si no es JSON
+ */
+function readJson(req, limit = MAX_BODY) {
+  return new Promise((resolve, reject) => {
+    const chunks = [];
+    let size = 0;
+    req.on('data', (chunk) => {
+      size += chunk.length;
+      // El resto se descarta sin guardarlo: cortar la conexión se llevaría también la respuesta
+      if (size > limit) {
+        reject(Object.assign(new Error(`Cuerpo demasiado grande (máx. ${limit} bytes)`), { status: 413 }));
+        return;
+      }
+      chunks.push(chunk);
+    });
+    req.on('end', () => {
+      try {
+        resolve(JSON.parse(Buffer.concat(chunks).toString('utf8')));
+      } catch {
+        reject(Object.assign(new Error('El cuerpo no es JSON'), { status: 400 }));
+      }
+    });
+    req.on('error', reject);
+  });
+}
+
+/**
+ * Lee y comprueba una vez los ficheros de STATIC_FILES: si falta alguno, o la página no tiene
+ * dónde llevar el token anti-CSRF, el servidor no arranca. Quedan en memoria con el hash
+ * de su contenido para el ETag
+ */
+function loadAssets(dir) {
+  return Object.fromEntries(Object.entries(STATIC_FILES).map(([route, asset]) => {
+    let body;
+    try {
+      body = fs.readFileSync(path.join(dir, asset.file));
+    } catch (err) {
+      throw new Error(`Falta ${asset.file} de la interfaz web: ${err.message}`);
+    }
+    if (asset.page && !body.includes(CSRF_META)) throw new Error(`${asset.file} no tiene la etiqueta ${CSRF_META}`);
+    const hash = crypto.createHash('sha256').update(body).digest('base64url').slice(0, 22);
+    return [route, { ...asset, body: asset.page ? body.toString('utf8') : body, hash }];
+  }));
+}
+
+/**
+ * index.html con el token anti-CSRF de quien la pide (app.js lo manda en cada llamada a /api)
+ */
+function renderPage(html, csrf) {
+  return html.replace(CSRF_META, `<meta name="csrf-token" content="${csrf || ''}">`);
+}
+
+/**
+ * ETag de un fichero servido: el de la página depende también del token que lleva, para
+ * que otra sesión nunca reciba un 304 con la copia de la anterior
+ */
+function assetTag(asset, csrf) {
+  if (!asset.page) return `"${asset.hash}"`;
+  const token = crypto.createHash('sha256').update(csrf || '').digest('base64url').slice(0, 22);
+  return `"${asset.hash}-${token}"`;
+}
+
+function notModified(req, etag) {
+  const header = req.headers['if-none-match'];
+  return Boolean(header) && (header.trim() === '*' || header.split(',').some((tag) => tag.trim().replace(/^W\//, '') === etag));
+}
+
+/**
+ * Servidor web; `api` = { devices({ tag }), status(), stats(), scan(), diagnose(host), ready(), trace({ ip }), runtime,
+ * register(registration, ip), wake(id), update(id, changes), events, cancel(), audit(filter), history(), diff(from, to) }
+ * (scan también sirve los escaneos en segundo plano de /api/scans, ver createScanJobs)
+ * (stats, la telemetría de los últimos escaneos; scan y diagnose devuelven promesas con los dispositivos y el
+ * diagnóstico de diagnose.js; ready, opcional, decide /readyz; trace y runtime, solo con serve --debug: la traza
+ * del último escaneo o null y el monitor de runtime.js; register, opcional, da de alta un NAS y devuelve
+ * su ficha o lanza un error con `status`; wake, opcional, manda el Wake-on-LAN a un NAS del inventario y
+ * devuelve las direcciones de difusión o lanza un error con `status`; update, opcional, cambia los campos
+ * del usuario de una ficha (los de inventory.update) y la devuelve o lanza un error con `status`; details,
+ * opcional, el sondeo ampliado (probeDetails) de un NAS del inventario por su IP o un error con `status`; events, opcional, un EventEmitter con
+ * scan-started, progress, device-found y scan-finished de cada escaneo, y cancel(), que corta el que esté en
+ * marcha y devuelve false si no hay ninguno, activan /ws; audit, opcional, las entradas de audit.log con
+ * los filtros de readAudit; history y diff, opcionales, el resumen de los escaneos guardados y diffScans
+ * entre dos de ellos, o un error con `status` 404 si falta alguno). Con `tls` ({ cert, key }) sirve HTTPS
+ * `allowedHosts`: nombres además de las IPs y localhost con los que se puede llegar al servidor
+ * `ingress` ({ proxy }, la IP del proxy; por defecto la del Supervisor): modo complemento de Home Assistant
+ * `webDir`: de dónde se leen la página y app.js
+ * Resuelve cuando está escuchando; rechaza si falta algún fichero de la página
+ */
+function startWebServer({ host, port = DEFAULT_PORT, auth, api, tls = null, allowedHosts = [], ingress = null, webDir = WEB_DIR }) {
+  let assets;
+  try {
+    assets = loadAssets(webDir);
+  } catch (err) {
+    return Promise.reject(err);
+  }
+  const ingressProxy = ingress && (ingress.proxy || INGRESS_PROXY);
+  const trustedHosts = new Set(allowedHosts.map((name) => String(name).replace(/\.$/, '').toLowerCase()));
+  // Con HTTPS la cookie no viaja nunca en claro
+  const cookieFlags = `Path=/; HttpOnly; SameSite=Strict; Max-Age=${SESSION_TTL / 1000}${tls ? '; Secure' : ''}`;
+  const limiters = Object.fromEntries(Object.entries(LIMITS).map(([name, limit]) => [name, createRateLimiter(limit)]));
+  const jobs = createScanJobs(api);
+  const channels = new Set(); // conexiones de /ws abiertas
+  const tooMany = (res, retryAfter, error) => {
+    res.writeHead(429, { ...SECURITY_HEADERS, 'Content-Type': 'application/json; charset=utf-8', 'Retry-After': retryAfter });
+    res.end(JSON.stringify({ error, retryAfter }));
+  };
+
+  const handle = async (req, res) => {
+    const url = new URL(req.url, 'http://localhost');
+    const client = req.socket.remoteAddress;
+
+    // Sondas de vida y de disponibilidad: sin autenticación ni límites (llegan cada pocos segundos)
+    if (req.method === 'GET' && url.pathname === '/healthz') {
+      return sendJson(res, 200, { status: 'ok' });
+    }
+    if (req.method === 'GET' && url.pathname === '/readyz') {
+      const ready = api.ready ? api.ready() : true;
+      return sendJson(res, ready ? 200 : 503, { status: ready ? 'ready' : 'starting' });
+    }
+
+    // Complemento de Home Assistant: solo por ingress. El Supervisor ya ha comprobado la sesión de
+    // Home Assistant; desde la LAN el puerto no debe abrir nada (con host_network también escucha ahí)
+    const viaIngress = Boolean(ingressProxy) && client?.replace(/^::ffff:/, '') === ingressProxy;
+    // Los NAS de la LAN se registran directamente, también en Home Assistant
+    const registration = req.method === 'POST' && url.pathname === '/api/register' && Boolean(api.register);
+    if (ingressProxy && !viaIngress && !registration) {
+      log.debug(`[Web] Petición fuera de ingress: ${client}`, { client });
+      return sendText(res, 403, 'En Home Assistant el Finder se abre desde su panel (ingress)');
+    }
+    const base = viaIngress ? ingressPath(req) : '';
+
+    if (!viaIngress && !hostAllowed(req, trustedHosts)) {
+      log.debug(`[Web] Host no permitido: ${req.headers.host}`, { host: req.headers.host, client });
+      return sendText(res, 421, `Host no permitido: ${requestHost(req) || '(ninguno)'} (añádelo a web.allowedHosts en config.json)`);
+    }
+
+    let retryAfter = limiters.requests.hit(client);
+    if (retryAfter) return tooMany(res, retryAfter, 'Demasiadas peticiones');
+    // Tras varios fallos se deja de comprobar el token o la contraseña de ese cliente
+    retryAfter = limiters.failedAuth.blocked(client);
+    if (retryAfter) return tooMany(res, retryAfter, 'Demasiados intentos fallidos');
+
+    // Alta de un NAS: sin token ni cookie (no es un navegador), la autentica su firma
+    if (registration) {
+      retryAfter = limiters.registrations.hit(client);
+      if (retryAfter) return tooMany(res, retryAfter, `Como mucho ${LIMITS.registrations.max} registros cada ${LIMITS.registrations.windowMs / 60000} minutos`);
+      try {
+        const device = await api.register(await readJson(req), client);
+        return sendJson(res, 200, { id: device.id, keyPin: device.keyPin });
+      } catch (err) {
+        if (!err.status) throw err;
+        if (err.status === 401 || err.status === 403) {
+          log.warn(`[Web] Registro rechazado de ${client}: ${err.message}`, { client });
+        }
+        return sendJson(res, err.status, { error: err.message });
+      }
+    }
+
+    if (req.method === 'GET' && url.pathname === '/login') {
+      const session = auth.login(url.searchParams.get('token'));
+      if (!session) {
+        limiters.failedAuth.hit(client);
+        return sendText(res, 401, 'Token no válido');
+      }
+      res.writeHead(303, {
+        ...SECURITY_HEADERS,
+        'Set-Cookie': `${COOKIE}=${session}; ${cookieFlags}`,
+        Location: `${base}/`
+      });
+      return res.end();
+    }
+
+    const method = viaIngress ? 'ingress' : auth.check(req);
+    if (!method) {
+      // Sin credenciales (primera visita) no cuenta como intento fallido
+      if (req.headers.authorization) limiters.failedAuth.hit(client);
+      return sendText(res, 401, 'Abre el enlace con el token que muestra el Finder al arrancar',
+        auth.basic ? { 'WWW-Authenticate': `Basic realm="${REALM}", charset="UTF-8"` } : {});
+    }
+    const csrf = auth.csrfToken(req, method);
+
+    const asset = req.method === 'GET' && assets[url.pathname];
+    if (asset) {
+      // Se guardan solo en este navegador y se revalidan siempre (304 si no han cambiado)
+      const etag = assetTag(asset, csrf);
+      const headers = {
+        ...(viaIngress ? INGRESS_HEADERS : SECURITY_HEADERS),
+        'Cache-Control': 'private, no-cache',
+        ETag: etag
+      };
+      if (notModified(req, etag)) {
+        res.writeHead(304, headers);
+        return res.end();
+      }
+      res.writeHead(200, { ...headers, 'Content-Type': asset.type });
+      return res.end(asset.page ? renderPage(asset.body, csrf) : asset.body);
+    }
+    if (url.pathname.startsWith('/api/')) {
+      if (!sameOrigin(req, viaIngress)) return sendJson(res, 403, { error: 'Origen no permitido' });
+      if (csrf && !safeEqual(req.headers[CSRF_HEADER] || '', csrf)) {
+        return sendJson(res, 403, { error: 'Falta el token de la página: recárgala' });
+      }
+    }
+    if (req.method === 'GET' && url.pathname === '/ws' && api.events) {
+      // Un WebSocket del navegador no lleva cabeceras propias: el token de la página va en ?csrf=
+      if (!sameOrigin(req, viaIngress)) return sendText(res, 403, 'Origen no permitido');
+      if (csrf && !safeEqual(url.searchParams.get('csrf') || '', csrf)) {
+        return sendText(res, 403, 'Falta el token de la página: recárgala');
+      }
+      if (!req.upgrade) return sendText(res, 426, 'Solo WebSocket', { Upgrade: 'websocket', Connection: 'Upgrade' });
+      const { socket, head } = req.upgrade;
+      res.detachSocket(socket);
+      const ws = acceptWebSocket(req, socket, head);
+      if (ws) {
+        channels.add(ws);
+        ws.on('close', () => channels.delete(ws));
+        openScanChannel(ws, { api, jobs, scanAllowed: () => limiters.scans.hit(client) });
+      }
+      return;
+    }
+    if (req.method === 'GET' && url.pathname === '/api/devices') {
+      return sendJson(res, 200, { devices: api.devices({ tag: url.searchParams.get('tag') || undefined }) });
+    }
+    if (req.method === 'GET' && url.pathname === '/api/scan') {
+      return sendJson(res, 200, api.status());
+    }
+    if (req.method === 'GET' && url.pathname === '/api/scan/progress') {
+      // Solo el avance, para una barra de progreso: lo mismo que GET /api/scan sin la telemetría
+      const { running = false, startedAt = null, found = 0, progress = {} } = api.status();
+      const { probed = 0, total = 0, methods = {}, subnets = [] } = progress;
+      return sendJson(res, 200, { running, startedAt, found, probed, total, methods, subnets });
+    }
+    if (req.method === 'GET' && url.pathname === '/api/scan/stats') {
+      return sendJson(res, 200, api.stats());
+    }
+    if (req.method === 'GET' && url.pathname === '/api/openapi.json') {
+      return sendJson(res, 200, buildOpenApi({ debug: Boolean(api.runtime), basePath: base }));
+    }
+    if (req.method === 'GET' && url.pathname === '/api/prometheus/sd') {
+      const port = url.searchParams.has('port') ? Number(url.searchParams.get('port')) : undefined;
+      if (port !== undefined && !(Number.isInteger(port) && port >= 1 && port <= 65535)) {
+        return sendJson(res, 400, { error: `Puerto no válido: ${url.searchParams.get('port')}` });
+      }
+      return sendJson(res, 200, serviceDiscovery(api.devices(), { port }));
+    }
+    if (req.method === 'GET' && url.pathname === '/api/audit' && api.audit) {
+      const filter = {};
+      for (const field of ['device', 'action', 'client', 'result', 'since']) {
+        if (url.searchParams.get(field)) filter[field] = url.searchParams.get(field);
+      }
+      if (filter.since && Number.isNaN(Date.parse(filter.since))) {
+        return sendJson(res, 400, { error: `Fecha no válida: ${filter.since} (ISO 8601)` });
+      }
+      if (url.searchParams.has('limit')) {
+        filter.limit = Number(url.searchParams.get('limit'));
+        if (!(Number.isInteger(filter.limit) && filter.limit >= 1 && filter.limit <= MAX_AUDIT)) {
+          return sendJson(res, 400, { error: `limit debe ir de 1 a ${MAX_AUDIT}` });
+        }
+      }
+      return sendJson(res, 200, { entries: api.audit(filter) });
+    }
+    if (req.method === 'POST' && url.pathname === '/api/scan') {
+      // Si ya hay un escaneo en curso la petición se une a él (ver api.scan): no cuenta
+      retryAfter = api.status().running ? 0 : limiters.scans.hit(client);
+      if (retryAfter) return tooMany(res, retryAfter, `Como mucho ${LIMITS.scans.max} escaneos cada ${LIMITS.scans.windowMs / 60000} minutos`);
+      return sendJson(res, 200, { devices: await api.scan() });
+    }
+    if (req.method === 'POST' && url.pathname === '/api/scans') {
+      // Unirse al escaneo en curso tampoco cuenta para el límite
+      retryAfter = jobs.running() || api.status().running ? 0 : limiters.scans.hit(client);
+      if (retryAfter) return tooMany(res, retryAfter, `Como mucho ${LIMITS.scans.max} escaneos cada ${LIMITS.scans.windowMs / 60000} minutos`);
+      const job = jobs.start();
+      res.writeHead(202, { ...SECURITY_HEADERS, 'Content-Type': 'application/json; charset=utf-8', Location: `${base}/api/scans/${job.id}` });
+      return res.end(JSON.stringify(jobs.view(job)));
+    }
+    if (req.method === 'GET' && url.pathname === '/api/scans/history' && api.history) {
+      return sendJson(res, 200, { scans: api.history() });
+    }
+    if (req.method === 'GET' && url.pathname === '/api/scans/diff' && api.diff) {
+      const from = url.searchParams.get('from') || 'previous';
+      const to = url.searchParams.get('to') || 'latest';
+      const invalid = [from, to].find((ref) => !SCAN_REF.test(ref));
+      if (invalid) return sendJson(res, 400, { error: `Escaneo no válido: ${invalid} (id, latest o previous)` });
+      try {
+        return sendJson(res, 200, api.diff(from, to));
+      } catch (err) {
+        if (!err.status) throw err;
+        return sendJson(res, err.status, { error: err.message });
+      }
+    }
+    const jobMatch = req.method === 'GET' && url.pathname.match(JOB_PATH);
+    if (jobMatch) {
+      const job = jobs.get(jobMatch[1]);
+      if (!job) return sendJson(res, 404, { error: 'No existe ese escaneo (se guardan los últimos durante una hora)' });
+      if (!jobMatch[2]) return sendJson(res, 200, jobs.view(job));
+      if (job.state === 'running') return sendJson(res, 409, { error: 'El escaneo aún no ha terminado', state: job.state });
+      if (job.state === 'failed') return sendJson(res, 409, { error: `El escaneo falló: ${job.error}`, state: job.state });
+      return sendJson(res, 200, { id: job.id, state: job.state, devices: job.devices });
+    }
+    if (req.method === 'POST' && url.pathname === '/api/diagnose') {
+      retryAfter = limiters.diagnoses.hit(client);
+      if (retryAfter) return tooMany(res, retryAfter, `Como mucho ${LIMITS.diagnoses.max} diagnósticos cada ${LIMITS.diagnoses.windowMs / 60000} minutos`);
+      try {
+        return sendJson(res, 200, await api.diagnose(url.searchParams.get('host')));
+      } catch (err) {
+        return sendJson(res, 400, { error: err.message });
+      }
+    }
+    const detailsMatch = req.method === 'GET' && api.details && url.pathname.match(DETAILS_PATH);
+    if (detailsMatch) {
+      retryAfter = limiters.diagnoses.hit(client);
+      if (retryAfter) return tooMany(res, retryAfter, `Como mucho ${LIMITS.diagnoses.max} diagnósticos cada ${LIMITS.diagnoses.windowMs / 60000} minutos`);
+      try {
+        return sendJson(res, 200, await api.details(detailsMatch[1]));
+      } catch (err) {
+        if (!err.status) throw err;
+        return sendJson(res, err.status, { error: err.message });
+      }
+    }
+    const deviceMatch = req.method === 'PATCH' && api.update && url.pathname.match(DEVICE_PATH);
+    if (deviceMatch) {
+      try {
+        const changes = await readJson(req);
+        if (!changes || typeof changes !== 'object' || Array.isArray(changes)) {
+          return sendJson(res, 400, { error: 'El cuerpo debe ser un objeto con los campos a cambiar' });
+        }
+        return sendJson(res, 200, await api.update(deviceMatch[1], changes));
+      } catch (err) {
+        if (!err.status) throw err;
+        return sendJson(res, err.status, { error: err.message });
+      }
+    }
+    const wakeMatch = req.method === 'POST' && api.wake && url.pathname.match(WAKE_PATH);
+    if (wakeMatch) {
+      retryAfter = limiters.actions.hit(client);
+      if (retryAfter) return tooMany(res, retryAfter, `Como mucho ${LIMITS.actions.max} acciones cada ${LIMITS.actions.windowMs / 60000} minutos`);
+      try {
+        return sendJson(res, 200, { sent: await api.wake(wakeMatch[1]) });
+      } catch (err) {
+        if (!err.status) throw err;
+        return sendJson(res, err.status, { error: err.message });
+      }
+    }
+    if (req.method === 'GET' && url.pathname === '/api/debug/trace' && api.trace) {
+      const trace = api.trace({ ip: url.searchParams.get('ip') || null });
+      if (!trace) return sendJson(res, 404, { error: 'Aún no hay ningún escaneo con traza: lanza uno (POST /api/scan)' });
+      return sendJson(res, 200, trace);
+    }
+    if (req.method === 'GET' && url.pathname === '/api/debug/runtime' && api.runtime) {
+      const connections = await new Promise((resolve) => server.getConnections((err, count) => resolve(err ? null : count)));
+      return sendJson(res, 200, { ...api.runtime.snapshot(), connections });
+    }
+    if (req.method === 'GET' && url.pathname === '/api/debug/cpu-profile' && api.runtime) {
+      let profile;
+      try {
+        profile = await api.runtime.cpuProfile(url.searchParams.get('seconds'));
+      } catch (err) {
+        if (err.status) return sendJson(res, err.status, { error: err.message });
+        throw err;
+      }
+      res.writeHead(200, {
+        ...SECURITY_HEADERS,
+        'Content-Type': 'application/json; charset=utf-8',
+        'Content-Disposition': `attachment; filename="finder-${Date.now()}.cpuprofile"`
+      });
+      return res.end(JSON.stringify(profile));
+    }
+    if (req.method === 'GET' && url.pathname === '/api/debug/heap-snapshot' && api.runtime) {
+      res.writeHead(200, {
+        ...SECURITY_HEADERS,
+        'Content-Type': 'application/json; charset=utf-8',
+        'Content-Disposition': `attachment; filename="finder-${Date.now()}.heapsnapshot"`
+      });
+      return api.runtime.heapSnapshot().pipe(res);
+    }
+    sendJson(res, 404, { error: 'No encontrado' });
+  };
+
+  const listener = (req, res) => {
+    handle(req, res).catch((err) => {
+      log.error(`[Web] ${req.method} ${req.url}: ${err.message}`);
+      if (!res.headersSent) sendJson(res, 500, { error: err.message });
+      else res.end();
+    });
+  };
+  const server = tls
+    ? https.createServer({ cert: tls.cert, key: tls.key, minVersion: 'TLSv1.2' }, listener)
+    : http.createServer(listener);
+  // Una pestaña desbocada no debe agotar los descriptores de ficheros
+  server.maxConnections = MAX_CONNECTIONS;
+
+  // La petición Upgrade de /ws pasa por handle() como las demás, con una respuesta sobre su
+  // socket: las mismas comprobaciones de ingress, Host, límites, credenciales y origen
+  server.on('upgrade', (req, socket, head) => {
+    const res = new http.ServerResponse(req);
+    res.shouldKeepAlive = false;
+    res.assignSocket(socket);
+    res.on('finish', () => socket.end());
+    req.upgrade = { socket, head };
+    listener(req, res);
+  });
+  // Tras el upgrade http ya no cuenta esas conexiones: al cerrar también se cierran los WebSocket
+  const closeAllConnections = server.closeAllConnections.bind(server);
+  server.closeAllConnections = () => {
+    for (const ws of channels) ws.close(1001, 'El Finder se detiene');
+    closeAllConnections();
+  };
+
+  return new Promise((resolve, reject) => {
+    server.once('error', reject);
+    server.listen(port, host, () => resolve(server));
+  });
+}
+
+module.exports = { createWebAuth, startWebServer, DEFAULT_PORT };
@@ -0,0 +1,206 @@
+// Interfaz web del modo serve: los NAS del inventario y un botón para reescanear (por /ws)
+const scanBtn = document.getElementById('scanBtn');
+const statusBar = document.getElementById('statusBar');
+const deviceList = document.getElementById('deviceList');
+const diagnoseForm = document.getElementById('diagnoseForm');
+const diagnoseHost = document.getElementById('diagnoseHost');
+const diagnoseBtn = document.getElementById('diagnoseBtn');
+const diagnoseSteps = document.getElementById('diagnoseSteps');
+const diagnoseVerdict = document.getElementById('diagnoseVerdict');
+
+const STEP_MARKS = { ok: '✓', warn: '!', fail: '✗', skip: '–' };
+// Token anti-CSRF que el servidor pone en la página: sin él /api no responde
+const csrfToken = document.querySelector('meta[name="csrf-token"]').content;
+
+// `path` relativo a la página: en Home Assistant se sirve bajo el prefijo de ingress
+async function api(path, options = {}) {
+  const res = await fetch(path, {
+    credentials: 'same-origin',
+    ...options,
+    headers: { 'X-CSRF-Token': csrfToken, ...options.headers }
+  });
+  const data = await res.json().catch(() => ({}));
+  if (!res.ok) throw new Error(data.error || `HTTP ${res.status}`);
+  return data;
+}
+
+/**
+ * Ficha de un NAS: enlace a su panel (se abre en otra pestaña)
+ */
+function renderDevice(device) {
+  const card = document.createElement('a');
+  card.className = `device-card ${device.online ? '' : 'offline'}`;
+  card.dataset.ip = device.ip;
+  card.href = device.url || `https://${device.ip}`;
+  card.target = '_blank';
+  card.rel = 'noopener noreferrer';
+
+  const name = document.createElement('div');
+  name.className = 'device-name';
+  name.textContent = `${device.favorite ? '★ ' : ''}${device.alias || device.name}`;
+
+  const meta = document.createElement('div');
+  meta.className = 'device-meta';
+  const state = document.createElement('span');
+  state.className = device.online ? 'device-online' : '';
+  state.textContent = device.online ? 'En línea' : `Visto ${new Date(device.lastSeen).toLocaleString()}`;
+  meta.append(state, ` · ${device.ip}${device.version ? ` · v${device.version}` : ''}`);
+
+  card.append(name, meta);
+  // Apagado o dormido: Wake-on-LAN si se conoce su MAC
+  if (!device.online && device.mac) {
+    const wakeBtn = document.createElement('button');
+    wakeBtn.className = 'device-action';
+    wakeBtn.textContent = 'Despertar';
+    wakeBtn.addEventListener('click', (event) => {
+      event.preventDefault();
+      wake(device, wakeBtn);
+    });
+    card.append(wakeBtn);
+  }
+  return card;
+}
+
+async function wake(device, button) {
+  button.disabled = true;
+  try {
+    await api(`api/devices/${encodeURIComponent(device.id)}/wake`, { method: 'POST' });
+    statusBar.textContent = `Paquete Wake-on-LAN enviado a ${device.alias || device.name}; tardará un poco en aparecer en línea`;
+  } catch (err) {
+    statusBar.textContent = `No se pudo despertar: ${err.message}`;
+  } finally {
+    button.disabled = false;
+  }
+}
+
+function renderDevices(devices) {
+  deviceList.replaceChildren(...devices.map(renderDevice));
+  const online = devices.filter((device) => device.online).length;
+  statusBar.textContent = devices.length === 0
+    ? 'Todavía no se ha encontrado ningún NAS'
+    : `${devices.length} NAS conocidos, ${online} en línea`;
+}
+
+async function loadDevices() {
+  try {
+    renderDevices((await api('api/devices')).devices);
+  } catch (err) {
+    statusBar.textContent = `No se pudo cargar la lista: ${err.message}`;
+  }
+}
+
+const RECONNECT_DELAY = 3000;
+let socket = null;
+let scanning = false;
+
+function setScanning(value) {
+  scanning = value;
+  scanBtn.textContent = scanning ? 'Cancelar el escaneo' : 'Escanear la red';
+  scanBtn.disabled = false;
+}
+
+/**
+ * Mensajes de /ws: el escaneo, su progreso y los NAS que va encontrando llegan en cuanto
+ * pasan, también los de un escaneo lanzado desde otra pestaña
+ */
+const SOCKET_MESSAGES = {
+  status: (message) => {
+    setScanning(message.running);
+    if (message.running) statusBar.textContent = 'Escaneando la red…';
+  },
+  'scan-started': () => {
+    setScanning(true);
+    statusBar.textContent = 'Escaneando la red…';
+  },
+  progress: ({ progress, found }) => {
+    if (progress?.total) {
+      statusBar.textContent = `Escaneando la red… ${progress.probed}/${progress.total} hosts, ${found} NAS`;
+    }
+  },
+  'device-found': ({ device }) => {
+    if (!deviceList.querySelector(`[data-ip="${CSS.escape(device.ip)}"]`)) {
+      deviceList.append(renderDevice({ ...device, online: true }));
+    }
+  },
+  'scan-finished': async ({ state, error }) => {
+    setScanning(false);
+    await loadDevices();
+    if (state === 'failed') statusBar.textContent = `Error en el escaneo: ${error}`;
+    else if (state === 'cancelled') statusBar.textContent = `Escaneo cancelado. ${statusBar.textContent}`;
+  },
+  error: ({ error }) => {
+    statusBar.textContent = error;
+    scanBtn.disabled = false;
+  }
+};
+
+function connect() {
+  // Relativa a la página, como las llamadas a /api (prefijo de ingress en Home Assistant)
+  const url = new URL('ws', location.href);
+  url.protocol = url.protocol === 'https:' ? 'wss:' : 'ws:';
+  url.searchParams.set('csrf', csrfToken);
+
+  socket = new WebSocket(url);
+  socket.addEventListener('message', (event) => {
+    const message = JSON.parse(event.data);
+    SOCKET_MESSAGES[message.type]?.(message);
+  });
+  socket.addEventListener('close', () => {
+    socket = null;
+    setTimeout(connect, RECONNECT_DELAY);
+  });
+}
+
+/**
+ * El mismo botón lanza el escaneo y, mientras corre, lo cancela
+ */
+function toggleScan() {
+  if (socket?.readyState !== WebSocket.OPEN) {
+    statusBar.textContent = 'Sin conexión con el Finder; reintentando…';
+    return;
+  }
+  scanBtn.disabled = true;
+  socket.send(JSON.stringify({ type: scanning ? 'cancel-scan' : 'start-scan' }));
+}
+
+/**
+ * Una etapa del diagnóstico: título, qué se vio y, si hace falta, qué hacer
+ */
+function renderStep(step) {
+  const item = document.createElement('li');
+  item.className = `diagnose-step ${step.status}`;
+  const title = document.createElement('div');
+  title.textContent = `${STEP_MARKS[step.status]} ${step.title}`;
+  const detail = document.createElement('div');
+  detail.className = 'diagnose-detail';
+  detail.textContent = step.detail;
+  item.append(title, detail);
+  if (step.hint) {
+    const hint = document.createElement('div');
+    hint.className = 'diagnose-hint';
+    hint.textContent = `→ ${step.hint}`;
+    item.append(hint);
+  }
+  return item;
+}
+
+async function diagnose(event) {
+  event.preventDefault();
+  diagnoseBtn.disabled = true;
+  diagnoseSteps.replaceChildren();
+  diagnoseVerdict.textContent = 'Comprobando…';
+  try {
+    const diagnosis = await api(`api/diagnose?host=${encodeURIComponent(diagnoseHost.value.trim())}`, { method: 'POST' });
+    diagnoseSteps.replaceChildren(...diagnosis.steps.map(renderStep));
+    diagnoseVerdict.textContent = diagnosis.verdict;
+  } catch (err) {
+    diagnoseVerdict.textContent = `No se pudo comprobar: ${err.message}`;
+  } finally {
+    diagnoseBtn.disabled = false;
+  }
+}
+
+scanBtn.addEventListener('click', toggleScan);
+diagnoseForm.addEventListener('submit', diagnose);
+loadDevices();
+connect();
@@ -0,0 +1,150 @@
+/**
+ * Servidor WebSocket mínimo (RFC 6455) para /ws de serve: mensajes de texto cortos en JSON,
+ * sin extensiones ni mensajes fragmentados (los navegadores no fragmentan mensajes tan pequeños)
+ * La autenticación la hace web.js antes de llamar a acceptWebSocket
+ */
+const crypto = require('crypto');
+const { EventEmitter } = require('events');
+
+const GUID = '258EAFA5-E914-47DA-95CA-C5AB0DC85B11';
+// Mensajes del cliente: órdenes de pocos bytes
+const MAX_MESSAGE = 4096;
+// Ping cada 30 s: mantiene abiertos los proxies (ingress) y detecta clientes caídos
+const HEARTBEAT = 30 * 1000;
+const OPCODE = { text: 0x1, close: 0x8, ping: 0x9, pong: 0xa };
+
+function protocolError(code, message) {
+  return Object.assign(new Error(message), { code });
+}
+
+/**
+ * Trama del servidor (sin máscara, en una sola pieza)
+ */
+function encodeFrame(opcode, payload = Buffer.alloc(0)) {
+  let header;
+  if (payload.length < 126) {
+    header = Buffer.from([0x80 | opcode, payload.length]);
+  } else if (payload.length < 65536) {
+    header = Buffer.from([0x80 | opcode, 126, 0, 0]);
+    header.writeUInt16BE(payload.length, 2);
+  } else {
+    header = Buffer.alloc(10);
+    header[0] = 0x80 | opcode;
+    header[1] = 127;
+    header.writeBigUInt64BE(BigInt(payload.length), 2);
+  }
+  return Buffer.concat([header, payload]);
+}
+
+/**
+ * Primera trama completa de `buffer`: { opcode, payload, size } o null si aún no ha llegado
+ * entera. Lanza un error con el `code` de cierre si el cliente no enmascara, fragmenta o
+ * pasa de `limit` bytes
+ */
+function decodeFrame(buffer, limit = MAX_MESSAGE) {
+  if (buffer.length < 2) return null;
+  const fin = (buffer[0] & 0x80) !== 0;
+  const opcode = buffer[0] & 0x0f;
+  if (buffer[0] & 0x70) throw protocolError(1002, 'Bits reservados activos');
+  if (!fin || opcode === 0) throw protocolError(1003, 'Mensajes fragmentados no admitidos');
+  if ((buffer[1] & 0x80) === 0) throw protocolError(1002, 'Trama del cliente sin máscara');
+
+  let length = buffer[1] & 0x7f;
+  let offset = 2;
+  if (length === 126) {
+    if (buffer.length < 4) return null;
+    length = buffer.readUInt16BE(2);
+    offset = 4;
+  } else if (length === 127) {
+    if (buffer.length < 10) return null;
+    const big = buffer.readBigUInt64BE(2);
+    length = big > BigInt(limit) ? limit + 1 : Number(big);
+    offset = 10;
+  }
+  if (length > limit) throw protocolError(1009, `Mensaje demasiado grande (máx. ${limit} bytes)`);
+  if (buffer.length < offset + 4 + length) return null;
+
+  const mask = buffer.subarray(offset, offset + 4);
+  const payload = Buffer.from(buffer.subarray(offset + 4, offset + 4 + length));
+  for (let i = 0; i < payload.length; i++) payload[i] ^= mask[i % 4];
+  return { opcode, payload, size: offset + 4 + length };
+}
+
+/**
+ * Completa el handshake de una petición Upgrade ya autenticada y devuelve la conexión:
+ * un EventEmitter con 'message' (texto) y 'close', y send(text), close(code, reason), terminate()
+ * null (tras responder 400) si no es un handshake WebSocket válido
+ */
+function acceptWebSocket(req, socket, head = Buffer.alloc(0)) {
+  const key = String(req.headers['sec-websocket-key'] || '');
+  const valid = String(req.headers.upgrade || '').toLowerCase() === 'websocket' &&
+    req.headers['sec-websocket-version'] === '13' &&
+    Buffer.from(key, 'base64').length === 16;
+  if (!valid) {
+    socket.end('HTTP/1.1 400 Bad Request\r\nConnection: close\r\nSec-WebSocket-Version: 13\r\n\r\n');
+    return null;
+  }
+
+  const accept = crypto.createHash('sha1').update(key + GUID).digest('base64');
+  socket.write('HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n' +
+    `Sec-WebSocket-Accept: ${accept}\r\n\r\n`);
+  socket.setNoDelay(true);
+
+  const connection = new EventEmitter();
+  let buffer = Buffer.from(head);
+  let open = true;
+  let alive = true;
+
+  const finish = () => {
+    if (!open) return;
+    open = false;
+    clearInterval(heartbeat);
+    connection.emit('close');
+  };
+  const heartbeat = setInterval(() => {
+    if (!alive) return connection.terminate();
+    alive = false;
+    socket.write(encodeFrame(OPCODE.ping));
+  }, HEARTBEAT);
+  heartbeat.unref();
+
+  connection.send = (text) => {
+    if (open) socket.write(encodeFrame(OPCODE.text, Buffer.from(text, 'utf8')));
+  };
+  connection.close = (code = 1000, reason = '') => {
+    if (!open) return;
+    const payload = Buffer.concat([Buffer.from([code >> 8, code & 0xff]), Buffer.from(reason, 'utf8').subarray(0, 120)]);
+    socket.end(encodeFrame(OPCODE.close, payload));
+    finish();
+  };
+  connection.terminate = () => {
+    socket.destroy();
+    finish();
+  };
+
+  const onData = (chunk) => {
+    buffer = Buffer.concat([buffer, chunk]);
+    try {
+      let frame;
+      while (open && (frame = decodeFrame(buffer))) {
+        buffer = buffer.subarray(frame.size);
+        alive = true;
+        if (frame.opcode === OPCODE.text) connection.emit('message', frame.payload.toString('utf8'));
+        else if (frame.opcode === OPCODE.ping) socket.write(encodeFrame(OPCODE.pong, frame.payload));
+        else if (frame.opcode === OPCODE.close) connection.close();
+        else if (frame.opcode !== OPCODE.pong) throw protocolError(1003, 'Solo se admiten mensajes de texto');
+      }
+    } catch (err) {
+      connection.close(err.code || 1002, err.message);
+    }
+  };
+  socket.on('data', onData);
+  socket.on('close', finish);
+  socket.on('error', () => socket.destroy());
+
+  // Lo que llegó junto al handshake, cuando quien llama ya escucha 'message'
+  if (buffer.length > 0) setImmediate(() => onData(Buffer.alloc(0)));
+  return connection;
+}
+
+module.exports = { acceptWebSocket, encodeFrame, decodeFrame, MAX_MESSAGE };
@@ -0,0 +1,82 @@
+const dgram = require('dgram');
+const os = require('os');
+const log = require('./log');
+const { ipv4ToInt, intToIpv4, ipv4InRange } = require('./netutil');
+const { normalizeMac } = require('./neighbors');
+
+const DEFAULT_PORT = 9;
+// El paquete mágico va por UDP sin confirmación: se repite por si se pierde alguno
+const REPEAT = 3;
+
+/**
+ * Paquete mágico: 6 bytes 0xff y la MAC 16 veces
+ */
+function magicPacket(mac) {
+  const normalized = normalizeMac(mac);
+  const bytes = normalized.split(':').map((part) => parseInt(part, 16));
+  if (bytes.length !== 6 || bytes.some((byte) => Number.isNaN(byte))) {
+    throw new Error(`MAC no válida: ${mac}`);
+  }
+  return Buffer.concat([Buffer.alloc(6, 0xff), ...Array(16).fill(Buffer.from(bytes))]);
+}
+
+/**
+ * Direcciones de difusión a las que enviar: la de cada interfaz IPv4 en la que está
+ * `ip` (o todas si no se conoce), la global y `extra` (p. ej. la de otra VLAN)
+ */
+function broadcastAddresses(ip, extra) {
+  const addresses = new Set();
+  for (const entries of Object.values(os.networkInterfaces())) {
+    for (const entry of entries || []) {
+      if (entry.family !== 'IPv4' || entry.internal || !entry.cidr) continue;
+      const prefix = Number(entry.cidr.split('/')[1]);
+      if (ip && !ipv4InRange(ip, entry.address, prefix)) continue;
+      const mask = prefix === 0 ? 0 : (~0 << (32 - prefix)) >>> 0;
+      addresses.add(intToIpv4((ipv4ToInt(entry.address) | ~mask) >>> 0));
+    }
+  }
+  addresses.add('255.255.255.255');
+  if (extra) addresses.add(extra);
+  return [...addresses];
+}
+
+/**
+ * Despierta un equipo con Wake-on-LAN
+ * `ip` (opcional) elige la interfaz; `broadcast` añade otra dirección de difusión
+ * Devuelve las direcciones a las que se envió
+ */
+async function wakeOnLan(mac, { ip = '', port = DEFAULT_PORT, broadcast = '' } = {}) {
+  const packet = magicPacket(mac);
+  const targets = broadcastAddresses(ip.includes(':') ? '' : ip, broadcast);
+  const socket = dgram.createSocket('udp4');
+
+  try {
+    await new Promise((resolve, reject) => {
+      socket.once('error', reject);
+      socket.bind(() => {
+        socket.removeListener('error', reject);
+        socket.setBroadcast(true);
+        resolve();
+      });
+    });
+
+    const send = (address) => new Promise((resolve, reject) => {
+      socket.send(packet, port, address, (err) => (err ? reject(err) : resolve()));
+    });
+    const sent = [];
+    for (const address of targets) {
+      try {
+        for (let i = 0; i < REPEAT; i++) await send(address);
+        sent.push(address);
+      } catch (err) {
+        log.warn(`[WoL] No se pudo enviar a ${address}: ${err.message}`);
+      }
+    }
+    if (sent.length === 0) throw new Error('No se pudo enviar el paquete mágico');
+    return sent;
+  } finally {
+    socket.close();
+  }
+}
+
+module.exports = { wakeOnLan, magicPacket };
@@ -0,0 +1,97 @@
+const crypto = require('crypto');
+const dgram = require('dgram');
+const log = require('./log');
+
+const WSD_PORT = 3702;
+const WSD_GROUP = '239.255.255.250';
+const WSD_TIMEOUT = 2000;
+
+/**
+ * Mensaje Probe de WS-Discovery (SOAP 1.2, espacio de nombres de 2005)
+ */
+function probeMessage(messageId) {
+  return Buffer.from([
+    '<?xml version="1.0" encoding="utf-8"?>',
+    '<soap:Envelope xmlns:soap="http://www.w3.org/2003/05/soap-envelope"',
+    ' xmlns:wsa="http://schemas.xmlsoap.org/ws/2004/08/addressing"',
+    ' xmlns:wsd="http://schemas.xmlsoap.org/ws/2005/04/discovery">',
+    '<soap:Header>',
+    '<wsa:To>urn:schemas-xmlsoap-org:ws:2005:04:discovery</wsa:To>',
+    '<wsa:Action>http://schemas.xmlsoap.org/ws/2005/04/discovery/Probe</wsa:Action>',
+    `<wsa:MessageID>${messageId}</wsa:MessageID>`,
+    '</soap:Header>',
+    '<soap:Body><wsd:Probe/></soap:Body>',
+    '</soap:Envelope>'
+  ].join(''), 'utf8');
+}
+
+/**
+ * Texto del primer elemento con ese nombre local, sea cual sea el prefijo
+ */
+function elementText(xml, name) {
+  const match = xml.match(new RegExp(`<(?:[\\w-]+:)?${name}\\b[^>]*>([^<]*)</(?:[\\w-]+:)?${name}>`));
+  return match ? match[1].trim() : '';
+}
+
+/**
+ * ProbeMatches que responde a nuestro Probe: { xaddrs, types } o null
+ */
+function parseProbeMatch(message, messageId) {
+  const xml = message.toString('utf8');
+  if (!xml.includes('ProbeMatches') || elementText(xml, 'RelatesTo') !== messageId) return null;
+
+  return {
+    xaddrs: elementText(xml, 'XAddrs').split(/\s+/).filter(Boolean),
+    types: elementText(xml, 'Types').split(/\s+/).filter(Boolean)
+  };
+}
+
+/**
+ * Envía un Probe por multicast en cada interfaz y recoge las respuestas
+ * Devuelve Map ip -> { xaddrs, types } (equipos Windows, wsdd de Samba, impresoras...)
+ * Si se aborta `signal` se devuelven las respuestas recibidas hasta ese momento
+ */
+function probeWsDiscovery(localAddresses, { timeout = WSD_TIMEOUT, signal } = {}) {
+  return new Promise((resolve) => {
+    const messageId = `urn:uuid:${crypto.randomUUID()}`;
+    const message = probeMessage(messageId);
+    const responders = new Map();
+    const socket = dgram.createSocket({ type: 'udp4', reuseAddr: true });
+    let timer;
+    let done = false;
+    const finish = () => {
+      if (done) return;
+      done = true;
+      clearTimeout(timer);
+      signal?.removeEventListener('abort', finish);
+      socket.close();
+      resolve(responders);
+    };
+    if (signal?.aborted) return finish();
+    signal?.addEventListener('abort', finish, { once: true });
+
+    socket.on('message', (packet, rinfo) => {
+      const match = parseProbeMatch(packet, messageId);
+      if (match && !responders.has(rinfo.address)) responders.set(rinfo.address, match);
+    });
+    socket.on('error', (err) => {
+      log.warn(`[WS-Discovery] ${err.message}`);
+      finish();
+    });
+
+    socket.bind(0, () => {
+      if (done) return;
+      for (const address of localAddresses) {
+        try {
+          socket.setMulticastInterface(address);
+          socket.send(message, WSD_PORT, WSD_GROUP);
+        } catch {
+          // Interfaz sin multicast
+        }
+      }
+      timer = setTimeout(finish, timeout);
+    });
+  });
+}
+
+module.exports = { probeWsDiscovery };
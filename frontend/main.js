@@ -311,6 +311,30 @@ function clearSession() {
     localStorage.removeItem('csrfToken');
 }
 
+// HomePiNAS Finder opens the dashboard with a one-time login ticket (#sso=...)
+async function consumeSsoTicket() {
+    const match = window.location.hash.match(/^#sso=([a-f0-9]{64})$/);
+    if (!match) return;
+
+    // Drop the ticket from the address bar and history before using it
+    history.replaceState(null, '', window.location.pathname + window.location.search);
+    try {
+        const res = await fetch(`${API_BASE}/pairing/sso`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ ticket: match[1] })
+        });
+        const data = await res.json();
+        if (res.ok && data.success) {
+            saveSession(data.sessionId, data.csrfToken);
+        } else {
+            console.warn('SSO login failed:', data.message);
+        }
+    } catch (e) {
+        console.warn('SSO login failed:', e);
+    }
+}
+
 // DOM Elements
 const views = {
     setup: document.getElementById('setup-view'),
@@ -399,6 +423,8 @@ const resetBtn = document.getElementById('reset-setup-btn');
 // Initialize State from Backend
 async function initAuth() {
     try {
+        // A login ticket from HomePiNAS Finder replaces any stored session
+        await consumeSsoTicket();
         // Try to load existing session
         loadSession();
 
@@ -4366,6 +4392,7 @@ function renderSystemView() {
     dashboardContent.appendChild(mgmtCard);
     dashboardContent.appendChild(infoCard);
     dashboardContent.appendChild(updateCard);
+    dashboardContent.appendChild(renderPairingCard());
 }
 
 async function systemAction(action) {
@@ -4513,6 +4540,152 @@ async function applyUpdate() {
 window.checkForUpdates = checkForUpdates;
 window.applyUpdate = applyUpdate;
 
+// Paired devices (HomePiNAS Finder)
+function renderPairingCard() {
+    const card = document.createElement('div');
+    card.className = 'glass-card';
+    card.style.gridColumn = '1 / -1';
+
+    const title = document.createElement('h3');
+    title.textContent = t('system.pairedDevices', 'Dispositivos Emparejados');
+
+    const desc = document.createElement('p');
+    desc.style.cssText = 'color: var(--text-dim); margin-top: 10px;';
+    desc.textContent = t('system.pairedDevicesDesc', 'Equipos con HomePiNAS Finder que pueden reiniciar, apagar y actualizar este NAS. Aprueba solo los códigos que veas en tu equipo.');
+
+    const list = document.createElement('div');
+    list.id = 'pairing-list';
+    list.style.cssText = 'margin-top: 15px;';
+
+    card.appendChild(title);
+    card.appendChild(desc);
+    card.appendChild(list);
+
+    loadPairing();
+    return card;
+}
+
+async function loadPairing() {
+    const list = document.getElementById('pairing-list');
+    if (!list) return;
+
+    try {
+        const [pendingRes, clientsRes] = await Promise.all([
+            authFetch(`${API_BASE}/pairing/pending`),
+            authFetch(`${API_BASE}/pairing/clients`)
+        ]);
+        if (!pendingRes.ok || !clientsRes.ok) throw new Error('Failed to load paired devices');
+        const { requests } = await pendingRes.json();
+        const { clients } = await clientsRes.json();
+
+        list.innerHTML = '';
+
+        for (const request of requests) {
+            const row = document.createElement('div');
+            row.className = 'stat-row';
+            row.style.cssText = 'gap: 10px; align-items: center;';
+            row.innerHTML = `
+                <span>⏳ <strong>${escapeHtml(request.clientName)}</strong> <span style="color: var(--text-dim);">(${escapeHtml(request.ip)})</span></span>
+            `;
+
+            const actions = document.createElement('span');
+            actions.style.cssText = 'display: flex; gap: 8px;';
+
+            const codeInput = document.createElement('input');
+            codeInput.type = 'text';
+            codeInput.inputMode = 'numeric';
+            codeInput.maxLength = 6;
+            codeInput.placeholder = t('system.pairingCode', 'Código');
+            codeInput.style.cssText = 'width: 90px;';
+
+            const approveBtn = document.createElement('button');
+            approveBtn.className = 'btn-primary btn-sm';
+            approveBtn.textContent = t('system.approve', 'Aprobar');
+            approveBtn.addEventListener('click', () => approvePairing(request.id, codeInput.value));
+
+            const denyBtn = document.createElement('button');
+            denyBtn.className = 'btn-primary btn-sm';
+            denyBtn.style.background = '#ef4444';
+            denyBtn.textContent = t('system.deny', 'Rechazar');
+            denyBtn.addEventListener('click', () => denyPairing(request.id));
+
+            actions.appendChild(codeInput);
+            actions.appendChild(approveBtn);
+            actions.appendChild(denyBtn);
+            row.appendChild(actions);
+            list.appendChild(row);
+        }
+
+        for (const client of clients) {
+            const row = document.createElement('div');
+            row.className = 'stat-row';
+            const lastUsed = client.lastUsed ? new Date(client.lastUsed).toLocaleString() : t('system.never', 'nunca');
+            row.innerHTML = `
+                <span>🔗 <strong>${escapeHtml(client.name)}</strong>
+                    <span style="color: var(--text-dim);">${escapeHtml(client.scopes.join(', '))} · ${t('system.lastUsed', 'último uso')}: ${escapeHtml(lastUsed)}</span>
+                </span>
+            `;
+
+            const revokeBtn = document.createElement('button');
+            revokeBtn.className = 'btn-primary btn-sm';
+            revokeBtn.style.background = '#ef4444';
+            revokeBtn.textContent = t('system.revoke', 'Revocar');
+            revokeBtn.addEventListener('click', () => revokePairedClient(client));
+            row.appendChild(revokeBtn);
+            list.appendChild(row);
+        }
+
+        if (requests.length === 0 && clients.length === 0) {
+            list.innerHTML = `<span style="color: var(--text-dim);">${t('system.noPairedDevices', 'Ningún dispositivo emparejado. Empareja uno desde HomePiNAS Finder.')}</span>`;
+        }
+    } catch (e) {
+        console.error('Pairing load error:', e);
+        list.innerHTML = `<span style="color: #ef4444;">Error: ${escapeHtml(e.message)}</span>`;
+    }
+}
+
+async function approvePairing(id, code) {
+    try {
+        const res = await authFetch(`${API_BASE}/pairing/${encodeURIComponent(id)}/approve`, {
+            method: 'POST',
+            body: JSON.stringify({ code: code.trim() })
+        });
+        const data = await res.json();
+        if (!res.ok) throw new Error(data.error || 'Pairing failed');
+        showNotification(t('system.pairingApproved', 'Dispositivo emparejado'), 'success');
+    } catch (e) {
+        console.error('Pairing approve error:', e);
+        showNotification(e.message, 'error');
+    }
+    loadPairing();
+}
+
+async function denyPairing(id) {
+    try {
+        await authFetch(`${API_BASE}/pairing/${encodeURIComponent(id)}/deny`, { method: 'POST' });
+    } catch (e) {
+        console.error('Pairing deny error:', e);
+    }
+    loadPairing();
+}
+
+async function revokePairedClient(client) {
+    const confirmed = await showConfirmModal('Revocar dispositivo', `¿Revocar el acceso de "${client.name}"? Tendrá que emparejarse de nuevo.`);
+    if (!confirmed) return;
+
+    try {
+        const res = await authFetch(`${API_BASE}/pairing/clients/${encodeURIComponent(client.id)}`, { method: 'DELETE' });
+        if (!res.ok) {
+            const data = await res.json();
+            throw new Error(data.error || 'Revoke failed');
+        }
+    } catch (e) {
+        console.error('Pairing revoke error:', e);
+        showNotification(e.message, 'error');
+    }
+    loadPairing();
+}
+
 // Helper Colors
 function getRoleColor(role) {
     switch (role) {